@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	_ "embed"
 	"encoding/json"
@@ -8,6 +9,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/gomcpgo/mcp/pkg/handler"
@@ -15,7 +17,9 @@ import (
 	"github.com/gomcpgo/mcp/pkg/server"
 	"github.com/prasanthmj/email/pkg/config"
 	emailHandler "github.com/prasanthmj/email/pkg/handler"
+	"github.com/prasanthmj/email/pkg/securefs"
 	"github.com/prasanthmj/email/pkg/storage"
+	"golang.org/x/term"
 )
 
 //go:embed icon.svg
@@ -24,6 +28,7 @@ var iconSVG []byte
 func main() {
 	// Parse command line flags
 	var (
+		configFile      = flag.String("config", "", "Load settings from a YAML or TOML file (environment variables override it)")
 		listFolders     = flag.Bool("folders", false, "List all email folders")
 		fetchHeaders    = flag.String("fetch", "", "Fetch email headers: -fetch 'since:7 days ago'")
 		fetchEmail      = flag.String("email", "", "Fetch full email by Message-ID")
@@ -34,21 +39,62 @@ func main() {
 		debugMode       = flag.Bool("debug", false, "Enable debug mode")
 		toolName        = flag.String("tool", "", "Call a specific tool")
 		toolArgs        = flag.String("args", "{}", "Tool arguments as JSON")
+		queryAudit      = flag.Bool("audit", false, "Query the audit log: -audit -args '{\"recipient\":\"customer@example.com\"}'")
+		encryptStore    = flag.Bool("encrypt-store", false, "Encrypt existing plaintext files under FILES_ROOT and tighten their permissions")
+		vaultAdd        = flag.String("vault-add", "", "Store an account password in the credential vault: -vault-add work (work.pgp for its PGP passphrase)")
+		vaultList       = flag.Bool("vault-list", false, "List the accounts with a password in the credential vault")
+		discover        = flag.String("discover", "", "Look up the IMAP and SMTP servers of an address: -discover me@example.com")
 	)
 	flag.Parse()
 
+	// Vault commands run before loading the configuration, which may need the vault
+	if *vaultAdd != "" || *vaultList {
+		if err := runVaultCommand(*vaultAdd, *vaultList); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Discovery needs no configuration
+	if *discover != "" {
+		found, err := config.NewDiscoverer().Discover(context.Background(), *discover)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		data, _ := json.MarshalIndent(found, "", "  ")
+		fmt.Println(string(data))
+		return
+	}
+
 	// Load configuration
-	cfg, err := config.LoadConfig()
+	cfg, err := loadConfig(*configFile)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	// Store migration runs before any handler touches the files
+	if *encryptStore {
+		if !cfg.EncryptAtRest {
+			fmt.Fprintln(os.Stderr, "Warning: no FILES_ENCRYPTION_KEY configured, only permissions will be tightened")
+		}
+		result, err := securefs.Migrate(cfg.FilesRoot)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		data, _ := json.MarshalIndent(result, "", "  ")
+		fmt.Println(string(data))
+		return
+	}
+
 	// Terminal mode operations
 	if *listFolders || *fetchHeaders != "" || *fetchEmail != "" || *sendTest || 
-	   *fetchAttachment != "" || *cacheInfo || *clearCache || *toolName != "" {
+	   *fetchAttachment != "" || *cacheInfo || *clearCache || *toolName != "" || *queryAudit {
 		err := runTerminalMode(cfg, *listFolders, *fetchHeaders, *fetchEmail, 
 		                      *sendTest, *fetchAttachment, *cacheInfo, *clearCache, 
-		                      *debugMode, *toolName, *toolArgs)
+		                      *debugMode, *toolName, *toolArgs, *queryAudit)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
@@ -63,10 +109,75 @@ func main() {
 	}
 }
 
+// loadConfig loads the configuration from a file if one is given, or from the environment
+func loadConfig(path string) (*config.MultiAccountConfig, error) {
+	if path != "" {
+		return config.LoadConfigFile(path)
+	}
+	return config.LoadConfig()
+}
+
+// readConfig loads the configuration like loadConfig without touching the account folders,
+// which Reload prepares once it accepts the configuration
+func readConfig(path string) (*config.MultiAccountConfig, error) {
+	if path != "" {
+		return config.ReadConfigFile(path)
+	}
+	return config.ReadConfig()
+}
+
+// runVaultCommand adds a password to the credential vault or lists its accounts
+func runVaultCommand(addAccount string, list bool) error {
+	vault, err := config.DefaultVault()
+	if err != nil {
+		return err
+	}
+
+	if list {
+		ids, err := vault.List()
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			fmt.Println(id)
+		}
+		return nil
+	}
+
+	password, err := readPassword(fmt.Sprintf("Password for %s: ", addAccount))
+	if err != nil {
+		return err
+	}
+	if err := vault.Add(addAccount, password); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Stored password for %s in %s\n", addAccount, vault.Path)
+	return nil
+}
+
+// readPassword prompts without echo on a terminal, or reads one line from piped input
+func readPassword(prompt string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		fmt.Fprint(os.Stderr, prompt)
+		password, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", fmt.Errorf("failed to read password: %w", err)
+		}
+		return string(password), nil
+	}
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("failed to read password: %w", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
 // runTerminalMode executes terminal mode for CLI testing
 func runTerminalMode(cfg *config.MultiAccountConfig, listFolders bool, fetchHeaders, fetchEmail string,
 	sendTest bool, fetchAttachment string, cacheInfo, clearCache, debugMode bool,
-	toolName, toolArgs string) error {
+	toolName, toolArgs string, queryAudit bool) error {
 
 	ctx := context.Background()
 
@@ -227,6 +338,11 @@ func runTerminalMode(cfg *config.MultiAccountConfig, listFolders bool, fetchHead
 		return nil
 	}
 
+	// Query the audit log, using -args as filters
+	if queryAudit {
+		toolName = "query_audit_log"
+	}
+
 	// Generic tool invocation
 	if toolName != "" {
 		var args map[string]interface{}
@@ -261,6 +377,14 @@ func runMCPServer(cfg *config.MultiAccountConfig) error {
 		return fmt.Errorf("failed to create handler: %w", err)
 	}
 
+	// Deliver queued and scheduled messages in the background
+	h.StartOutboxWorker(context.Background())
+
+	// Reload the configuration on SIGHUP or when the config file changes
+	h.StartConfigWatcher(context.Background(), func() (*config.MultiAccountConfig, error) {
+		return readConfig(cfg.ConfigFile)
+	})
+
 	// Create handler registry
 	registry := handler.NewHandlerRegistry()
 	registry.RegisterToolHandler(h)
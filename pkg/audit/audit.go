@@ -0,0 +1,323 @@
+package audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prasanthmj/email/pkg/email"
+	"github.com/prasanthmj/email/pkg/securefs"
+)
+
+// Record event types
+const (
+	EventToolCall    = "tool_call"
+	EventMessageSent = "message_sent"
+)
+
+// Record statuses
+const (
+	StatusOK    = "ok"
+	StatusError = "error"
+)
+
+// hashedArgs are arguments whose values are replaced by a hash, so content is never stored
+var hashedArgs = map[string]bool{
+	"body":        true,
+	"html_body":   true,
+	"data":        true,
+	"comment":     true,
+	"description": true,
+}
+
+// redactedArgs are arguments whose values are removed entirely
+var redactedArgs = map[string]bool{
+	"confirm_token": true,
+	"password":      true,
+}
+
+// Record is one line of the audit log
+type Record struct {
+	Time    time.Time              `json:"time"`
+	Account string                 `json:"account"`
+	Event   string                 `json:"event"`
+	Tool    string                 `json:"tool,omitempty"`
+	Args    map[string]interface{} `json:"args,omitempty"`
+	Status  string                 `json:"status,omitempty"`
+	Error   string                 `json:"error,omitempty"`
+	Message *email.SentMessage     `json:"message,omitempty"`
+}
+
+// Query selects audit records; zero fields match everything
+type Query struct {
+	Event     string
+	Tool      string
+	Status    string
+	Recipient string // Case-insensitive substring of any To, CC or BCC address
+	Since     time.Time
+	Until     time.Time
+	Limit     int
+}
+
+// Logger appends records to an account's JSONL audit log, rotating it by size.
+// Rotated files are named audit.jsonl.1 (newest) to audit.jsonl.N (oldest).
+type Logger struct {
+	mu       sync.Mutex
+	account  string
+	path     string
+	maxSize  int64
+	maxFiles int
+}
+
+// New creates a logger for account writing to path
+func New(account, path string, maxSize int64, maxFiles int) *Logger {
+	return &Logger{
+		account:  account,
+		path:     path,
+		maxSize:  maxSize,
+		maxFiles: maxFiles,
+	}
+}
+
+// Append writes a record, filling in the time and account if unset
+func (l *Logger) Append(rec Record) error {
+	if rec.Time.IsZero() {
+		rec.Time = time.Now()
+	}
+	if rec.Account == "" {
+		rec.Account = l.account
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit record: %w", err)
+	}
+	line, err := securefs.SealLine(data)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt audit record: %w", err)
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := securefs.MkdirAll(filepath.Dir(l.path)); err != nil {
+		return fmt.Errorf("failed to create audit directory: %w", err)
+	}
+	if info, err := os.Stat(l.path); err == nil && l.maxSize > 0 && info.Size()+int64(len(line)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, securefs.FileMode)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(line); err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return nil
+}
+
+// rotate shifts the current and rotated files up by one, dropping the oldest
+func (l *Logger) rotate() error {
+	if l.maxFiles <= 0 {
+		if err := os.Remove(l.path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to rotate audit log: %w", err)
+		}
+		return nil
+	}
+	os.Remove(l.rotatedPath(l.maxFiles))
+	for i := l.maxFiles - 1; i >= 1; i-- {
+		if err := os.Rename(l.rotatedPath(i), l.rotatedPath(i+1)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to rotate audit log: %w", err)
+		}
+	}
+	if err := os.Rename(l.path, l.rotatedPath(1)); err != nil {
+		return fmt.Errorf("failed to rotate audit log: %w", err)
+	}
+	return nil
+}
+
+// rotatedPath returns the path of rotated file n
+func (l *Logger) rotatedPath(n int) string {
+	return fmt.Sprintf("%s.%d", l.path, n)
+}
+
+// RecordCall logs a tool invocation with sanitized arguments
+func (l *Logger) RecordCall(tool string, args map[string]interface{}, callErr error) error {
+	rec := Record{
+		Event:  EventToolCall,
+		Tool:   tool,
+		Args:   SanitizeArgs(args),
+		Status: StatusOK,
+	}
+	if callErr != nil {
+		rec.Status = StatusError
+		rec.Error = callErr.Error()
+	}
+	return l.Append(rec)
+}
+
+// RecordSent logs a message accepted by the SMTP server. It implements email.SendRecorder.
+func (l *Logger) RecordSent(msg email.SentMessage) {
+	if err := l.Append(Record{Event: EventMessageSent, Status: StatusOK, Message: &msg}); err != nil {
+		fmt.Fprintf(os.Stderr, "Audit warning (%s): %v\n", l.account, err)
+	}
+}
+
+// Query returns matching records, newest first
+func (l *Logger) Query(q Query) ([]Record, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Read from the oldest rotated file to the current one
+	paths := []string{}
+	for i := l.maxFiles; i >= 1; i-- {
+		paths = append(paths, l.rotatedPath(i))
+	}
+	paths = append(paths, l.path)
+
+	var matches []Record
+	for _, path := range paths {
+		records, err := readRecords(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, rec := range records {
+			if q.matches(rec) {
+				matches = append(matches, rec)
+			}
+		}
+	}
+
+	// Reverse so the newest record comes first
+	for i, j := 0, len(matches)-1; i < j; i, j = i+1, j-1 {
+		matches[i], matches[j] = matches[j], matches[i]
+	}
+	if q.Limit > 0 && len(matches) > q.Limit {
+		matches = matches[:q.Limit]
+	}
+	return matches, nil
+}
+
+// readRecords loads all records of one log file, skipping malformed lines
+func readRecords(path string) ([]Record, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer f.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		line, err := securefs.OpenLine(scanner.Bytes())
+		if err != nil {
+			continue
+		}
+		var rec Record
+		if err := json.Unmarshal(line, &rec); err != nil {
+			continue
+		}
+		records = append(records, rec)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+	return records, nil
+}
+
+// matches reports whether a record satisfies the query
+func (q Query) matches(rec Record) bool {
+	if q.Event != "" && rec.Event != q.Event {
+		return false
+	}
+	if q.Tool != "" && rec.Tool != q.Tool {
+		return false
+	}
+	if q.Status != "" && rec.Status != q.Status {
+		return false
+	}
+	if !q.Since.IsZero() && rec.Time.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && rec.Time.After(q.Until) {
+		return false
+	}
+	if q.Recipient != "" {
+		return rec.Message != nil && hasRecipient(rec.Message, q.Recipient)
+	}
+	return true
+}
+
+// hasRecipient reports whether any recipient of msg contains the search string
+func hasRecipient(msg *email.SentMessage, search string) bool {
+	search = strings.ToLower(search)
+	for _, list := range [][]string{msg.To, msg.CC, msg.BCC} {
+		for _, addr := range list {
+			if strings.Contains(strings.ToLower(addr), search) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SanitizeArgs returns a copy of tool arguments with message content hashed and secrets removed
+func SanitizeArgs(args map[string]interface{}) map[string]interface{} {
+	if len(args) == 0 {
+		return nil
+	}
+	clean := make(map[string]interface{}, len(args))
+	for key, value := range args {
+		switch {
+		case redactedArgs[key]:
+			clean[key] = "[redacted]"
+		case hashedArgs[key]:
+			clean[key] = hashValue(value)
+		default:
+			clean[key] = sanitizeValue(value)
+		}
+	}
+	return clean
+}
+
+// sanitizeValue applies SanitizeArgs to nested objects
+func sanitizeValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return SanitizeArgs(v)
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = sanitizeValue(item)
+		}
+		return out
+	}
+	return value
+}
+
+// hashValue replaces content with its SHA-256 hash and length
+func hashValue(value interface{}) string {
+	var data []byte
+	if s, ok := value.(string); ok {
+		data = []byte(s)
+	} else {
+		data, _ = json.Marshal(value)
+	}
+	sum := sha256.Sum256(data)
+	return fmt.Sprintf("sha256:%s (%d bytes)", hex.EncodeToString(sum[:]), len(data))
+}
@@ -0,0 +1,104 @@
+package audit
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prasanthmj/email/pkg/email"
+)
+
+func TestSanitizeArgs(t *testing.T) {
+	args := map[string]interface{}{
+		"to":            []interface{}{"bob@example.com"},
+		"body":          "secret text",
+		"confirm_token": "abc",
+		"inline_attachments": []interface{}{
+			map[string]interface{}{"cache_id": "x", "description": "hidden"},
+		},
+	}
+	clean := SanitizeArgs(args)
+
+	body, _ := clean["body"].(string)
+	if !strings.HasPrefix(body, "sha256:") || strings.Contains(body, "secret") {
+		t.Errorf("Expected body to be hashed, got %q", body)
+	}
+	if clean["confirm_token"] != "[redacted]" {
+		t.Errorf("Expected confirm_token to be redacted, got %v", clean["confirm_token"])
+	}
+	nested := clean["inline_attachments"].([]interface{})[0].(map[string]interface{})
+	if nested["cache_id"] != "x" || !strings.HasPrefix(nested["description"].(string), "sha256:") {
+		t.Errorf("Expected nested arguments to be sanitized, got %v", nested)
+	}
+	if args["body"] != "secret text" {
+		t.Error("Expected original arguments to be unchanged")
+	}
+}
+
+func TestLoggerQuery(t *testing.T) {
+	logger := New("work", filepath.Join(t.TempDir(), "audit", "audit.jsonl"), 0, 3)
+
+	if err := logger.RecordCall("fetch_email", map[string]interface{}{"message_id": "<a@x>"}, nil); err != nil {
+		t.Fatalf("Failed to record call: %v", err)
+	}
+	logger.RecordSent(email.SentMessage{MessageID: "<m1@x>", To: []string{"Customer <customer@example.org>"}})
+	if err := logger.RecordCall("send_email", nil, errors.New("boom")); err != nil {
+		t.Fatalf("Failed to record call: %v", err)
+	}
+
+	all, err := logger.Query(Query{})
+	if err != nil {
+		t.Fatalf("Failed to query: %v", err)
+	}
+	if len(all) != 3 || all[0].Tool != "send_email" || all[0].Account != "work" {
+		t.Fatalf("Expected 3 records newest first, got %+v", all)
+	}
+
+	sent, _ := logger.Query(Query{Recipient: "CUSTOMER@example.org"})
+	if len(sent) != 1 || sent[0].Message.MessageID != "<m1@x>" {
+		t.Errorf("Expected the sent message, got %+v", sent)
+	}
+	failed, _ := logger.Query(Query{Status: StatusError})
+	if len(failed) != 1 || failed[0].Error != "boom" {
+		t.Errorf("Expected the failed call, got %+v", failed)
+	}
+	none, _ := logger.Query(Query{Since: time.Now().Add(time.Hour)})
+	if len(none) != 0 {
+		t.Errorf("Expected no records in the future, got %d", len(none))
+	}
+}
+
+func TestLoggerRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	logger := New("work", path, 200, 2)
+
+	for i := 0; i < 10; i++ {
+		if err := logger.RecordCall("list_folders", nil, nil); err != nil {
+			t.Fatalf("Failed to record call: %v", err)
+		}
+	}
+
+	for _, p := range []string{path, path + ".1", path + ".2"} {
+		info, err := os.Stat(p)
+		if err != nil {
+			t.Fatalf("Expected %s to exist: %v", p, err)
+		}
+		if info.Size() > 200 {
+			t.Errorf("Expected %s to be rotated at 200 bytes, got %d", p, info.Size())
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Error("Expected only 2 rotated files to be kept")
+	}
+
+	records, err := logger.Query(Query{})
+	if err != nil {
+		t.Fatalf("Failed to query: %v", err)
+	}
+	if len(records) == 0 || len(records) >= 10 {
+		t.Errorf("Expected rotated-out records to be dropped, got %d", len(records))
+	}
+}
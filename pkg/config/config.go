@@ -1,12 +1,17 @@
 package config
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
+
+	"github.com/prasanthmj/email/pkg/securefs"
 )
 
 // AccountConfig represents configuration for a single email account
@@ -16,8 +21,43 @@ type AccountConfig struct {
 
 	// Email account
 	EmailAddress  string
-	EmailPassword string
-	Provider      string // gmail, outlook, or custom
+	EmailPassword *Secret // Resolved on first login, never serialized
+	Provider      string // A preset name (see ProviderNames) or custom
+
+	// Signature appended to new messages (plain text and HTML forms)
+	Signature     string
+	SignatureHTML string
+
+	// Additional sender identities (aliases) sent through this login
+	Identities []Identity
+
+	// Outgoing message limits (provider defaults unless overridden)
+	RateLimits RateLimits
+
+	// Outbound recipient and attachment restrictions
+	Policy Policy
+
+	// DKIM signing of outgoing mail (custom provider accounts)
+	DKIM DKIMSigning
+
+	// S/MIME certificate, key and recipient certificate store
+	SMIME SMIME
+
+	// OpenPGP secret key and keyring of recipient public keys
+	PGP PGP
+
+	// Effective mode (read_only, drafts_only or full), never less strict than the server mode
+	Mode string
+
+	// Sanitize and delimit email content returned to the model
+	ContentSafety bool
+
+	// Verify DKIM signatures of fetched messages against DNS
+	VerifyDKIM bool
+
+	// Servers whose Authentication-Results headers are trusted, matched against the
+	// authserv-id including subdomains. Defaults to the provider preset's servers.
+	AuthServIDs []string
 
 	// IMAP settings
 	IMAPServer string
@@ -27,6 +67,10 @@ type AccountConfig struct {
 	SMTPServer string
 	SMTPPort   int
 
+	// PEM certificates trusted for the IMAP and SMTP servers in addition to the system
+	// roots, such as the self-signed certificate of Proton Mail Bridge
+	TLSCAFile string
+
 	// Timeout settings
 	TimeoutSeconds int
 	Timeout        time.Duration
@@ -41,43 +85,237 @@ type AccountConfig struct {
 
 // MultiAccountConfig manages multiple email accounts
 type MultiAccountConfig struct {
+	// File the configuration was loaded from, if any
+	ConfigFile string
+
 	// Global storage settings
 	FilesRoot         string
+	EncryptAtRest     bool // Files under FilesRoot are encrypted with FILES_ENCRYPTION_KEY*
 	CacheMaxSize      int64
 	MaxAttachmentSize int64
 
+	// Outbox worker settings
+	OutboxPollInterval time.Duration
+	OutboxMaxAttempts  int
+
+	// Sending limits shared by all accounts
+	GlobalRateLimits RateLimits
+
+	// Audit log settings (per account, rotated by size)
+	AuditEnabled  bool
+	AuditMaxSize  int64
+	AuditMaxFiles int
+
+	// Server-wide mode and tool filters (nil sets mean no filter)
+	Mode          string
+	EnabledTools  map[string]bool
+	DisabledTools map[string]bool
+
+	// Tool call deadlines (0 means none), with per-tool overrides
+	DefaultToolTimeout time.Duration
+	ToolTimeouts       map[string]time.Duration
+
 	// Account management
 	Accounts         map[string]*AccountConfig
 	DefaultAccountID string
 }
 
-// LoadConfig loads multi-account configuration from environment variables
+// LoadConfig loads multi-account configuration from environment variables and prepares
+// the account folders
 func LoadConfig() (*MultiAccountConfig, error) {
+	cfg, err := ReadConfig()
+	if err != nil {
+		return nil, err
+	}
+	return cfg, cfg.PrepareStorage()
+}
+
+// LoadConfigFile loads configuration from a YAML or TOML file and prepares the account
+// folders. Environment variables override the settings in the file.
+func LoadConfigFile(path string) (*MultiAccountConfig, error) {
+	cfg, err := ReadConfigFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return cfg, cfg.PrepareStorage()
+}
+
+// ReadConfig loads configuration like LoadConfig without changing anything under
+// FILES_ROOT, so a reload can be checked before PrepareStorage applies it
+func ReadConfig() (*MultiAccountConfig, error) {
+	return loadConfig(nil)
+}
+
+// ReadConfigFile loads configuration like LoadConfigFile without changing anything under
+// FILES_ROOT
+func ReadConfigFile(path string) (*MultiAccountConfig, error) {
+	src, err := readConfigFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := loadConfig(src)
+	if err != nil {
+		return nil, src.annotate(err)
+	}
+	cfg.ConfigFile = path
+	return cfg, nil
+}
+
+// PrepareStorage migrates the folders of renamed accounts and creates each account's
+// folders and metadata
+func (m *MultiAccountConfig) PrepareStorage() error {
+	if len(m.Accounts) == 0 {
+		return nil
+	}
+
+	// Build map of current accounts (accountID -> email) for migration detection
+	currentAccounts := make(map[string]string)
+	for id, acct := range m.Accounts {
+		currentAccounts[id] = acct.EmailAddress
+	}
+
+	// Migrations run before the account folders are created
+	migrations, err := DetectMigrations(m.FilesRoot, currentAccounts)
+	if err != nil {
+		return fmt.Errorf("failed to detect migrations: %w", err)
+	}
+
+	if len(migrations) > 0 {
+		fmt.Fprintf(os.Stderr, "Detected %d account folder migration(s)\n", len(migrations))
+		migrationErrors := ExecuteAllMigrations(m.FilesRoot, migrations)
+		if len(migrationErrors) > 0 {
+			// Log migration errors but don't fail startup
+			for _, err := range migrationErrors {
+				fmt.Fprintf(os.Stderr, "Migration warning: %v\n", err)
+			}
+		} else {
+			fmt.Fprintf(os.Stderr, "All migrations completed successfully\n")
+		}
+	}
+
+	for id, acct := range m.Accounts {
+		if err := acct.prepareStorage(); err != nil {
+			return fmt.Errorf("failed to prepare account %s: %w", id, err)
+		}
+	}
+	return nil
+}
+
+var (
+	// loadMu serializes loads, which read the config file through source
+	loadMu sync.Mutex
+	source *fileSource
+)
+
+// getenv returns an environment variable, falling back to the config file being loaded
+func getenv(name string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	if source != nil {
+		return source.values[name]
+	}
+	return ""
+}
+
+// loadConfig resolves the configuration from the environment and an optional file
+func loadConfig(src *fileSource) (*MultiAccountConfig, error) {
+	loadMu.Lock()
+	source = src
+	defer func() {
+		source = nil
+		loadMu.Unlock()
+	}()
+
 	cfg := &MultiAccountConfig{
-		FilesRoot:         "/tmp/email-mcp",
-		CacheMaxSize:      10485760, // 10MB default
-		MaxAttachmentSize: 26214400, // 25MB default
-		Accounts:          make(map[string]*AccountConfig),
+		FilesRoot:          "/tmp/email-mcp",
+		CacheMaxSize:       10485760, // 10MB default
+		MaxAttachmentSize:  26214400, // 25MB default
+		OutboxPollInterval: 30 * time.Second,
+		OutboxMaxAttempts:  8,
+		AuditEnabled:       true,
+		AuditMaxSize:       10485760, // 10MB per file
+		AuditMaxFiles:      5,
+		Accounts:           make(map[string]*AccountConfig),
 	}
 
 	// Load global storage settings
-	if root := os.Getenv("FILES_ROOT"); root != "" {
+	if root := getenv("FILES_ROOT"); root != "" {
 		cfg.FilesRoot = root
 	}
-	if size := os.Getenv("EMAIL_CACHE_MAX_SIZE"); size != "" {
+	key, err := loadEncryptionKey()
+	if err != nil {
+		return nil, err
+	}
+	if err := securefs.UseKey(cfg.FilesRoot, key); err != nil {
+		return nil, err
+	}
+	cfg.EncryptAtRest = key != nil
+	if size := getenv("EMAIL_CACHE_MAX_SIZE"); size != "" {
 		s, err := strconv.ParseInt(size, 10, 64)
 		if err != nil {
 			return nil, fmt.Errorf("invalid EMAIL_CACHE_MAX_SIZE: %w", err)
 		}
 		cfg.CacheMaxSize = s
 	}
-	if size := os.Getenv("EMAIL_MAX_ATTACHMENT_SIZE"); size != "" {
+	if size := getenv("EMAIL_MAX_ATTACHMENT_SIZE"); size != "" {
 		s, err := strconv.ParseInt(size, 10, 64)
 		if err != nil {
 			return nil, fmt.Errorf("invalid EMAIL_MAX_ATTACHMENT_SIZE: %w", err)
 		}
 		cfg.MaxAttachmentSize = s
 	}
+	if poll := getenv("OUTBOX_POLL_SECONDS"); poll != "" {
+		p, err := strconv.Atoi(poll)
+		if err != nil || p < 1 {
+			return nil, fmt.Errorf("invalid OUTBOX_POLL_SECONDS: %s", poll)
+		}
+		cfg.OutboxPollInterval = time.Duration(p) * time.Second
+	}
+	if attempts := getenv("OUTBOX_MAX_ATTEMPTS"); attempts != "" {
+		a, err := strconv.Atoi(attempts)
+		if err != nil || a < 1 {
+			return nil, fmt.Errorf("invalid OUTBOX_MAX_ATTEMPTS: %s", attempts)
+		}
+		cfg.OutboxMaxAttempts = a
+	}
+	if enabled := getenv("AUDIT_LOG"); enabled != "" {
+		b, err := strconv.ParseBool(enabled)
+		if err != nil {
+			return nil, fmt.Errorf("invalid AUDIT_LOG: %s", enabled)
+		}
+		cfg.AuditEnabled = b
+	}
+	if size := getenv("AUDIT_MAX_SIZE"); size != "" {
+		s, err := strconv.ParseInt(size, 10, 64)
+		if err != nil || s < 1 {
+			return nil, fmt.Errorf("invalid AUDIT_MAX_SIZE: %s", size)
+		}
+		cfg.AuditMaxSize = s
+	}
+	if files := getenv("AUDIT_MAX_FILES"); files != "" {
+		f, err := strconv.Atoi(files)
+		if err != nil || f < 0 {
+			return nil, fmt.Errorf("invalid AUDIT_MAX_FILES: %s", files)
+		}
+		cfg.AuditMaxFiles = f
+	}
+	globalLimits, err := loadRateLimits("", RateLimits{})
+	if err != nil {
+		return nil, err
+	}
+	cfg.GlobalRateLimits = globalLimits
+
+	mode, err := parseMode("MODE", getenv("MODE"))
+	if err != nil {
+		return nil, err
+	}
+	cfg.Mode = mode
+	cfg.EnabledTools, cfg.DisabledTools = loadToolFilter()
+	cfg.DefaultToolTimeout, cfg.ToolTimeouts, err = loadToolTimeouts()
+	if err != nil {
+		return nil, err
+	}
 
 	// Discover and load all accounts from environment variables
 	accountIDs := discoverAccountIDs()
@@ -89,51 +327,26 @@ func LoadConfig() (*MultiAccountConfig, error) {
 		return cfg, nil
 	}
 
-	// Build map of current accounts (accountID -> email) for migration detection
-	currentAccounts := make(map[string]string)
-	for _, accountID := range accountIDs {
-		prefix := "ACCOUNT_" + accountID + "_"
-		email := os.Getenv(prefix + "EMAIL")
-		if email != "" {
-			currentAccounts[accountID] = email
-		}
-	}
-
-	// Detect and execute folder migrations before loading accounts
-	migrations, err := DetectMigrations(cfg.FilesRoot, currentAccounts)
-	if err != nil {
-		return nil, fmt.Errorf("failed to detect migrations: %w", err)
-	}
-
-	if len(migrations) > 0 {
-		fmt.Fprintf(os.Stderr, "Detected %d account folder migration(s)\n", len(migrations))
-		migrationErrors := ExecuteAllMigrations(cfg.FilesRoot, migrations)
-		if len(migrationErrors) > 0 {
-			// Log migration errors but don't fail startup
-			for _, err := range migrationErrors {
-				fmt.Fprintf(os.Stderr, "Migration warning: %v\n", err)
-			}
-		} else {
-			fmt.Fprintf(os.Stderr, "All migrations completed successfully\n")
-		}
-	}
-
 	// Load all accounts
 	for _, accountID := range accountIDs {
 		acct, err := loadAccountConfig(accountID, cfg.FilesRoot)
 		if err != nil {
 			return nil, fmt.Errorf("failed to load account %s: %w", accountID, err)
 		}
+		acct.Mode = StricterMode(cfg.Mode, acct.Mode)
 		cfg.Accounts[accountID] = acct
 	}
 
 	// Load default account ID
-	cfg.DefaultAccountID = os.Getenv("DEFAULT_ACCOUNT_ID")
+	cfg.DefaultAccountID = getenv("DEFAULT_ACCOUNT_ID")
 
 	// Only validate if we have accounts configured
 	if len(cfg.Accounts) > 0 {
 		// If no default specified but we have accounts, use the first one
-		if cfg.DefaultAccountID == "" {
+		if cfg.DefaultAccountID == "" && source != nil && len(source.accounts) > 0 {
+			// The first account in the config file is the default
+			cfg.DefaultAccountID = source.accounts[0]
+		} else if cfg.DefaultAccountID == "" {
 			// Pick first account as default
 			for id := range cfg.Accounts {
 				cfg.DefaultAccountID = id
@@ -151,12 +364,19 @@ func LoadConfig() (*MultiAccountConfig, error) {
 	return cfg, nil
 }
 
-// discoverAccountIDs scans environment variables to find all configured accounts
+// discoverAccountIDs scans environment variables and the config file to find all
+// configured accounts
 func discoverAccountIDs() []string {
 	accountSet := make(map[string]bool)
 	prefix := "ACCOUNT_"
 	suffix := "_EMAIL"
 
+	if source != nil {
+		for _, id := range source.accounts {
+			accountSet[id] = true
+		}
+	}
+
 	for _, env := range os.Environ() {
 		parts := strings.SplitN(env, "=", 2)
 		key := parts[0]
@@ -178,71 +398,103 @@ func discoverAccountIDs() []string {
 	return accountIDs
 }
 
+// hasExplicitServers reports whether all four server settings are given, making discovery unnecessary
+func hasExplicitServers(prefix string) bool {
+	for _, name := range []string{"IMAP_SERVER", "IMAP_PORT", "SMTP_SERVER", "SMTP_PORT"} {
+		if getenv(prefix+name) == "" {
+			return false
+		}
+	}
+	return true
+}
+
 // loadAccountConfig loads configuration for a single account
 func loadAccountConfig(accountID, filesRoot string) (*AccountConfig, error) {
 	prefix := "ACCOUNT_" + accountID + "_"
 
 	acct := &AccountConfig{
 		AccountID:      accountID,
-		Provider:       "gmail",       // default
 		TimeoutSeconds: 120,           // 2 minutes default
 	}
 
 	// Load email credentials
-	acct.EmailAddress = os.Getenv(prefix + "EMAIL")
+	acct.EmailAddress = getenv(prefix + "EMAIL")
 	if acct.EmailAddress == "" {
 		return nil, fmt.Errorf("missing %sEMAIL", prefix)
 	}
 
-	acct.EmailPassword = os.Getenv(prefix + "PASSWORD")
-	if acct.EmailPassword == "" {
-		return nil, fmt.Errorf("missing %sPASSWORD", prefix)
+	password, err := loadPassword(prefix, accountID)
+	if err != nil {
+		return nil, err
 	}
+	acct.EmailPassword = password
 
-	// Provider
-	if provider := os.Getenv(prefix + "PROVIDER"); provider != "" {
-		acct.Provider = provider
+	// Provider, inferred from the address domain when not set (gmail for unknown domains)
+	acct.Provider = getenv(prefix + "PROVIDER")
+	if acct.Provider == "" {
+		acct.Provider = providerForAddress(acct.EmailAddress)
+	}
+	if acct.Provider == "" {
+		acct.Provider = "gmail"
 	}
 
 	// Auto-configure for known providers
-	switch acct.Provider {
-	case "gmail":
-		acct.IMAPServer = "imap.gmail.com"
-		acct.IMAPPort = 993
-		acct.SMTPServer = "smtp.gmail.com"
-		acct.SMTPPort = 587
-	case "outlook":
-		acct.IMAPServer = "outlook.office365.com"
-		acct.IMAPPort = 993
-		acct.SMTPServer = "smtp-mail.outlook.com"
-		acct.SMTPPort = 587
-	default:
+	if preset, ok := providerPresets[acct.Provider]; ok {
+		acct.IMAPServer = preset.Servers.IMAPServer
+		acct.IMAPPort = preset.Servers.IMAPPort
+		acct.SMTPServer = preset.Servers.SMTPServer
+		acct.SMTPPort = preset.Servers.SMTPPort
+	} else if acct.Provider == "auto" && !hasExplicitServers(prefix) {
+		ctx, cancel := context.WithTimeout(context.Background(), discoveryTimeout)
+		defer cancel()
+		found, err := discoverCached(ctx, acct.EmailAddress)
+		if err != nil {
+			return nil, fmt.Errorf("%sPROVIDER=auto: %w", prefix, err)
+		}
+		acct.Provider = found.Provider
+		acct.IMAPServer = found.IMAPServer
+		acct.IMAPPort = found.IMAPPort
+		acct.SMTPServer = found.SMTPServer
+		acct.SMTPPort = found.SMTPPort
+	} else {
 		// For custom providers, all settings must be explicitly provided
 		acct.Provider = "custom"
 	}
 
 	// Override with explicit settings if provided
-	if server := os.Getenv(prefix + "IMAP_SERVER"); server != "" {
+	if server := getenv(prefix + "IMAP_SERVER"); server != "" {
 		acct.IMAPServer = server
 	}
-	if port := os.Getenv(prefix + "IMAP_PORT"); port != "" {
+	if port := getenv(prefix + "IMAP_PORT"); port != "" {
 		p, err := strconv.Atoi(port)
 		if err != nil {
 			return nil, fmt.Errorf("invalid %sIMAP_PORT: %w", prefix, err)
 		}
 		acct.IMAPPort = p
 	}
-	if server := os.Getenv(prefix + "SMTP_SERVER"); server != "" {
+	if server := getenv(prefix + "SMTP_SERVER"); server != "" {
 		acct.SMTPServer = server
 	}
-	if port := os.Getenv(prefix + "SMTP_PORT"); port != "" {
+	if port := getenv(prefix + "SMTP_PORT"); port != "" {
 		p, err := strconv.Atoi(port)
 		if err != nil {
 			return nil, fmt.Errorf("invalid %sSMTP_PORT: %w", prefix, err)
 		}
 		acct.SMTPPort = p
 	}
-	if timeout := os.Getenv(prefix + "TIMEOUT_SECONDS"); timeout != "" {
+	acct.AuthServIDs = providerPresets[acct.Provider].AuthServIDs
+	if ids := getenv(prefix + "AUTHSERV_IDS"); ids != "" {
+		acct.AuthServIDs = splitList(ids)
+	}
+	acct.TLSCAFile = getenv(prefix + "TLS_CA_FILE")
+	if acct.TLSCAFile != "" {
+		if _, err := os.Stat(acct.TLSCAFile); err != nil {
+			return nil, fmt.Errorf("failed to read %sTLS_CA_FILE: %w", prefix, err)
+		}
+	} else if acct.Provider == "proton-bridge" {
+		return nil, fmt.Errorf("%sTLS_CA_FILE is required for proton-bridge: export the Bridge's TLS certificate and set it to the cert.pem file", prefix)
+	}
+	if timeout := getenv(prefix + "TIMEOUT_SECONDS"); timeout != "" {
 		t, err := strconv.Atoi(timeout)
 		if err != nil {
 			return nil, fmt.Errorf("invalid %sTIMEOUT_SECONDS: %w", prefix, err)
@@ -250,6 +502,57 @@ func loadAccountConfig(accountID, filesRoot string) (*AccountConfig, error) {
 		acct.TimeoutSeconds = t
 	}
 
+	// Signature and sender identities
+	signature, signatureHTML, err := loadSignature(prefix)
+	if err != nil {
+		return nil, err
+	}
+	acct.Signature = signature
+	acct.SignatureHTML = signatureHTML
+
+	identities, err := loadIdentities(prefix)
+	if err != nil {
+		return nil, err
+	}
+	acct.Identities = identities
+
+	rateLimits, err := loadRateLimits(prefix, providerRateLimits(acct.Provider))
+	if err != nil {
+		return nil, err
+	}
+	acct.RateLimits = rateLimits
+
+	policy, err := loadPolicy(prefix, acct)
+	if err != nil {
+		return nil, err
+	}
+	acct.Policy = policy
+
+	dkim, err := loadDKIMSigning(prefix, acct)
+	if err != nil {
+		return nil, err
+	}
+	acct.DKIM = dkim
+
+	mode, err := parseMode(prefix+"MODE", getenv(prefix+"MODE"))
+	if err != nil {
+		return nil, err
+	}
+	acct.Mode = mode
+
+	// Content safety and DKIM verification default to the server-wide settings
+	for setting, target := range map[string]*bool{"CONTENT_SAFETY": &acct.ContentSafety, "VERIFY_DKIM": &acct.VerifyDKIM} {
+		for _, name := range []string{setting, prefix + setting} {
+			if value := getenv(name); value != "" {
+				enabled, err := strconv.ParseBool(value)
+				if err != nil {
+					return nil, fmt.Errorf("invalid %s: %s", name, value)
+				}
+				*target = enabled
+			}
+		}
+	}
+
 	// Set timeout duration
 	acct.Timeout = time.Duration(acct.TimeoutSeconds) * time.Second
 
@@ -275,25 +578,56 @@ func loadAccountConfig(accountID, filesRoot string) (*AccountConfig, error) {
 	acct.AttachmentDir = filepath.Join(acct.CacheDir, "attachments")
 	acct.MetadataFile = filepath.Join(accountRoot, "metadata.yaml")
 
-	// Create directories
-	dirs := []string{acct.DraftsDir, acct.EmailCacheDir, acct.AttachmentDir}
+	smime, err := loadSMIME(prefix, accountRoot)
+	if err != nil {
+		return nil, err
+	}
+	acct.SMIME = smime
+
+	pgp, err := loadPGP(prefix, accountID, accountRoot)
+	if err != nil {
+		return nil, err
+	}
+	acct.PGP = pgp
+
+	return acct, nil
+}
+
+// prepareStorage creates the account's folders and writes its metadata
+func (a *AccountConfig) prepareStorage() error {
+	dirs := []string{a.DraftsDir, a.EmailCacheDir, a.AttachmentDir, a.PGP.Keyring, a.SMIME.CertStore}
 	for _, dir := range dirs {
-		if err := os.MkdirAll(dir, 0755); err != nil {
-			return nil, fmt.Errorf("failed to create directory %s: %w", dir, err)
+		if dir == "" {
+			// The certificate store is only set when S/MIME is configured
+			continue
+		}
+		if err := securefs.MkdirAll(dir); err != nil {
+			return fmt.Errorf("failed to create directory %s: %w", dir, err)
 		}
 	}
 
 	// Write or update metadata for migration tracking
-	if err := WriteAccountMetadata(acct.MetadataFile, acct.AccountID, acct.EmailAddress); err != nil {
-		return nil, fmt.Errorf("failed to write account metadata: %w", err)
+	if err := WriteAccountMetadata(a.MetadataFile, a.AccountID, a.EmailAddress); err != nil {
+		return fmt.Errorf("failed to write account metadata: %w", err)
 	}
+	return nil
+}
 
-	return acct, nil
+// Equal reports whether two account configurations are the same, including the password
+func (a *AccountConfig) Equal(b *AccountConfig) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	x, y := *a, *b
+	x.EmailPassword, y.EmailPassword = nil, nil
+	x.PGP.Passphrase, y.PGP.Passphrase = nil, nil
+	return reflect.DeepEqual(x, y) && a.EmailPassword.Equal(b.EmailPassword) &&
+		a.PGP.Passphrase.Equal(b.PGP.Passphrase)
 }
 
 // IsConfigured checks if email credentials are available
 func (a *AccountConfig) IsConfigured() bool {
-	return a.EmailAddress != "" && a.EmailPassword != ""
+	return a.EmailAddress != "" && a.EmailPassword != nil
 }
 
 // ValidateForOperation checks if configuration is valid for email operations
@@ -301,7 +635,7 @@ func (a *AccountConfig) ValidateForOperation() error {
 	if a.EmailAddress == "" {
 		return fmt.Errorf("account %s: email address not configured", a.AccountID)
 	}
-	if a.EmailPassword == "" {
+	if a.EmailPassword == nil {
 		return fmt.Errorf("account %s: email password not configured", a.AccountID)
 	}
 	if a.IMAPServer == "" || a.IMAPPort == 0 {
@@ -335,3 +335,43 @@ func TestExecuteMigration_SourceNotExists(t *testing.T) {
 		t.Fatal("Migration should fail when source folder doesn't exist")
 	}
 }
+
+func TestReadConfigThenPrepareStorage(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("FILES_ROOT", tmpDir)
+	t.Setenv("ACCOUNT_Operations_EMAIL", "business@example.com")
+	t.Setenv("ACCOUNT_Operations_PASSWORD", "secret")
+
+	// Folder of the account before it was renamed from "Business"
+	businessFolder := filepath.Join(tmpDir, "Business")
+	os.MkdirAll(businessFolder, 0755)
+	WriteAccountMetadata(filepath.Join(businessFolder, "metadata.yaml"), "Business", "business@example.com")
+
+	// Reading the configuration changes nothing on disk
+	cfg, err := ReadConfig()
+	if err != nil {
+		t.Fatalf("Failed to read config: %v", err)
+	}
+	if _, err := os.Stat(businessFolder); err != nil {
+		t.Errorf("Expected ReadConfig to leave the old folder in place: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "Operations")); !os.IsNotExist(err) {
+		t.Errorf("Expected ReadConfig not to create the account folder, got %v", err)
+	}
+
+	if err := cfg.PrepareStorage(); err != nil {
+		t.Fatalf("Failed to prepare storage: %v", err)
+	}
+	if _, err := os.Stat(businessFolder); !os.IsNotExist(err) {
+		t.Errorf("Expected the old folder to be migrated, got %v", err)
+	}
+	acct := cfg.Accounts["Operations"]
+	for _, dir := range []string{acct.DraftsDir, acct.EmailCacheDir, acct.AttachmentDir, acct.PGP.Keyring} {
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			t.Errorf("Expected %s to be created: %v", dir, err)
+		}
+	}
+	if metadata, err := ReadAccountMetadata(acct.MetadataFile); err != nil || metadata.AccountID != "Operations" {
+		t.Errorf("Expected metadata for Operations, got %+v (%v)", metadata, err)
+	}
+}
@@ -79,7 +79,7 @@ func TestMultiAccountConfig_Validate(t *testing.T) {
 			"Personal": {
 				AccountID:     "Personal",
 				EmailAddress:  "test@example.com",
-				EmailPassword: "password",
+				EmailPassword: StaticSecret("password"),
 				IMAPServer:    "imap.example.com",
 				IMAPPort:      993,
 				SMTPServer:    "smtp.example.com",
@@ -111,7 +111,7 @@ func TestAccountConfig_ValidateForOperation(t *testing.T) {
 	acct := &AccountConfig{
 		AccountID:     "Test",
 		EmailAddress:  "test@example.com",
-		EmailPassword: "password",
+		EmailPassword: StaticSecret("password"),
 		IMAPServer:    "imap.example.com",
 		IMAPPort:      993,
 		SMTPServer:    "smtp.example.com",
@@ -130,15 +130,48 @@ func TestAccountConfig_ValidateForOperation(t *testing.T) {
 	acct.EmailAddress = "test@example.com"
 
 	// Test missing password
-	acct.EmailPassword = ""
+	acct.EmailPassword = nil
 	if err := acct.ValidateForOperation(); err == nil {
 		t.Error("Expected error for missing password")
 	}
-	acct.EmailPassword = "password"
+	acct.EmailPassword = StaticSecret("password")
 
 	// Test missing IMAP server
 	acct.IMAPServer = ""
 	if err := acct.ValidateForOperation(); err == nil {
 		t.Error("Expected error for missing IMAP server")
 	}
-}
\ No newline at end of file
+}
+
+func TestAccountConfig_Equal(t *testing.T) {
+	a := &AccountConfig{AccountID: "a", EmailAddress: "a@example.com", EmailPassword: StaticSecret("x"), Policy: Policy{AllowedDomains: []string{"example.com"}}}
+	b := &AccountConfig{AccountID: "a", EmailAddress: "a@example.com", EmailPassword: StaticSecret("x"), Policy: Policy{AllowedDomains: []string{"example.com"}}}
+	if !a.Equal(b) {
+		t.Error("Expected identical accounts to be equal")
+	}
+	b.Policy.AllowedDomains = []string{"example.org"}
+	if a.Equal(b) {
+		t.Error("Expected a policy change to be detected")
+	}
+	b.Policy = a.Policy
+	b.EmailPassword = StaticSecret("y")
+	if a.Equal(b) {
+		t.Error("Expected a password change to be detected")
+	}
+
+	// Secrets from files or commands are compared by setting, not resolved
+	never := func() (string, error) {
+		t.Error("Expected the passphrase command not to run")
+		return "", nil
+	}
+	b.EmailPassword = a.EmailPassword
+	a.PGP.Passphrase = NewSecret("ACCOUNT_a_PGP_PASSPHRASE_CMD", "pass show pgp", never)
+	b.PGP.Passphrase = NewSecret("ACCOUNT_a_PGP_PASSPHRASE_CMD", "pass show pgp", never)
+	if !a.Equal(b) {
+		t.Error("Expected the same passphrase command to be equal")
+	}
+	b.PGP.Passphrase = NewSecret("ACCOUNT_a_PGP_PASSPHRASE_CMD", "pass show other", never)
+	if a.Equal(b) {
+		t.Error("Expected a passphrase change to be detected")
+	}
+}
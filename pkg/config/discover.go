@@ -0,0 +1,251 @@
+package config
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// discoveryTimeout bounds the whole autodiscovery of one account
+const discoveryTimeout = 30 * time.Second
+
+// ispdbURL is the base URL of Thunderbird's ISP database
+const ispdbURL = "https://autoconfig.thunderbird.net/v1.1/"
+
+// Resolver looks up the DNS records used by autodiscovery. *net.Resolver implements it.
+type Resolver interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+	LookupMX(ctx context.Context, name string) ([]*net.MX, error)
+}
+
+// Discoverer finds the IMAP and SMTP servers of an email address
+type Discoverer struct {
+	HTTPClient *http.Client
+	Resolver   Resolver
+	ISPDBURL   string
+}
+
+// NewDiscoverer creates a discoverer using the system resolver and HTTPS
+func NewDiscoverer() *Discoverer {
+	return &Discoverer{
+		HTTPClient: &http.Client{Timeout: 10 * time.Second},
+		Resolver:   net.DefaultResolver,
+		ISPDBURL:   ispdbURL,
+	}
+}
+
+// discoverer is used for PROVIDER=auto accounts; tests replace it
+var discoverer = NewDiscoverer()
+
+// discoveredServers caches discovery results by address, so reloads keep the servers
+// found at startup instead of trusting a new, possibly spoofed, DNS answer
+var (
+	discoveredMu      sync.Mutex
+	discoveredServers = make(map[string]*Discovered)
+)
+
+// discoverCached discovers the servers for address once per process and logs the result
+func discoverCached(ctx context.Context, address string) (*Discovered, error) {
+	key := strings.ToLower(address)
+	discoveredMu.Lock()
+	defer discoveredMu.Unlock()
+	if found, ok := discoveredServers[key]; ok {
+		return found, nil
+	}
+	found, err := discoverer.Discover(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(os.Stderr, "Discovered servers for %s from %s: IMAP %s:%d, SMTP %s:%d\n",
+		address, found.Source, found.IMAPServer, found.IMAPPort, found.SMTPServer, found.SMTPPort)
+	discoveredServers[key] = found
+	return found, nil
+}
+
+// Discovered is the result of autodiscovery
+type Discovered struct {
+	ServerSettings
+	Provider string `json:"provider"` // Matching preset, or custom
+	Source   string `json:"source"`   // Where the settings were found
+}
+
+// Discover tries, in order, the provider presets, the domain's autoconfig file, the
+// ISP database, SRV records (RFC 6186) and the ISP database entry of the domain's mail
+// exchanger. Autoconfig files are only fetched over HTTPS.
+func (d *Discoverer) Discover(ctx context.Context, address string) (*Discovered, error) {
+	at := strings.LastIndex(address, "@")
+	if at < 0 || at == len(address)-1 {
+		return nil, fmt.Errorf("invalid email address %q", address)
+	}
+	domain := strings.ToLower(address[at+1:])
+
+	if name := providerForAddress(address); name != "" {
+		return &Discovered{ServerSettings: providerPresets[name].Servers, Provider: name, Source: "preset " + name}, nil
+	}
+
+	query := "?emailaddress=" + url.QueryEscape(address)
+	sources := []string{
+		"https://autoconfig." + domain + "/mail/config-v1.1.xml" + query,
+		"https://" + domain + "/.well-known/autoconfig/mail/config-v1.1.xml" + query,
+		d.ISPDBURL + domain,
+	}
+	var errs []string
+	for _, source := range sources {
+		settings, err := d.fetchAutoconfig(ctx, source, address)
+		if err == nil {
+			return discovered(settings, source), nil
+		}
+		errs = append(errs, fmt.Sprintf("%s: %v", source, err))
+	}
+
+	settings, err := d.lookupSRV(ctx, domain)
+	if err == nil {
+		return discovered(settings, "SRV records of "+domain), nil
+	}
+	errs = append(errs, fmt.Sprintf("SRV records: %v", err))
+
+	mxDomain, err := d.lookupMXDomain(ctx, domain)
+	if err == nil && mxDomain == domain {
+		err = fmt.Errorf("mail exchanger is in %s itself", domain)
+	}
+	if err == nil {
+		source := d.ISPDBURL + mxDomain
+		settings, err = d.fetchAutoconfig(ctx, source, address)
+		if err == nil {
+			return discovered(settings, source+" (mail exchanger of "+domain+")"), nil
+		}
+	}
+	errs = append(errs, fmt.Sprintf("mail exchanger: %v", err))
+
+	return nil, fmt.Errorf("failed to discover mail servers for %s:\n  %s", domain, strings.Join(errs, "\n  "))
+}
+
+// discovered labels settings with the preset they belong to, if any
+func discovered(settings ServerSettings, source string) *Discovered {
+	return &Discovered{ServerSettings: settings, Provider: providerForServer(settings.IMAPServer), Source: source}
+}
+
+// clientConfig is the Mozilla autoconfig / ISPDB document format
+type clientConfig struct {
+	Providers []struct {
+		Incoming []autoconfigServer `xml:"incomingServer"`
+		Outgoing []autoconfigServer `xml:"outgoingServer"`
+	} `xml:"emailProvider"`
+}
+
+// autoconfigServer is one server entry of an autoconfig document
+type autoconfigServer struct {
+	Type       string `xml:"type,attr"`
+	Hostname   string `xml:"hostname"`
+	Port       int    `xml:"port"`
+	SocketType string `xml:"socketType"`
+}
+
+// fetchAutoconfig downloads and parses an autoconfig document
+func (d *Discoverer) fetchAutoconfig(ctx context.Context, source, address string) (ServerSettings, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return ServerSettings{}, err
+	}
+	resp, err := d.HTTPClient.Do(req)
+	if err != nil {
+		return ServerSettings{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return ServerSettings{}, fmt.Errorf("HTTP %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return ServerSettings{}, err
+	}
+	return parseAutoconfig(data, address)
+}
+
+// parseAutoconfig picks an IMAP server using SSL/TLS and an SMTP server using STARTTLS
+func parseAutoconfig(data []byte, address string) (ServerSettings, error) {
+	var doc clientConfig
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return ServerSettings{}, fmt.Errorf("failed to parse autoconfig: %w", err)
+	}
+
+	localPart, domain := address[:strings.LastIndex(address, "@")], address[strings.LastIndex(address, "@")+1:]
+	placeholders := strings.NewReplacer("%EMAILADDRESS%", address, "%EMAILLOCALPART%", localPart, "%EMAILDOMAIN%", domain)
+
+	var settings ServerSettings
+	for _, p := range doc.Providers {
+		for _, s := range p.Incoming {
+			if settings.IMAPServer == "" && s.Type == "imap" && s.SocketType == "SSL" {
+				settings.IMAPServer, settings.IMAPPort = placeholders.Replace(s.Hostname), s.Port
+			}
+		}
+		for _, s := range p.Outgoing {
+			if settings.SMTPServer == "" && s.Type == "smtp" && s.SocketType == "STARTTLS" {
+				settings.SMTPServer, settings.SMTPPort = placeholders.Replace(s.Hostname), s.Port
+			}
+		}
+	}
+	if settings.IMAPServer == "" || settings.IMAPPort == 0 {
+		return ServerSettings{}, fmt.Errorf("no IMAP server with SSL/TLS")
+	}
+	if settings.SMTPServer == "" || settings.SMTPPort == 0 {
+		return ServerSettings{}, fmt.Errorf("no SMTP server with STARTTLS")
+	}
+	return settings, nil
+}
+
+// lookupSRV reads the _imaps._tcp and _submission._tcp records of domain
+func (d *Discoverer) lookupSRV(ctx context.Context, domain string) (ServerSettings, error) {
+	imapHost, imapPort, err := d.srvTarget(ctx, "imaps", domain)
+	if err != nil {
+		return ServerSettings{}, err
+	}
+	smtpHost, smtpPort, err := d.srvTarget(ctx, "submission", domain)
+	if err != nil {
+		return ServerSettings{}, err
+	}
+	return ServerSettings{imapHost, imapPort, smtpHost, smtpPort}, nil
+}
+
+// srvTarget returns the preferred target of a service, which is sorted first by the resolver
+func (d *Discoverer) srvTarget(ctx context.Context, service, domain string) (string, int, error) {
+	_, records, err := d.Resolver.LookupSRV(ctx, service, "tcp", domain)
+	if err != nil {
+		return "", 0, err
+	}
+	if len(records) == 0 || records[0].Target == "." {
+		return "", 0, fmt.Errorf("_%s._tcp.%s is not available", service, domain)
+	}
+	return strings.TrimSuffix(records[0].Target, "."), int(records[0].Port), nil
+}
+
+// lookupMXDomain returns the registered domain of the preferred mail exchanger, so that
+// domains hosted by a provider can be found under the provider's ISPDB entry
+func (d *Discoverer) lookupMXDomain(ctx context.Context, domain string) (string, error) {
+	records, err := d.Resolver.LookupMX(ctx, domain)
+	if err != nil {
+		return "", err
+	}
+	if len(records) == 0 {
+		return "", fmt.Errorf("no MX records for %s", domain)
+	}
+	best := records[0]
+	for _, mx := range records[1:] {
+		if mx.Pref < best.Pref {
+			best = mx
+		}
+	}
+	labels := strings.Split(strings.ToLower(strings.TrimSuffix(best.Host, ".")), ".")
+	if len(labels) < 2 {
+		return "", fmt.Errorf("invalid MX host %q", best.Host)
+	}
+	return strings.Join(labels[len(labels)-2:], "."), nil
+}
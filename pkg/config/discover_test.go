@@ -0,0 +1,258 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeTransport serves fixed responses keyed by URL and 404 for everything else
+type fakeTransport map[string]string
+
+func (f fakeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, ok := f[req.URL.String()]
+	status := http.StatusOK
+	if !ok {
+		status = http.StatusNotFound
+	}
+	return &http.Response{
+		StatusCode: status,
+		Status:     http.StatusText(status),
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    req,
+	}, nil
+}
+
+// fakeResolver answers SRV and MX lookups from maps
+type fakeResolver struct {
+	srv map[string][]*net.SRV
+	mx  map[string][]*net.MX
+}
+
+func (r fakeResolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	key := fmt.Sprintf("_%s._%s.%s", service, proto, name)
+	if records, ok := r.srv[key]; ok {
+		return key, records, nil
+	}
+	return "", nil, fmt.Errorf("no such host %s", key)
+}
+
+func (r fakeResolver) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	if records, ok := r.mx[name]; ok {
+		return records, nil
+	}
+	return nil, fmt.Errorf("no such host %s", name)
+}
+
+const testAutoconfig = `<?xml version="1.0"?>
+<clientConfig version="1.1">
+  <emailProvider id="example.org">
+    <incomingServer type="pop3">
+      <hostname>pop.example.org</hostname><port>995</port><socketType>SSL</socketType>
+    </incomingServer>
+    <incomingServer type="imap">
+      <hostname>imap.example.org</hostname><port>143</port><socketType>STARTTLS</socketType>
+    </incomingServer>
+    <incomingServer type="imap">
+      <hostname>imap.%EMAILDOMAIN%</hostname><port>993</port><socketType>SSL</socketType>
+    </incomingServer>
+    <outgoingServer type="smtp">
+      <hostname>smtp.example.org</hostname><port>465</port><socketType>SSL</socketType>
+    </outgoingServer>
+    <outgoingServer type="smtp">
+      <hostname>smtp.example.org</hostname><port>587</port><socketType>STARTTLS</socketType>
+    </outgoingServer>
+  </emailProvider>
+</clientConfig>`
+
+func newTestDiscoverer(responses fakeTransport, resolver fakeResolver) *Discoverer {
+	return &Discoverer{
+		HTTPClient: &http.Client{Transport: responses},
+		Resolver:   resolver,
+		ISPDBURL:   "https://ispdb.test/v1.1/",
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	ctx := context.Background()
+	want := ServerSettings{"imap.example.org", 993, "smtp.example.org", 587}
+
+	tests := []struct {
+		name      string
+		responses fakeTransport
+		resolver  fakeResolver
+		want      ServerSettings
+		provider  string
+		source    string
+	}{
+		{
+			name:      "autoconfig subdomain",
+			responses: fakeTransport{"https://autoconfig.example.org/mail/config-v1.1.xml?emailaddress=me%40example.org": testAutoconfig},
+			want:      want,
+			provider:  "custom",
+			source:    "https://autoconfig.example.org/",
+		},
+		{
+			name:      "well-known autoconfig",
+			responses: fakeTransport{"https://example.org/.well-known/autoconfig/mail/config-v1.1.xml?emailaddress=me%40example.org": testAutoconfig},
+			want:      want,
+			provider:  "custom",
+			source:    "https://example.org/.well-known/",
+		},
+		{
+			name:      "ISPDB",
+			responses: fakeTransport{"https://ispdb.test/v1.1/example.org": testAutoconfig},
+			want:      want,
+			provider:  "custom",
+			source:    "https://ispdb.test/",
+		},
+		{
+			name: "SRV records",
+			resolver: fakeResolver{srv: map[string][]*net.SRV{
+				"_imaps._tcp.example.org":      {{Target: "mail.example.org.", Port: 993}},
+				"_submission._tcp.example.org": {{Target: "mail.example.org.", Port: 587}},
+			}},
+			want:     ServerSettings{"mail.example.org", 993, "mail.example.org", 587},
+			provider: "custom",
+			source:   "SRV records",
+		},
+		{
+			name: "ISPDB entry of the mail exchanger",
+			responses: fakeTransport{"https://ispdb.test/v1.1/googlemail.com": `<clientConfig><emailProvider>
+				<incomingServer type="imap"><hostname>imap.gmail.com</hostname><port>993</port><socketType>SSL</socketType></incomingServer>
+				<outgoingServer type="smtp"><hostname>smtp.gmail.com</hostname><port>587</port><socketType>STARTTLS</socketType></outgoingServer>
+			</emailProvider></clientConfig>`},
+			resolver: fakeResolver{mx: map[string][]*net.MX{
+				"example.org": {{Host: "alt1.aspmx.l.googlemail.com.", Pref: 5}, {Host: "aspmx.l.googlemail.com.", Pref: 1}},
+			}},
+			want:     providerPresets["gmail"].Servers,
+			provider: "gmail",
+			source:   "mail exchanger of example.org",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			found, err := newTestDiscoverer(tt.responses, tt.resolver).Discover(ctx, "me@example.org")
+			if err != nil {
+				t.Fatalf("Discover failed: %v", err)
+			}
+			if found.ServerSettings != tt.want {
+				t.Errorf("Expected %+v, got %+v", tt.want, found.ServerSettings)
+			}
+			if found.Provider != tt.provider {
+				t.Errorf("Expected provider %s, got %s", tt.provider, found.Provider)
+			}
+			if !strings.Contains(found.Source, tt.source) {
+				t.Errorf("Expected source containing %q, got %q", tt.source, found.Source)
+			}
+		})
+	}
+
+	// Known domains use the preset without any lookups
+	found, err := newTestDiscoverer(nil, fakeResolver{}).Discover(ctx, "me@iCloud.com")
+	if err != nil || found.Provider != "icloud" {
+		t.Errorf("Expected the icloud preset, got %+v, %v", found, err)
+	}
+
+	// Failures list every method tried
+	_, err = newTestDiscoverer(nil, fakeResolver{}).Discover(ctx, "me@example.org")
+	if err == nil {
+		t.Fatal("Expected an error when nothing is found")
+	}
+	for _, part := range []string{"autoconfig.example.org", "ispdb.test", "SRV records", "mail exchanger"} {
+		if !strings.Contains(err.Error(), part) {
+			t.Errorf("Expected error to mention %q, got: %v", part, err)
+		}
+	}
+}
+
+func TestParseAutoconfig_Unsupported(t *testing.T) {
+	doc := `<clientConfig><emailProvider>
+		<incomingServer type="imap"><hostname>imap.example.org</hostname><port>143</port><socketType>STARTTLS</socketType></incomingServer>
+		<outgoingServer type="smtp"><hostname>smtp.example.org</hostname><port>587</port><socketType>STARTTLS</socketType></outgoingServer>
+	</emailProvider></clientConfig>`
+	if _, err := parseAutoconfig([]byte(doc), "me@example.org"); err == nil || !strings.Contains(err.Error(), "IMAP") {
+		t.Errorf("Expected an error for IMAP without SSL/TLS, got %v", err)
+	}
+}
+
+func TestLoadAccountConfig_Providers(t *testing.T) {
+	prefix := "ACCOUNT_prov_"
+	os.Setenv(prefix+"PASSWORD", "secret")
+	defer os.Unsetenv(prefix + "PASSWORD")
+	defer os.Unsetenv(prefix + "EMAIL")
+	defer os.Unsetenv(prefix + "PROVIDER")
+
+	// The provider is inferred from well-known domains
+	os.Setenv(prefix+"EMAIL", "me@yahoo.com")
+	acct, err := loadAccountConfig("prov", t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to load account: %v", err)
+	}
+	if acct.Provider != "yahoo" || acct.IMAPServer != "imap.mail.yahoo.com" || acct.SMTPPort != 587 {
+		t.Errorf("Expected the yahoo preset, got %s %s:%d", acct.Provider, acct.SMTPServer, acct.SMTPPort)
+	}
+
+	// PROVIDER=auto discovers the servers
+	saved := discoverer
+	defer func() { discoverer = saved }()
+	discoverer = newTestDiscoverer(fakeTransport{"https://ispdb.test/v1.1/example.org": testAutoconfig}, fakeResolver{})
+	clear(discoveredServers)
+	os.Setenv(prefix+"EMAIL", "me@example.org")
+	os.Setenv(prefix+"PROVIDER", "auto")
+	acct, err = loadAccountConfig("prov", t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to load account: %v", err)
+	}
+	if acct.Provider != "custom" || acct.IMAPServer != "imap.example.org" || acct.IMAPPort != 993 {
+		t.Errorf("Expected discovered settings, got %s %s:%d", acct.Provider, acct.IMAPServer, acct.IMAPPort)
+	}
+
+	// Reloads reuse the servers found first instead of asking DNS again
+	discoverer = newTestDiscoverer(nil, fakeResolver{})
+	acct, err = loadAccountConfig("prov", t.TempDir())
+	if err != nil || acct.IMAPServer != "imap.example.org" {
+		t.Errorf("Expected the cached discovery result, got %+v (%v)", acct, err)
+	}
+
+	clear(discoveredServers)
+	if _, err := loadAccountConfig("prov", t.TempDir()); err == nil || !strings.Contains(err.Error(), prefix+"PROVIDER=auto") {
+		t.Errorf("Expected a discovery error, got %v", err)
+	}
+
+	// Proton Mail Bridge needs its certificate
+	os.Setenv(prefix+"EMAIL", "me@proton.me")
+	os.Setenv(prefix+"PROVIDER", "")
+	if _, err := loadAccountConfig("prov", t.TempDir()); err == nil || !strings.Contains(err.Error(), prefix+"TLS_CA_FILE") {
+		t.Errorf("Expected proton-bridge to require TLS_CA_FILE, got %v", err)
+	}
+	certFile := filepath.Join(t.TempDir(), "cert.pem")
+	os.WriteFile(certFile, []byte("pem"), 0600)
+	t.Setenv(prefix+"TLS_CA_FILE", certFile)
+	acct, err = loadAccountConfig("prov", t.TempDir())
+	if err != nil || acct.Provider != "proton-bridge" || acct.TLSCAFile != certFile {
+		t.Errorf("Expected the proton-bridge preset with its certificate, got %+v (%v)", acct, err)
+	}
+	if len(acct.AuthServIDs) != 0 {
+		t.Errorf("Expected no trusted authserv-ids for Proton Mail Bridge, got %v", acct.AuthServIDs)
+	}
+
+	// Gmail's Authentication-Results are trusted by default; others are configured
+	os.Setenv(prefix+"EMAIL", "me@gmail.com")
+	acct, err = loadAccountConfig("prov", t.TempDir())
+	if err != nil || len(acct.AuthServIDs) != 1 || acct.AuthServIDs[0] != "mx.google.com" {
+		t.Errorf("Expected Gmail's authserv-id, got %v (%v)", acct.AuthServIDs, err)
+	}
+	t.Setenv(prefix+"AUTHSERV_IDS", "MX.Example.org, relay.example.org")
+	acct, err = loadAccountConfig("prov", t.TempDir())
+	if err != nil || len(acct.AuthServIDs) != 2 || acct.AuthServIDs[0] != "mx.example.org" {
+		t.Errorf("Expected the configured authserv-ids, got %v (%v)", acct.AuthServIDs, err)
+	}
+}
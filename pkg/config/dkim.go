@@ -0,0 +1,80 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// DefaultDKIMHeaders are signed when {prefix}DKIM_HEADERS is not set. Only headers
+// present in a message are signed.
+var DefaultDKIMHeaders = []string{
+	"from", "reply-to", "to", "cc", "subject", "date", "message-id", "in-reply-to", "references",
+	"mime-version", "content-type", "content-transfer-encoding", "list-unsubscribe", "list-unsubscribe-post",
+}
+
+// DKIMSigning configures DKIM signing of outgoing mail. Signing is off when Selector is empty.
+type DKIMSigning struct {
+	Selector       string
+	Domain         string   // d= domain (default: the account's domain)
+	PrivateKeyFile string   // PEM-encoded RSA or Ed25519 private key
+	Headers        []string // Lower-cased header names to sign
+	HeaderCanon    string   // simple or relaxed
+	BodyCanon      string   // simple or relaxed
+}
+
+// Enabled reports whether outgoing mail is signed
+func (d DKIMSigning) Enabled() bool {
+	return d.Selector != ""
+}
+
+// loadDKIMSigning loads signing settings from {prefix}DKIM_* environment variables
+func loadDKIMSigning(prefix string, acct *AccountConfig) (DKIMSigning, error) {
+	d := DKIMSigning{
+		Selector:       strings.TrimSpace(getenv(prefix + "DKIM_SELECTOR")),
+		Domain:         strings.ToLower(strings.TrimSpace(getenv(prefix + "DKIM_DOMAIN"))),
+		PrivateKeyFile: getenv(prefix + "DKIM_PRIVATE_KEY_FILE"),
+		Headers:        splitList(getenv(prefix + "DKIM_HEADERS")),
+		HeaderCanon:    "relaxed",
+		BodyCanon:      "relaxed",
+	}
+	if !d.Enabled() {
+		return d, nil
+	}
+
+	if acct.Provider != "custom" {
+		return d, fmt.Errorf("%sDKIM_SELECTOR is only supported for custom provider accounts (%s signs mail itself)", prefix, acct.Provider)
+	}
+	if d.Domain == "" {
+		d.Domain = AddressDomain(acct.EmailAddress)
+	}
+	if d.PrivateKeyFile == "" {
+		return d, fmt.Errorf("%sDKIM_PRIVATE_KEY_FILE is required when %sDKIM_SELECTOR is set", prefix, prefix)
+	}
+	if _, err := os.Stat(d.PrivateKeyFile); err != nil {
+		return d, fmt.Errorf("failed to read %sDKIM_PRIVATE_KEY_FILE: %w", prefix, err)
+	}
+
+	if len(d.Headers) == 0 {
+		d.Headers = slices.Clone(DefaultDKIMHeaders)
+	} else if !slices.Contains(d.Headers, "from") {
+		return d, fmt.Errorf("invalid %sDKIM_HEADERS: the From header must be signed", prefix)
+	}
+
+	// Same form as the c= tag: header/body, where a missing body algorithm means simple
+	if canon := strings.ToLower(strings.TrimSpace(getenv(prefix + "DKIM_CANONICALIZATION"))); canon != "" {
+		header, body, found := strings.Cut(canon, "/")
+		if !found {
+			body = "simple"
+		}
+		for _, c := range []string{header, body} {
+			if c != "simple" && c != "relaxed" {
+				return d, fmt.Errorf("invalid %sDKIM_CANONICALIZATION: %s (use simple or relaxed, e.g. relaxed/simple)", prefix, canon)
+			}
+		}
+		d.HeaderCanon, d.BodyCanon = header, body
+	}
+
+	return d, nil
+}
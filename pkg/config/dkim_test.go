@@ -0,0 +1,59 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadDKIMSigning(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "dkim.pem")
+	if err := os.WriteFile(keyFile, []byte("key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	acct := &AccountConfig{EmailAddress: "me@Example.com", Provider: "custom"}
+
+	d, err := loadDKIMSigning("ACCOUNT_dk_", acct)
+	if err != nil || d.Enabled() {
+		t.Fatalf("Expected signing to be off by default, got %+v (%v)", d, err)
+	}
+
+	t.Setenv("ACCOUNT_dk_DKIM_SELECTOR", "mail2024")
+	t.Setenv("ACCOUNT_dk_DKIM_PRIVATE_KEY_FILE", keyFile)
+	d, err = loadDKIMSigning("ACCOUNT_dk_", acct)
+	if err != nil {
+		t.Fatalf("Failed to load DKIM settings: %v", err)
+	}
+	if d.Domain != "example.com" || d.HeaderCanon != "relaxed" || d.BodyCanon != "relaxed" || !reflect.DeepEqual(d.Headers, DefaultDKIMHeaders) {
+		t.Errorf("Unexpected defaults: %+v", d)
+	}
+
+	t.Setenv("ACCOUNT_dk_DKIM_DOMAIN", "mail.example.com")
+	t.Setenv("ACCOUNT_dk_DKIM_HEADERS", "From, Subject,Date")
+	t.Setenv("ACCOUNT_dk_DKIM_CANONICALIZATION", "relaxed")
+	d, err = loadDKIMSigning("ACCOUNT_dk_", acct)
+	if err != nil {
+		t.Fatalf("Failed to load DKIM settings: %v", err)
+	}
+	if d.Domain != "mail.example.com" || d.HeaderCanon != "relaxed" || d.BodyCanon != "simple" || !reflect.DeepEqual(d.Headers, []string{"from", "subject", "date"}) {
+		t.Errorf("Unexpected settings: %+v", d)
+	}
+
+	for name, value := range map[string]string{
+		"DKIM_CANONICALIZATION": "relaxed/loose",
+		"DKIM_HEADERS":          "subject,date",
+		"DKIM_PRIVATE_KEY_FILE": filepath.Join(t.TempDir(), "missing.pem"),
+	} {
+		old := os.Getenv("ACCOUNT_dk_" + name)
+		os.Setenv("ACCOUNT_dk_"+name, value)
+		if _, err := loadDKIMSigning("ACCOUNT_dk_", acct); err == nil {
+			t.Errorf("Expected error for %s=%s", name, value)
+		}
+		os.Setenv("ACCOUNT_dk_"+name, old)
+	}
+
+	if _, err := loadDKIMSigning("ACCOUNT_dk_", &AccountConfig{EmailAddress: "me@gmail.com", Provider: "gmail"}); err == nil {
+		t.Error("Expected error for DKIM signing on a gmail account")
+	}
+}
@@ -0,0 +1,73 @@
+package config
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/prasanthmj/email/pkg/securefs"
+)
+
+// loadEncryptionKey reads the at-rest encryption key from FILES_ENCRYPTION_KEY,
+// FILES_ENCRYPTION_KEY_FILE or the output of FILES_ENCRYPTION_KEY_CMD. It returns nil
+// when none is set.
+func loadEncryptionKey() ([]byte, error) {
+	value := getenv("FILES_ENCRYPTION_KEY")
+	file := getenv("FILES_ENCRYPTION_KEY_FILE")
+	command := getenv("FILES_ENCRYPTION_KEY_CMD")
+
+	set := 0
+	for _, v := range []string{value, file, command} {
+		if v != "" {
+			set++
+		}
+	}
+	if set == 0 {
+		return nil, nil
+	}
+	if set > 1 {
+		return nil, fmt.Errorf("only one of FILES_ENCRYPTION_KEY, FILES_ENCRYPTION_KEY_FILE and FILES_ENCRYPTION_KEY_CMD may be set")
+	}
+
+	source := "FILES_ENCRYPTION_KEY"
+	switch {
+	case file != "":
+		source = "FILES_ENCRYPTION_KEY_FILE"
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read FILES_ENCRYPTION_KEY_FILE: %w", err)
+		}
+		value = string(data)
+	case command != "":
+		source = "FILES_ENCRYPTION_KEY_CMD"
+		out, err := exec.Command("sh", "-c", command).Output()
+		if err != nil {
+			return nil, fmt.Errorf("failed to run FILES_ENCRYPTION_KEY_CMD: %w", err)
+		}
+		value = string(out)
+	}
+
+	key, err := parseEncryptionKey(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", source, err)
+	}
+	return key, nil
+}
+
+// parseEncryptionKey decodes a base64 or hex encoded 32-byte key
+func parseEncryptionKey(value string) ([]byte, error) {
+	value = strings.TrimSpace(value)
+	if len(value) == hex.EncodedLen(securefs.KeySize) {
+		if key, err := hex.DecodeString(value); err == nil {
+			return key, nil
+		}
+	}
+	key, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(key) != securefs.KeySize {
+		return nil, fmt.Errorf("expected %d bytes encoded as base64 or hex (generate one with: openssl rand -base64 32)", securefs.KeySize)
+	}
+	return key, nil
+}
@@ -0,0 +1,52 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadEncryptionKey(t *testing.T) {
+	if key, err := loadEncryptionKey(); err != nil || key != nil {
+		t.Fatalf("Expected no key by default, got %x (%v)", key, err)
+	}
+
+	want := bytes.Repeat([]byte{0xab}, 32)
+	t.Setenv("FILES_ENCRYPTION_KEY", "q6urq6urq6urq6urq6urq6urq6urq6urq6urq6urq6s=")
+	if key, err := loadEncryptionKey(); err != nil || !bytes.Equal(key, want) {
+		t.Errorf("Expected the base64 key, got %x (%v)", key, err)
+	}
+	t.Setenv("FILES_ENCRYPTION_KEY", "abababababababababababababababababababababababababababababababab")
+	if key, err := loadEncryptionKey(); err != nil || !bytes.Equal(key, want) {
+		t.Errorf("Expected the hex key, got %x (%v)", key, err)
+	}
+	t.Setenv("FILES_ENCRYPTION_KEY", "too-short")
+	if _, err := loadEncryptionKey(); err == nil {
+		t.Error("Expected an error for a short key")
+	}
+
+	keyFile := filepath.Join(t.TempDir(), "key")
+	if err := os.WriteFile(keyFile, []byte("abababababababababababababababababababababababababababababababab\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("FILES_ENCRYPTION_KEY_FILE", keyFile)
+	if _, err := loadEncryptionKey(); err == nil {
+		t.Error("Expected an error when several key sources are set")
+	}
+
+	t.Setenv("FILES_ENCRYPTION_KEY", "")
+	if key, err := loadEncryptionKey(); err != nil || !bytes.Equal(key, want) {
+		t.Errorf("Expected the key from the file, got %x (%v)", key, err)
+	}
+
+	t.Setenv("FILES_ENCRYPTION_KEY_FILE", "")
+	t.Setenv("FILES_ENCRYPTION_KEY_CMD", "cat "+keyFile)
+	if key, err := loadEncryptionKey(); err != nil || !bytes.Equal(key, want) {
+		t.Errorf("Expected the key from the command, got %x (%v)", key, err)
+	}
+	t.Setenv("FILES_ENCRYPTION_KEY_CMD", "exit 1")
+	if _, err := loadEncryptionKey(); err == nil {
+		t.Error("Expected an error for a failing command")
+	}
+}
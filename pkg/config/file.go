@@ -0,0 +1,547 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"github.com/pelletier/go-toml/v2/unstable"
+	"gopkg.in/yaml.v3"
+)
+
+// fileConfig is the structure of a -config file. Every setting stands for the environment
+// variable of the same name, which takes precedence when it is set.
+type fileConfig struct {
+	FilesRoot              string          `yaml:"files_root" toml:"files_root"`
+	FilesEncryptionKey     string          `yaml:"files_encryption_key" toml:"files_encryption_key"`
+	FilesEncryptionKeyFile string          `yaml:"files_encryption_key_file" toml:"files_encryption_key_file"`
+	FilesEncryptionKeyCmd  string          `yaml:"files_encryption_key_cmd" toml:"files_encryption_key_cmd"`
+	EmailCacheMaxSize      *int64          `yaml:"email_cache_max_size" toml:"email_cache_max_size"`
+	EmailMaxAttachmentSize *int64          `yaml:"email_max_attachment_size" toml:"email_max_attachment_size"`
+	OutboxPollSeconds      *int            `yaml:"outbox_poll_seconds" toml:"outbox_poll_seconds"`
+	OutboxMaxAttempts      *int            `yaml:"outbox_max_attempts" toml:"outbox_max_attempts"`
+	AuditLog               *bool           `yaml:"audit_log" toml:"audit_log"`
+	AuditMaxSize           *int64          `yaml:"audit_max_size" toml:"audit_max_size"`
+	AuditMaxFiles          *int            `yaml:"audit_max_files" toml:"audit_max_files"`
+	RateLimits             *fileRateLimits `yaml:"rate_limits" toml:"rate_limits"`
+	Mode                   string          `yaml:"mode" toml:"mode"`
+	EnabledTools           []string        `yaml:"enabled_tools" toml:"enabled_tools"`
+	DisabledTools          []string        `yaml:"disabled_tools" toml:"disabled_tools"`
+	ToolTimeoutSeconds     *int            `yaml:"tool_timeout_seconds" toml:"tool_timeout_seconds"`
+	ToolTimeouts           map[string]int  `yaml:"tool_timeouts" toml:"tool_timeouts"`
+	ContentSafety          *bool           `yaml:"content_safety" toml:"content_safety"`
+	VerifyDKIM             *bool           `yaml:"verify_dkim" toml:"verify_dkim"`
+	DefaultAccount         string          `yaml:"default_account" toml:"default_account"`
+	Accounts               []fileAccount   `yaml:"accounts" toml:"accounts"`
+}
+
+// fileAccount holds the ACCOUNT_{id}_* settings of one account
+type fileAccount struct {
+	ID                string          `yaml:"id" toml:"id"`
+	Email             string          `yaml:"email" toml:"email"`
+	Password          string          `yaml:"password" toml:"password"`
+	PasswordFile      string          `yaml:"password_file" toml:"password_file"`
+	PasswordCmd       string          `yaml:"password_cmd" toml:"password_cmd"`
+	Provider          string          `yaml:"provider" toml:"provider"`
+	IMAPServer        string          `yaml:"imap_server" toml:"imap_server"`
+	IMAPPort          *int            `yaml:"imap_port" toml:"imap_port"`
+	SMTPServer        string          `yaml:"smtp_server" toml:"smtp_server"`
+	SMTPPort          *int            `yaml:"smtp_port" toml:"smtp_port"`
+	TLSCAFile         string          `yaml:"tls_ca_file" toml:"tls_ca_file"`
+	TimeoutSeconds    *int            `yaml:"timeout_seconds" toml:"timeout_seconds"`
+	Mode              string          `yaml:"mode" toml:"mode"`
+	ContentSafety     *bool           `yaml:"content_safety" toml:"content_safety"`
+	VerifyDKIM        *bool           `yaml:"verify_dkim" toml:"verify_dkim"`
+	AuthServIDs       []string        `yaml:"authserv_ids" toml:"authserv_ids"`
+	Signature         string          `yaml:"signature" toml:"signature"`
+	SignatureHTML     string          `yaml:"signature_html" toml:"signature_html"`
+	SignatureFile     string          `yaml:"signature_file" toml:"signature_file"`
+	SignatureHTMLFile string          `yaml:"signature_html_file" toml:"signature_html_file"`
+	Identities        []fileIdentity  `yaml:"identities" toml:"identities"`
+	RateLimits        *fileRateLimits `yaml:"rate_limits" toml:"rate_limits"`
+	Policy            *filePolicy     `yaml:"policy" toml:"policy"`
+	DKIM              *fileDKIM       `yaml:"dkim" toml:"dkim"`
+	SMIME             *fileSMIME      `yaml:"smime" toml:"smime"`
+	PGP               *filePGP        `yaml:"pgp" toml:"pgp"`
+}
+
+type fileIdentity struct {
+	ID                string `yaml:"id" toml:"id"`
+	Address           string `yaml:"address" toml:"address"`
+	Name              string `yaml:"name" toml:"name"`
+	ReplyTo           string `yaml:"reply_to" toml:"reply_to"`
+	Signature         string `yaml:"signature" toml:"signature"`
+	SignatureHTML     string `yaml:"signature_html" toml:"signature_html"`
+	SignatureFile     string `yaml:"signature_file" toml:"signature_file"`
+	SignatureHTMLFile string `yaml:"signature_html_file" toml:"signature_html_file"`
+}
+
+type fileRateLimits struct {
+	PerMinute *int `yaml:"per_minute" toml:"per_minute"`
+	PerHour   *int `yaml:"per_hour" toml:"per_hour"`
+	PerDay    *int `yaml:"per_day" toml:"per_day"`
+}
+
+type filePolicy struct {
+	AllowedDomains     []string `yaml:"allowed_domains" toml:"allowed_domains"`
+	BlockedDomains     []string `yaml:"blocked_domains" toml:"blocked_domains"`
+	BlockedAttachments []string `yaml:"blocked_attachments" toml:"blocked_attachments"`
+	RequiredBCC        []string `yaml:"required_bcc" toml:"required_bcc"`
+	InternalDomains    []string `yaml:"internal_domains" toml:"internal_domains"`
+	MaxRecipients      *int     `yaml:"max_recipients" toml:"max_recipients"`
+	ConfirmExternal    *bool    `yaml:"confirm_external" toml:"confirm_external"`
+	ConfirmDelivery    string   `yaml:"confirm_delivery" toml:"confirm_delivery"`
+}
+
+type fileDKIM struct {
+	Selector         string   `yaml:"selector" toml:"selector"`
+	Domain           string   `yaml:"domain" toml:"domain"`
+	PrivateKeyFile   string   `yaml:"private_key_file" toml:"private_key_file"`
+	Headers          []string `yaml:"headers" toml:"headers"`
+	Canonicalization string   `yaml:"canonicalization" toml:"canonicalization"`
+}
+
+type fileSMIME struct {
+	CertFile  string `yaml:"cert_file" toml:"cert_file"`
+	KeyFile   string `yaml:"key_file" toml:"key_file"`
+	CertStore string `yaml:"cert_store" toml:"cert_store"`
+	CAFile    string `yaml:"ca_file" toml:"ca_file"`
+}
+
+type filePGP struct {
+	Keyring        string `yaml:"keyring" toml:"keyring"`
+	PrivateKeyFile string `yaml:"private_key_file" toml:"private_key_file"`
+	Passphrase     string `yaml:"passphrase" toml:"passphrase"`
+	PassphraseFile string `yaml:"passphrase_file" toml:"passphrase_file"`
+	PassphraseCmd  string `yaml:"passphrase_cmd" toml:"passphrase_cmd"`
+}
+
+// validID matches account and identity IDs, which become part of variable names
+var validID = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// fileSource is a parsed config file flattened to the environment variables it sets
+type fileSource struct {
+	path     string
+	values   map[string]string // Variable name -> value
+	keys     map[string]string // Variable name -> key path in the file
+	prefixes map[string]string // Account and identity variable prefix -> key path
+	lines    map[string]int    // Key path -> line number
+	accounts []string          // Account IDs in file order
+}
+
+// readConfigFile parses a YAML (.yaml, .yml) or TOML (.toml) config file
+func readConfigFile(path string) (*fileSource, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	src := &fileSource{
+		path:     path,
+		values:   make(map[string]string),
+		keys:     make(map[string]string),
+		prefixes: make(map[string]string),
+	}
+	var fc fileConfig
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = src.parseYAML(data, &fc)
+	case ".toml":
+		err = src.parseTOML(data, &fc)
+	default:
+		return nil, fmt.Errorf("unsupported config file %s: use .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := src.flatten(&fc); err != nil {
+		return nil, err
+	}
+	return src, nil
+}
+
+// parseYAML decodes data strictly and records the line of every key
+func (f *fileSource) parseYAML(data []byte, fc *fileConfig) error {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return f.yamlError(err)
+	}
+	f.lines = make(map[string]int)
+	if len(root.Content) > 0 {
+		indexYAML(root.Content[0], "", f.lines)
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(fc); err != nil && !errors.Is(err, io.EOF) {
+		return f.yamlError(err)
+	}
+	return nil
+}
+
+// indexYAML records the line of each mapping key and sequence item under path
+func indexYAML(node *yaml.Node, path string, lines map[string]int) {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := joinPath(path, node.Content[i].Value)
+			lines[key] = node.Content[i].Line
+			indexYAML(node.Content[i+1], key, lines)
+		}
+	case yaml.SequenceNode:
+		for i, item := range node.Content {
+			key := fmt.Sprintf("%s[%d]", path, i)
+			lines[key] = item.Line
+			indexYAML(item, key, lines)
+		}
+	}
+}
+
+// yamlLine matches the line prefix of yaml.v3 error messages
+var yamlLine = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+// yamlType matches the Go type names in yaml.v3 error messages
+var yamlType = regexp.MustCompile(` in type config\.\w+`)
+
+// yamlError rewrites yaml.v3 errors as path:line: message
+func (f *fileSource) yamlError(err error) error {
+	var messages []string
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		messages = typeErr.Errors
+	} else {
+		messages = []string{err.Error()}
+	}
+
+	var out []string
+	for _, msg := range messages {
+		msg = yamlType.ReplaceAllString(msg, "")
+		if m := yamlLine.FindStringSubmatch(msg); m != nil {
+			out = append(out, fmt.Sprintf("%s:%s: %s", f.path, m[1], m[2]))
+		} else {
+			out = append(out, fmt.Sprintf("%s: %s", f.path, strings.TrimPrefix(msg, "yaml: ")))
+		}
+	}
+	return errors.New(strings.Join(out, "\n"))
+}
+
+// parseTOML decodes data strictly and records the line of every key
+func (f *fileSource) parseTOML(data []byte, fc *fileConfig) error {
+	dec := toml.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(fc); err != nil {
+		return f.tomlError(err)
+	}
+	f.lines = indexTOML(data)
+	return nil
+}
+
+// indexTOML records the line of each key, table and array table element. Keys inside
+// inline tables and arrays share the line of the key they belong to.
+func indexTOML(data []byte) map[string]int {
+	lines := make(map[string]int)
+	counts := make(map[string]int) // Array table path -> elements so far
+	table := ""
+
+	p := unstable.Parser{}
+	p.Reset(data)
+	for p.NextExpression() {
+		expr := p.Expression()
+		switch expr.Kind {
+		case unstable.Table, unstable.ArrayTable:
+			table = ""
+			it := expr.Key()
+			var line int
+			for it.Next() {
+				node := it.Node()
+				if line == 0 {
+					line = p.Shape(node.Raw).Start.Line
+				}
+				table = joinPath(table, string(node.Data))
+				if n, ok := counts[table]; ok && (!it.IsLast() || expr.Kind == unstable.Table) {
+					table = fmt.Sprintf("%s[%d]", table, n-1)
+				}
+			}
+			if expr.Kind == unstable.ArrayTable {
+				n := counts[table]
+				counts[table] = n + 1
+				table = fmt.Sprintf("%s[%d]", table, n)
+			}
+			lines[table] = line
+		case unstable.KeyValue:
+			key := table
+			it := expr.Key()
+			var line int
+			for it.Next() {
+				node := it.Node()
+				if line == 0 {
+					line = p.Shape(node.Raw).Start.Line
+				}
+				key = joinPath(key, string(node.Data))
+			}
+			lines[key] = line
+		}
+	}
+	return lines
+}
+
+// tomlError rewrites go-toml errors as path:line: message
+func (f *fileSource) tomlError(err error) error {
+	var strict *toml.StrictMissingError
+	if errors.As(err, &strict) {
+		var out []string
+		for _, e := range strict.Errors {
+			line, _ := e.Position()
+			out = append(out, fmt.Sprintf("%s:%d: unknown setting %s", f.path, line, strings.Join(e.Key(), ".")))
+		}
+		return errors.New(strings.Join(out, "\n"))
+	}
+	var decodeErr *toml.DecodeError
+	if errors.As(err, &decodeErr) {
+		line, _ := decodeErr.Position()
+		return fmt.Errorf("%s:%d: %s", f.path, line, strings.TrimPrefix(decodeErr.Error(), "toml: "))
+	}
+	return fmt.Errorf("%s: %w", f.path, err)
+}
+
+// joinPath appends a key to a dotted path
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// line returns the line of a key path, falling back to its closest parent
+func (f *fileSource) line(path string) int {
+	for path != "" {
+		if line, ok := f.lines[path]; ok {
+			return line
+		}
+		cut := strings.LastIndexAny(path, ".[")
+		if cut < 0 {
+			break
+		}
+		path = path[:cut]
+	}
+	return 0
+}
+
+// errorf reports a problem at a key path
+func (f *fileSource) errorf(path, format string, args ...interface{}) error {
+	return fmt.Errorf("%s:%d: %s", f.path, f.line(path), fmt.Sprintf(format, args...))
+}
+
+// set records the variable a file setting stands for
+func (f *fileSource) set(name, path, value string) {
+	if value == "" {
+		return
+	}
+	f.values[name] = value
+	f.keys[name] = path
+}
+
+// setInt records an optional integer setting
+func (f *fileSource) setInt(name, path string, value *int) {
+	if value != nil {
+		f.set(name, path, strconv.Itoa(*value))
+	}
+}
+
+// setInt64 records an optional 64-bit integer setting
+func (f *fileSource) setInt64(name, path string, value *int64) {
+	if value != nil {
+		f.set(name, path, strconv.FormatInt(*value, 10))
+	}
+}
+
+// setBool records an optional boolean setting
+func (f *fileSource) setBool(name, path string, value *bool) {
+	if value != nil {
+		f.set(name, path, strconv.FormatBool(*value))
+	}
+}
+
+// setList records a list setting as a comma-separated value
+func (f *fileSource) setList(name, path string, values []string) {
+	f.set(name, path, strings.Join(values, ","))
+}
+
+// setMap records a map setting as comma-separated key=value pairs in key order
+func (f *fileSource) setMap(name, path string, values map[string]int) {
+	items := make([]string, 0, len(values))
+	for key, value := range values {
+		items = append(items, key+"="+strconv.Itoa(value))
+	}
+	sort.Strings(items)
+	f.setList(name, path, items)
+}
+
+// setRateLimits records the RATE_LIMIT_* settings under prefix
+func (f *fileSource) setRateLimits(prefix, path string, r *fileRateLimits) {
+	if r == nil {
+		return
+	}
+	f.setInt(prefix+"RATE_LIMIT_PER_MINUTE", path+".per_minute", r.PerMinute)
+	f.setInt(prefix+"RATE_LIMIT_PER_HOUR", path+".per_hour", r.PerHour)
+	f.setInt(prefix+"RATE_LIMIT_PER_DAY", path+".per_day", r.PerDay)
+}
+
+// setSignature records the SIGNATURE* settings under prefix
+func (f *fileSource) setSignature(prefix, path, plain, html, plainFile, htmlFile string) {
+	f.set(prefix+"SIGNATURE", path+".signature", plain)
+	f.set(prefix+"SIGNATURE_HTML", path+".signature_html", html)
+	f.set(prefix+"SIGNATURE_FILE", path+".signature_file", plainFile)
+	f.set(prefix+"SIGNATURE_HTML_FILE", path+".signature_html_file", htmlFile)
+}
+
+// flatten converts the file to the environment variables it stands for
+func (f *fileSource) flatten(fc *fileConfig) error {
+	f.set("FILES_ROOT", "files_root", fc.FilesRoot)
+	f.set("FILES_ENCRYPTION_KEY", "files_encryption_key", fc.FilesEncryptionKey)
+	f.set("FILES_ENCRYPTION_KEY_FILE", "files_encryption_key_file", fc.FilesEncryptionKeyFile)
+	f.set("FILES_ENCRYPTION_KEY_CMD", "files_encryption_key_cmd", fc.FilesEncryptionKeyCmd)
+	f.setInt64("EMAIL_CACHE_MAX_SIZE", "email_cache_max_size", fc.EmailCacheMaxSize)
+	f.setInt64("EMAIL_MAX_ATTACHMENT_SIZE", "email_max_attachment_size", fc.EmailMaxAttachmentSize)
+	f.setInt("OUTBOX_POLL_SECONDS", "outbox_poll_seconds", fc.OutboxPollSeconds)
+	f.setInt("OUTBOX_MAX_ATTEMPTS", "outbox_max_attempts", fc.OutboxMaxAttempts)
+	f.setBool("AUDIT_LOG", "audit_log", fc.AuditLog)
+	f.setInt64("AUDIT_MAX_SIZE", "audit_max_size", fc.AuditMaxSize)
+	f.setInt("AUDIT_MAX_FILES", "audit_max_files", fc.AuditMaxFiles)
+	f.setRateLimits("", "rate_limits", fc.RateLimits)
+	f.set("MODE", "mode", fc.Mode)
+	f.setList("ENABLED_TOOLS", "enabled_tools", fc.EnabledTools)
+	f.setList("DISABLED_TOOLS", "disabled_tools", fc.DisabledTools)
+	f.setInt("TOOL_TIMEOUT_SECONDS", "tool_timeout_seconds", fc.ToolTimeoutSeconds)
+	f.setMap("TOOL_TIMEOUTS", "tool_timeouts", fc.ToolTimeouts)
+	f.setBool("CONTENT_SAFETY", "content_safety", fc.ContentSafety)
+	f.setBool("VERIFY_DKIM", "verify_dkim", fc.VerifyDKIM)
+	f.set("DEFAULT_ACCOUNT_ID", "default_account", fc.DefaultAccount)
+
+	seen := make(map[string]bool)
+	for i, a := range fc.Accounts {
+		path := fmt.Sprintf("accounts[%d]", i)
+		if !validID.MatchString(a.ID) {
+			return f.errorf(path, "account id %q must be non-empty and contain only letters, digits, '_' and '-'", a.ID)
+		}
+		if seen[a.ID] {
+			return f.errorf(path+".id", "duplicate account id %s", a.ID)
+		}
+		seen[a.ID] = true
+		if a.Email == "" {
+			return f.errorf(path, "account %s: email is required", a.ID)
+		}
+		f.accounts = append(f.accounts, a.ID)
+
+		prefix := "ACCOUNT_" + a.ID + "_"
+		f.prefixes[prefix] = path
+		f.set(prefix+"EMAIL", path+".email", a.Email)
+		f.set(prefix+"PASSWORD", path+".password", a.Password)
+		f.set(prefix+"PASSWORD_FILE", path+".password_file", a.PasswordFile)
+		f.set(prefix+"PASSWORD_CMD", path+".password_cmd", a.PasswordCmd)
+		f.set(prefix+"PROVIDER", path+".provider", a.Provider)
+		f.set(prefix+"IMAP_SERVER", path+".imap_server", a.IMAPServer)
+		f.setInt(prefix+"IMAP_PORT", path+".imap_port", a.IMAPPort)
+		f.set(prefix+"SMTP_SERVER", path+".smtp_server", a.SMTPServer)
+		f.setInt(prefix+"SMTP_PORT", path+".smtp_port", a.SMTPPort)
+		f.set(prefix+"TLS_CA_FILE", path+".tls_ca_file", a.TLSCAFile)
+		f.setInt(prefix+"TIMEOUT_SECONDS", path+".timeout_seconds", a.TimeoutSeconds)
+		f.set(prefix+"MODE", path+".mode", a.Mode)
+		f.setBool(prefix+"CONTENT_SAFETY", path+".content_safety", a.ContentSafety)
+		f.setBool(prefix+"VERIFY_DKIM", path+".verify_dkim", a.VerifyDKIM)
+		f.setList(prefix+"AUTHSERV_IDS", path+".authserv_ids", a.AuthServIDs)
+		f.setSignature(prefix, path, a.Signature, a.SignatureHTML, a.SignatureFile, a.SignatureHTMLFile)
+		f.setRateLimits(prefix, path+".rate_limits", a.RateLimits)
+
+		var identityIDs []string
+		for j, identity := range a.Identities {
+			idPath := fmt.Sprintf("%s.identities[%d]", path, j)
+			if !validID.MatchString(identity.ID) {
+				return f.errorf(idPath, "identity id %q must be non-empty and contain only letters, digits, '_' and '-'", identity.ID)
+			}
+			identityIDs = append(identityIDs, identity.ID)
+			idPrefix := prefix + "IDENTITY_" + identity.ID + "_"
+			f.prefixes[idPrefix] = idPath
+			f.set(idPrefix+"ADDRESS", idPath+".address", identity.Address)
+			f.set(idPrefix+"NAME", idPath+".name", identity.Name)
+			f.set(idPrefix+"REPLY_TO", idPath+".reply_to", identity.ReplyTo)
+			f.setSignature(idPrefix, idPath, identity.Signature, identity.SignatureHTML, identity.SignatureFile, identity.SignatureHTMLFile)
+		}
+		f.setList(prefix+"IDENTITIES", path+".identities", identityIDs)
+
+		if p := a.Policy; p != nil {
+			pp := path + ".policy"
+			f.setList(prefix+"POLICY_ALLOWED_DOMAINS", pp+".allowed_domains", p.AllowedDomains)
+			f.setList(prefix+"POLICY_BLOCKED_DOMAINS", pp+".blocked_domains", p.BlockedDomains)
+			f.setList(prefix+"POLICY_BLOCKED_ATTACHMENTS", pp+".blocked_attachments", p.BlockedAttachments)
+			f.setList(prefix+"POLICY_REQUIRED_BCC", pp+".required_bcc", p.RequiredBCC)
+			f.setList(prefix+"POLICY_INTERNAL_DOMAINS", pp+".internal_domains", p.InternalDomains)
+			f.setInt(prefix+"POLICY_MAX_RECIPIENTS", pp+".max_recipients", p.MaxRecipients)
+			f.setBool(prefix+"POLICY_CONFIRM_EXTERNAL", pp+".confirm_external", p.ConfirmExternal)
+			f.set(prefix+"POLICY_CONFIRM_DELIVERY", pp+".confirm_delivery", p.ConfirmDelivery)
+		}
+		if d := a.DKIM; d != nil {
+			dp := path + ".dkim"
+			f.set(prefix+"DKIM_SELECTOR", dp+".selector", d.Selector)
+			f.set(prefix+"DKIM_DOMAIN", dp+".domain", d.Domain)
+			f.set(prefix+"DKIM_PRIVATE_KEY_FILE", dp+".private_key_file", d.PrivateKeyFile)
+			f.setList(prefix+"DKIM_HEADERS", dp+".headers", d.Headers)
+			f.set(prefix+"DKIM_CANONICALIZATION", dp+".canonicalization", d.Canonicalization)
+		}
+		if s := a.SMIME; s != nil {
+			sp := path + ".smime"
+			f.set(prefix+"SMIME_CERT_FILE", sp+".cert_file", s.CertFile)
+			f.set(prefix+"SMIME_KEY_FILE", sp+".key_file", s.KeyFile)
+			f.set(prefix+"SMIME_CERT_STORE", sp+".cert_store", s.CertStore)
+			f.set(prefix+"SMIME_CA_FILE", sp+".ca_file", s.CAFile)
+		}
+		if p := a.PGP; p != nil {
+			pp := path + ".pgp"
+			f.set(prefix+"PGP_KEYRING", pp+".keyring", p.Keyring)
+			f.set(prefix+"PGP_PRIVATE_KEY_FILE", pp+".private_key_file", p.PrivateKeyFile)
+			f.set(prefix+"PGP_PASSPHRASE", pp+".passphrase", p.Passphrase)
+			f.set(prefix+"PGP_PASSPHRASE_FILE", pp+".passphrase_file", p.PassphraseFile)
+			f.set(prefix+"PGP_PASSPHRASE_CMD", pp+".passphrase_cmd", p.PassphraseCmd)
+		}
+	}
+	return nil
+}
+
+// annotate prefixes a load error with the file line of the setting it is about. Errors
+// about settings overridden by the environment are returned unchanged.
+func (f *fileSource) annotate(err error) error {
+	msg := err.Error()
+
+	// Prefer the longest variable name, so ACCOUNT_a_SMTP_PORT wins over ACCOUNT_a_SMTP
+	names := make([]string, 0, len(f.keys)+len(f.prefixes))
+	for name := range f.keys {
+		names = append(names, name)
+	}
+	for prefix := range f.prefixes {
+		names = append(names, prefix)
+	}
+	sort.Slice(names, func(i, j int) bool { return len(names[i]) > len(names[j]) })
+
+	for _, name := range names {
+		if !strings.Contains(msg, name) {
+			continue
+		}
+		if path, ok := f.keys[name]; ok {
+			if os.Getenv(name) != "" {
+				return err
+			}
+			return fmt.Errorf("%s:%d: %w", f.path, f.line(path), err)
+		}
+		return fmt.Errorf("%s:%d: %w", f.path, f.line(f.prefixes[name]), err)
+	}
+	return err
+}
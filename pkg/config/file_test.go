@@ -0,0 +1,161 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeConfigFile writes a config file into a temporary directory that also serves as
+// FILES_ROOT
+func writeConfigFile(t *testing.T, name, content string) string {
+	t.Helper()
+	dir := t.TempDir()
+	path := filepath.Join(dir, name)
+	content = strings.ReplaceAll(content, "$ROOT", filepath.Join(dir, "data"))
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	useTestVault(t)
+	return path
+}
+
+const yamlConfig = `files_root: $ROOT
+mode: drafts_only
+rate_limits:
+  per_day: 1000
+accounts:
+  - id: work
+    email: work@example.com
+    password: secret
+    provider: custom
+    imap_server: imap.example.com
+    imap_port: 993
+    smtp_server: smtp.example.com
+    smtp_port: 587
+    identities:
+      - id: support
+        address: support@example.com
+        name: Support Team
+    policy:
+      allowed_domains: [example.com, example.org]
+      max_recipients: 10
+  - id: home
+    email: me@example.net
+    password_cmd: echo home-secret
+`
+
+func TestLoadConfigFileYAML(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", yamlConfig)
+
+	cfg, err := LoadConfigFile(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.ConfigFile != path || cfg.Mode != ModeDraftsOnly || cfg.GlobalRateLimits.PerDay != 1000 {
+		t.Errorf("Unexpected global settings: %+v", cfg)
+	}
+	if cfg.DefaultAccountID != "work" || len(cfg.Accounts) != 2 {
+		t.Fatalf("Expected two accounts with work as default, got %d (%s)", len(cfg.Accounts), cfg.DefaultAccountID)
+	}
+
+	work := cfg.Accounts["work"]
+	if work.SMTPServer != "smtp.example.com" || work.SMTPPort != 587 || work.Mode != ModeDraftsOnly {
+		t.Errorf("Unexpected account settings: %+v", work)
+	}
+	if len(work.Identities) != 1 || work.Identities[0].DisplayName != "Support Team" {
+		t.Errorf("Unexpected identities: %+v", work.Identities)
+	}
+	if strings.Join(work.Policy.AllowedDomains, ",") != "example.com,example.org" || work.Policy.MaxRecipients != 10 {
+		t.Errorf("Unexpected policy: %+v", work.Policy)
+	}
+	if password, err := cfg.Accounts["home"].EmailPassword.Value(); err != nil || password != "home-secret" {
+		t.Errorf("Expected the password from the command, got %q (%v)", password, err)
+	}
+}
+
+func TestLoadConfigFileEnvOverride(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", yamlConfig)
+	t.Setenv("ACCOUNT_work_SMTP_PORT", "2525")
+	t.Setenv("DEFAULT_ACCOUNT_ID", "home")
+
+	cfg, err := LoadConfigFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Accounts["work"].SMTPPort != 2525 || cfg.DefaultAccountID != "home" {
+		t.Errorf("Expected environment variables to override the file, got port %d and default %s", cfg.Accounts["work"].SMTPPort, cfg.DefaultAccountID)
+	}
+
+	// An invalid override is reported without a file location
+	t.Setenv("ACCOUNT_work_SMTP_PORT", "abc")
+	if _, err := LoadConfigFile(path); err == nil || strings.HasPrefix(err.Error(), path) {
+		t.Errorf("Expected an unannotated error, got %v", err)
+	}
+}
+
+func TestLoadConfigFileTOML(t *testing.T) {
+	path := writeConfigFile(t, "config.toml", `files_root = "$ROOT"
+default_account = "home"
+
+[[accounts]]
+id = "work"
+email = "work@example.com"
+password = "secret"
+
+[accounts.dkim]
+selector = "mail"
+
+[[accounts]]
+id = "home"
+email = "me@example.net"
+password = "secret"
+rate_limits = { per_hour = 5 }
+`)
+
+	// DKIM signing needs a custom provider, so the error points at the selector
+	_, err := LoadConfigFile(path)
+	if err == nil || !strings.HasPrefix(err.Error(), path+":10: ") {
+		t.Fatalf("Expected an error at line 10, got %v", err)
+	}
+
+	data, _ := os.ReadFile(path)
+	os.WriteFile(path, []byte(strings.Replace(string(data), "[accounts.dkim]\nselector = \"mail\"\n", "", 1)), 0600)
+	cfg, err := LoadConfigFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.DefaultAccountID != "home" || cfg.Accounts["home"].RateLimits.PerHour != 5 {
+		t.Errorf("Unexpected settings: default %s, limits %+v", cfg.DefaultAccountID, cfg.Accounts["home"].RateLimits)
+	}
+}
+
+func TestLoadConfigFileErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    string
+	}{
+		{"unknown key", "c.yaml", "files_root: $ROOT\naccounts:\n  - id: a\n    email: a@example.com\n    pasword: x\n", ":5: field pasword not found"},
+		{"wrong type", "c.yaml", "files_root: $ROOT\naudit_max_files: many\n", ":2: cannot unmarshal"},
+		{"syntax", "c.yaml", "files_root: $ROOT\naccounts: [\n", ":2: did not find expected node content"},
+		{"invalid value", "c.yaml", "files_root: $ROOT\naccounts:\n  - id: a\n    email: a@example.com\n    password: x\n    mode: everything\n", ":6: failed to load account a: invalid ACCOUNT_a_MODE"},
+		{"missing password", "c.yaml", "files_root: $ROOT\naccounts:\n  - id: a\n    email: a@example.com\n", ":3: failed to load account a: missing ACCOUNT_a_PASSWORD"},
+		{"duplicate id", "c.yaml", "files_root: $ROOT\naccounts:\n  - id: a\n    email: a@example.com\n  - id: a\n    email: b@example.com\n", ":5: duplicate account id a"},
+		{"bad id", "c.yaml", "files_root: $ROOT\naccounts:\n  - id: a b\n    email: a@example.com\n", ":3: account id"},
+		{"toml unknown key", "c.toml", "files_root = \"$ROOT\"\n\n[[accounts]]\nid = \"a\"\nemial = \"a@example.com\"\n", ":5: unknown setting accounts.emial"},
+		{"toml wrong type", "c.toml", "files_root = \"$ROOT\"\noutbox_max_attempts = \"8\"\n", ":2: "},
+		{"extension", "c.json", "{}", "unsupported config file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeConfigFile(t, tt.file, tt.content)
+			_, err := LoadConfigFile(path)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Expected an error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
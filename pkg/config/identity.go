@@ -0,0 +1,105 @@
+package config
+
+import (
+	"fmt"
+	"net/mail"
+	"strings"
+)
+
+// Identity is an additional verified sender address (alias) of an account
+type Identity struct {
+	ID            string
+	EmailAddress  string
+	DisplayName   string
+	Signature     string
+	SignatureHTML string
+	ReplyTo       string
+}
+
+// loadIdentities loads sender identities from environment variables:
+// ACCOUNT_{id}_IDENTITIES lists identity names, and each identity is configured with
+// ACCOUNT_{id}_IDENTITY_{name}_ADDRESS, _NAME, _REPLY_TO and the signature settings.
+func loadIdentities(prefix string) ([]Identity, error) {
+	list := getenv(prefix + "IDENTITIES")
+	if list == "" {
+		return nil, nil
+	}
+
+	var identities []Identity
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if seen[strings.ToUpper(name)] {
+			return nil, fmt.Errorf("duplicate identity %s in %sIDENTITIES", name, prefix)
+		}
+		seen[strings.ToUpper(name)] = true
+
+		idPrefix := prefix + "IDENTITY_" + name + "_"
+		identity := Identity{
+			ID:           name,
+			EmailAddress: getenv(idPrefix + "ADDRESS"),
+			DisplayName:  getenv(idPrefix + "NAME"),
+			ReplyTo:      getenv(idPrefix + "REPLY_TO"),
+		}
+		signature, signatureHTML, err := loadSignature(idPrefix)
+		if err != nil {
+			return nil, err
+		}
+		identity.Signature = signature
+		identity.SignatureHTML = signatureHTML
+		if identity.EmailAddress == "" {
+			return nil, fmt.Errorf("missing %sADDRESS", idPrefix)
+		}
+		if _, err := mail.ParseAddress(identity.EmailAddress); err != nil {
+			return nil, fmt.Errorf("invalid %sADDRESS: %w", idPrefix, err)
+		}
+		if identity.ReplyTo != "" {
+			if _, err := mail.ParseAddress(identity.ReplyTo); err != nil {
+				return nil, fmt.Errorf("invalid %sREPLY_TO: %w", idPrefix, err)
+			}
+		}
+		if strings.ContainsAny(identity.DisplayName, "\r\n") {
+			return nil, fmt.Errorf("%sNAME must not contain line breaks", idPrefix)
+		}
+		identities = append(identities, identity)
+	}
+
+	return identities, nil
+}
+
+// FindIdentity returns the identity matching an identity ID or email address.
+// It returns nil when name is empty or refers to the account's primary address.
+func (a *AccountConfig) FindIdentity(name string) (*Identity, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || strings.EqualFold(name, a.EmailAddress) {
+		return nil, nil
+	}
+	for i := range a.Identities {
+		if strings.EqualFold(a.Identities[i].ID, name) || strings.EqualFold(a.Identities[i].EmailAddress, name) {
+			return &a.Identities[i], nil
+		}
+	}
+	return nil, fmt.Errorf("identity %s not found for account %s", name, a.AccountID)
+}
+
+// MatchIdentity returns the first identity whose address appears in addrs, or nil
+func (a *AccountConfig) MatchIdentity(addrs []string) *Identity {
+	for _, raw := range addrs {
+		address := strings.TrimSpace(raw)
+		if parsed, err := mail.ParseAddress(raw); err == nil {
+			address = parsed.Address
+		}
+		if strings.EqualFold(address, a.EmailAddress) {
+			return nil
+		}
+		for i := range a.Identities {
+			if strings.EqualFold(a.Identities[i].EmailAddress, address) {
+				return &a.Identities[i]
+			}
+		}
+	}
+	return nil
+}
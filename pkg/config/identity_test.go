@@ -0,0 +1,103 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadIdentities(t *testing.T) {
+	t.Setenv("ACCOUNT_Work_IDENTITIES", "support, billing")
+	t.Setenv("ACCOUNT_Work_IDENTITY_support_ADDRESS", "support@example.com")
+	t.Setenv("ACCOUNT_Work_IDENTITY_support_NAME", "Example Support")
+	t.Setenv("ACCOUNT_Work_IDENTITY_support_SIGNATURE", `Thanks,\nSupport`)
+	t.Setenv("ACCOUNT_Work_IDENTITY_support_REPLY_TO", "helpdesk@example.com")
+	t.Setenv("ACCOUNT_Work_IDENTITY_billing_ADDRESS", "billing@example.com")
+
+	identities, err := loadIdentities("ACCOUNT_Work_")
+	if err != nil {
+		t.Fatalf("Failed to load identities: %v", err)
+	}
+	if len(identities) != 2 {
+		t.Fatalf("Expected 2 identities, got %d", len(identities))
+	}
+	if identities[0].DisplayName != "Example Support" || identities[0].ReplyTo != "helpdesk@example.com" {
+		t.Errorf("Unexpected identity: %+v", identities[0])
+	}
+	if identities[0].Signature != "Thanks,\nSupport" {
+		t.Errorf("Expected escaped newline in signature, got %q", identities[0].Signature)
+	}
+
+	// Missing address is an error
+	t.Setenv("ACCOUNT_Work_IDENTITIES", "support,sales")
+	if _, err := loadIdentities("ACCOUNT_Work_"); err == nil {
+		t.Error("Expected error for identity without address")
+	}
+}
+
+func TestFindAndMatchIdentity(t *testing.T) {
+	acct := &AccountConfig{
+		AccountID:    "Work",
+		EmailAddress: "me@example.com",
+		Identities: []Identity{
+			{ID: "support", EmailAddress: "support@example.com"},
+			{ID: "billing", EmailAddress: "billing@example.com"},
+		},
+	}
+
+	if id, err := acct.FindIdentity("SUPPORT"); err != nil || id == nil || id.ID != "support" {
+		t.Errorf("Expected support identity by ID, got %v, %v", id, err)
+	}
+	if id, err := acct.FindIdentity("billing@example.com"); err != nil || id == nil || id.ID != "billing" {
+		t.Errorf("Expected billing identity by address, got %v, %v", id, err)
+	}
+	if id, err := acct.FindIdentity("me@example.com"); err != nil || id != nil {
+		t.Errorf("Primary address should resolve to no identity, got %v, %v", id, err)
+	}
+	if _, err := acct.FindIdentity("sales"); err == nil {
+		t.Error("Expected error for unknown identity")
+	}
+
+	if id := acct.MatchIdentity([]string{"Someone <other@example.org>", "Billing <billing@example.com>"}); id == nil || id.ID != "billing" {
+		t.Errorf("Expected billing identity from recipients, got %v", id)
+	}
+	if id := acct.MatchIdentity([]string{"me@example.com", "support@example.com"}); id != nil {
+		t.Errorf("Primary address listed first should win, got %v", id)
+	}
+}
+
+func TestSignatureFor(t *testing.T) {
+	dir := t.TempDir()
+	htmlFile := filepath.Join(dir, "footer.html")
+	os.WriteFile(htmlFile, []byte("<p>Legal footer</p>\n"), 0644)
+
+	t.Setenv("ACCOUNT_Work_SIGNATURE", `Jane\nAcme`)
+	t.Setenv("ACCOUNT_Work_SIGNATURE_HTML_FILE", htmlFile)
+
+	plain, html, err := loadSignature("ACCOUNT_Work_")
+	if err != nil {
+		t.Fatalf("Failed to load signature: %v", err)
+	}
+	if plain != "Jane\nAcme" || html != "<p>Legal footer</p>" {
+		t.Errorf("Unexpected signature: %q %q", plain, html)
+	}
+
+	acct := &AccountConfig{
+		EmailAddress:  "me@example.com",
+		Signature:     plain,
+		SignatureHTML: html,
+		Identities: []Identity{
+			{ID: "support", EmailAddress: "support@example.com", Signature: "Support Team"},
+			{ID: "billing", EmailAddress: "billing@example.com"},
+		},
+	}
+	if p, h := acct.SignatureFor("support"); p != "Support Team" || h != "" {
+		t.Errorf("Expected identity signature, got %q %q", p, h)
+	}
+	if p, _ := acct.SignatureFor("billing"); p != "Jane\nAcme" {
+		t.Errorf("Identity without signature should fall back to account, got %q", p)
+	}
+	if p, _ := acct.SignatureFor(""); p != "Jane\nAcme" {
+		t.Errorf("Expected account signature, got %q", p)
+	}
+}
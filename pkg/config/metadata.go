@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"time"
 
+	"github.com/prasanthmj/email/pkg/securefs"
 	"gopkg.in/yaml.v3"
 )
 
@@ -50,7 +51,7 @@ func WriteAccountMetadata(metadataPath, accountID, emailAddress string) error {
 	}
 
 	// Write to file
-	if err := os.WriteFile(metadataPath, data, 0644); err != nil {
+	if err := securefs.WriteFile(metadataPath, data); err != nil {
 		return fmt.Errorf("failed to write metadata: %w", err)
 	}
 
@@ -59,7 +60,7 @@ func WriteAccountMetadata(metadataPath, accountID, emailAddress string) error {
 
 // ReadAccountMetadata reads account metadata from disk
 func ReadAccountMetadata(metadataPath string) (*AccountMetadata, error) {
-	data, err := os.ReadFile(metadataPath)
+	data, err := securefs.ReadFile(metadataPath)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return nil, fmt.Errorf("metadata file not found: %w", err)
@@ -0,0 +1,60 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Server and account modes, from most to least restrictive
+const (
+	ModeReadOnly   = "read_only"   // Read mail only; no drafts, templates or sending
+	ModeDraftsOnly = "drafts_only" // Read mail and manage drafts and templates; no sending
+	ModeFull       = "full"        // All tools
+)
+
+// modeRank orders modes by what they permit
+var modeRank = map[string]int{
+	ModeReadOnly:   0,
+	ModeDraftsOnly: 1,
+	ModeFull:       2,
+}
+
+// parseMode validates a MODE setting, returning ModeFull when it is empty
+func parseMode(name, value string) (string, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "" {
+		return ModeFull, nil
+	}
+	if _, ok := modeRank[value]; !ok {
+		return "", fmt.Errorf("invalid %s: %s (must be read_only, drafts_only or full)", name, value)
+	}
+	return value, nil
+}
+
+// StricterMode returns the more restrictive of two modes
+func StricterMode(a, b string) string {
+	if modeRank[a] <= modeRank[b] {
+		return a
+	}
+	return b
+}
+
+// ModeAllows reports whether mode permits tools that need the required mode
+func ModeAllows(mode, required string) bool {
+	return modeRank[mode] >= modeRank[required]
+}
+
+// loadToolFilter reads the ENABLED_TOOLS and DISABLED_TOOLS lists
+func loadToolFilter() (enabled, disabled map[string]bool) {
+	toSet := func(value string) map[string]bool {
+		set := make(map[string]bool)
+		for _, name := range splitList(getenv(value)) {
+			set[name] = true
+		}
+		if len(set) == 0 {
+			return nil
+		}
+		return set
+	}
+	return toSet("ENABLED_TOOLS"), toSet("DISABLED_TOOLS")
+}
@@ -0,0 +1,77 @@
+package config
+
+import (
+	"os"
+	"testing"
+)
+
+func TestModes(t *testing.T) {
+	if mode, err := parseMode("MODE", ""); err != nil || mode != ModeFull {
+		t.Errorf("Expected empty mode to default to full, got %q (%v)", mode, err)
+	}
+	if mode, err := parseMode("MODE", " Read_Only "); err != nil || mode != ModeReadOnly {
+		t.Errorf("Expected read_only, got %q (%v)", mode, err)
+	}
+	if _, err := parseMode("MODE", "readonly"); err == nil {
+		t.Error("Expected error for invalid mode")
+	}
+
+	if got := StricterMode(ModeFull, ModeDraftsOnly); got != ModeDraftsOnly {
+		t.Errorf("Expected drafts_only, got %s", got)
+	}
+	if got := StricterMode(ModeReadOnly, ModeFull); got != ModeReadOnly {
+		t.Errorf("Expected read_only, got %s", got)
+	}
+
+	if !ModeAllows(ModeDraftsOnly, ModeReadOnly) {
+		t.Error("Expected drafts_only to allow read tools")
+	}
+	if ModeAllows(ModeDraftsOnly, ModeFull) {
+		t.Error("Expected drafts_only to reject send tools")
+	}
+}
+
+func TestLoadModeConfig(t *testing.T) {
+	os.Setenv("ACCOUNT_modetest_EMAIL", "test@gmail.com")
+	os.Setenv("ACCOUNT_modetest_PASSWORD", "test-password")
+	os.Setenv("ACCOUNT_modetest_MODE", "full")
+	os.Setenv("MODE", "drafts_only")
+	os.Setenv("DISABLED_TOOLS", "mail_merge, send_invite")
+	defer os.Unsetenv("ACCOUNT_modetest_EMAIL")
+	defer os.Unsetenv("ACCOUNT_modetest_PASSWORD")
+	defer os.Unsetenv("ACCOUNT_modetest_MODE")
+	defer os.Unsetenv("MODE")
+	defer os.Unsetenv("DISABLED_TOOLS")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.Mode != ModeDraftsOnly {
+		t.Errorf("Expected server mode drafts_only, got %s", cfg.Mode)
+	}
+	// An account cannot be less restricted than the server
+	if mode := cfg.Accounts["modetest"].Mode; mode != ModeDraftsOnly {
+		t.Errorf("Expected account mode drafts_only, got %s", mode)
+	}
+	if cfg.EnabledTools != nil {
+		t.Errorf("Expected no enabled tool list, got %v", cfg.EnabledTools)
+	}
+	if !cfg.DisabledTools["mail_merge"] || !cfg.DisabledTools["send_invite"] {
+		t.Errorf("Expected disabled tools to be parsed, got %v", cfg.DisabledTools)
+	}
+
+	os.Setenv("ACCOUNT_modetest_MODE", "read_only")
+	cfg, err = LoadConfig()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if mode := cfg.Accounts["modetest"].Mode; mode != ModeReadOnly {
+		t.Errorf("Expected account mode read_only, got %s", mode)
+	}
+
+	os.Setenv("MODE", "send_only")
+	if _, err := LoadConfig(); err == nil {
+		t.Error("Expected error for invalid MODE")
+	}
+}
@@ -0,0 +1,48 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// PGP configures OpenPGP for an account. Sending signed or encrypted mail needs
+// PrivateKeyFile; the keyring is always available for importing recipient keys.
+type PGP struct {
+	Keyring        string  // Directory of public keys (armored or binary)
+	PrivateKeyFile string  // Armored or binary secret key of the account
+	Passphrase     *Secret // Unlocks PrivateKeyFile if it is protected; nil if not configured
+}
+
+// Enabled reports whether the account has an OpenPGP secret key
+func (p PGP) Enabled() bool {
+	return p.PrivateKeyFile != ""
+}
+
+// loadPGP loads OpenPGP settings from {prefix}PGP_* environment variables. The
+// passphrase comes from {prefix}PGP_PASSPHRASE, its _FILE and _CMD variants, or the
+// vault entry {accountID}.pgp. The keyring defaults to {accountRoot}/pgp.
+func loadPGP(prefix, accountID, accountRoot string) (PGP, error) {
+	p := PGP{
+		Keyring:        getenv(prefix + "PGP_KEYRING"),
+		PrivateKeyFile: getenv(prefix + "PGP_PRIVATE_KEY_FILE"),
+	}
+	if p.Enabled() {
+		if _, err := os.Stat(p.PrivateKeyFile); err != nil {
+			return p, fmt.Errorf("failed to read %sPGP_PRIVATE_KEY_FILE: %w", prefix, err)
+		}
+		passphrase, err := loadSecret(prefix + "PGP_PASSPHRASE")
+		if err == nil && passphrase == nil {
+			passphrase, err = vaultSecret(accountID + ".pgp")
+		}
+		if err != nil {
+			return p, err
+		}
+		p.Passphrase = passphrase
+	}
+
+	if p.Keyring == "" {
+		p.Keyring = filepath.Join(accountRoot, "pgp")
+	}
+	return p, nil
+}
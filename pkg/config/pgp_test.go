@@ -0,0 +1,83 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadPGP(t *testing.T) {
+	root := t.TempDir()
+	vault := useTestVault(t)
+
+	p, err := loadPGP("ACCOUNT_pg_", "pg", root)
+	if err != nil || p.Enabled() {
+		t.Fatalf("Expected PGP to be off by default, got %+v (%v)", p, err)
+	}
+	if p.Keyring != filepath.Join(root, "pgp") {
+		t.Errorf("Expected the default keyring, got %s", p.Keyring)
+	}
+
+	t.Setenv("ACCOUNT_pg_PGP_PRIVATE_KEY_FILE", filepath.Join(root, "missing.asc"))
+	if _, err := loadPGP("ACCOUNT_pg_", "pg", root); err == nil {
+		t.Error("Expected an error for a missing private key file")
+	}
+
+	keyFile := filepath.Join(root, "me.asc")
+	if err := os.WriteFile(keyFile, []byte("key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("ACCOUNT_pg_PGP_PRIVATE_KEY_FILE", keyFile)
+	t.Setenv("ACCOUNT_pg_PGP_PASSPHRASE", "secret")
+	t.Setenv("ACCOUNT_pg_PGP_KEYRING", filepath.Join(root, "keys"))
+	p, err = loadPGP("ACCOUNT_pg_", "pg", root)
+	if err != nil || !p.Enabled() || p.Keyring != filepath.Join(root, "keys") {
+		t.Fatalf("Unexpected settings: %+v (%v)", p, err)
+	}
+	if pass, err := p.Passphrase.Value(); err != nil || pass != "secret" {
+		t.Errorf("Expected the literal passphrase, got %q (%v)", pass, err)
+	}
+
+	// The passphrase can come from a file, a command or the vault like the password
+	passFile := filepath.Join(root, "passphrase")
+	if err := os.WriteFile(passFile, []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("ACCOUNT_pg_PGP_PASSPHRASE_FILE", passFile)
+	if _, err := loadPGP("ACCOUNT_pg_", "pg", root); err == nil {
+		t.Error("Expected an error when several passphrase sources are set")
+	}
+	t.Setenv("ACCOUNT_pg_PGP_PASSPHRASE", "")
+	p, err = loadPGP("ACCOUNT_pg_", "pg", root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pass, err := p.Passphrase.Value(); err != nil || pass != "from-file" || p.Passphrase.Source() != "ACCOUNT_pg_PGP_PASSPHRASE_FILE" {
+		t.Errorf("Expected the passphrase file, got %q from %s (%v)", pass, p.Passphrase.Source(), err)
+	}
+
+	t.Setenv("ACCOUNT_pg_PGP_PASSPHRASE_FILE", "")
+	t.Setenv("ACCOUNT_pg_PGP_PASSPHRASE_CMD", "echo from-cmd")
+	p, err = loadPGP("ACCOUNT_pg_", "pg", root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pass, err := p.Passphrase.Value(); err != nil || pass != "from-cmd" {
+		t.Errorf("Expected the command's passphrase, got %q (%v)", pass, err)
+	}
+
+	t.Setenv("ACCOUNT_pg_PGP_PASSPHRASE_CMD", "")
+	if p, err = loadPGP("ACCOUNT_pg_", "pg", root); err != nil || p.Passphrase != nil {
+		t.Errorf("Expected no passphrase, got %v (%v)", p.Passphrase, err)
+	}
+	if err := vault.Add("pg.pgp", "from-vault"); err != nil {
+		t.Fatal(err)
+	}
+	p, err = loadPGP("ACCOUNT_pg_", "pg", root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pass, err := p.Passphrase.Value(); err != nil || pass != "from-vault" {
+		t.Errorf("Expected the vault passphrase, got %q (%v)", pass, err)
+	}
+}
@@ -0,0 +1,122 @@
+package config
+
+import (
+	"fmt"
+	"net/mail"
+	"strconv"
+	"strings"
+)
+
+// Where confirm_send tokens are delivered
+const (
+	ConfirmDeliveryStderr   = "stderr"   // Logged for the operator only, out of the agent's reach
+	ConfirmDeliveryResponse = "response" // Returned to the caller, which can confirm by itself
+)
+
+// Policy restricts what an account may send. Empty fields impose no restriction.
+type Policy struct {
+	AllowedDomains     []string // Only these recipient domains (and their subdomains) may be mailed
+	BlockedDomains     []string // Recipient domains that may never be mailed
+	MaxRecipients      int      // Maximum To+CC+BCC recipients per message
+	BlockedAttachments []string // File extensions (".exe") or MIME types ("application/x-msdownload")
+	RequiredBCC        []string // Addresses added as BCC to every message
+	ConfirmExternal    bool     // Messages to external domains need confirm_send
+	ConfirmDelivery    string   // Where confirm_send tokens go: ConfirmDeliveryStderr or ConfirmDeliveryResponse
+	InternalDomains    []string // Domains treated as internal (default: the account and identity domains)
+}
+
+// loadPolicy loads the outbound policy from {prefix}POLICY_* environment variables
+func loadPolicy(prefix string, acct *AccountConfig) (Policy, error) {
+	p := Policy{
+		AllowedDomains:     splitList(getenv(prefix + "POLICY_ALLOWED_DOMAINS")),
+		BlockedDomains:     splitList(getenv(prefix + "POLICY_BLOCKED_DOMAINS")),
+		BlockedAttachments: splitList(getenv(prefix + "POLICY_BLOCKED_ATTACHMENTS")),
+		RequiredBCC:        splitList(getenv(prefix + "POLICY_REQUIRED_BCC")),
+		InternalDomains:    splitList(getenv(prefix + "POLICY_INTERNAL_DOMAINS")),
+	}
+
+	if max := getenv(prefix + "POLICY_MAX_RECIPIENTS"); max != "" {
+		n, err := strconv.Atoi(max)
+		if err != nil || n < 0 {
+			return p, fmt.Errorf("invalid %sPOLICY_MAX_RECIPIENTS: %s", prefix, max)
+		}
+		p.MaxRecipients = n
+	}
+	if confirm := getenv(prefix + "POLICY_CONFIRM_EXTERNAL"); confirm != "" {
+		b, err := strconv.ParseBool(confirm)
+		if err != nil {
+			return p, fmt.Errorf("invalid %sPOLICY_CONFIRM_EXTERNAL: %w", prefix, err)
+		}
+		p.ConfirmExternal = b
+	}
+	switch p.ConfirmDelivery = strings.ToLower(getenv(prefix + "POLICY_CONFIRM_DELIVERY")); p.ConfirmDelivery {
+	case "":
+		p.ConfirmDelivery = ConfirmDeliveryStderr
+	case ConfirmDeliveryStderr, ConfirmDeliveryResponse:
+	default:
+		return p, fmt.Errorf("invalid %sPOLICY_CONFIRM_DELIVERY: %s (use %s or %s)", prefix, p.ConfirmDelivery, ConfirmDeliveryStderr, ConfirmDeliveryResponse)
+	}
+
+	for _, addr := range p.RequiredBCC {
+		if _, err := mail.ParseAddress(addr); err != nil {
+			return p, fmt.Errorf("invalid %sPOLICY_REQUIRED_BCC address %s: %w", prefix, addr, err)
+		}
+	}
+	for i, ext := range p.BlockedAttachments {
+		if !strings.HasPrefix(ext, ".") && !strings.Contains(ext, "/") {
+			p.BlockedAttachments[i] = "." + ext
+		}
+	}
+
+	// Default the internal domains to those the account sends from
+	if len(p.InternalDomains) == 0 {
+		seen := make(map[string]bool)
+		addresses := []string{acct.EmailAddress}
+		for _, identity := range acct.Identities {
+			addresses = append(addresses, identity.EmailAddress)
+		}
+		for _, addr := range addresses {
+			if domain := AddressDomain(addr); domain != "" && !seen[domain] {
+				seen[domain] = true
+				p.InternalDomains = append(p.InternalDomains, domain)
+			}
+		}
+	}
+
+	return p, nil
+}
+
+// splitList splits a comma-separated setting into trimmed, lower-cased, non-empty values
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.ToLower(strings.TrimSpace(item)); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// AddressDomain returns the lower-cased domain of an email address, or "" if it has none
+func AddressDomain(address string) string {
+	if parsed, err := mail.ParseAddress(address); err == nil {
+		address = parsed.Address
+	}
+	at := strings.LastIndex(address, "@")
+	if at < 0 {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSpace(address[at+1:]))
+}
+
+// DomainMatches reports whether domain equals one of the patterns or is a subdomain of one
+func DomainMatches(domain string, patterns []string) bool {
+	domain = strings.ToLower(domain)
+	for _, pattern := range patterns {
+		pattern = strings.TrimPrefix(strings.ToLower(pattern), "*.")
+		if domain == pattern || strings.HasSuffix(domain, "."+pattern) {
+			return true
+		}
+	}
+	return false
+}
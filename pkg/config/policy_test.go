@@ -0,0 +1,68 @@
+package config
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestLoadPolicy(t *testing.T) {
+	os.Setenv("ACCOUNT_pol_POLICY_BLOCKED_DOMAINS", "Competitor.com, ")
+	os.Setenv("ACCOUNT_pol_POLICY_MAX_RECIPIENTS", "10")
+	os.Setenv("ACCOUNT_pol_POLICY_BLOCKED_ATTACHMENTS", "exe,.JS,application/x-msdownload")
+	os.Setenv("ACCOUNT_pol_POLICY_CONFIRM_EXTERNAL", "true")
+	defer func() {
+		for _, name := range []string{"BLOCKED_DOMAINS", "MAX_RECIPIENTS", "BLOCKED_ATTACHMENTS", "CONFIRM_EXTERNAL", "REQUIRED_BCC"} {
+			os.Unsetenv("ACCOUNT_pol_POLICY_" + name)
+		}
+	}()
+
+	acct := &AccountConfig{
+		EmailAddress: "me@example.com",
+		Identities:   []Identity{{ID: "support", EmailAddress: "help@example.org"}},
+	}
+	p, err := loadPolicy("ACCOUNT_pol_", acct)
+	if err != nil {
+		t.Fatalf("Failed to load policy: %v", err)
+	}
+	if !reflect.DeepEqual(p.BlockedDomains, []string{"competitor.com"}) || p.MaxRecipients != 10 || !p.ConfirmExternal || p.ConfirmDelivery != ConfirmDeliveryStderr {
+		t.Errorf("Unexpected policy: %+v", p)
+	}
+	if want := []string{".exe", ".js", "application/x-msdownload"}; !reflect.DeepEqual(p.BlockedAttachments, want) {
+		t.Errorf("Expected blocked attachments %v, got %v", want, p.BlockedAttachments)
+	}
+	if want := []string{"example.com", "example.org"}; !reflect.DeepEqual(p.InternalDomains, want) {
+		t.Errorf("Expected internal domains %v, got %v", want, p.InternalDomains)
+	}
+
+	t.Setenv("ACCOUNT_pol_POLICY_CONFIRM_DELIVERY", "Response")
+	if p, err := loadPolicy("ACCOUNT_pol_", acct); err != nil || p.ConfirmDelivery != ConfirmDeliveryResponse {
+		t.Errorf("Expected tokens in the response, got %q (%v)", p.ConfirmDelivery, err)
+	}
+	t.Setenv("ACCOUNT_pol_POLICY_CONFIRM_DELIVERY", "email")
+	if _, err := loadPolicy("ACCOUNT_pol_", acct); err == nil {
+		t.Error("Expected error for an unknown confirm delivery")
+	}
+	t.Setenv("ACCOUNT_pol_POLICY_CONFIRM_DELIVERY", "")
+
+	os.Setenv("ACCOUNT_pol_POLICY_REQUIRED_BCC", "not an address")
+	if _, err := loadPolicy("ACCOUNT_pol_", acct); err == nil {
+		t.Error("Expected error for invalid required BCC")
+	}
+}
+
+func TestDomainMatches(t *testing.T) {
+	patterns := []string{"example.com", "*.partner.net"}
+	for domain, want := range map[string]bool{
+		"example.com":      true,
+		"mail.example.com": true,
+		"badexample.com":   false,
+		"partner.net":      true,
+		"eu.partner.net":   true,
+		"other.org":        false,
+	} {
+		if got := DomainMatches(domain, patterns); got != want {
+			t.Errorf("DomainMatches(%q) = %v, want %v", domain, got, want)
+		}
+	}
+}
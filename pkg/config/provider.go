@@ -0,0 +1,105 @@
+package config
+
+import (
+	"sort"
+	"strings"
+)
+
+// ServerSettings are the IMAP and SMTP endpoints of an account
+type ServerSettings struct {
+	IMAPServer string `json:"imap_server"`
+	IMAPPort   int    `json:"imap_port"`
+	SMTPServer string `json:"smtp_server"`
+	SMTPPort   int    `json:"smtp_port"`
+}
+
+// providerPreset describes a well-known provider's servers and the address domains it
+// hosts. AuthServIDs are the authserv-ids its receiving servers put in
+// Authentication-Results, where known.
+type providerPreset struct {
+	Servers     ServerSettings
+	Domains     []string
+	AuthServIDs []string
+}
+
+// providerPresets maps PROVIDER values to server settings. IMAP uses implicit TLS and SMTP
+// uses submission with STARTTLS, which is what the email clients support.
+var providerPresets = map[string]providerPreset{
+	"gmail": {
+		Servers:     ServerSettings{"imap.gmail.com", 993, "smtp.gmail.com", 587},
+		Domains:     []string{"gmail.com", "googlemail.com"},
+		AuthServIDs: []string{"mx.google.com"},
+	},
+	"outlook": {
+		Servers: ServerSettings{"outlook.office365.com", 993, "smtp-mail.outlook.com", 587},
+		Domains: []string{"outlook.com", "hotmail.com", "live.com", "msn.com"},
+	},
+	"yahoo": {
+		Servers: ServerSettings{"imap.mail.yahoo.com", 993, "smtp.mail.yahoo.com", 587},
+		Domains: []string{"yahoo.com", "ymail.com", "rocketmail.com"},
+	},
+	"icloud": {
+		Servers: ServerSettings{"imap.mail.me.com", 993, "smtp.mail.me.com", 587},
+		Domains: []string{"icloud.com", "me.com", "mac.com"},
+	},
+	"fastmail": {
+		Servers:     ServerSettings{"imap.fastmail.com", 993, "smtp.fastmail.com", 587},
+		Domains:     []string{"fastmail.com", "fastmail.fm"},
+		AuthServIDs: []string{"messagingengine.com"},
+	},
+	"zoho": {
+		Servers: ServerSettings{"imap.zoho.com", 993, "smtp.zoho.com", 587},
+		Domains: []string{"zoho.com", "zohomail.com"},
+	},
+	"gmx": {
+		Servers: ServerSettings{"imap.gmx.com", 993, "mail.gmx.com", 587},
+		Domains: []string{"gmx.com"},
+	},
+	// Proton Mail is only reachable through the locally running Bridge, whose IMAP
+	// connection mode must be set to SSL
+	"proton-bridge": {
+		Servers: ServerSettings{"127.0.0.1", 1143, "127.0.0.1", 1025},
+		Domains: []string{"proton.me", "protonmail.com", "pm.me"},
+	},
+	"yandex": {
+		Servers: ServerSettings{"imap.yandex.com", 993, "smtp.yandex.com", 587},
+		Domains: []string{"yandex.com", "yandex.ru"},
+	},
+	"aol": {
+		Servers: ServerSettings{"imap.aol.com", 993, "smtp.aol.com", 587},
+		Domains: []string{"aol.com"},
+	},
+}
+
+// ProviderNames returns the names of the provider presets
+func ProviderNames() []string {
+	names := make([]string, 0, len(providerPresets))
+	for name := range providerPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// providerForAddress returns the preset hosting the address's domain, or "" if none does
+func providerForAddress(address string) string {
+	domain := strings.ToLower(address[strings.LastIndex(address, "@")+1:])
+	for name, preset := range providerPresets {
+		for _, d := range preset.Domains {
+			if d == domain {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// providerForServer returns the preset whose IMAP server is host, or "custom"
+func providerForServer(host string) string {
+	for name, preset := range providerPresets {
+		if strings.EqualFold(preset.Servers.IMAPServer, host) {
+			return name
+		}
+	}
+	return "custom"
+}
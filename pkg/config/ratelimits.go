@@ -0,0 +1,52 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// RateLimits caps the number of messages sent per window. Zero means unlimited.
+type RateLimits struct {
+	PerMinute int
+	PerHour   int
+	PerDay    int
+}
+
+// IsZero reports whether no limit is set
+func (r RateLimits) IsZero() bool {
+	return r.PerMinute == 0 && r.PerHour == 0 && r.PerDay == 0
+}
+
+// providerRateLimits returns conservative defaults below each provider's published sending limits
+func providerRateLimits(provider string) RateLimits {
+	switch provider {
+	case "gmail":
+		return RateLimits{PerMinute: 20, PerHour: 100, PerDay: 500}
+	case "outlook":
+		return RateLimits{PerMinute: 30, PerDay: 300}
+	}
+	return RateLimits{}
+}
+
+// loadRateLimits overrides limits with {prefix}RATE_LIMIT_PER_MINUTE, _PER_HOUR and _PER_DAY
+func loadRateLimits(prefix string, limits RateLimits) (RateLimits, error) {
+	for _, setting := range []struct {
+		name  string
+		value *int
+	}{
+		{"RATE_LIMIT_PER_MINUTE", &limits.PerMinute},
+		{"RATE_LIMIT_PER_HOUR", &limits.PerHour},
+		{"RATE_LIMIT_PER_DAY", &limits.PerDay},
+	} {
+		raw := getenv(prefix + setting.name)
+		if raw == "" {
+			continue
+		}
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			return limits, fmt.Errorf("invalid %s%s: %s", prefix, setting.name, raw)
+		}
+		*setting.value = n
+	}
+	return limits, nil
+}
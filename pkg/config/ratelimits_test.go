@@ -0,0 +1,32 @@
+package config
+
+import (
+	"os"
+	"testing"
+)
+
+func TestLoadRateLimits(t *testing.T) {
+	os.Setenv("ACCOUNT_rl_RATE_LIMIT_PER_MINUTE", "5")
+	os.Setenv("ACCOUNT_rl_RATE_LIMIT_PER_DAY", "0")
+	defer os.Unsetenv("ACCOUNT_rl_RATE_LIMIT_PER_MINUTE")
+	defer os.Unsetenv("ACCOUNT_rl_RATE_LIMIT_PER_DAY")
+
+	limits, err := loadRateLimits("ACCOUNT_rl_", providerRateLimits("gmail"))
+	if err != nil {
+		t.Fatalf("Failed to load rate limits: %v", err)
+	}
+	want := RateLimits{PerMinute: 5, PerHour: 100, PerDay: 0}
+	if limits != want {
+		t.Errorf("Expected %+v, got %+v", want, limits)
+	}
+
+	if !providerRateLimits("custom").IsZero() {
+		t.Error("Expected no default limits for custom providers")
+	}
+
+	os.Setenv("ACCOUNT_rl_RATE_LIMIT_PER_HOUR", "-1")
+	defer os.Unsetenv("ACCOUNT_rl_RATE_LIMIT_PER_HOUR")
+	if _, err := loadRateLimits("ACCOUNT_rl_", RateLimits{}); err == nil {
+		t.Error("Expected error for negative limit")
+	}
+}
@@ -0,0 +1,184 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// redacted replaces secret values wherever a Secret is printed or serialized
+const redacted = "[redacted]"
+
+// Secret is a credential that is resolved on first use. Its value is never printed or
+// serialized.
+type Secret struct {
+	source  string // Where the value comes from, for error messages
+	spec    string // The source's setting (file path or command), to detect changes
+	resolve func() (string, error)
+
+	mu    sync.Mutex
+	value string
+	ok    bool
+}
+
+// NewSecret creates a secret resolved by calling resolve on first use. spec identifies the
+// setting behind the source, such as a file path, so reloads can tell whether it changed.
+func NewSecret(source, spec string, resolve func() (string, error)) *Secret {
+	return &Secret{source: source, spec: spec, resolve: resolve}
+}
+
+// StaticSecret wraps a literal value
+func StaticSecret(value string) *Secret {
+	return &Secret{source: "literal", value: value, ok: true}
+}
+
+// Value resolves the secret. Failures are not cached so a later call can retry.
+func (s *Secret) Value() (string, error) {
+	if s == nil {
+		return "", fmt.Errorf("secret not configured")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ok {
+		return s.value, nil
+	}
+	value, err := s.resolve()
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s: %w", s.source, err)
+	}
+	if value == "" {
+		return "", fmt.Errorf("%s is empty", s.source)
+	}
+	s.value, s.ok = value, true
+	return value, nil
+}
+
+// Equal reports whether two secrets come from the same setting. Literal values are
+// compared; files, commands and vault entries are never resolved to compare them, so a
+// reload does not run password commands.
+func (s *Secret) Equal(o *Secret) bool {
+	if s == nil || o == nil {
+		return s == o
+	}
+	if s.source != o.source || s.spec != o.spec {
+		return false
+	}
+	if s.resolve == nil || o.resolve == nil {
+		return s.resolve == nil && o.resolve == nil && s.value == o.value
+	}
+	return true
+}
+
+// Reset drops a resolved value so the next use reads the file, command or vault entry
+// again, picking up a rotated password. Literal values are kept.
+func (s *Secret) Reset() {
+	if s == nil || s.resolve == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.value, s.ok = "", false
+}
+
+// Source describes where the secret comes from
+func (s *Secret) Source() string {
+	return s.source
+}
+
+// String never reveals the value
+func (s *Secret) String() string {
+	return redacted
+}
+
+// GoString never reveals the value
+func (s *Secret) GoString() string {
+	return redacted
+}
+
+// MarshalJSON never reveals the value
+func (s *Secret) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + redacted + `"`), nil
+}
+
+// MarshalYAML never reveals the value
+func (s *Secret) MarshalYAML() (interface{}, error) {
+	return redacted, nil
+}
+
+// loadSecret determines where a secret comes from: {name}, {name}_FILE or {name}_CMD.
+// Files and commands are only read when the secret is first needed. It returns nil
+// when none is set.
+func loadSecret(name string) (*Secret, error) {
+	value := getenv(name)
+	file := getenv(name + "_FILE")
+	command := getenv(name + "_CMD")
+
+	set := 0
+	for _, v := range []string{value, file, command} {
+		if v != "" {
+			set++
+		}
+	}
+	if set > 1 {
+		return nil, fmt.Errorf("only one of %s, %s_FILE and %s_CMD may be set", name, name, name)
+	}
+
+	switch {
+	case value != "":
+		return StaticSecret(value), nil
+	case file != "":
+		if _, err := os.Stat(file); err != nil {
+			return nil, fmt.Errorf("failed to read %s_FILE: %w", name, err)
+		}
+		return NewSecret(name+"_FILE", file, func() (string, error) {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return "", err
+			}
+			return strings.TrimRight(string(data), "\r\n"), nil
+		}), nil
+	case command != "":
+		return NewSecret(name+"_CMD", command, func() (string, error) {
+			out, err := exec.Command("sh", "-c", command).Output()
+			if err != nil {
+				return "", err
+			}
+			return strings.TrimRight(string(out), "\r\n"), nil
+		}), nil
+	}
+	return nil, nil
+}
+
+// vaultSecret returns the credential vault entry named entry, or nil if there is none
+func vaultSecret(entry string) (*Secret, error) {
+	vault, err := DefaultVault()
+	if err != nil {
+		return nil, err
+	}
+	ids, err := vault.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		if id == entry {
+			return NewSecret("vault entry "+entry, vault.Path, func() (string, error) {
+				return vault.Get(entry)
+			}), nil
+		}
+	}
+	return nil, nil
+}
+
+// loadPassword determines where an account's password comes from: {prefix}PASSWORD,
+// {prefix}PASSWORD_FILE, {prefix}PASSWORD_CMD or the credential vault.
+func loadPassword(prefix, accountID string) (*Secret, error) {
+	if s, err := loadSecret(prefix + "PASSWORD"); s != nil || err != nil {
+		return s, err
+	}
+	if s, err := vaultSecret(accountID); s != nil || err != nil {
+		return s, err
+	}
+	return nil, fmt.Errorf("missing %sPASSWORD (or %sPASSWORD_FILE, %sPASSWORD_CMD, or a vault entry added with -vault-add %s)", prefix, prefix, prefix, accountID)
+}
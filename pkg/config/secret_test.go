@@ -0,0 +1,176 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// useTestVault points the credential vault at a temporary directory
+func useTestVault(t *testing.T) *Vault {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("VAULT_FILE", filepath.Join(dir, "vault"))
+	t.Setenv("VAULT_KEY_FILE", filepath.Join(dir, "vault.key"))
+	v, err := DefaultVault()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestLoadPassword(t *testing.T) {
+	useTestVault(t)
+	prefix := "ACCOUNT_pw_"
+
+	if _, err := loadPassword(prefix, "pw"); err == nil || !strings.Contains(err.Error(), "-vault-add pw") {
+		t.Errorf("Expected a missing password error, got %v", err)
+	}
+
+	t.Setenv(prefix+"PASSWORD", "literal")
+	if s, err := loadPassword(prefix, "pw"); err != nil {
+		t.Fatal(err)
+	} else if v, _ := s.Value(); v != "literal" {
+		t.Errorf("Expected the literal password, got %q", v)
+	}
+
+	file := filepath.Join(t.TempDir(), "password")
+	os.WriteFile(file, []byte("from-file\n"), 0600)
+	t.Setenv(prefix+"PASSWORD_FILE", file)
+	if _, err := loadPassword(prefix, "pw"); err == nil {
+		t.Error("Expected an error when several sources are set")
+	}
+
+	t.Setenv(prefix+"PASSWORD", "")
+	s, err := loadPassword(prefix, "pw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := s.Value(); err != nil || v != "from-file" {
+		t.Errorf("Expected the password from the file, got %q (%v)", v, err)
+	}
+
+	t.Setenv(prefix+"PASSWORD_FILE", filepath.Join(t.TempDir(), "missing"))
+	if _, err := loadPassword(prefix, "pw"); err == nil {
+		t.Error("Expected an error for a missing password file")
+	}
+
+	// Commands run on first use only
+	marker := filepath.Join(t.TempDir(), "ran")
+	t.Setenv(prefix+"PASSWORD_FILE", "")
+	t.Setenv(prefix+"PASSWORD_CMD", fmt.Sprintf("touch %s && echo from-cmd", marker))
+	s, err = loadPassword(prefix, "pw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("Expected the command not to run before the password is needed")
+	}
+	if v, err := s.Value(); err != nil || v != "from-cmd" {
+		t.Errorf("Expected the password from the command, got %q (%v)", v, err)
+	}
+
+	t.Setenv(prefix+"PASSWORD_CMD", "exit 1")
+	s, _ = loadPassword(prefix, "pw")
+	if _, err := s.Value(); err == nil || !strings.Contains(err.Error(), "PASSWORD_CMD") {
+		t.Errorf("Expected a failing command error, got %v", err)
+	}
+}
+
+func TestVault(t *testing.T) {
+	v := useTestVault(t)
+
+	if ids, err := v.List(); err != nil || len(ids) != 0 {
+		t.Fatalf("Expected an empty vault, got %v (%v)", ids, err)
+	}
+	if err := v.Add("work", "s3cret"); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Add("home", "hunter2"); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, _ := os.ReadFile(v.Path)
+	if strings.Contains(string(raw), "s3cret") || strings.Contains(string(raw), "work") {
+		t.Errorf("Expected the vault to be encrypted, got %q", raw)
+	}
+	for _, path := range []string{v.Path, v.KeyFile} {
+		if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+			t.Errorf("Expected %s to be 0600, got %v", path, info.Mode().Perm())
+		}
+	}
+	if ids, _ := v.List(); strings.Join(ids, ",") != "home,work" {
+		t.Errorf("Expected both accounts, got %v", ids)
+	}
+
+	// Accounts without a password in the environment fall back to the vault
+	s, err := loadPassword("ACCOUNT_work_", "work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p, err := s.Value(); err != nil || p != "s3cret" {
+		t.Errorf("Expected the vault password, got %q (%v)", p, err)
+	}
+
+	os.WriteFile(v.KeyFile, []byte("q6urq6urq6urq6urq6urq6urq6urq6urq6urq6urq6s=\n"), 0600)
+	if _, err := v.Get("work"); err == nil {
+		t.Error("Expected a wrong vault key to fail")
+	}
+}
+
+func TestSecretRedaction(t *testing.T) {
+	acct := AccountConfig{AccountID: "work", EmailPassword: StaticSecret("s3cret")}
+	data, _ := json.Marshal(acct)
+	for _, out := range []string{string(data), fmt.Sprintf("%v %+v %#v %s", acct.EmailPassword, acct, acct, acct.EmailPassword)} {
+		if strings.Contains(out, "s3cret") {
+			t.Errorf("Expected the password to be redacted, got %s", out)
+		}
+	}
+}
+
+func TestSecretEqual(t *testing.T) {
+	if !StaticSecret("a").Equal(StaticSecret("a")) || StaticSecret("a").Equal(StaticSecret("b")) {
+		t.Error("Expected literal secrets to compare by value")
+	}
+
+	file := filepath.Join(t.TempDir(), "password")
+	os.WriteFile(file, []byte("first"), 0600)
+	read := func() (string, error) {
+		data, err := os.ReadFile(file)
+		return string(data), err
+	}
+	old := NewSecret("ACCOUNT_a_PASSWORD_FILE", file, read)
+	if !old.Equal(NewSecret("ACCOUNT_a_PASSWORD_FILE", file, read)) {
+		t.Error("Expected unresolved secrets with the same source to be equal")
+	}
+	if old.Equal(NewSecret("ACCOUNT_a_PASSWORD_FILE", file+".new", read)) {
+		t.Error("Expected a different file to make the secret differ")
+	}
+
+	// Comparing never resolves the secrets
+	calls := 0
+	counting := func() (string, error) {
+		calls++
+		return read()
+	}
+	used := NewSecret("ACCOUNT_a_PASSWORD_CMD", "pass show a", counting)
+	used.Value()
+	if !used.Equal(NewSecret("ACCOUNT_a_PASSWORD_CMD", "pass show a", counting)) || calls != 1 {
+		t.Errorf("Expected secrets from the same command to be equal without running it, ran %d times", calls)
+	}
+
+	// After a reset, a rotated password is read on next use
+	os.WriteFile(file, []byte("second"), 0600)
+	used.Reset()
+	if v, err := used.Value(); err != nil || v != "second" || calls != 2 {
+		t.Errorf("Expected the rotated password after a reset, got %q (%v)", v, err)
+	}
+	literal := StaticSecret("a")
+	literal.Reset()
+	if v, err := literal.Value(); err != nil || v != "a" {
+		t.Errorf("Expected a literal secret to survive a reset, got %q (%v)", v, err)
+	}
+}
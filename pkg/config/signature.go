@@ -0,0 +1,43 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// loadSignature reads plain text and HTML signatures for an env prefix from
+// {prefix}SIGNATURE / {prefix}SIGNATURE_HTML, or from files named by
+// {prefix}SIGNATURE_FILE / {prefix}SIGNATURE_HTML_FILE.
+func loadSignature(prefix string) (plain, html string, err error) {
+	plain = strings.ReplaceAll(getenv(prefix+"SIGNATURE"), `\n`, "\n")
+	html = getenv(prefix + "SIGNATURE_HTML")
+
+	if path := getenv(prefix + "SIGNATURE_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to read %sSIGNATURE_FILE: %w", prefix, err)
+		}
+		plain = strings.TrimRight(string(data), "\r\n")
+	}
+	if path := getenv(prefix + "SIGNATURE_HTML_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to read %sSIGNATURE_HTML_FILE: %w", prefix, err)
+		}
+		html = strings.TrimSpace(string(data))
+	}
+
+	return plain, html, nil
+}
+
+// SignatureFor returns the plain text and HTML signatures for an identity.
+// An identity with its own signature overrides the account signature.
+func (a *AccountConfig) SignatureFor(identityID string) (plain, html string) {
+	if identity, err := a.FindIdentity(identityID); err == nil && identity != nil {
+		if identity.Signature != "" || identity.SignatureHTML != "" {
+			return identity.Signature, identity.SignatureHTML
+		}
+	}
+	return a.Signature, a.SignatureHTML
+}
@@ -0,0 +1,53 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// SMIME configures S/MIME for an account. It is off when CertFile is empty.
+type SMIME struct {
+	CertFile  string // PEM certificate of the account, optionally followed by its chain
+	KeyFile   string // PEM private key matching CertFile
+	CertStore string // Directory of recipient certificates (PEM or DER)
+	CAFile    string // Extra PEM trust anchors for verifying signatures
+}
+
+// Enabled reports whether the account has an S/MIME certificate
+func (s SMIME) Enabled() bool {
+	return s.CertFile != ""
+}
+
+// loadSMIME loads S/MIME settings from {prefix}SMIME_* environment variables.
+// The certificate store defaults to {accountRoot}/certs.
+func loadSMIME(prefix, accountRoot string) (SMIME, error) {
+	s := SMIME{
+		CertFile:  getenv(prefix + "SMIME_CERT_FILE"),
+		KeyFile:   getenv(prefix + "SMIME_KEY_FILE"),
+		CertStore: getenv(prefix + "SMIME_CERT_STORE"),
+		CAFile:    getenv(prefix + "SMIME_CA_FILE"),
+	}
+	if !s.Enabled() {
+		if s.KeyFile != "" {
+			return s, fmt.Errorf("%sSMIME_CERT_FILE is required when %sSMIME_KEY_FILE is set", prefix, prefix)
+		}
+		return s, nil
+	}
+	if s.KeyFile == "" {
+		return s, fmt.Errorf("%sSMIME_KEY_FILE is required when %sSMIME_CERT_FILE is set", prefix, prefix)
+	}
+	for name, path := range map[string]string{"SMIME_CERT_FILE": s.CertFile, "SMIME_KEY_FILE": s.KeyFile, "SMIME_CA_FILE": s.CAFile} {
+		if path == "" {
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			return s, fmt.Errorf("failed to read %s%s: %w", prefix, name, err)
+		}
+	}
+
+	if s.CertStore == "" {
+		s.CertStore = filepath.Join(accountRoot, "certs")
+	}
+	return s, nil
+}
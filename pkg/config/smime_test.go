@@ -0,0 +1,42 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadSMIME(t *testing.T) {
+	root := t.TempDir()
+	certFile := filepath.Join(root, "me.crt")
+	keyFile := filepath.Join(root, "me.key")
+	for _, f := range []string{certFile, keyFile} {
+		if err := os.WriteFile(f, []byte("pem"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s, err := loadSMIME("ACCOUNT_sm_", root)
+	if err != nil || s.Enabled() {
+		t.Fatalf("Expected S/MIME to be off by default, got %+v (%v)", s, err)
+	}
+
+	t.Setenv("ACCOUNT_sm_SMIME_CERT_FILE", certFile)
+	if _, err := loadSMIME("ACCOUNT_sm_", root); err == nil {
+		t.Error("Expected an error when the key file is missing")
+	}
+
+	t.Setenv("ACCOUNT_sm_SMIME_KEY_FILE", keyFile)
+	s, err = loadSMIME("ACCOUNT_sm_", root)
+	if err != nil {
+		t.Fatalf("Failed to load S/MIME settings: %v", err)
+	}
+	if s.CertStore != filepath.Join(root, "certs") {
+		t.Errorf("Expected the default certificate store, got %s", s.CertStore)
+	}
+
+	t.Setenv("ACCOUNT_sm_SMIME_CA_FILE", filepath.Join(root, "missing.pem"))
+	if _, err := loadSMIME("ACCOUNT_sm_", root); err == nil {
+		t.Error("Expected an error for a missing CA file")
+	}
+}
@@ -0,0 +1,47 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultToolTimeout bounds tool calls when TOOL_TIMEOUT_SECONDS is not set
+const defaultToolTimeout = 5 * time.Minute
+
+// loadToolTimeouts reads TOOL_TIMEOUT_SECONDS, the deadline of every tool call, and
+// TOOL_TIMEOUTS, per-tool overrides such as "fetch_email=60,send_email=30". A timeout
+// of 0 means no deadline.
+func loadToolTimeouts() (time.Duration, map[string]time.Duration, error) {
+	timeout := defaultToolTimeout
+	if value := getenv("TOOL_TIMEOUT_SECONDS"); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds < 0 {
+			return 0, nil, fmt.Errorf("invalid TOOL_TIMEOUT_SECONDS: %s", value)
+		}
+		timeout = time.Duration(seconds) * time.Second
+	}
+
+	var perTool map[string]time.Duration
+	for _, item := range splitList(getenv("TOOL_TIMEOUTS")) {
+		tool, value, ok := strings.Cut(item, "=")
+		seconds, err := strconv.Atoi(strings.TrimSpace(value))
+		if !ok || err != nil || seconds < 0 {
+			return 0, nil, fmt.Errorf("invalid TOOL_TIMEOUTS entry %q (expected tool=seconds)", item)
+		}
+		if perTool == nil {
+			perTool = make(map[string]time.Duration)
+		}
+		perTool[strings.TrimSpace(tool)] = time.Duration(seconds) * time.Second
+	}
+	return timeout, perTool, nil
+}
+
+// ToolTimeout returns the deadline for a call of tool, or 0 if it has none
+func (m *MultiAccountConfig) ToolTimeout(tool string) time.Duration {
+	if timeout, ok := m.ToolTimeouts[tool]; ok {
+		return timeout
+	}
+	return m.DefaultToolTimeout
+}
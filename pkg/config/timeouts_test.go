@@ -0,0 +1,53 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadToolTimeouts(t *testing.T) {
+	timeout, perTool, err := loadToolTimeouts()
+	if err != nil || timeout != defaultToolTimeout || perTool != nil {
+		t.Fatalf("Expected the default timeout, got %s %v (%v)", timeout, perTool, err)
+	}
+
+	t.Setenv("TOOL_TIMEOUT_SECONDS", "120")
+	t.Setenv("TOOL_TIMEOUTS", "fetch_email=60, fetch_email_attachment=0")
+	timeout, perTool, err = loadToolTimeouts()
+	if err != nil {
+		t.Fatalf("Failed to load tool timeouts: %v", err)
+	}
+	cfg := &MultiAccountConfig{DefaultToolTimeout: timeout, ToolTimeouts: perTool}
+	if cfg.ToolTimeout("send_email") != 2*time.Minute || cfg.ToolTimeout("fetch_email") != time.Minute || cfg.ToolTimeout("fetch_email_attachment") != 0 {
+		t.Errorf("Unexpected tool timeouts: %s %v", timeout, perTool)
+	}
+
+	for _, value := range []string{"fetch_email", "fetch_email=abc", "fetch_email=-1"} {
+		t.Setenv("TOOL_TIMEOUTS", value)
+		if _, _, err := loadToolTimeouts(); err == nil || !strings.Contains(err.Error(), "TOOL_TIMEOUTS") {
+			t.Errorf("Expected an error for %q, got %v", value, err)
+		}
+	}
+	t.Setenv("TOOL_TIMEOUTS", "")
+	t.Setenv("TOOL_TIMEOUT_SECONDS", "-5")
+	if _, _, err := loadToolTimeouts(); err == nil {
+		t.Error("Expected an error for a negative TOOL_TIMEOUT_SECONDS")
+	}
+}
+
+func TestLoadConfigFileToolTimeouts(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", yamlConfig+`tool_timeout_seconds: 90
+tool_timeouts:
+  fetch_email: 30
+  send_email: 15
+`)
+
+	cfg, err := LoadConfigFile(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.ToolTimeout("list_folders") != 90*time.Second || cfg.ToolTimeout("fetch_email") != 30*time.Second || cfg.ToolTimeout("send_email") != 15*time.Second {
+		t.Errorf("Unexpected tool timeouts: %s %v", cfg.DefaultToolTimeout, cfg.ToolTimeouts)
+	}
+}
@@ -0,0 +1,161 @@
+package config
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/prasanthmj/email/pkg/securefs"
+)
+
+// Vault is an encrypted file of account passwords. It is encrypted with a key file
+// that is generated on first use, so it works the same on every OS.
+type Vault struct {
+	Path    string
+	KeyFile string
+}
+
+// DefaultVault returns the vault at VAULT_FILE and VAULT_KEY_FILE, by default
+// email-mcp/vault and email-mcp/vault.key in the user's config directory
+func DefaultVault() (*Vault, error) {
+	v := &Vault{
+		Path:    os.Getenv("VAULT_FILE"),
+		KeyFile: os.Getenv("VAULT_KEY_FILE"),
+	}
+	if v.Path == "" || v.KeyFile == "" {
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return nil, fmt.Errorf("failed to locate the credential vault (set VAULT_FILE and VAULT_KEY_FILE): %w", err)
+		}
+		if v.Path == "" {
+			v.Path = filepath.Join(dir, "email-mcp", "vault")
+		}
+		if v.KeyFile == "" {
+			v.KeyFile = filepath.Join(dir, "email-mcp", "vault.key")
+		}
+	}
+	return v, nil
+}
+
+// List returns the account IDs with a stored password
+func (v *Vault) List() ([]string, error) {
+	entries, err := v.load()
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(entries))
+	for id := range entries {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// Get returns the stored password of an account
+func (v *Vault) Get(accountID string) (string, error) {
+	entries, err := v.load()
+	if err != nil {
+		return "", err
+	}
+	password, ok := entries[accountID]
+	if !ok {
+		return "", fmt.Errorf("no vault entry for account %s", accountID)
+	}
+	return password, nil
+}
+
+// Add stores or replaces the password of an account, creating the vault and its key
+// if needed
+func (v *Vault) Add(accountID, password string) error {
+	if accountID == "" || password == "" {
+		return fmt.Errorf("account ID and password are required")
+	}
+	entries, err := v.load()
+	if err != nil {
+		return err
+	}
+	if entries == nil {
+		entries = make(map[string]string)
+	}
+	entries[accountID] = password
+
+	key, err := v.key(true)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return fmt.Errorf("failed to encode vault: %w", err)
+	}
+	sealed, err := securefs.SealWith(key, data)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt vault: %w", err)
+	}
+	if err := securefs.MkdirAll(filepath.Dir(v.Path)); err != nil {
+		return fmt.Errorf("failed to create vault directory: %w", err)
+	}
+	tmpPath := v.Path + ".tmp"
+	if err := os.WriteFile(tmpPath, sealed, securefs.FileMode); err != nil {
+		return fmt.Errorf("failed to write vault: %w", err)
+	}
+	if err := os.Rename(tmpPath, v.Path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write vault: %w", err)
+	}
+	return nil
+}
+
+// load decrypts the vault; a missing vault has no entries
+func (v *Vault) load() (map[string]string, error) {
+	sealed, err := os.ReadFile(v.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read vault: %w", err)
+	}
+	key, err := v.key(false)
+	if err != nil {
+		return nil, err
+	}
+	data, err := securefs.OpenWith(key, sealed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt vault %s with %s: %w", v.Path, v.KeyFile, err)
+	}
+	var entries map[string]string
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse vault: %w", err)
+	}
+	return entries, nil
+}
+
+// key reads the vault key, generating it if create is set and it does not exist
+func (v *Vault) key(create bool) ([]byte, error) {
+	data, err := os.ReadFile(v.KeyFile)
+	if os.IsNotExist(err) && create {
+		key := make([]byte, securefs.KeySize)
+		if _, err := rand.Read(key); err != nil {
+			return nil, fmt.Errorf("failed to generate vault key: %w", err)
+		}
+		if err := securefs.MkdirAll(filepath.Dir(v.KeyFile)); err != nil {
+			return nil, fmt.Errorf("failed to create vault key directory: %w", err)
+		}
+		encoded := base64.StdEncoding.EncodeToString(key) + "\n"
+		if err := os.WriteFile(v.KeyFile, []byte(encoded), securefs.FileMode); err != nil {
+			return nil, fmt.Errorf("failed to write vault key: %w", err)
+		}
+		return key, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read vault key: %w", err)
+	}
+	key, err := parseEncryptionKey(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid vault key %s: %w", v.KeyFile, err)
+	}
+	return key, nil
+}
@@ -1,6 +1,8 @@
 package email
 
 import (
+	"bytes"
+	"context"
 	"crypto/md5"
 	"fmt"
 	"io"
@@ -12,6 +14,7 @@ import (
 	"github.com/emersion/go-imap/client"
 	"github.com/emersion/go-message/mail"
 	"github.com/prasanthmj/email/pkg/config"
+	"github.com/prasanthmj/email/pkg/securefs"
 )
 
 // AttachmentFetcher handles attachment operations
@@ -30,18 +33,26 @@ func NewAttachmentFetcher(cfg *config.AccountConfig, imapClient *IMAPClient, max
 	}
 }
 
-// FetchAttachments fetches attachments from an email
-func (af *AttachmentFetcher) FetchAttachments(messageID string, attachmentNames []string, fetchAll bool) ([]AttachmentResult, error) {
-	c, err := af.imapClient.connect()
+// FetchAttachments fetches attachments from an email. If ctx is cancelled, attachments
+// saved by this call are removed again.
+func (af *AttachmentFetcher) FetchAttachments(ctx context.Context, messageID string, attachmentNames []string, fetchAll bool) ([]AttachmentResult, error) {
+	c, logout, err := af.imapClient.connect(ctx)
 	if err != nil {
 		return nil, err
 	}
-	defer c.Logout()
+	defer logout()
 
 	// Find the email in any folder
-	attachments, err := af.searchAndFetchAttachments(c, messageID, attachmentNames, fetchAll)
+	var created []string
+	attachments, err := af.searchAndFetchAttachments(ctx, c, messageID, attachmentNames, fetchAll, &created)
+	if err == nil {
+		err = ctx.Err()
+	}
 	if err != nil {
-		return nil, err
+		for _, path := range created {
+			os.Remove(path)
+		}
+		return nil, contextErr(ctx, err)
 	}
 
 	return attachments, nil
@@ -56,12 +67,15 @@ type AttachmentResult struct {
 }
 
 // searchAndFetchAttachments searches for an email and fetches its attachments
-func (af *AttachmentFetcher) searchAndFetchAttachments(c *client.Client, messageID string, attachmentNames []string, fetchAll bool) ([]AttachmentResult, error) {
+func (af *AttachmentFetcher) searchAndFetchAttachments(ctx context.Context, c *client.Client, messageID string, attachmentNames []string, fetchAll bool, created *[]string) ([]AttachmentResult, error) {
 	// Try common folders first
 	commonFolders := []string{"INBOX", "Sent", "[Gmail]/Sent Mail", "Sent Items", "[Gmail]/All Mail"}
 	
 	for _, folder := range commonFolders {
-		results, err := af.fetchAttachmentsFromFolder(c, folder, messageID, attachmentNames, fetchAll)
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		results, err := af.fetchAttachmentsFromFolder(ctx, c, folder, messageID, attachmentNames, fetchAll, created)
 		if err == nil && len(results) > 0 {
 			return results, nil
 		}
@@ -75,7 +89,11 @@ func (af *AttachmentFetcher) searchAndFetchAttachments(c *client.Client, message
 	}()
 
 	for m := range mailboxes {
-		results, err := af.fetchAttachmentsFromFolder(c, m.Name, messageID, attachmentNames, fetchAll)
+		// Keep draining so List can finish after a cancellation closed the connection
+		if ctx.Err() != nil {
+			continue
+		}
+		results, err := af.fetchAttachmentsFromFolder(ctx, c, m.Name, messageID, attachmentNames, fetchAll, created)
 		if err == nil && len(results) > 0 {
 			return results, nil
 		}
@@ -84,12 +102,16 @@ func (af *AttachmentFetcher) searchAndFetchAttachments(c *client.Client, message
 	if err := <-done; err != nil {
 		return nil, fmt.Errorf("failed to search folders: %w", err)
 	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 
 	return nil, fmt.Errorf("email not found: %s", messageID)
 }
 
-// fetchAttachmentsFromFolder fetches attachments from a specific folder
-func (af *AttachmentFetcher) fetchAttachmentsFromFolder(c *client.Client, folder, messageID string, attachmentNames []string, fetchAll bool) ([]AttachmentResult, error) {
+// fetchAttachmentsFromFolder fetches attachments from a specific folder, adding the paths
+// of newly saved files to created
+func (af *AttachmentFetcher) fetchAttachmentsFromFolder(ctx context.Context, c *client.Client, folder, messageID string, attachmentNames []string, fetchAll bool, created *[]string) ([]AttachmentResult, error) {
 	mbox, err := c.Select(folder, true) // read-only
 	if err != nil {
 		return nil, err
@@ -137,7 +159,14 @@ func (af *AttachmentFetcher) fetchAttachmentsFromFolder(c *client.Client, folder
 		return nil, fmt.Errorf("failed to get message body")
 	}
 
-	mr, err := mail.CreateReader(r)
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read message: %w", err)
+	}
+	// Attachments of encrypted messages are inside the encrypted entity
+	raw, _, _ = unwrapMessage(raw, af.config, "")
+
+	mr, err := mail.CreateReader(bytes.NewReader(raw))
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse message: %w", err)
 	}
@@ -152,6 +181,9 @@ func (af *AttachmentFetcher) fetchAttachmentsFromFolder(c *client.Client, folder
 
 	// Extract attachments
 	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		p, err := mr.NextPart()
 		if err == io.EOF {
 			break
@@ -195,7 +227,11 @@ func (af *AttachmentFetcher) fetchAttachmentsFromFolder(c *client.Client, folder
 			
 			// Save to cache
 			cachePath := filepath.Join(af.config.AttachmentDir, cacheID)
-			err = os.WriteFile(cachePath, content, 0644)
+			_, statErr := os.Stat(cachePath)
+			err = securefs.WriteFile(cachePath, content)
+			if err == nil && os.IsNotExist(statErr) {
+				*created = append(*created, cachePath)
+			}
 			if err != nil {
 				results = append(results, AttachmentResult{
 					Filename: filename,
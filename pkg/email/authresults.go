@@ -0,0 +1,271 @@
+package email
+
+import (
+	"net/mail"
+	"strings"
+)
+
+// Sources of an authentication result
+const (
+	AuthSourceHeader = "authentication-results" // Reported by the receiving server
+	AuthSourceLocal  = "local"                  // Verified by this server
+)
+
+// Sender trust verdicts
+const (
+	TrustPass = "pass" // An authenticated domain aligns with the From domain
+	TrustFail = "fail" // Authentication of the From domain failed
+	TrustNone = "none" // No usable authentication results
+)
+
+// AuthVerdict holds the SPF, DKIM and DMARC results of a received message
+type AuthVerdict struct {
+	AuthServID string       `yaml:"authserv_id,omitempty" json:"authserv_id,omitempty"` // Server that produced Authentication-Results
+	FromDomain string       `yaml:"from_domain,omitempty" json:"from_domain,omitempty"`
+	SPF        string       `yaml:"spf,omitempty" json:"spf,omitempty"`               // pass, fail, softfail, neutral, none, temperror, permerror
+	SPFDomain  string       `yaml:"spf_domain,omitempty" json:"spf_domain,omitempty"` // Envelope sender (MAIL FROM) domain
+	DKIM       []DKIMResult `yaml:"dkim,omitempty" json:"dkim,omitempty"`
+	DMARC      string       `yaml:"dmarc,omitempty" json:"dmarc,omitempty"`
+}
+
+// DKIMResult is the outcome of one DKIM signature
+type DKIMResult struct {
+	Result   string `yaml:"result" json:"result"`
+	Domain   string `yaml:"domain,omitempty" json:"domain,omitempty"`
+	Selector string `yaml:"selector,omitempty" json:"selector,omitempty"`
+	Reason   string `yaml:"reason,omitempty" json:"reason,omitempty"`
+	Source   string `yaml:"source" json:"source"`
+}
+
+// SenderTrust summarizes whether the From domain is authenticated
+type SenderTrust struct {
+	Verdict       string `json:"verdict"`                  // pass, fail or none
+	AlignedDomain string `json:"aligned_domain,omitempty"` // Authenticated domain aligned with From
+	Reason        string `json:"reason"`
+}
+
+// ParseAuthVerdict extracts authentication results from the header fields of a message.
+// The verdict is never nil; it holds only the From domain when there are no results.
+// Only fields added by a trusted server are used (RFC 8601 section 5): the topmost
+// Authentication-Results field whose authserv-id, or Received-SPF field whose receiver,
+// is one of trustedIDs or a subdomain of one. Anything else may have been inserted by the
+// sender, so without trustedIDs no results are used.
+func ParseAuthVerdict(header mail.Header, trustedIDs []string) *AuthVerdict {
+	verdict := &AuthVerdict{}
+	if from, err := header.AddressList("From"); err == nil && len(from) > 0 {
+		verdict.FromDomain = domainOf(from[0].Address)
+	}
+
+	for _, value := range header["Authentication-Results"] {
+		if trustedAuthServ(authServID(value), trustedIDs) {
+			parseAuthenticationResults(value, verdict)
+			break
+		}
+	}
+	if verdict.SPF == "" {
+		for _, value := range header["Received-Spf"] {
+			if trustedAuthServ(spfReceiver(value), trustedIDs) {
+				parseReceivedSPF(value, verdict)
+				break
+			}
+		}
+	}
+	return verdict
+}
+
+// trustedAuthServ reports whether id is one of trustedIDs or a subdomain of one
+func trustedAuthServ(id string, trustedIDs []string) bool {
+	if id == "" {
+		return false
+	}
+	for _, trusted := range trustedIDs {
+		trusted = strings.ToLower(trusted)
+		if id == trusted || strings.HasSuffix(id, "."+trusted) {
+			return true
+		}
+	}
+	return false
+}
+
+// authServID returns the lowercased authserv-id of an Authentication-Results value
+func authServID(value string) string {
+	id, _, _ := strings.Cut(stripComments(value), ";")
+	if fields := strings.Fields(id); len(fields) > 0 && !strings.Contains(fields[0], "=") {
+		return strings.ToLower(fields[0])
+	}
+	return ""
+}
+
+// spfReceiver returns the lowercased receiver key of a Received-SPF value
+func spfReceiver(value string) string {
+	for _, f := range strings.Fields(stripComments(value)) {
+		k, v, ok := strings.Cut(strings.TrimSuffix(f, ";"), "=")
+		if ok && strings.EqualFold(k, "receiver") {
+			return strings.ToLower(strings.Trim(v, `"`))
+		}
+	}
+	return ""
+}
+
+// stripComments removes RFC 5322 comments (nested parentheses) outside quoted strings
+func stripComments(value string) string {
+	var out strings.Builder
+	depth := 0
+	quoted := false
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case c == '\\' && i+1 < len(value):
+			if depth == 0 {
+				out.WriteByte(c)
+				out.WriteByte(value[i+1])
+			}
+			i++
+		case c == '"' && depth == 0:
+			quoted = !quoted
+			out.WriteByte(c)
+		case c == '(' && !quoted:
+			depth++
+		case c == ')' && !quoted && depth > 0:
+			depth--
+			out.WriteByte(' ')
+		case depth == 0:
+			out.WriteByte(c)
+		}
+	}
+	return out.String()
+}
+
+// parseAuthenticationResults parses an RFC 8601 Authentication-Results value
+func parseAuthenticationResults(value string, verdict *AuthVerdict) {
+	parts := strings.Split(stripComments(value), ";")
+	verdict.AuthServID = authServID(value)
+
+	for _, part := range parts[1:] {
+		fields := strings.Fields(part)
+		if len(fields) == 0 {
+			continue
+		}
+		method, result, ok := strings.Cut(strings.ToLower(fields[0]), "=")
+		if !ok {
+			continue
+		}
+		props := make(map[string]string)
+		for _, f := range fields[1:] {
+			if k, v, ok := strings.Cut(f, "="); ok {
+				props[strings.ToLower(k)] = strings.Trim(v, `"`)
+			}
+		}
+
+		switch method {
+		case "spf":
+			verdict.SPF = result
+			if from := props["smtp.mailfrom"]; from != "" {
+				verdict.SPFDomain = domainOf(from)
+			} else if helo := props["smtp.helo"]; helo != "" {
+				verdict.SPFDomain = strings.ToLower(helo)
+			}
+		case "dkim":
+			dkim := DKIMResult{Result: result, Source: AuthSourceHeader, Selector: props["header.s"]}
+			if d := props["header.d"]; d != "" {
+				dkim.Domain = strings.ToLower(d)
+			} else if i := props["header.i"]; i != "" {
+				dkim.Domain = domainOf(i)
+			}
+			verdict.DKIM = append(verdict.DKIM, dkim)
+		case "dmarc":
+			verdict.DMARC = result
+			if from := props["header.from"]; from != "" && verdict.FromDomain == "" {
+				verdict.FromDomain = strings.ToLower(from)
+			}
+		}
+	}
+}
+
+// parseReceivedSPF parses a Received-SPF value (RFC 7208 9.1)
+func parseReceivedSPF(value string, verdict *AuthVerdict) {
+	fields := strings.Fields(stripComments(value))
+	if len(fields) == 0 {
+		return
+	}
+	verdict.SPF = strings.ToLower(fields[0])
+	for _, f := range fields[1:] {
+		k, v, ok := strings.Cut(strings.TrimSuffix(f, ";"), "=")
+		if ok && strings.EqualFold(k, "envelope-from") {
+			verdict.SPFDomain = domainOf(strings.Trim(v, `"<>`))
+		}
+	}
+}
+
+// domainOf returns the lowercased domain of an address, or the value itself if it has no @
+func domainOf(address string) string {
+	address = strings.ToLower(strings.TrimSpace(address))
+	if i := strings.LastIndexByte(address, '@'); i >= 0 {
+		return address[i+1:]
+	}
+	return address
+}
+
+// aligned reports relaxed alignment: one domain equals or is a subdomain of the other
+func aligned(authDomain, fromDomain string) bool {
+	if authDomain == "" || fromDomain == "" {
+		return false
+	}
+	return authDomain == fromDomain ||
+		strings.HasSuffix(fromDomain, "."+authDomain) ||
+		strings.HasSuffix(authDomain, "."+fromDomain)
+}
+
+// Trust summarizes the verdict. DMARC decides when present; otherwise a passing DKIM
+// signature or SPF check aligned with the From domain counts as a pass.
+func (v *AuthVerdict) Trust() SenderTrust {
+	if v == nil {
+		return SenderTrust{Verdict: TrustNone, Reason: "no authentication results"}
+	}
+
+	// Prefer locally verified signatures, then those reported by the server
+	var dkimPass, dkimFail *DKIMResult
+	for _, source := range []string{AuthSourceLocal, AuthSourceHeader} {
+		for i := range v.DKIM {
+			r := &v.DKIM[i]
+			if r.Source != source || !aligned(r.Domain, v.FromDomain) {
+				continue
+			}
+			if r.Result == DKIMPass && dkimPass == nil {
+				dkimPass = r
+			} else if r.Result == DKIMFail && dkimFail == nil {
+				dkimFail = r
+			}
+		}
+	}
+	spfAligned := v.SPF == "pass" && aligned(v.SPFDomain, v.FromDomain)
+
+	switch v.DMARC {
+	case "pass":
+		domain := v.FromDomain
+		if dkimPass != nil {
+			domain = dkimPass.Domain
+		} else if spfAligned {
+			domain = v.SPFDomain
+		}
+		return SenderTrust{Verdict: TrustPass, AlignedDomain: domain, Reason: "DMARC pass"}
+	case "fail":
+		return SenderTrust{Verdict: TrustFail, Reason: "DMARC fail for " + v.FromDomain}
+	}
+
+	switch {
+	case dkimPass != nil:
+		return SenderTrust{Verdict: TrustPass, AlignedDomain: dkimPass.Domain, Reason: "aligned DKIM signature verified (" + dkimPass.Source + ")"}
+	case spfAligned:
+		return SenderTrust{Verdict: TrustPass, AlignedDomain: v.SPFDomain, Reason: "aligned SPF pass"}
+	case dkimFail != nil:
+		reason := "DKIM signature for " + dkimFail.Domain + " failed"
+		if dkimFail.Reason != "" {
+			reason += ": " + dkimFail.Reason
+		}
+		return SenderTrust{Verdict: TrustFail, Reason: reason}
+	case v.SPF == "fail" && aligned(v.SPFDomain, v.FromDomain):
+		return SenderTrust{Verdict: TrustFail, Reason: "SPF fail for " + v.SPFDomain}
+	}
+	return SenderTrust{Verdict: TrustNone, Reason: "no authentication aligned with " + v.FromDomain}
+}
@@ -0,0 +1,101 @@
+package email
+
+import (
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+func parseHeader(t *testing.T, header string) mail.Header {
+	t.Helper()
+	msg, err := mail.ReadMessage(strings.NewReader(header + "\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg.Header
+}
+
+func TestParseAuthVerdict(t *testing.T) {
+	header := parseHeader(t, "Authentication-Results: mx.google.com;\r\n"+
+		"       dkim=pass header.i=@news.example.com header.s=s1 header.b=abc;\r\n"+
+		"       spf=pass (google.com: domain of bounce@mailer.example.net designates 1.2.3.4 as permitted sender) smtp.mailfrom=bounce@mailer.example.net;\r\n"+
+		"       dmarc=pass (p=REJECT sp=REJECT dis=NONE) header.from=example.com\r\n"+
+		"Authentication-Results: forged.example; dkim=fail header.d=example.com\r\n"+
+		"From: Example <info@example.com>\r\n")
+
+	v := ParseAuthVerdict(header, []string{"mx.google.com"})
+	if v.AuthServID != "mx.google.com" || v.FromDomain != "example.com" {
+		t.Errorf("Unexpected verdict %+v", v)
+	}
+	if v.SPF != "pass" || v.SPFDomain != "mailer.example.net" || v.DMARC != "pass" {
+		t.Errorf("Unexpected SPF/DMARC results %+v", v)
+	}
+	if len(v.DKIM) != 1 || v.DKIM[0].Domain != "news.example.com" || v.DKIM[0].Selector != "s1" {
+		t.Errorf("Expected only the topmost DKIM result, got %+v", v.DKIM)
+	}
+
+	trust := v.Trust()
+	if trust.Verdict != TrustPass || trust.AlignedDomain != "news.example.com" {
+		t.Errorf("Expected DMARC pass aligned via DKIM, got %+v", trust)
+	}
+}
+
+func TestParseReceivedSPF(t *testing.T) {
+	header := parseHeader(t, "Received-SPF: fail (example.com: domain of x@example.com does not designate 5.6.7.8) client-ip=5.6.7.8; envelope-from=\"x@example.com\"; receiver=mx1.example.org;\r\n"+
+		"From: x@example.com\r\n")
+	v := ParseAuthVerdict(header, []string{"example.org"})
+	if v.SPF != "fail" || v.SPFDomain != "example.com" {
+		t.Errorf("Unexpected SPF result %+v", v)
+	}
+	if trust := v.Trust(); trust.Verdict != TrustFail {
+		t.Errorf("Expected aligned SPF fail to fail, got %+v", trust)
+	}
+}
+
+func TestParseAuthVerdictUntrustedServer(t *testing.T) {
+	// A mailbox whose server adds no Authentication-Results of its own: the topmost
+	// field was inserted by the sender
+	header := parseHeader(t, "Authentication-Results: x; dmarc=pass header.from=example.com\r\n"+
+		"Received-SPF: pass client-ip=1.2.3.4; envelope-from=\"x@example.com\"; receiver=x;\r\n"+
+		"From: ceo@example.com\r\n")
+
+	for _, trusted := range [][]string{nil, {"mx.google.com"}} {
+		v := ParseAuthVerdict(header, trusted)
+		if v.AuthServID != "" || v.DMARC != "" || v.SPF != "" {
+			t.Errorf("Expected results from an untrusted server to be ignored with %v, got %+v", trusted, v)
+		}
+		if trust := v.Trust(); trust.Verdict != TrustNone {
+			t.Errorf("Expected a forged header to give no trust with %v, got %+v", trusted, trust)
+		}
+	}
+
+	// A trusted server's results are used even below a forged field
+	header = parseHeader(t, "Authentication-Results: mx.example.org.evil.example; dmarc=fail header.from=example.com\r\n"+
+		"Authentication-Results: mx.example.org; dmarc=pass header.from=example.com\r\n"+
+		"From: ceo@example.com\r\n")
+	if trust := ParseAuthVerdict(header, []string{"mx.example.org"}).Trust(); trust.Verdict != TrustPass {
+		t.Errorf("Expected the trusted server's DMARC pass, got %+v", trust)
+	}
+}
+
+func TestSenderTrust(t *testing.T) {
+	tests := []struct {
+		name    string
+		verdict *AuthVerdict
+		want    string
+		domain  string
+	}{
+		{"no results", nil, TrustNone, ""},
+		{"dmarc fail", &AuthVerdict{FromDomain: "bank.com", DMARC: "fail", DKIM: []DKIMResult{{Result: "pass", Domain: "bank.com", Source: AuthSourceHeader}}}, TrustFail, ""},
+		{"local dkim pass", &AuthVerdict{FromDomain: "a.com", DKIM: []DKIMResult{{Result: "pass", Domain: "a.com", Source: AuthSourceLocal}}}, TrustPass, "a.com"},
+		{"unaligned dkim", &AuthVerdict{FromDomain: "bank.com", SPF: "pass", SPFDomain: "spammer.net", DKIM: []DKIMResult{{Result: "pass", Domain: "spammer.net", Source: AuthSourceHeader}}}, TrustNone, ""},
+		{"aligned spf", &AuthVerdict{FromDomain: "shop.com", SPF: "pass", SPFDomain: "mail.shop.com"}, TrustPass, "mail.shop.com"},
+		{"dkim fail", &AuthVerdict{FromDomain: "a.com", DKIM: []DKIMResult{{Result: "fail", Domain: "a.com", Source: AuthSourceLocal, Reason: "body hash did not verify"}}}, TrustFail, ""},
+	}
+	for _, tt := range tests {
+		trust := tt.verdict.Trust()
+		if trust.Verdict != tt.want || trust.AlignedDomain != tt.domain {
+			t.Errorf("%s: expected %s (%s), got %+v", tt.name, tt.want, tt.domain, trust)
+		}
+	}
+}
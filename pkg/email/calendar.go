@@ -0,0 +1,179 @@
+package email
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net/mail"
+	"path/filepath"
+	"strings"
+	"time"
+
+	gomail "github.com/emersion/go-message/mail"
+	"github.com/prasanthmj/email/pkg/securefs"
+)
+
+// buildCalendarMessage renders an iTIP message: multipart/mixed containing a
+// multipart/alternative (text, optional HTML, text/calendar) plus an invite.ics copy
+// for clients that only look at attachments.
+func (sc *SMTPClient) buildCalendarMessage(opts SendOptions) ([]byte, error) {
+	if len(opts.To) == 0 {
+		return nil, fmt.Errorf("at least one recipient is required")
+	}
+	if opts.Subject == "" {
+		return nil, fmt.Errorf("subject is required")
+	}
+	method := strings.ToUpper(opts.Calendar.Method)
+	if method == "" || opts.Calendar.Content == "" {
+		return nil, fmt.Errorf("calendar method and content are required")
+	}
+
+	var h gomail.Header
+	from, err := parseAddressList([]string{sc.fromHeader(opts)})
+	if err != nil {
+		return nil, err
+	}
+	to, err := parseAddressList(opts.To)
+	if err != nil {
+		return nil, err
+	}
+	cc, err := parseAddressList(opts.CC)
+	if err != nil {
+		return nil, err
+	}
+	h.SetAddressList("From", from)
+	h.SetAddressList("To", to)
+	if len(cc) > 0 {
+		h.SetAddressList("Cc", cc)
+	}
+	if len(opts.ReplyTo) > 0 {
+		replyTo, err := parseAddressList(opts.ReplyTo)
+		if err != nil {
+			return nil, err
+		}
+		h.SetAddressList("Reply-To", replyTo)
+	}
+	h.SetSubject(opts.Subject)
+	h.SetDate(time.Now())
+	if err := h.GenerateMessageID(); err != nil {
+		return nil, err
+	}
+
+	// Set threading headers if this is a reply
+	if opts.ReplyToMessageID != "" {
+		h.Set("In-Reply-To", opts.ReplyToMessageID)
+		refs := opts.References
+		if !contains(refs, opts.ReplyToMessageID) {
+			refs = append(refs, opts.ReplyToMessageID)
+		}
+		h.Set("References", strings.Join(refs, " "))
+	}
+	for _, field := range sc.extraHeaders(opts) {
+		h.Add(field.Name, field.Value)
+	}
+
+	var buf bytes.Buffer
+	mw, err := gomail.CreateWriter(&buf, h)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create message: %w", err)
+	}
+
+	iw, err := mw.CreateInline()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create message body: %w", err)
+	}
+
+	body := opts.Body
+	if body == "" && opts.HTMLBody == "" {
+		body = opts.Subject
+	}
+	if body != "" {
+		if err := writeInlinePart(iw, "text/plain", map[string]string{"charset": "UTF-8"}, body); err != nil {
+			return nil, err
+		}
+	}
+	if opts.HTMLBody != "" {
+		if err := writeInlinePart(iw, "text/html", map[string]string{"charset": "UTF-8"}, opts.HTMLBody); err != nil {
+			return nil, err
+		}
+	}
+	calParams := map[string]string{"method": method, "charset": "UTF-8"}
+	if err := writeInlinePart(iw, "text/calendar", calParams, opts.Calendar.Content); err != nil {
+		return nil, err
+	}
+	if err := iw.Close(); err != nil {
+		return nil, err
+	}
+
+	// Regular attachments from cache
+	for _, cacheID := range opts.Attachments {
+		attachmentPath := filepath.Join(sc.config.AttachmentDir, cacheID)
+		content, err := securefs.ReadFile(attachmentPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to attach file %s: %w", cacheID, err)
+		}
+		ct := mime.TypeByExtension(filepath.Ext(cacheID))
+		if ct == "" {
+			ct = "application/octet-stream"
+		}
+		if err := writeAttachmentPart(mw, ct, nil, filepath.Base(cacheID), content); err != nil {
+			return nil, err
+		}
+	}
+
+	icsName := "invite.ics"
+	if method == MethodReply {
+		icsName = "reply.ics"
+	}
+	if err := writeAttachmentPart(mw, "application/ics", map[string]string{"name": icsName}, icsName, []byte(opts.Calendar.Content)); err != nil {
+		return nil, err
+	}
+
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeInlinePart writes one alternative of a multipart/alternative body
+func writeInlinePart(iw *gomail.InlineWriter, contentType string, params map[string]string, content string) error {
+	var h gomail.InlineHeader
+	h.SetContentType(contentType, params)
+	w, err := iw.CreatePart(h)
+	if err != nil {
+		return fmt.Errorf("failed to create %s part: %w", contentType, err)
+	}
+	if _, err := io.WriteString(w, content); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// writeAttachmentPart writes an attachment part to a multipart/mixed message
+func writeAttachmentPart(mw *gomail.Writer, contentType string, params map[string]string, filename string, content []byte) error {
+	var h gomail.AttachmentHeader
+	h.SetContentType(contentType, params)
+	h.SetFilename(filename)
+	w, err := mw.CreateAttachment(h)
+	if err != nil {
+		return fmt.Errorf("failed to create attachment %s: %w", filename, err)
+	}
+	if _, err := w.Write(content); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// parseAddressList parses RFC 5322 address strings
+func parseAddressList(addrs []string) ([]*gomail.Address, error) {
+	var result []*gomail.Address
+	for _, a := range addrs {
+		addr, err := mail.ParseAddress(a)
+		if err != nil {
+			return nil, fmt.Errorf("invalid address %q: %w", a, err)
+		}
+		result = append(result, (*gomail.Address)(addr))
+	}
+	return result, nil
+}
@@ -0,0 +1,654 @@
+package email
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"sort"
+	"time"
+)
+
+// Object identifiers used by CMS (RFC 5652) and S/MIME (RFC 8551)
+var (
+	oidData          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidEnvelopedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 3}
+
+	oidAttrContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidAttrMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidAttrSigningTime   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}
+
+	oidSHA1   = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidSHA256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+
+	oidRSAEncryption   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidRSAOAEP         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 7}
+	oidSHA1WithRSA     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 5}
+	oidSHA256WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+	oidSHA384WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 12}
+	oidSHA512WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 13}
+	oidECDSAWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidECDSAWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}
+	oidECDSAWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}
+	oidECPublicKey     = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+
+	oidAES128CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+	oidDESEDE3CBC = asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 7}
+)
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+type encapsulatedContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+	EContent     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo encapsulatedContentInfo
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      []signerInfo  `asn1:"set"`
+}
+
+type signerInfo struct {
+	Version            int
+	SID                asn1.RawValue // IssuerAndSerialNumber or [0] SubjectKeyIdentifier
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type issuerAndSerial struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue `asn1:"set"`
+}
+
+type envelopedData struct {
+	Version              int
+	OriginatorInfo       asn1.RawValue   `asn1:"optional,tag:0"`
+	RecipientInfos       []asn1.RawValue `asn1:"set"`
+	EncryptedContentInfo encryptedContentInfo
+	UnprotectedAttrs     asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type keyTransRecipientInfo struct {
+	Version                int
+	RID                    asn1.RawValue // IssuerAndSerialNumber or [0] SubjectKeyIdentifier
+	KeyEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedKey           []byte
+}
+
+type encryptedContentInfo struct {
+	ContentType                asn1.ObjectIdentifier
+	ContentEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedContent           asn1.RawValue `asn1:"optional,tag:0"`
+}
+
+// CMSSigner describes who signed CMS content and whether the signature holds
+type CMSSigner struct {
+	Certificate *x509.Certificate
+	Chain       []*x509.Certificate // Other certificates carried in the message
+	SigningTime time.Time
+}
+
+// errNoRecipient is returned when a message was not encrypted for our certificate
+var errNoRecipient = errors.New("message is not encrypted for this account's certificate")
+
+// berToDER converts BER (indefinite lengths, constructed OCTET STRINGs) to DER so
+// encoding/asn1 can parse messages produced by common mail clients
+func berToDER(data []byte) ([]byte, error) {
+	out, rest, err := berElement(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 && !bytes.Equal(rest, make([]byte, len(rest))) {
+		return nil, fmt.Errorf("trailing data after ASN.1 structure")
+	}
+	return out, nil
+}
+
+// berElement converts one BER element and returns the remaining input
+func berElement(data []byte) ([]byte, []byte, error) {
+	if len(data) < 2 {
+		return nil, nil, fmt.Errorf("truncated ASN.1 element")
+	}
+	tag := data[0]
+	if tag&0x1f == 0x1f {
+		return nil, nil, fmt.Errorf("unsupported high ASN.1 tag number")
+	}
+	constructed := tag&0x20 != 0
+	pos := 1
+
+	length := -1 // Indefinite
+	if l := data[pos]; l < 0x80 {
+		length = int(l)
+		pos++
+	} else if l == 0x80 {
+		if !constructed {
+			return nil, nil, fmt.Errorf("indefinite length on primitive ASN.1 element")
+		}
+		pos++
+	} else {
+		n := int(l & 0x7f)
+		pos++
+		if n > 4 || pos+n > len(data) {
+			return nil, nil, fmt.Errorf("invalid ASN.1 length")
+		}
+		length = 0
+		for _, b := range data[pos : pos+n] {
+			length = length<<8 | int(b)
+		}
+		pos += n
+	}
+
+	if !constructed {
+		if length < 0 || pos+length > len(data) {
+			return nil, nil, fmt.Errorf("truncated ASN.1 element")
+		}
+		return derElement(tag, data[pos:pos+length]), data[pos+length:], nil
+	}
+
+	var children [][]byte
+	var content []byte
+	if length >= 0 {
+		if pos+length > len(data) {
+			return nil, nil, fmt.Errorf("truncated ASN.1 element")
+		}
+		content = data[pos : pos+length]
+		for len(content) > 0 {
+			child, rest, err := berElement(content)
+			if err != nil {
+				return nil, nil, err
+			}
+			children = append(children, child)
+			content = rest
+		}
+		content = data[pos+length:]
+	} else {
+		content = data[pos:]
+		for {
+			if len(content) < 2 {
+				return nil, nil, fmt.Errorf("missing end-of-contents marker")
+			}
+			if content[0] == 0 && content[1] == 0 {
+				content = content[2:]
+				break
+			}
+			child, rest, err := berElement(content)
+			if err != nil {
+				return nil, nil, err
+			}
+			children = append(children, child)
+			content = rest
+		}
+	}
+
+	// Constructed OCTET STRINGs become one primitive OCTET STRING
+	if tag == 0x24 {
+		var joined []byte
+		for _, child := range children {
+			var chunk asn1.RawValue
+			if _, err := asn1.Unmarshal(child, &chunk); err != nil {
+				return nil, nil, err
+			}
+			joined = append(joined, chunk.Bytes...)
+		}
+		return derElement(0x04, joined), content, nil
+	}
+	return derElement(tag, bytes.Join(children, nil)), content, nil
+}
+
+// derElement encodes a tag, definite length and content
+func derElement(tag byte, content []byte) []byte {
+	out := []byte{tag}
+	switch n := len(content); {
+	case n < 0x80:
+		out = append(out, byte(n))
+	case n < 0x100:
+		out = append(out, 0x81, byte(n))
+	case n < 0x10000:
+		out = append(out, 0x82, byte(n>>8), byte(n))
+	case n < 0x1000000:
+		out = append(out, 0x83, byte(n>>16), byte(n>>8), byte(n))
+	default:
+		out = append(out, 0x84, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+	return append(out, content...)
+}
+
+// explicitTag wraps DER content in a context-specific constructed tag
+func explicitTag(tag int, content []byte) asn1.RawValue {
+	return asn1.RawValue{FullBytes: derElement(0xa0|byte(tag), content)}
+}
+
+// parseContentInfo parses a CMS ContentInfo, accepting BER
+func parseContentInfo(data []byte) (*contentInfo, error) {
+	der, err := berToDER(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse PKCS #7 structure: %w", err)
+	}
+	var ci contentInfo
+	if _, err := asn1.Unmarshal(der, &ci); err != nil {
+		return nil, fmt.Errorf("failed to parse PKCS #7 structure: %w", err)
+	}
+	return &ci, nil
+}
+
+// octetContent returns the bytes of an OCTET STRING that may have been split into
+// chunks under an implicit tag
+func octetContent(v asn1.RawValue) ([]byte, error) {
+	if !v.IsCompound {
+		return v.Bytes, nil
+	}
+	var out []byte
+	rest := v.Bytes
+	for len(rest) > 0 {
+		var chunk asn1.RawValue
+		var err error
+		if rest, err = asn1.Unmarshal(rest, &chunk); err != nil {
+			return nil, err
+		}
+		out = append(out, chunk.Bytes...)
+	}
+	return out, nil
+}
+
+// digestFor returns the hash for a digest algorithm OID
+func digestFor(oid asn1.ObjectIdentifier) (crypto.Hash, func() hash.Hash, error) {
+	switch {
+	case oid.Equal(oidSHA256):
+		return crypto.SHA256, sha256.New, nil
+	case oid.Equal(oidSHA384):
+		return crypto.SHA384, sha512.New384, nil
+	case oid.Equal(oidSHA512):
+		return crypto.SHA512, sha512.New, nil
+	case oid.Equal(oidSHA1):
+		return crypto.SHA1, sha1.New, nil
+	}
+	return 0, nil, fmt.Errorf("unsupported digest algorithm %v", oid)
+}
+
+// signatureAlgorithm maps a CMS digest and signature algorithm to the x509 equivalent
+func signatureAlgorithm(digest crypto.Hash, sigAlg asn1.ObjectIdentifier) (x509.SignatureAlgorithm, error) {
+	switch {
+	case sigAlg.Equal(oidRSAEncryption):
+		switch digest {
+		case crypto.SHA1:
+			return x509.SHA1WithRSA, nil
+		case crypto.SHA256:
+			return x509.SHA256WithRSA, nil
+		case crypto.SHA384:
+			return x509.SHA384WithRSA, nil
+		case crypto.SHA512:
+			return x509.SHA512WithRSA, nil
+		}
+	case sigAlg.Equal(oidSHA1WithRSA):
+		return x509.SHA1WithRSA, nil
+	case sigAlg.Equal(oidSHA256WithRSA):
+		return x509.SHA256WithRSA, nil
+	case sigAlg.Equal(oidSHA384WithRSA):
+		return x509.SHA384WithRSA, nil
+	case sigAlg.Equal(oidSHA512WithRSA):
+		return x509.SHA512WithRSA, nil
+	case sigAlg.Equal(oidECDSAWithSHA256), sigAlg.Equal(oidECPublicKey) && digest == crypto.SHA256:
+		return x509.ECDSAWithSHA256, nil
+	case sigAlg.Equal(oidECDSAWithSHA384), sigAlg.Equal(oidECPublicKey) && digest == crypto.SHA384:
+		return x509.ECDSAWithSHA384, nil
+	case sigAlg.Equal(oidECDSAWithSHA512), sigAlg.Equal(oidECPublicKey) && digest == crypto.SHA512:
+		return x509.ECDSAWithSHA512, nil
+	}
+	return x509.UnknownSignatureAlgorithm, fmt.Errorf("unsupported signature algorithm %v", sigAlg)
+}
+
+// matchesIdentifier reports whether a SignerIdentifier or RecipientIdentifier names cert
+func matchesIdentifier(id asn1.RawValue, cert *x509.Certificate) bool {
+	if id.Class == asn1.ClassContextSpecific && id.Tag == 0 {
+		return len(cert.SubjectKeyId) > 0 && bytes.Equal(id.Bytes, cert.SubjectKeyId)
+	}
+	var ias issuerAndSerial
+	if _, err := asn1.Unmarshal(id.FullBytes, &ias); err != nil {
+		return false
+	}
+	return bytes.Equal(ias.Issuer.FullBytes, cert.RawIssuer) && ias.SerialNumber.Cmp(cert.SerialNumber) == 0
+}
+
+// issuerAndSerialFor returns the DER IssuerAndSerialNumber of a certificate
+func issuerAndSerialFor(cert *x509.Certificate) (asn1.RawValue, error) {
+	der, err := asn1.Marshal(issuerAndSerial{Issuer: asn1.RawValue{FullBytes: cert.RawIssuer}, SerialNumber: cert.SerialNumber})
+	return asn1.RawValue{FullBytes: der}, err
+}
+
+// VerifyCMSSignature checks a SignedData structure. content is the signed data for
+// detached signatures; for encapsulated signatures pass nil and the content is returned.
+// Certificate trust is not evaluated here.
+func VerifyCMSSignature(p7 []byte, content []byte) ([]byte, *CMSSigner, error) {
+	ci, err := parseContentInfo(p7)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !ci.ContentType.Equal(oidSignedData) {
+		return nil, nil, fmt.Errorf("PKCS #7 content is not signed data")
+	}
+	var sd signedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse signed data: %w", err)
+	}
+	if content == nil {
+		// The explicit [0] tag wraps an OCTET STRING
+		var eContent asn1.RawValue
+		if _, err := asn1.Unmarshal(sd.EncapContentInfo.EContent.Bytes, &eContent); err != nil || len(eContent.Bytes) == 0 {
+			return nil, nil, fmt.Errorf("signature is detached but no content was given")
+		}
+		content = eContent.Bytes
+	}
+
+	var certs []*x509.Certificate
+	if len(sd.Certificates.Bytes) > 0 {
+		if certs, err = x509.ParseCertificates(sd.Certificates.Bytes); err != nil {
+			return nil, nil, fmt.Errorf("failed to parse signer certificates: %w", err)
+		}
+	}
+	if len(sd.SignerInfos) == 0 {
+		return nil, nil, fmt.Errorf("message has no signers")
+	}
+
+	si := sd.SignerInfos[0]
+	signer := &CMSSigner{}
+	for _, cert := range certs {
+		if matchesIdentifier(si.SID, cert) {
+			signer.Certificate = cert
+		} else {
+			signer.Chain = append(signer.Chain, cert)
+		}
+	}
+	if signer.Certificate == nil {
+		return content, nil, fmt.Errorf("signer certificate is not included in the message")
+	}
+
+	digest, newHash, err := digestFor(si.DigestAlgorithm.Algorithm)
+	if err != nil {
+		return content, signer, err
+	}
+	sigAlg, err := signatureAlgorithm(digest, si.SignatureAlgorithm.Algorithm)
+	if err != nil {
+		return content, signer, err
+	}
+	h := newHash()
+	h.Write(content)
+	contentDigest := h.Sum(nil)
+
+	signed := content
+	if len(si.SignedAttrs.Bytes) > 0 {
+		var messageDigest []byte
+		rest := si.SignedAttrs.Bytes
+		for len(rest) > 0 {
+			var attr attribute
+			if rest, err = asn1.Unmarshal(rest, &attr); err != nil {
+				return content, signer, fmt.Errorf("failed to parse signed attributes: %w", err)
+			}
+			switch {
+			case attr.Type.Equal(oidAttrMessageDigest):
+				asn1.Unmarshal(attr.Values.Bytes, &messageDigest)
+			case attr.Type.Equal(oidAttrSigningTime):
+				asn1.Unmarshal(attr.Values.Bytes, &signer.SigningTime)
+			}
+		}
+		if !bytes.Equal(messageDigest, contentDigest) {
+			return content, signer, fmt.Errorf("message digest does not match the content")
+		}
+		// The signature covers the attributes encoded as a SET, not the [0] IMPLICIT tag
+		signed = append([]byte{0x31}, si.SignedAttrs.FullBytes[1:]...)
+	}
+
+	if err := signer.Certificate.CheckSignature(sigAlg, signed, si.Signature); err != nil {
+		return content, signer, fmt.Errorf("signature did not verify: %w", err)
+	}
+	return content, signer, nil
+}
+
+// SignCMS creates a detached SignedData over content with SHA-256, including the
+// signer certificate and chain
+func SignCMS(content []byte, cert *x509.Certificate, chain []*x509.Certificate, key crypto.Signer, now time.Time) ([]byte, error) {
+	var sigAlg pkix.AlgorithmIdentifier
+	switch key.Public().(type) {
+	case *rsa.PublicKey:
+		sigAlg = pkix.AlgorithmIdentifier{Algorithm: oidRSAEncryption, Parameters: asn1.NullRawValue}
+	case *ecdsa.PublicKey:
+		sigAlg = pkix.AlgorithmIdentifier{Algorithm: oidECDSAWithSHA256}
+	default:
+		return nil, fmt.Errorf("unsupported S/MIME key type %T (use RSA or ECDSA)", key.Public())
+	}
+
+	digest := sha256.Sum256(content)
+	attrs, err := signedAttributes(digest[:], now)
+	if err != nil {
+		return nil, err
+	}
+	attrsDigest := sha256.Sum256(derElement(0x31, attrs))
+	signature, err := key.Sign(rand.Reader, attrsDigest[:], crypto.SHA256)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign message: %w", err)
+	}
+
+	sid, err := issuerAndSerialFor(cert)
+	if err != nil {
+		return nil, err
+	}
+	var certs []byte
+	for _, c := range append([]*x509.Certificate{cert}, chain...) {
+		certs = append(certs, c.Raw...)
+	}
+	sha256ID := pkix.AlgorithmIdentifier{Algorithm: oidSHA256, Parameters: asn1.NullRawValue}
+	sd := signedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{sha256ID},
+		EncapContentInfo: encapsulatedContentInfo{EContentType: oidData},
+		Certificates:     asn1.RawValue{FullBytes: derElement(0xa0, certs)},
+		SignerInfos: []signerInfo{{
+			Version:            1,
+			SID:                sid,
+			DigestAlgorithm:    sha256ID,
+			SignedAttrs:        asn1.RawValue{FullBytes: derElement(0xa0, attrs)},
+			SignatureAlgorithm: sigAlg,
+			Signature:          signature,
+		}},
+	}
+	return marshalContentInfo(oidSignedData, sd)
+}
+
+// signedAttributes encodes the contentType, signingTime and messageDigest attributes
+// in DER SET OF order
+func signedAttributes(digest []byte, now time.Time) ([]byte, error) {
+	values := []struct {
+		oid   asn1.ObjectIdentifier
+		value interface{}
+	}{
+		{oidAttrContentType, oidData},
+		{oidAttrSigningTime, now.UTC()},
+		{oidAttrMessageDigest, digest},
+	}
+	var encoded [][]byte
+	for _, v := range values {
+		value, err := asn1.Marshal(v.value)
+		if err != nil {
+			return nil, err
+		}
+		attr, err := asn1.Marshal(attribute{Type: v.oid, Values: asn1.RawValue{FullBytes: derElement(0x31, value)}})
+		if err != nil {
+			return nil, err
+		}
+		encoded = append(encoded, attr)
+	}
+	sort.Slice(encoded, func(i, j int) bool { return bytes.Compare(encoded[i], encoded[j]) < 0 })
+	return bytes.Join(encoded, nil), nil
+}
+
+// marshalContentInfo wraps a CMS structure in a ContentInfo
+func marshalContentInfo(contentType asn1.ObjectIdentifier, content interface{}) ([]byte, error) {
+	inner, err := asn1.Marshal(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode PKCS #7 structure: %w", err)
+	}
+	return asn1.Marshal(contentInfo{ContentType: contentType, Content: explicitTag(0, inner)})
+}
+
+// EncryptCMS creates an EnvelopedData with AES-256-CBC for the given RSA recipients
+func EncryptCMS(content []byte, recipients []*x509.Certificate) ([]byte, error) {
+	key := make([]byte, 32)
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(iv); err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	padding := aes.BlockSize - len(content)%aes.BlockSize
+	plain := append(append([]byte{}, content...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+	encrypted := make([]byte, len(plain))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, plain)
+
+	var infos []asn1.RawValue
+	for _, cert := range recipients {
+		pub, ok := cert.PublicKey.(*rsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("certificate for %s does not have an RSA key", cert.Subject.CommonName)
+		}
+		encryptedKey, err := rsa.EncryptPKCS1v15(rand.Reader, pub, key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encrypt content key: %w", err)
+		}
+		rid, err := issuerAndSerialFor(cert)
+		if err != nil {
+			return nil, err
+		}
+		der, err := asn1.Marshal(keyTransRecipientInfo{
+			RID:                    rid,
+			KeyEncryptionAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidRSAEncryption, Parameters: asn1.NullRawValue},
+			EncryptedKey:           encryptedKey,
+		})
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, asn1.RawValue{FullBytes: der})
+	}
+
+	ivParam, err := asn1.Marshal(iv)
+	if err != nil {
+		return nil, err
+	}
+	return marshalContentInfo(oidEnvelopedData, envelopedData{
+		RecipientInfos: infos,
+		EncryptedContentInfo: encryptedContentInfo{
+			ContentType:                oidData,
+			ContentEncryptionAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidAES256CBC, Parameters: asn1.RawValue{FullBytes: ivParam}},
+			EncryptedContent:           asn1.RawValue{FullBytes: derElement(0x80, encrypted)},
+		},
+	})
+}
+
+// DecryptCMS decrypts an EnvelopedData addressed to cert
+func DecryptCMS(p7 []byte, cert *x509.Certificate, key crypto.Decrypter) ([]byte, error) {
+	ci, err := parseContentInfo(p7)
+	if err != nil {
+		return nil, err
+	}
+	if !ci.ContentType.Equal(oidEnvelopedData) {
+		return nil, fmt.Errorf("PKCS #7 content is not enveloped data")
+	}
+	var ed envelopedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &ed); err != nil {
+		return nil, fmt.Errorf("failed to parse enveloped data: %w", err)
+	}
+
+	var contentKey []byte
+	for _, info := range ed.RecipientInfos {
+		var ktri keyTransRecipientInfo
+		if info.Class != asn1.ClassUniversal || info.Tag != asn1.TagSequence {
+			continue // Only key transport recipients are supported
+		}
+		if _, err := asn1.Unmarshal(info.FullBytes, &ktri); err != nil || !matchesIdentifier(ktri.RID, cert) {
+			continue
+		}
+		var opts crypto.DecrypterOpts
+		if ktri.KeyEncryptionAlgorithm.Algorithm.Equal(oidRSAOAEP) {
+			opts = &rsa.OAEPOptions{Hash: crypto.SHA1}
+		}
+		if contentKey, err = key.Decrypt(rand.Reader, ktri.EncryptedKey, opts); err != nil {
+			return nil, fmt.Errorf("failed to decrypt content key: %w", err)
+		}
+		break
+	}
+	if contentKey == nil {
+		return nil, errNoRecipient
+	}
+
+	eci := ed.EncryptedContentInfo
+	encrypted, err := octetContent(eci.EncryptedContent)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse encrypted content: %w", err)
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(eci.ContentEncryptionAlgorithm.Parameters.FullBytes, &iv); err != nil {
+		return nil, fmt.Errorf("failed to parse content encryption parameters: %w", err)
+	}
+
+	var block cipher.Block
+	alg := eci.ContentEncryptionAlgorithm.Algorithm
+	switch {
+	case alg.Equal(oidAES128CBC), alg.Equal(oidAES192CBC), alg.Equal(oidAES256CBC):
+		block, err = aes.NewCipher(contentKey)
+	case alg.Equal(oidDESEDE3CBC):
+		block, err = des.NewTripleDESCipher(contentKey)
+	default:
+		return nil, fmt.Errorf("unsupported content encryption algorithm %v", alg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt content: %w", err)
+	}
+	if len(iv) != block.BlockSize() || len(encrypted) == 0 || len(encrypted)%block.BlockSize() != 0 {
+		return nil, fmt.Errorf("failed to decrypt content: invalid length")
+	}
+	plain := make([]byte, len(encrypted))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, encrypted)
+
+	padding := int(plain[len(plain)-1])
+	if padding == 0 || padding > block.BlockSize() || !bytes.Equal(plain[len(plain)-padding:], bytes.Repeat([]byte{byte(padding)}, padding)) {
+		return nil, fmt.Errorf("failed to decrypt content: invalid padding")
+	}
+	return plain[:len(plain)-padding], nil
+}
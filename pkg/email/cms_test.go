@@ -0,0 +1,108 @@
+package email
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// testCertificate issues a certificate for address, signed by parent (self-signed when nil)
+func testCertificate(t *testing.T, address string, key crypto.Signer, parent *x509.Certificate, parentKey crypto.Signer) *x509.Certificate {
+	t.Helper()
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	template := &x509.Certificate{
+		SerialNumber:   serial,
+		Subject:        pkix.Name{CommonName: address},
+		EmailAddresses: []string{address},
+		NotBefore:      time.Now().Add(-time.Hour),
+		NotAfter:       time.Now().Add(24 * time.Hour),
+		KeyUsage:       x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection},
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestCMSSignVerify(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	content := []byte("Content-Type: text/plain\r\n\r\nSigned body\r\n")
+
+	for name, key := range map[string]crypto.Signer{"rsa": rsaKey, "ecdsa": ecKey} {
+		cert := testCertificate(t, "alice@example.com", key, nil, nil)
+		p7, err := SignCMS(content, cert, nil, key, time.Now())
+		if err != nil {
+			t.Fatalf("%s: failed to sign: %v", name, err)
+		}
+
+		_, info, err := VerifyCMSSignature(p7, content)
+		if err != nil || info.Certificate.Subject.CommonName != "alice@example.com" || info.SigningTime.IsZero() {
+			t.Errorf("%s: expected a valid signature, got %+v (%v)", name, info, err)
+		}
+		if _, _, err := VerifyCMSSignature(p7, bytes.Replace(content, []byte("Signed"), []byte("Forged"), 1)); err == nil {
+			t.Errorf("%s: expected modified content to fail", name)
+		}
+	}
+}
+
+func TestCMSEncryptDecrypt(t *testing.T) {
+	aliceKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	bobKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	eveKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	alice := testCertificate(t, "alice@example.com", aliceKey, nil, nil)
+	bob := testCertificate(t, "bob@example.org", bobKey, nil, nil)
+	eve := testCertificate(t, "eve@example.net", eveKey, nil, nil)
+	content := bytes.Repeat([]byte("secret line\r\n"), 100)
+
+	p7, err := EncryptCMS(content, []*x509.Certificate{alice, bob})
+	if err != nil {
+		t.Fatalf("Failed to encrypt: %v", err)
+	}
+	for _, r := range []struct {
+		cert *x509.Certificate
+		key  *rsa.PrivateKey
+	}{{alice, aliceKey}, {bob, bobKey}} {
+		plain, err := DecryptCMS(p7, r.cert, r.key)
+		if err != nil || !bytes.Equal(plain, content) {
+			t.Errorf("Expected %s to decrypt, got %v", r.cert.Subject.CommonName, err)
+		}
+	}
+	if _, err := DecryptCMS(p7, eve, eveKey); err != errNoRecipient {
+		t.Errorf("Expected errNoRecipient for eve, got %v", err)
+	}
+}
+
+func TestBERToDER(t *testing.T) {
+	// SEQUENCE (indefinite) { constructed OCTET STRING (indefinite) { "ab", "cd" } }
+	ber := []byte{0x30, 0x80, 0x24, 0x80, 0x04, 0x02, 'a', 'b', 0x04, 0x02, 'c', 'd', 0x00, 0x00, 0x00, 0x00}
+	want := []byte{0x30, 0x06, 0x04, 0x04, 'a', 'b', 'c', 'd'}
+
+	der, err := berToDER(ber)
+	if err != nil || !bytes.Equal(der, want) {
+		t.Errorf("Expected %x, got %x (%v)", want, der, err)
+	}
+	if _, err := berToDER([]byte{0x30, 0x80, 0x04, 0x01}); err == nil {
+		t.Error("Expected truncated input to fail")
+	}
+}
@@ -0,0 +1,392 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DKIM result values, as used in Authentication-Results (RFC 8601)
+const (
+	DKIMPass      = "pass"
+	DKIMFail      = "fail"
+	DKIMNone      = "none"
+	DKIMPermError = "permerror"
+	DKIMTempError = "temperror"
+)
+
+// TXTResolver looks up DNS TXT records. *net.Resolver satisfies it; tests can stub it.
+type TXTResolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+// DefaultResolver is the resolver used when none is configured
+var DefaultResolver TXTResolver = net.DefaultResolver
+
+// rawHeaderField is a header field exactly as it appears in a message, folding included
+type rawHeaderField struct {
+	name string // As written
+	raw  string // "Name: value\r\n" including continuation lines
+}
+
+// dkimSignature holds the parsed tags of a DKIM-Signature header
+type dkimSignature struct {
+	algorithm   string
+	signature   []byte
+	bodyHash    []byte
+	headerCanon string
+	bodyCanon   string
+	domain      string
+	selector    string
+	headers     []string
+	bodyLength  int64 // -1 when absent
+	expires     time.Time
+	field       rawHeaderField
+}
+
+// toCRLF converts bare LF line endings to CRLF
+func toCRLF(data []byte) []byte {
+	if !bytes.Contains(data, []byte("\n")) {
+		return data
+	}
+	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+	return bytes.ReplaceAll(data, []byte("\n"), []byte("\r\n"))
+}
+
+// splitRawMessage separates a CRLF message into header fields and body
+func splitRawMessage(raw []byte) ([]rawHeaderField, []byte) {
+	var header, body []byte
+	if i := bytes.Index(raw, []byte("\r\n\r\n")); i >= 0 {
+		header, body = raw[:i+2], raw[i+4:]
+	} else {
+		header = raw
+	}
+
+	var fields []rawHeaderField
+	for _, line := range strings.SplitAfter(string(header), "\r\n") {
+		if line == "" {
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(fields) > 0 {
+			fields[len(fields)-1].raw += line
+			continue
+		}
+		name := line
+		if i := strings.IndexByte(line, ':'); i >= 0 {
+			name = line[:i]
+		}
+		fields = append(fields, rawHeaderField{name: strings.TrimSpace(name), raw: line})
+	}
+	return fields, body
+}
+
+// wspRun matches runs of spaces and tabs
+var wspRun = regexp.MustCompile(`[ \t]+`)
+
+// canonicalizeHeader applies the simple or relaxed header algorithm (RFC 6376 3.4.1-2)
+func canonicalizeHeader(field rawHeaderField, canon string) string {
+	if canon != "relaxed" {
+		return field.raw
+	}
+	value := field.raw
+	if i := strings.IndexByte(value, ':'); i >= 0 {
+		value = value[i+1:]
+	}
+	value = strings.ReplaceAll(value, "\r\n", "")
+	value = wspRun.ReplaceAllString(value, " ")
+	return strings.ToLower(strings.TrimSpace(field.name)) + ":" + strings.TrimSpace(value) + "\r\n"
+}
+
+// canonicalizeBody applies the simple or relaxed body algorithm (RFC 6376 3.4.3-4)
+func canonicalizeBody(body []byte, canon string) []byte {
+	if canon == "relaxed" {
+		lines := bytes.Split(body, []byte("\r\n"))
+		for i, line := range lines {
+			line = wspRun.ReplaceAll(line, []byte(" "))
+			lines[i] = bytes.TrimRight(line, " ")
+		}
+		body = bytes.Join(lines, []byte("\r\n"))
+	}
+
+	// Remove trailing empty lines
+	for bytes.HasSuffix(body, []byte("\r\n")) {
+		body = body[:len(body)-2]
+	}
+	if len(body) == 0 {
+		if canon == "relaxed" {
+			return nil
+		}
+		return []byte("\r\n")
+	}
+	return append(body, '\r', '\n')
+}
+
+// parseTagList parses a DKIM tag=value list
+func parseTagList(value string) map[string]string {
+	tags := make(map[string]string)
+	for _, part := range strings.Split(value, ";") {
+		k, v, ok := strings.Cut(part, "=")
+		if !ok {
+			continue
+		}
+		tags[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return tags
+}
+
+// stripFWS removes all whitespace, as required for base64 tag values
+func stripFWS(value string) string {
+	return strings.Join(strings.Fields(value), "")
+}
+
+// parseDKIMSignature parses a DKIM-Signature header field
+func parseDKIMSignature(field rawHeaderField) (*dkimSignature, error) {
+	value := field.raw[strings.IndexByte(field.raw, ':')+1:]
+	tags := parseTagList(value)
+
+	if tags["v"] != "1" {
+		return nil, fmt.Errorf("unsupported DKIM version %q", tags["v"])
+	}
+	sig := &dkimSignature{
+		algorithm:  strings.ToLower(tags["a"]),
+		domain:     strings.ToLower(tags["d"]),
+		selector:   tags["s"],
+		bodyLength: -1,
+		field:      field,
+	}
+	if sig.domain == "" || sig.selector == "" || tags["h"] == "" {
+		return nil, fmt.Errorf("DKIM signature is missing d=, s= or h=")
+	}
+
+	var err error
+	if sig.signature, err = base64.StdEncoding.DecodeString(stripFWS(tags["b"])); err != nil || len(sig.signature) == 0 {
+		return nil, fmt.Errorf("invalid DKIM b= tag")
+	}
+	if sig.bodyHash, err = base64.StdEncoding.DecodeString(stripFWS(tags["bh"])); err != nil || len(sig.bodyHash) == 0 {
+		return nil, fmt.Errorf("invalid DKIM bh= tag")
+	}
+
+	sig.headerCanon, sig.bodyCanon = "simple", "simple"
+	if c := strings.ToLower(tags["c"]); c != "" {
+		h, b, found := strings.Cut(c, "/")
+		sig.headerCanon = h
+		if found {
+			sig.bodyCanon = b
+		}
+	}
+	for _, canon := range []string{sig.headerCanon, sig.bodyCanon} {
+		if canon != "simple" && canon != "relaxed" {
+			return nil, fmt.Errorf("unsupported DKIM canonicalization %q", canon)
+		}
+	}
+
+	for _, h := range strings.Split(tags["h"], ":") {
+		sig.headers = append(sig.headers, strings.TrimSpace(h))
+	}
+	if !containsFold(sig.headers, "From") {
+		return nil, fmt.Errorf("DKIM signature does not cover the From header")
+	}
+
+	if l := stripFWS(tags["l"]); l != "" {
+		if sig.bodyLength, err = strconv.ParseInt(l, 10, 64); err != nil || sig.bodyLength < 0 {
+			return nil, fmt.Errorf("invalid DKIM l= tag")
+		}
+	}
+	if x := stripFWS(tags["x"]); x != "" {
+		ts, err := strconv.ParseInt(x, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid DKIM x= tag")
+		}
+		sig.expires = time.Unix(ts, 0)
+	}
+	return sig, nil
+}
+
+// hashAlgorithm returns the hash for a DKIM algorithm
+func hashAlgorithm(algorithm string) (crypto.Hash, func() hash.Hash, error) {
+	switch algorithm {
+	case "rsa-sha256", "ed25519-sha256":
+		return crypto.SHA256, sha256.New, nil
+	case "rsa-sha1":
+		return crypto.SHA1, sha1.New, nil
+	}
+	return 0, nil, fmt.Errorf("unsupported DKIM algorithm %q", algorithm)
+}
+
+// bValuePattern matches the value of the b= tag (but not bh=) in a DKIM-Signature
+var bValuePattern = regexp.MustCompile(`((?:^|;)\s*b\s*=)[^;]*`)
+
+// signedHeaderData returns the canonicalized header fields covered by a signature,
+// followed by the signature field itself with an empty b= value and no trailing CRLF
+func signedHeaderData(fields []rawHeaderField, headers []string, sigField rawHeaderField, canon string) []byte {
+	var buf bytes.Buffer
+	used := make(map[int]bool)
+	for _, name := range headers {
+		// Instances are used from the bottom of the header upwards
+		for i := len(fields) - 1; i >= 0; i-- {
+			if used[i] || !strings.EqualFold(fields[i].name, name) {
+				continue
+			}
+			used[i] = true
+			buf.WriteString(canonicalizeHeader(fields[i], canon))
+			break
+		}
+	}
+
+	colon := strings.IndexByte(sigField.raw, ':')
+	emptied := sigField
+	emptied.raw = sigField.raw[:colon+1] + bValuePattern.ReplaceAllString(sigField.raw[colon+1:], "${1}")
+	buf.WriteString(strings.TrimSuffix(canonicalizeHeader(emptied, canon), "\r\n"))
+	return buf.Bytes()
+}
+
+// lookupDKIMKey fetches and parses the public key of a selector
+func lookupDKIMKey(ctx context.Context, resolver TXTResolver, selector, domain string) (crypto.PublicKey, error) {
+	records, err := resolver.LookupTXT(ctx, selector+"._domainkey."+domain)
+	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return nil, &dkimError{DKIMPermError, "no key for signature"}
+		}
+		return nil, &dkimError{DKIMTempError, fmt.Sprintf("key lookup failed: %v", err)}
+	}
+	if len(records) == 0 {
+		return nil, &dkimError{DKIMPermError, "no key for signature"}
+	}
+
+	tags := parseTagList(strings.Join(records, ""))
+	if v, ok := tags["v"]; ok && v != "DKIM1" {
+		return nil, &dkimError{DKIMPermError, "invalid key record version"}
+	}
+	p := stripFWS(tags["p"])
+	if p == "" {
+		return nil, &dkimError{DKIMPermError, "key revoked"}
+	}
+	der, err := base64.StdEncoding.DecodeString(p)
+	if err != nil {
+		return nil, &dkimError{DKIMPermError, "invalid key encoding"}
+	}
+
+	switch strings.ToLower(tags["k"]) {
+	case "", "rsa":
+		if pub, err := x509.ParsePKIXPublicKey(der); err == nil {
+			if rsaKey, ok := pub.(*rsa.PublicKey); ok {
+				return rsaKey, nil
+			}
+		}
+		if rsaKey, err := x509.ParsePKCS1PublicKey(der); err == nil {
+			return rsaKey, nil
+		}
+		return nil, &dkimError{DKIMPermError, "invalid RSA key"}
+	case "ed25519":
+		if len(der) != ed25519.PublicKeySize {
+			return nil, &dkimError{DKIMPermError, "invalid Ed25519 key"}
+		}
+		return ed25519.PublicKey(der), nil
+	}
+	return nil, &dkimError{DKIMPermError, fmt.Sprintf("unsupported key type %q", tags["k"])}
+}
+
+// dkimError carries the result a verification problem maps to
+type dkimError struct {
+	result string
+	reason string
+}
+
+func (e *dkimError) Error() string {
+	return e.reason
+}
+
+// verifySignature checks one DKIM signature against the message
+func verifySignature(ctx context.Context, resolver TXTResolver, sig *dkimSignature, fields []rawHeaderField, body []byte, now time.Time) error {
+	cryptoHash, newHash, err := hashAlgorithm(sig.algorithm)
+	if err != nil {
+		return &dkimError{DKIMPermError, err.Error()}
+	}
+	if !sig.expires.IsZero() && now.After(sig.expires) {
+		return &dkimError{DKIMFail, "signature expired"}
+	}
+
+	canonBody := canonicalizeBody(body, sig.bodyCanon)
+	if sig.bodyLength >= 0 {
+		if sig.bodyLength > int64(len(canonBody)) {
+			return &dkimError{DKIMFail, "l= exceeds body length"}
+		}
+		canonBody = canonBody[:sig.bodyLength]
+	}
+	h := newHash()
+	h.Write(canonBody)
+	if !bytes.Equal(h.Sum(nil), sig.bodyHash) {
+		return &dkimError{DKIMFail, "body hash did not verify"}
+	}
+
+	key, err := lookupDKIMKey(ctx, resolver, sig.selector, sig.domain)
+	if err != nil {
+		return err
+	}
+
+	h = newHash()
+	h.Write(signedHeaderData(fields, sig.headers, sig.field, sig.headerCanon))
+	digest := h.Sum(nil)
+
+	switch pub := key.(type) {
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(sig.algorithm, "rsa-") {
+			return &dkimError{DKIMPermError, "key type does not match algorithm"}
+		}
+		if err := rsa.VerifyPKCS1v15(pub, cryptoHash, digest, sig.signature); err != nil {
+			return &dkimError{DKIMFail, "signature did not verify"}
+		}
+	case ed25519.PublicKey:
+		if sig.algorithm != "ed25519-sha256" {
+			return &dkimError{DKIMPermError, "key type does not match algorithm"}
+		}
+		if !ed25519.Verify(pub, digest, sig.signature) {
+			return &dkimError{DKIMFail, "signature did not verify"}
+		}
+	}
+	return nil
+}
+
+// VerifyDKIM checks every DKIM-Signature of a raw message, looking up keys with resolver
+func VerifyDKIM(ctx context.Context, raw []byte, resolver TXTResolver) []DKIMResult {
+	if resolver == nil {
+		resolver = DefaultResolver
+	}
+	fields, body := splitRawMessage(toCRLF(raw))
+
+	var results []DKIMResult
+	for _, field := range fields {
+		if !strings.EqualFold(field.name, "DKIM-Signature") {
+			continue
+		}
+		result := DKIMResult{Result: DKIMPass, Source: AuthSourceLocal}
+		sig, err := parseDKIMSignature(field)
+		if err == nil {
+			result.Domain, result.Selector = sig.domain, sig.selector
+			err = verifySignature(ctx, resolver, sig, fields, body, time.Now())
+		} else {
+			err = &dkimError{DKIMPermError, err.Error()}
+		}
+		var dErr *dkimError
+		if errors.As(err, &dErr) {
+			result.Result, result.Reason = dErr.result, dErr.reason
+		}
+		results = append(results, result)
+	}
+	return results
+}
@@ -0,0 +1,119 @@
+package email
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/prasanthmj/email/pkg/config"
+)
+
+// LoadDKIMKey reads a PEM-encoded RSA (PKCS #1 or PKCS #8) or Ed25519 (PKCS #8) private key
+func LoadDKIMKey(path string) (crypto.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read DKIM private key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("failed to parse DKIM private key: no PEM block in %s", path)
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse DKIM private key: %w", err)
+	}
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return k, nil
+	case ed25519.PrivateKey:
+		return k, nil
+	}
+	return nil, fmt.Errorf("unsupported DKIM private key type %T (use RSA or Ed25519)", key)
+}
+
+// SignDKIM prepends a DKIM-Signature header (RFC 6376) to a raw message. Configured
+// headers are signed if the message has them; line endings are normalized to CRLF.
+func SignDKIM(raw []byte, settings config.DKIMSigning, key crypto.Signer, now time.Time) ([]byte, error) {
+	algorithm := "rsa-sha256"
+	if _, ok := key.(ed25519.PrivateKey); ok {
+		algorithm = "ed25519-sha256"
+	}
+
+	raw = toCRLF(raw)
+	fields, body := splitRawMessage(raw)
+
+	var headers []string
+	present := make(map[string]int)
+	for _, f := range fields {
+		present[strings.ToLower(f.name)]++
+	}
+	for _, name := range settings.Headers {
+		// Sign every instance of repeated headers
+		for i := 0; i < present[name]; i++ {
+			headers = append(headers, name)
+		}
+	}
+	if present["from"] == 0 {
+		return nil, fmt.Errorf("failed to sign message: no From header")
+	}
+
+	bodyHash := sha256.Sum256(canonicalizeBody(body, settings.BodyCanon))
+	value := fmt.Sprintf(" v=1; a=%s; c=%s/%s; d=%s; s=%s; t=%d;\r\n\th=%s;\r\n\tbh=%s;\r\n\tb=",
+		algorithm, settings.HeaderCanon, settings.BodyCanon, settings.Domain, settings.Selector, now.Unix(),
+		strings.Join(headers, ":"), base64.StdEncoding.EncodeToString(bodyHash[:]))
+	field := rawHeaderField{name: "DKIM-Signature", raw: "DKIM-Signature:" + value + "\r\n"}
+
+	digest := sha256.Sum256(signedHeaderData(fields, headers, field, settings.HeaderCanon))
+	var signature []byte
+	var err error
+	if algorithm == "ed25519-sha256" {
+		// Ed25519 signs the SHA-256 digest as the message (RFC 8463)
+		signature, err = key.Sign(rand.Reader, digest[:], crypto.Hash(0))
+	} else {
+		signature, err = key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign message: %w", err)
+	}
+
+	signed := make([]byte, 0, len(field.raw)+len(raw)+len(signature)*2)
+	signed = append(signed, "DKIM-Signature:"+value+foldBase64(base64.StdEncoding.EncodeToString(signature))+"\r\n"...)
+	return append(signed, raw...), nil
+}
+
+// foldBase64 splits a long base64 value into folded lines
+func foldBase64(value string) string {
+	var b strings.Builder
+	for len(value) > 72 {
+		b.WriteString(value[:72])
+		b.WriteString("\r\n\t ")
+		value = value[72:]
+	}
+	b.WriteString(value)
+	return b.String()
+}
+
+// signMessage DKIM-signs rendered message bytes when the account has signing configured
+func (sc *SMTPClient) signMessage(raw []byte) ([]byte, error) {
+	if !sc.config.DKIM.Enabled() {
+		return raw, nil
+	}
+	key, err := LoadDKIMKey(sc.config.DKIM.PrivateKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	return SignDKIM(raw, sc.config.DKIM, key, time.Now())
+}
@@ -0,0 +1,136 @@
+package email
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prasanthmj/email/pkg/config"
+)
+
+// writeKey stores a private key as PEM and returns the resolver record for its public key
+func writeKey(t *testing.T, path string, key, public interface{}) string {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if edKey, ok := public.(ed25519.PublicKey); ok {
+		return "v=DKIM1; k=ed25519; p=" + base64.StdEncoding.EncodeToString(edKey)
+	}
+	pub, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return "v=DKIM1; k=rsa; p=" + base64.StdEncoding.EncodeToString(pub)
+}
+
+func TestDKIMSigningRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPublic, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolver := stubResolver{
+		"rsa._domainkey.example.com": writeKey(t, filepath.Join(dir, "rsa.pem"), rsaKey, &rsaKey.PublicKey),
+		"ed._domainkey.example.com":  writeKey(t, filepath.Join(dir, "ed.pem"), edKey, edPublic),
+	}
+
+	tests := []struct {
+		selector string
+		canon    string
+	}{
+		{"rsa", "relaxed/relaxed"},
+		{"rsa", "simple/simple"},
+		{"ed", "relaxed/simple"},
+	}
+	for _, tt := range tests {
+		headerCanon, bodyCanon, _ := strings.Cut(tt.canon, "/")
+		sc := NewSMTPClient(&config.AccountConfig{
+			EmailAddress: "sender@example.com",
+			DKIM: config.DKIMSigning{
+				Selector:       tt.selector,
+				Domain:         "example.com",
+				PrivateKeyFile: filepath.Join(dir, tt.selector+".pem"),
+				Headers:        config.DefaultDKIMHeaders,
+				HeaderCanon:    headerCanon,
+				BodyCanon:      bodyCanon,
+			},
+		})
+
+		raw, err := sc.buildMessage(SendOptions{
+			To:       []string{"recipient@example.org"},
+			CC:       []string{"copy@example.org"},
+			Subject:  "Signed update",
+			Body:     "Hello,\n\nthis message is signed.  \n",
+			HTMLBody: "<p>Hello, this message is signed.</p>",
+			ReplyTo:  []string{"help@example.com"},
+		})
+		if err != nil {
+			t.Fatalf("%s %s: failed to build message: %v", tt.selector, tt.canon, err)
+		}
+		if !strings.HasPrefix(string(raw), "DKIM-Signature: v=1; a=") || !strings.Contains(string(raw), "c="+tt.canon) {
+			t.Fatalf("%s %s: expected a DKIM-Signature header first, got:\n%.300s", tt.selector, tt.canon, raw)
+		}
+
+		results := VerifyDKIM(context.Background(), raw, resolver)
+		if len(results) != 1 || results[0].Result != DKIMPass || results[0].Selector != tt.selector {
+			t.Errorf("%s %s: expected signature to verify, got %+v", tt.selector, tt.canon, results)
+		}
+
+		tampered := strings.Replace(string(raw), "Subject: Signed update", "Subject: Changed", 1)
+		if results := VerifyDKIM(context.Background(), []byte(tampered), resolver); results[0].Result != DKIMFail {
+			t.Errorf("%s %s: expected tampered subject to fail, got %+v", tt.selector, tt.canon, results)
+		}
+	}
+}
+
+func TestSignDKIMHeaders(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings := config.DKIMSigning{
+		Selector:    "s1",
+		Domain:      "example.com",
+		Headers:     []string{"from", "subject", "x-missing"},
+		HeaderCanon: "relaxed",
+		BodyCanon:   "relaxed",
+	}
+
+	signed, err := SignDKIM([]byte(testMessage), settings, key, time.Unix(1700000000, 0))
+	if err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+	fields, _ := splitRawMessage(signed)
+	sig, err := parseDKIMSignature(fields[0])
+	if err != nil {
+		t.Fatalf("Failed to parse signature: %v", err)
+	}
+	if strings.Join(sig.headers, ":") != "from:subject" || sig.domain != "example.com" || sig.selector != "s1" {
+		t.Errorf("Unexpected signature tags: %+v", sig)
+	}
+	if !strings.Contains(fields[0].raw, "t=1700000000;") {
+		t.Errorf("Expected signing timestamp, got %s", fields[0].raw)
+	}
+
+	if _, err := SignDKIM([]byte("Subject: no sender\r\n\r\nbody"), settings, key, time.Now()); err == nil {
+		t.Error("Expected error for a message without From")
+	}
+}
@@ -0,0 +1,149 @@
+package email
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+)
+
+// stubResolver serves DKIM key records from a map
+type stubResolver map[string]string
+
+func (r stubResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	if record, ok := r[name]; ok {
+		return []string{record}, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+}
+
+const testMessage = "From: Alice <alice@example.com>\r\n" +
+	"To: bob@example.org\r\n" +
+	"Subject:  Quarterly   report\r\n" +
+	"\r\n" +
+	"Hi Bob,  \r\n" +
+	"the report is attached.\r\n" +
+	"\r\n\r\n"
+
+// testSign adds a relaxed/relaxed DKIM-Signature to msg using sign for the header hash
+func testSign(t *testing.T, msg, algorithm string, sign func(digest []byte) []byte) string {
+	t.Helper()
+	fields, body := splitRawMessage([]byte(msg))
+	bh := sha256.Sum256(canonicalizeBody(body, "relaxed"))
+	value := fmt.Sprintf(" v=1; a=%s; c=relaxed/relaxed; d=example.com; s=sel;\r\n\th=from:to:subject; bh=%s; b=",
+		algorithm, base64.StdEncoding.EncodeToString(bh[:]))
+	field := rawHeaderField{name: "DKIM-Signature", raw: "DKIM-Signature:" + value + "\r\n"}
+
+	digest := sha256.Sum256(signedHeaderData(fields, []string{"from", "to", "subject"}, field, "relaxed"))
+	sig := base64.StdEncoding.EncodeToString(sign(digest[:]))
+	return "DKIM-Signature:" + value + sig + "\r\n" + msg
+}
+
+func TestVerifyDKIM(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, _ := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	resolver := stubResolver{"sel._domainkey.example.com": "v=DKIM1; k=rsa; p=" + base64.StdEncoding.EncodeToString(der)}
+
+	signed := testSign(t, testMessage, "rsa-sha256", func(digest []byte) []byte {
+		sig, err := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sig
+	})
+
+	results := VerifyDKIM(context.Background(), []byte(signed), resolver)
+	if len(results) != 1 || results[0].Result != DKIMPass || results[0].Domain != "example.com" || results[0].Source != AuthSourceLocal {
+		t.Fatalf("Expected a local pass for example.com, got %+v", results)
+	}
+
+	// Relaxed canonicalization tolerates whitespace changes and LF line endings
+	relaxed := strings.ReplaceAll(strings.Replace(signed, "Subject:  Quarterly", "Subject: Quarterly", 1), "\r\n", "\n")
+	if results := VerifyDKIM(context.Background(), []byte(relaxed), resolver); results[0].Result != DKIMPass {
+		t.Errorf("Expected relaxed changes to pass, got %+v", results)
+	}
+
+	tampered := strings.Replace(signed, "attached", "deleted", 1)
+	if results := VerifyDKIM(context.Background(), []byte(tampered), resolver); results[0].Result != DKIMFail || !strings.Contains(results[0].Reason, "body hash") {
+		t.Errorf("Expected body hash failure, got %+v", results)
+	}
+
+	forged := strings.Replace(signed, "bob@example.org", "eve@example.org", 1)
+	if results := VerifyDKIM(context.Background(), []byte(forged), resolver); results[0].Result != DKIMFail {
+		t.Errorf("Expected signature failure for a changed header, got %+v", results)
+	}
+
+	if results := VerifyDKIM(context.Background(), []byte(signed), stubResolver{}); results[0].Result != DKIMPermError {
+		t.Errorf("Expected permerror without a key, got %+v", results)
+	}
+
+	if results := VerifyDKIM(context.Background(), []byte(testMessage), resolver); len(results) != 0 {
+		t.Errorf("Expected no results for an unsigned message, got %+v", results)
+	}
+}
+
+func TestVerifyDKIMEd25519(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolver := stubResolver{"sel._domainkey.example.com": "v=DKIM1; k=ed25519; p=" + base64.StdEncoding.EncodeToString(pub)}
+
+	signed := testSign(t, testMessage, "ed25519-sha256", func(digest []byte) []byte {
+		return ed25519.Sign(priv, digest)
+	})
+	if results := VerifyDKIM(context.Background(), []byte(signed), resolver); len(results) != 1 || results[0].Result != DKIMPass {
+		t.Errorf("Expected Ed25519 signature to pass, got %+v", results)
+	}
+}
+
+func TestCanonicalizeBody(t *testing.T) {
+	if got := string(canonicalizeBody([]byte("a  b \r\n\r\n"), "relaxed")); got != "a b\r\n" {
+		t.Errorf("Unexpected relaxed body %q", got)
+	}
+	if got := string(canonicalizeBody(nil, "simple")); got != "\r\n" {
+		t.Errorf("Unexpected simple empty body %q", got)
+	}
+	if got := canonicalizeBody(nil, "relaxed"); len(got) != 0 {
+		t.Errorf("Unexpected relaxed empty body %q", got)
+	}
+}
+
+// TestVerifyDKIMRFC8463 checks the Ed25519 example message from RFC 8463, Appendix A
+func TestVerifyDKIMRFC8463(t *testing.T) {
+	msg := "DKIM-Signature: v=1; a=ed25519-sha256; c=relaxed/relaxed;\r\n" +
+		" d=football.example.com; i=@football.example.com;\r\n" +
+		" q=dns/txt; s=brisbane; t=1528637909; h=from : to :\r\n" +
+		" subject : date : message-id : from : subject : date;\r\n" +
+		" bh=2jUSOH9NhtVGCQWNr9BrIAPreKQjO6Sn7XIkfJVOzv8=;\r\n" +
+		" b=/gCrinpcQOoIfuHNQIbq4pgh9kyIK3AQUdt9OdqQehSwhEIug4D11Bus\r\n" +
+		" Fa3bT3FY5OsU7ZbnKELq+eXdp1Q1Dw==\r\n" +
+		"From: Joe SixPack <joe@football.example.com>\r\n" +
+		"To: Suzie Q <suzie@shopping.example.net>\r\n" +
+		"Subject: Is dinner ready?\r\n" +
+		"Date: Fri, 11 Jul 2003 21:00:37 -0700 (PDT)\r\n" +
+		"Message-ID: <20030712040037.46341.5F8J@football.example.com>\r\n" +
+		"\r\n" +
+		"Hi.\r\n" +
+		"\r\n" +
+		"We lost the game.  Are you hungry yet?\r\n" +
+		"\r\n" +
+		"Joe.\r\n"
+	resolver := stubResolver{"brisbane._domainkey.football.example.com": "v=DKIM1; k=ed25519; p=11qYAYKxCrfVS/7TyWQHOg7hcvPapiMlrwIaaPcHURo="}
+
+	results := VerifyDKIM(context.Background(), []byte(msg), resolver)
+	if len(results) != 1 || results[0].Result != DKIMPass || results[0].Selector != "brisbane" {
+		t.Errorf("Expected the RFC 8463 example to verify, got %+v", results)
+	}
+}
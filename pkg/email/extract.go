@@ -0,0 +1,572 @@
+package email
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/emersion/go-message/mail"
+	"github.com/ledongthuc/pdf"
+	"github.com/prasanthmj/email/pkg/securefs"
+)
+
+// Attachment kinds reported by ExtractText
+const (
+	KindPDF  = "pdf"
+	KindDOCX = "docx"
+	KindXLSX = "xlsx"
+	KindPPTX = "pptx"
+	KindCSV  = "csv"
+	KindTSV  = "tsv"
+	KindText = "text"
+	KindHTML = "html"
+	KindEML  = "eml"
+	KindZIP  = "zip"
+)
+
+// Limits that keep hostile Office documents from exhausting memory
+const (
+	maxZIPEntrySize = 64 << 20 // Uncompressed size of a single archive member
+	maxXLSXColumns  = 16384    // Column XFD, the last one Excel supports
+)
+
+// ExtractText extracts readable text from an attachment file.
+// It returns the extracted text along with the detected kind of file.
+func ExtractText(filePath string) (string, string, error) {
+	data, err := securefs.ReadFile(filePath)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to open attachment: %w", err)
+	}
+
+	kind, err := detectKind(filePath, data)
+	if err != nil {
+		return "", "", err
+	}
+
+	var text string
+	switch kind {
+	case KindPDF:
+		text, err = extractPDF(data)
+	case KindDOCX:
+		text, err = extractDOCX(data)
+	case KindXLSX:
+		text, err = extractXLSX(data)
+	case KindPPTX:
+		text, err = extractPPTX(data)
+	case KindCSV:
+		text, err = extractDelimited(data, ',')
+	case KindTSV:
+		text, err = extractDelimited(data, '\t')
+	case KindHTML:
+		text, err = extractHTML(data)
+	case KindEML:
+		text, err = extractEML(data)
+	case KindZIP:
+		text, err = listZIP(data)
+	default:
+		text, err = extractPlain(data)
+	}
+	if err != nil {
+		return "", kind, fmt.Errorf("failed to extract %s text: %w", kind, err)
+	}
+
+	return cleanupWhitespace(text), kind, nil
+}
+
+// detectKind determines the file kind from its extension, falling back to content sniffing
+func detectKind(filePath string, data []byte) (string, error) {
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".pdf":
+		return KindPDF, nil
+	case ".docx", ".docm":
+		return KindDOCX, nil
+	case ".xlsx", ".xlsm":
+		return KindXLSX, nil
+	case ".pptx", ".pptm":
+		return KindPPTX, nil
+	case ".csv":
+		return KindCSV, nil
+	case ".tsv", ".tab":
+		return KindTSV, nil
+	case ".html", ".htm":
+		return KindHTML, nil
+	case ".eml":
+		return KindEML, nil
+	case ".zip":
+		return KindZIP, nil
+	case ".txt", ".text", ".md", ".log", ".json", ".xml", ".yaml", ".yml", ".ics", ".vcf":
+		return KindText, nil
+	}
+
+	// Unknown extension - sniff the first bytes
+	head := data
+	if len(head) > 512 {
+		head = head[:512]
+	}
+
+	switch {
+	case bytes.HasPrefix(head, []byte("%PDF-")):
+		return KindPDF, nil
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")):
+		return sniffZIPKind(data), nil
+	case bytes.Contains(bytes.ToLower(head), []byte("<html")):
+		return KindHTML, nil
+	case utf8.Valid(head):
+		return KindText, nil
+	}
+
+	return "", fmt.Errorf("unsupported attachment type: %s", filepath.Base(filePath))
+}
+
+// sniffZIPKind distinguishes Office Open XML documents from plain ZIP archives
+func sniffZIPKind(data []byte) string {
+	zr, err := openZIP(data)
+	if err != nil {
+		return KindZIP
+	}
+
+	for _, f := range zr.File {
+		switch {
+		case f.Name == "word/document.xml":
+			return KindDOCX
+		case f.Name == "xl/workbook.xml":
+			return KindXLSX
+		case f.Name == "ppt/presentation.xml":
+			return KindPPTX
+		}
+	}
+	return KindZIP
+}
+
+// extractPDF extracts plain text from all pages of a PDF. The PDF library panics on
+// malformed input, which is recovered so a hostile attachment cannot crash the server.
+func extractPDF(data []byte) (text string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			text, err = "", fmt.Errorf("failed to parse PDF: %v", r)
+		}
+	}()
+
+	r, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	for i := 1; i <= r.NumPage(); i++ {
+		page := r.Page(i)
+		if page.V.IsNull() {
+			continue
+		}
+		text, err := page.GetPlainText(nil)
+		if err != nil {
+			continue
+		}
+		if i > 1 {
+			sb.WriteString(fmt.Sprintf("\n\n--- Page %d ---\n\n", i))
+		}
+		sb.WriteString(text)
+	}
+
+	return sb.String(), nil
+}
+
+// extractDOCX extracts paragraph text from a Word document
+func extractDOCX(data []byte) (string, error) {
+	zr, err := openZIP(data)
+	if err != nil {
+		return "", err
+	}
+
+	document, err := readZIPFile(zr, "word/document.xml")
+	if err != nil {
+		return "", err
+	}
+
+	return ooxmlText(document, "p", "t")
+}
+
+// extractPPTX extracts text from each slide of a PowerPoint presentation
+func extractPPTX(data []byte) (string, error) {
+	zr, err := openZIP(data)
+	if err != nil {
+		return "", err
+	}
+
+	var slides []string
+	for _, f := range zr.File {
+		if strings.HasPrefix(f.Name, "ppt/slides/slide") && strings.HasSuffix(f.Name, ".xml") {
+			slides = append(slides, f.Name)
+		}
+	}
+	sort.Slice(slides, func(i, j int) bool {
+		return partNumber(slides[i]) < partNumber(slides[j])
+	})
+
+	var sb strings.Builder
+	for i, name := range slides {
+		data, err := readZIPFile(zr, name)
+		if err != nil {
+			return "", err
+		}
+		text, err := ooxmlText(data, "p", "t")
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(fmt.Sprintf("--- Slide %d ---\n", i+1))
+		sb.WriteString(text)
+		sb.WriteString("\n\n")
+	}
+
+	return sb.String(), nil
+}
+
+// extractXLSX extracts cell values from every worksheet as tab-separated rows
+func extractXLSX(data []byte) (string, error) {
+	zr, err := openZIP(data)
+	if err != nil {
+		return "", err
+	}
+
+	// Shared strings are optional (workbooks with only numbers don't have them)
+	var sharedStrings []string
+	if data, err := readZIPFile(zr, "xl/sharedStrings.xml"); err == nil {
+		sharedStrings, err = parseSharedStrings(data)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	sheetNames := map[string]string{}
+	if data, err := readZIPFile(zr, "xl/workbook.xml"); err == nil {
+		var wb struct {
+			Sheets []struct {
+				Name    string `xml:"name,attr"`
+				SheetID string `xml:"sheetId,attr"`
+			} `xml:"sheets>sheet"`
+		}
+		if xml.Unmarshal(data, &wb) == nil {
+			for _, s := range wb.Sheets {
+				sheetNames["sheet"+s.SheetID] = s.Name
+			}
+		}
+	}
+
+	var sheets []string
+	for _, f := range zr.File {
+		if strings.HasPrefix(f.Name, "xl/worksheets/sheet") && strings.HasSuffix(f.Name, ".xml") {
+			sheets = append(sheets, f.Name)
+		}
+	}
+	sort.Slice(sheets, func(i, j int) bool {
+		return partNumber(sheets[i]) < partNumber(sheets[j])
+	})
+
+	var sb strings.Builder
+	for _, name := range sheets {
+		data, err := readZIPFile(zr, name)
+		if err != nil {
+			return "", err
+		}
+
+		var ws struct {
+			Rows []struct {
+				Cells []struct {
+					Ref    string `xml:"r,attr"`
+					Type   string `xml:"t,attr"`
+					Value  string `xml:"v"`
+					Inline string `xml:"is>t"`
+				} `xml:"c"`
+			} `xml:"sheetData>row"`
+		}
+		if err := xml.Unmarshal(data, &ws); err != nil {
+			return "", fmt.Errorf("failed to parse %s: %w", name, err)
+		}
+
+		base := strings.TrimSuffix(path.Base(name), ".xml")
+		title := sheetNames[base]
+		if title == "" {
+			title = base
+		}
+		sb.WriteString(fmt.Sprintf("--- Sheet: %s ---\n", title))
+
+		for _, row := range ws.Rows {
+			var values []string
+			for _, c := range row.Cells {
+				// Pad skipped columns so values stay aligned
+				col := columnIndex(c.Ref)
+				if col >= maxXLSXColumns {
+					return "", fmt.Errorf("cell %s in %s is beyond the last column XFD", c.Ref, name)
+				}
+				if col > len(values) {
+					for len(values) < col {
+						values = append(values, "")
+					}
+				}
+
+				v := c.Value
+				switch c.Type {
+				case "s":
+					if idx, err := strconv.Atoi(v); err == nil && idx >= 0 && idx < len(sharedStrings) {
+						v = sharedStrings[idx]
+					}
+				case "inlineStr":
+					v = c.Inline
+				}
+				values = append(values, v)
+			}
+			sb.WriteString(strings.Join(values, "\t"))
+			sb.WriteString("\n")
+		}
+		sb.WriteString("\n")
+	}
+
+	return sb.String(), nil
+}
+
+// parseSharedStrings parses the XLSX shared string table
+func parseSharedStrings(data []byte) ([]string, error) {
+	var sst struct {
+		Items []struct {
+			Text string `xml:"t"`
+			Runs []struct {
+				Text string `xml:"t"`
+			} `xml:"r"`
+		} `xml:"si"`
+	}
+	if err := xml.Unmarshal(data, &sst); err != nil {
+		return nil, fmt.Errorf("failed to parse shared strings: %w", err)
+	}
+
+	strs := make([]string, 0, len(sst.Items))
+	for _, item := range sst.Items {
+		if len(item.Runs) > 0 {
+			var sb strings.Builder
+			for _, r := range item.Runs {
+				sb.WriteString(r.Text)
+			}
+			strs = append(strs, sb.String())
+		} else {
+			strs = append(strs, item.Text)
+		}
+	}
+	return strs, nil
+}
+
+// columnIndex converts a cell reference like "C7" to a zero-based column index
+func columnIndex(ref string) int {
+	col := 0
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' || col > maxXLSXColumns {
+			break
+		}
+		col = col*26 + int(r-'A'+1)
+	}
+	return col - 1
+}
+
+// partNumber extracts the numeric suffix of a part name like "ppt/slides/slide12.xml"
+func partNumber(name string) int {
+	base := strings.TrimSuffix(path.Base(name), ".xml")
+	i := len(base)
+	for i > 0 && base[i-1] >= '0' && base[i-1] <= '9' {
+		i--
+	}
+	n, _ := strconv.Atoi(base[i:])
+	return n
+}
+
+// ooxmlText walks Office Open XML, emitting text elements and breaking lines at paragraphs
+func ooxmlText(data []byte, paragraphTag, textTag string) (string, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	var sb strings.Builder
+	inText := false
+
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to parse document XML: %w", err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case textTag:
+				inText = true
+			case "tab":
+				sb.WriteString("\t")
+			case "br", "cr":
+				sb.WriteString("\n")
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case textTag:
+				inText = false
+			case paragraphTag:
+				sb.WriteString("\n")
+			}
+		case xml.CharData:
+			if inText {
+				sb.Write(t)
+			}
+		}
+	}
+
+	return sb.String(), nil
+}
+
+// openZIP opens an in-memory ZIP archive
+func openZIP(data []byte) (*zip.Reader, error) {
+	return zip.NewReader(bytes.NewReader(data), int64(len(data)))
+}
+
+// readZIPFile reads a single named file from a ZIP archive
+func readZIPFile(zr *zip.Reader, name string) ([]byte, error) {
+	for _, f := range zr.File {
+		if f.Name != name {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		data, err := io.ReadAll(io.LimitReader(rc, maxZIPEntrySize+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(data) > maxZIPEntrySize {
+			return nil, fmt.Errorf("%s exceeds %d bytes when uncompressed", name, maxZIPEntrySize)
+		}
+		return data, nil
+	}
+	return nil, fmt.Errorf("%s not found in archive", name)
+}
+
+// extractDelimited renders CSV/TSV records as tab-separated lines
+func extractDelimited(data []byte, delimiter rune) (string, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.Comma = delimiter
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+
+	var sb strings.Builder
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(strings.Join(record, "\t"))
+		sb.WriteString("\n")
+	}
+
+	return sb.String(), nil
+}
+
+// extractHTML converts an HTML file to text
+func extractHTML(data []byte) (string, error) {
+	return ConvertHTMLToText(string(data))
+}
+
+// extractPlain reads a plain text file, rejecting binary content
+func extractPlain(data []byte) (string, error) {
+	if !utf8.Valid(data) {
+		return "", fmt.Errorf("file is not valid UTF-8 text")
+	}
+	return string(data), nil
+}
+
+// extractEML renders a message/rfc822 attachment as headers, body and attachment list
+func extractEML(data []byte) (string, error) {
+	mr, err := mail.CreateReader(bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	for _, key := range []string{"From", "To", "Cc", "Date", "Subject"} {
+		if v, err := mr.Header.Text(key); err == nil && v != "" {
+			sb.WriteString(fmt.Sprintf("%s: %s\n", key, v))
+		}
+	}
+	sb.WriteString("\n")
+
+	var textBody, htmlBody string
+	var attachments []string
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			break
+		}
+
+		switch h := p.Header.(type) {
+		case *mail.InlineHeader:
+			b, _ := io.ReadAll(p.Body)
+			ct, _, _ := h.ContentType()
+			if strings.Contains(ct, "text/html") {
+				htmlBody = string(b)
+			} else if strings.Contains(ct, "text/plain") {
+				textBody = string(b)
+			}
+		case *mail.AttachmentHeader:
+			filename, _ := h.Filename()
+			attachments = append(attachments, filename)
+		}
+	}
+
+	if textBody == "" && htmlBody != "" {
+		textBody, _ = ConvertHTMLToText(htmlBody)
+	}
+	sb.WriteString(textBody)
+
+	if len(attachments) > 0 {
+		sb.WriteString("\n\nAttachments:\n")
+		for _, name := range attachments {
+			sb.WriteString("  - " + name + "\n")
+		}
+	}
+
+	return sb.String(), nil
+}
+
+// listZIP lists the entries of a ZIP archive without extracting them
+func listZIP(data []byte) (string, error) {
+	zr, err := openZIP(data)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("ZIP archive with %d entries:\n", len(zr.File)))
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			sb.WriteString(fmt.Sprintf("  %s/\n", strings.TrimSuffix(f.Name, "/")))
+			continue
+		}
+		flags := ""
+		if f.Flags&0x1 != 0 {
+			flags = " (encrypted)"
+		}
+		sb.WriteString(fmt.Sprintf("  %s\t%d bytes%s\n", f.Name, f.UncompressedSize64, flags))
+	}
+
+	return sb.String(), nil
+}
@@ -0,0 +1,159 @@
+package email
+
+import (
+	"archive/zip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeZIP creates a ZIP archive at path with the given files
+func writeZIP(t *testing.T, path string, files map[string]string) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	zw := zip.NewWriter(f)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExtractText_DOCX(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "att_123.docx")
+	writeZIP(t, path, map[string]string{
+		"word/document.xml": `<?xml version="1.0"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">
+<w:body>
+<w:p><w:r><w:t>Quarterly</w:t></w:r><w:r><w:t xml:space="preserve"> report</w:t></w:r></w:p>
+<w:p><w:r><w:t>Second paragraph</w:t></w:r></w:p>
+</w:body></w:document>`,
+	})
+
+	text, kind, err := ExtractText(path)
+	if err != nil {
+		t.Fatalf("Failed to extract DOCX: %v", err)
+	}
+	if kind != KindDOCX {
+		t.Errorf("Expected kind %s, got %s", KindDOCX, kind)
+	}
+	if text != "Quarterly report\nSecond paragraph" {
+		t.Errorf("Unexpected DOCX text: %q", text)
+	}
+}
+
+func TestExtractText_XLSX(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "att_456.xlsx")
+	writeZIP(t, path, map[string]string{
+		"xl/workbook.xml":      `<workbook><sheets><sheet name="Invoices" sheetId="1"/></sheets></workbook>`,
+		"xl/sharedStrings.xml": `<sst><si><t>Customer</t></si><si><t>Amount</t></si><si><r><t>Acme</t></r><r><t> Corp</t></r></si></sst>`,
+		"xl/worksheets/sheet1.xml": `<worksheet><sheetData>
+<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c></row>
+<row r="2"><c r="A2" t="s"><v>2</v></c><c r="C2"><v>42.5</v></c></row>
+</sheetData></worksheet>`,
+	})
+
+	text, kind, err := ExtractText(path)
+	if err != nil {
+		t.Fatalf("Failed to extract XLSX: %v", err)
+	}
+	if kind != KindXLSX {
+		t.Errorf("Expected kind %s, got %s", KindXLSX, kind)
+	}
+	if !strings.Contains(text, "--- Sheet: Invoices ---") {
+		t.Errorf("Expected sheet name in output, got %q", text)
+	}
+	if !strings.Contains(text, "Customer\tAmount") {
+		t.Errorf("Expected header row, got %q", text)
+	}
+	// Column B is empty in row 2, so the amount must stay in column C
+	if !strings.Contains(text, "Acme Corp\t\t42.5") {
+		t.Errorf("Expected aligned data row, got %q", text)
+	}
+}
+
+func TestExtractText_OfficeLimits(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// A cell far beyond column XFD must not allocate padding for every column
+	path := filepath.Join(tmpDir, "att_wide.xlsx")
+	writeZIP(t, path, map[string]string{
+		"xl/workbook.xml":          `<workbook><sheets><sheet name="Wide" sheetId="1"/></sheets></workbook>`,
+		"xl/worksheets/sheet1.xml": `<worksheet><sheetData><row r="1"><c r="ZZZZZZZ1"><v>1</v></c></row></sheetData></worksheet>`,
+	})
+	if _, _, err := ExtractText(path); err == nil || !strings.Contains(err.Error(), "XFD") {
+		t.Errorf("Expected an error for a cell beyond XFD, got %v", err)
+	}
+
+	// A highly compressed document is rejected once it exceeds the size limit
+	path = filepath.Join(tmpDir, "att_bomb.docx")
+	writeZIP(t, path, map[string]string{
+		"word/document.xml": strings.Repeat("a", maxZIPEntrySize+1),
+	})
+	if _, _, err := ExtractText(path); err == nil || !strings.Contains(err.Error(), "exceeds") {
+		t.Errorf("Expected an error for an oversized archive member, got %v", err)
+	}
+}
+
+func TestExtractText_CorruptPDF(t *testing.T) {
+	// Object 1 is missing its endobj, which makes the PDF library panic
+	head := "%PDF-1.4\n"
+	obj := "1 0 obj\n<< /Type /Catalog /Pages 2 0 R >>\n"
+	data := head + obj + fmt.Sprintf("xref\n0 2\n0000000000 65535 f \n%010d 00000 n \ntrailer\n<< /Size 2 /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n",
+		len(head), len(head)+len(obj))
+
+	path := filepath.Join(t.TempDir(), "att_corrupt.pdf")
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ExtractText(path); err == nil || !strings.Contains(err.Error(), "failed to parse PDF") {
+		t.Errorf("Expected a parse error for a corrupt PDF, got %v", err)
+	}
+}
+
+func TestExtractText_CSVAndZIP(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	csvPath := filepath.Join(tmpDir, "att_789.csv")
+	os.WriteFile(csvPath, []byte("name,email\n\"Doe, Jane\",jane@example.com\n"), 0644)
+
+	text, kind, err := ExtractText(csvPath)
+	if err != nil {
+		t.Fatalf("Failed to extract CSV: %v", err)
+	}
+	if kind != KindCSV {
+		t.Errorf("Expected kind %s, got %s", KindCSV, kind)
+	}
+	if text != "name\temail\nDoe, Jane\tjane@example.com" {
+		t.Errorf("Unexpected CSV text: %q", text)
+	}
+
+	// A ZIP without Office parts and an unknown extension is listed, not extracted
+	zipPath := filepath.Join(tmpDir, "att_abc.bin")
+	writeZIP(t, zipPath, map[string]string{"docs/readme.txt": "hello"})
+
+	text, kind, err = ExtractText(zipPath)
+	if err != nil {
+		t.Fatalf("Failed to list ZIP: %v", err)
+	}
+	if kind != KindZIP {
+		t.Errorf("Expected kind %s, got %s", KindZIP, kind)
+	}
+	if !strings.Contains(text, "docs/readme.txt\t5 bytes") {
+		t.Errorf("Expected entry listing, got %q", text)
+	}
+}
@@ -0,0 +1,229 @@
+package email
+
+import (
+	"fmt"
+	"mime"
+	"net/mail"
+	"net/textproto"
+	"sort"
+	"strings"
+)
+
+// Message priorities accepted in SendOptions.Priority
+const (
+	PriorityHigh   = "high"
+	PriorityNormal = "normal"
+	PriorityLow    = "low"
+)
+
+// reservedHeaders are managed by the client and cannot be set through SendOptions.Headers
+var reservedHeaders = map[string]bool{
+	"From":                        true,
+	"Sender":                      true,
+	"To":                          true,
+	"Cc":                          true,
+	"Bcc":                         true,
+	"Reply-To":                    true,
+	"Subject":                     true,
+	"Date":                        true,
+	"Message-Id":                  true,
+	"In-Reply-To":                 true,
+	"References":                  true,
+	"Mime-Version":                true,
+	"Content-Type":                true,
+	"Content-Transfer-Encoding":   true,
+	"Content-Disposition":         true,
+	"Content-Id":                  true,
+	"Return-Path":                 true,
+	"Received":                    true,
+	"Dkim-Signature":              true,
+	"Importance":                  true,
+	"X-Priority":                  true,
+	"Disposition-Notification-To": true,
+	"List-Unsubscribe":            true,
+	"List-Unsubscribe-Post":       true,
+}
+
+// headerField is a single header name/value pair in output order
+type headerField struct {
+	Name  string
+	Value string
+}
+
+// Validate checks header-bound fields for CR/LF injection and malformed values
+func (opts SendOptions) Validate() error {
+	single := map[string]string{
+		"subject":             opts.Subject,
+		"from_name":           opts.FromName,
+		"reply_to_message_id": opts.ReplyToMessageID,
+	}
+	for field, value := range single {
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("%s must not contain line breaks", field)
+		}
+	}
+
+	lists := map[string][]string{
+		"to":         opts.To,
+		"cc":         opts.CC,
+		"bcc":        opts.BCC,
+		"reply_to":   opts.ReplyTo,
+		"references": opts.References,
+	}
+	for field, values := range lists {
+		for _, value := range values {
+			if strings.ContainsAny(value, "\r\n") {
+				return fmt.Errorf("%s must not contain line breaks", field)
+			}
+		}
+	}
+
+	for _, addr := range opts.ReplyTo {
+		if _, err := mail.ParseAddress(addr); err != nil {
+			return fmt.Errorf("invalid reply_to address %q: %w", addr, err)
+		}
+	}
+
+	switch strings.ToLower(opts.Priority) {
+	case "", PriorityHigh, PriorityNormal, PriorityLow:
+	default:
+		return fmt.Errorf("invalid priority: %q (must be 'high', 'normal' or 'low')", opts.Priority)
+	}
+
+	switch opts.Crypto {
+	case "", CryptoSMIME, CryptoPGP:
+	default:
+		return fmt.Errorf("invalid crypto: %q (must be 'smime' or 'pgp')", opts.Crypto)
+	}
+
+	hasHTTPS := false
+	for _, uri := range opts.ListUnsubscribe {
+		u := strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(uri), "<"), ">")
+		lower := strings.ToLower(u)
+		if !strings.HasPrefix(lower, "mailto:") && !strings.HasPrefix(lower, "https:") && !strings.HasPrefix(lower, "http:") {
+			return fmt.Errorf("list_unsubscribe entries must be mailto: or http(s): URIs, got %q", uri)
+		}
+		if strings.ContainsAny(u, "\r\n<>, \t") {
+			return fmt.Errorf("invalid list_unsubscribe URI: %q", uri)
+		}
+		if strings.HasPrefix(lower, "https:") {
+			hasHTTPS = true
+		}
+	}
+	if opts.ListUnsubscribeOneClick && !hasHTTPS {
+		return fmt.Errorf("list_unsubscribe_one_click requires an https: list_unsubscribe URI")
+	}
+
+	for name, value := range opts.Headers {
+		if err := validateHeaderName(name); err != nil {
+			return err
+		}
+		if strings.ContainsAny(value, "\r\n\x00") {
+			return fmt.Errorf("header %s must not contain line breaks", name)
+		}
+	}
+
+	return nil
+}
+
+// validateHeaderName checks a custom header name against RFC 5322 field-name syntax
+func validateHeaderName(name string) error {
+	if name == "" {
+		return fmt.Errorf("header name must not be empty")
+	}
+	for _, r := range name {
+		// Printable US-ASCII except colon
+		if r < 33 || r > 126 || r == ':' {
+			return fmt.Errorf("invalid header name: %q", name)
+		}
+	}
+	if reservedHeaders[textproto.CanonicalMIMEHeaderKey(name)] {
+		return fmt.Errorf("header %s cannot be set directly; use the dedicated option instead", name)
+	}
+	return nil
+}
+
+// fromHeader formats the From address of the selected identity with the optional display name
+func (sc *SMTPClient) fromHeader(opts SendOptions) string {
+	address := sc.config.EmailAddress
+	if identity, err := sc.config.FindIdentity(opts.FromIdentity); err == nil && identity != nil {
+		address = identity.EmailAddress
+	}
+	if opts.FromName == "" {
+		return address
+	}
+	return (&mail.Address{Name: opts.FromName, Address: address}).String()
+}
+
+// applyIdentity fills display name and Reply-To defaults from the selected identity
+func (sc *SMTPClient) applyIdentity(opts SendOptions) (SendOptions, error) {
+	identity, err := sc.config.FindIdentity(opts.FromIdentity)
+	if err != nil || identity == nil {
+		return opts, err
+	}
+
+	if opts.FromName == "" {
+		opts.FromName = identity.DisplayName
+	}
+	if len(opts.ReplyTo) == 0 && identity.ReplyTo != "" {
+		opts.ReplyTo = []string{identity.ReplyTo}
+	}
+
+	return opts, nil
+}
+
+// encodeAddressList normalizes addresses so display names are RFC 2047 encoded
+func encodeAddressList(addrs []string) []string {
+	var result []string
+	for _, a := range addrs {
+		if addr, err := mail.ParseAddress(a); err == nil {
+			result = append(result, addr.String())
+		} else {
+			result = append(result, strings.TrimSpace(a))
+		}
+	}
+	return result
+}
+
+// extraHeaders returns priority, read-receipt, List-Unsubscribe and custom headers
+func (sc *SMTPClient) extraHeaders(opts SendOptions) []headerField {
+	var fields []headerField
+
+	switch strings.ToLower(opts.Priority) {
+	case PriorityHigh:
+		fields = append(fields,
+			headerField{"X-Priority", "1 (Highest)"},
+			headerField{"Importance", "High"})
+	case PriorityLow:
+		fields = append(fields,
+			headerField{"X-Priority", "5 (Lowest)"},
+			headerField{"Importance", "Low"})
+	}
+
+	if opts.ReadReceipt {
+		fields = append(fields, headerField{"Disposition-Notification-To", sc.fromHeader(opts)})
+	}
+
+	if len(opts.ListUnsubscribe) > 0 {
+		var uris []string
+		for _, uri := range opts.ListUnsubscribe {
+			uris = append(uris, "<"+strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(uri), "<"), ">")+">")
+		}
+		fields = append(fields, headerField{"List-Unsubscribe", strings.Join(uris, ", ")})
+		if opts.ListUnsubscribeOneClick {
+			fields = append(fields, headerField{"List-Unsubscribe-Post", "List-Unsubscribe=One-Click"})
+		}
+	}
+
+	// Sort custom headers so the output is deterministic
+	names := make([]string, 0, len(opts.Headers))
+	for name := range opts.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fields = append(fields, headerField{textproto.CanonicalMIMEHeaderKey(name), mime.QEncoding.Encode("UTF-8", opts.Headers[name])})
+	}
+
+	return fields
+}
@@ -0,0 +1,133 @@
+package email
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prasanthmj/email/pkg/config"
+)
+
+func TestSendOptionsValidate(t *testing.T) {
+	base := func() SendOptions {
+		return SendOptions{To: []string{"to@example.com"}, Subject: "Hi", Body: "Body"}
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(*SendOptions)
+		wantErr bool
+	}{
+		{"valid", func(o *SendOptions) {}, false},
+		{"custom header", func(o *SendOptions) { o.Headers = map[string]string{"X-Campaign-ID": "42"} }, false},
+		{"subject injection", func(o *SendOptions) { o.Subject = "Hi\r\nBcc: victim@example.com" }, true},
+		{"from name injection", func(o *SendOptions) { o.FromName = "Bob\nBcc: x@example.com" }, true},
+		{"header value injection", func(o *SendOptions) { o.Headers = map[string]string{"X-Tag": "a\r\nBcc: x"} }, true},
+		{"header name with colon", func(o *SendOptions) { o.Headers = map[string]string{"X-Bad:Name": "a"} }, true},
+		{"header name with space", func(o *SendOptions) { o.Headers = map[string]string{"X Bad": "a"} }, true},
+		{"reserved header", func(o *SendOptions) { o.Headers = map[string]string{"bcc": "x@example.com"} }, true},
+		{"invalid reply-to", func(o *SendOptions) { o.ReplyTo = []string{"not an address"} }, true},
+		{"invalid priority", func(o *SendOptions) { o.Priority = "urgent" }, true},
+		{"unsubscribe scheme", func(o *SendOptions) { o.ListUnsubscribe = []string{"javascript:alert(1)"} }, true},
+		{"one-click without https", func(o *SendOptions) {
+			o.ListUnsubscribe = []string{"mailto:unsub@example.com"}
+			o.ListUnsubscribeOneClick = true
+		}, true},
+	}
+
+	for _, test := range tests {
+		opts := base()
+		test.modify(&opts)
+		err := opts.Validate()
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: Validate() error = %v, wantErr %v", test.name, err, test.wantErr)
+		}
+	}
+}
+
+func TestBuildMessage_Headers(t *testing.T) {
+	sc := NewSMTPClient(&config.AccountConfig{EmailAddress: "sender@example.com"})
+
+	raw, err := sc.buildMessage(SendOptions{
+		To:                      []string{"recipient@example.com"},
+		Subject:                 "Monthly update",
+		Body:                    "Hello",
+		FromName:                "Jörg Support",
+		ReplyTo:                 []string{"Help Desk <help@example.com>"},
+		Priority:                PriorityHigh,
+		ReadReceipt:             true,
+		ListUnsubscribe:         []string{"mailto:unsub@example.com", "https://example.com/unsub?id=1"},
+		ListUnsubscribeOneClick: true,
+		Headers:                 map[string]string{"x-campaign-id": "spring-2024"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to build message: %v", err)
+	}
+	msg := string(raw)
+
+	for _, want := range []string{
+		"From: =?utf-8?q?J=C3=B6rg_Support?= <sender@example.com>",
+		"Reply-To: \"Help Desk\" <help@example.com>",
+		"X-Priority: 1 (Highest)",
+		"Importance: High",
+		"Disposition-Notification-To: ",
+		"List-Unsubscribe: <mailto:unsub@example.com>, <https://example.com/unsub?id=1>",
+		"List-Unsubscribe-Post: List-Unsubscribe=One-Click",
+		"X-Campaign-Id: spring-2024",
+	} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("Expected %q in message:\n%s", want, msg)
+		}
+	}
+
+	// Injection attempts never reach the wire
+	_, err = sc.buildMessage(SendOptions{
+		To:      []string{"recipient@example.com"},
+		Subject: "Hi",
+		Body:    "Hello",
+		Headers: map[string]string{"X-Note": "ok\r\nBcc: victim@example.com"},
+	})
+	if err == nil {
+		t.Error("Expected header injection to be rejected")
+	}
+}
+
+func TestBuildMessage_Identity(t *testing.T) {
+	sc := NewSMTPClient(&config.AccountConfig{
+		AccountID:    "work",
+		EmailAddress: "me@example.com",
+		Identities: []config.Identity{{
+			ID:           "support",
+			EmailAddress: "support@example.com",
+			DisplayName:  "Example Support",
+			ReplyTo:      "helpdesk@example.com",
+		}},
+	})
+
+	raw, err := sc.buildMessage(SendOptions{
+		To:           []string{"customer@example.org"},
+		Subject:      "Your ticket",
+		Body:         "Hello",
+		FromIdentity: "support",
+	})
+	if err != nil {
+		t.Fatalf("Failed to build message: %v", err)
+	}
+	msg := string(raw)
+	for _, want := range []string{
+		"From: \"Example Support\" <support@example.com>",
+		"Reply-To: <helpdesk@example.com>",
+	} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("Expected %q in message:\n%s", want, msg)
+		}
+	}
+
+	if _, err := sc.buildMessage(SendOptions{
+		To:           []string{"customer@example.org"},
+		Subject:      "Hi",
+		Body:         "Hello",
+		FromIdentity: "sales",
+	}); err == nil {
+		t.Error("Expected error for unknown identity")
+	}
+}
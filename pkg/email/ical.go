@@ -0,0 +1,588 @@
+package email
+
+import (
+	"crypto/rand"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Calendar methods (iTIP, RFC 5546)
+const (
+	MethodRequest = "REQUEST"
+	MethodReply   = "REPLY"
+	MethodCancel  = "CANCEL"
+)
+
+// Participation statuses used in invitation replies
+const (
+	PartStatAccepted  = "ACCEPTED"
+	PartStatDeclined  = "DECLINED"
+	PartStatTentative = "TENTATIVE"
+)
+
+// CalendarEvent represents a VEVENT parsed from a text/calendar part
+type CalendarEvent struct {
+	Method       string             `yaml:"method,omitempty" json:"method,omitempty"`
+	UID          string             `yaml:"uid" json:"uid"`
+	Sequence     int                `yaml:"sequence" json:"sequence"`
+	Status       string             `yaml:"status,omitempty" json:"status,omitempty"`
+	Summary      string             `yaml:"summary,omitempty" json:"summary,omitempty"`
+	Description  string             `yaml:"description,omitempty" json:"description,omitempty"`
+	Location     string             `yaml:"location,omitempty" json:"location,omitempty"`
+	Organizer    *CalendarAttendee  `yaml:"organizer,omitempty" json:"organizer,omitempty"`
+	Attendees    []CalendarAttendee `yaml:"attendees,omitempty" json:"attendees,omitempty"`
+	Start        time.Time          `yaml:"start" json:"start"`
+	End          time.Time          `yaml:"end,omitempty" json:"end,omitempty"`
+	TimeZone     string             `yaml:"time_zone,omitempty" json:"time_zone,omitempty"`
+	AllDay       bool               `yaml:"all_day,omitempty" json:"all_day,omitempty"`
+	RRule        string             `yaml:"rrule,omitempty" json:"rrule,omitempty"`
+	RecurrenceID string             `yaml:"recurrence_id,omitempty" json:"recurrence_id,omitempty"`
+}
+
+// CalendarAttendee represents an ORGANIZER or ATTENDEE property
+type CalendarAttendee struct {
+	Email    string `yaml:"email" json:"email"`
+	Name     string `yaml:"name,omitempty" json:"name,omitempty"`
+	Role     string `yaml:"role,omitempty" json:"role,omitempty"`
+	PartStat string `yaml:"partstat,omitempty" json:"partstat,omitempty"`
+	RSVP     bool   `yaml:"rsvp,omitempty" json:"rsvp,omitempty"`
+}
+
+// CalendarPart is an iCalendar body sent as text/calendar inside multipart/alternative
+type CalendarPart struct {
+	Method  string `json:"method"`
+	Content string `json:"content"`
+}
+
+// icalProperty is a single content line: NAME;PARAM=VALUE:value
+type icalProperty struct {
+	Name   string
+	Params map[string]string
+	Value  string
+}
+
+// ParseCalendar parses all VEVENTs from an iCalendar document
+func ParseCalendar(data string) ([]CalendarEvent, error) {
+	lines := unfoldICalLines(data)
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("empty calendar data")
+	}
+
+	var events []CalendarEvent
+	var method string
+	var current *CalendarEvent
+	var startProp, endProp *icalProperty
+	depth := 0 // nesting inside the VEVENT (VALARM etc.)
+
+	for _, line := range lines {
+		prop, ok := parseICalLine(line)
+		if !ok {
+			continue
+		}
+
+		switch prop.Name {
+		case "BEGIN":
+			if strings.EqualFold(prop.Value, "VEVENT") && current == nil {
+				current = &CalendarEvent{Method: method}
+				startProp, endProp = nil, nil
+				continue
+			}
+			if current != nil {
+				depth++
+			}
+			continue
+		case "END":
+			if current == nil {
+				continue
+			}
+			if depth > 0 {
+				depth--
+				continue
+			}
+			if strings.EqualFold(prop.Value, "VEVENT") {
+				if startProp != nil {
+					current.Start, current.TimeZone, current.AllDay = parseICalTime(*startProp)
+				}
+				if endProp != nil {
+					current.End, _, _ = parseICalTime(*endProp)
+				}
+				events = append(events, *current)
+				current = nil
+			}
+			continue
+		}
+
+		if current == nil {
+			if prop.Name == "METHOD" {
+				method = strings.ToUpper(prop.Value)
+			}
+			continue
+		}
+		if depth > 0 {
+			continue
+		}
+
+		p := prop
+		switch prop.Name {
+		case "UID":
+			current.UID = prop.Value
+		case "SEQUENCE":
+			current.Sequence, _ = strconv.Atoi(prop.Value)
+		case "STATUS":
+			current.Status = strings.ToUpper(prop.Value)
+		case "SUMMARY":
+			current.Summary = unescapeICalText(prop.Value)
+		case "DESCRIPTION":
+			current.Description = unescapeICalText(prop.Value)
+		case "LOCATION":
+			current.Location = unescapeICalText(prop.Value)
+		case "DTSTART":
+			startProp = &p
+		case "DTEND":
+			endProp = &p
+		case "RRULE":
+			current.RRule = prop.Value
+		case "RECURRENCE-ID":
+			current.RecurrenceID = prop.Value
+		case "ORGANIZER":
+			org := parseICalAttendee(prop)
+			current.Organizer = &org
+		case "ATTENDEE":
+			current.Attendees = append(current.Attendees, parseICalAttendee(prop))
+		}
+	}
+
+	if len(events) == 0 {
+		return nil, fmt.Errorf("no events found in calendar data")
+	}
+	return events, nil
+}
+
+// unfoldICalLines splits iCalendar data into logical lines, joining folded continuations
+func unfoldICalLines(data string) []string {
+	data = strings.ReplaceAll(data, "\r\n", "\n")
+	var lines []string
+	for _, raw := range strings.Split(data, "\n") {
+		if raw == "" {
+			continue
+		}
+		if (raw[0] == ' ' || raw[0] == '\t') && len(lines) > 0 {
+			lines[len(lines)-1] += raw[1:]
+			continue
+		}
+		lines = append(lines, raw)
+	}
+	return lines
+}
+
+// parseICalLine parses a content line into name, parameters and value
+func parseICalLine(line string) (icalProperty, bool) {
+	// Find the value separator, skipping colons inside quoted parameter values
+	inQuote := false
+	sep := -1
+	for i, r := range line {
+		if r == '"' {
+			inQuote = !inQuote
+		} else if r == ':' && !inQuote {
+			sep = i
+			break
+		}
+	}
+	if sep < 0 {
+		return icalProperty{}, false
+	}
+
+	prop := icalProperty{Params: map[string]string{}, Value: line[sep+1:]}
+	head := line[:sep]
+
+	var parts []string
+	inQuote = false
+	last := 0
+	for i, r := range head {
+		if r == '"' {
+			inQuote = !inQuote
+		} else if r == ';' && !inQuote {
+			parts = append(parts, head[last:i])
+			last = i + 1
+		}
+	}
+	parts = append(parts, head[last:])
+
+	prop.Name = strings.ToUpper(parts[0])
+	for _, param := range parts[1:] {
+		kv := strings.SplitN(param, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		prop.Params[strings.ToUpper(kv[0])] = strings.Trim(kv[1], `"`)
+	}
+	return prop, true
+}
+
+// parseICalAttendee parses an ORGANIZER or ATTENDEE property
+func parseICalAttendee(prop icalProperty) CalendarAttendee {
+	addr := prop.Value
+	if len(addr) > 7 && strings.EqualFold(addr[:7], "mailto:") {
+		addr = addr[7:]
+	}
+	return CalendarAttendee{
+		Email:    addr,
+		Name:     prop.Params["CN"],
+		Role:     prop.Params["ROLE"],
+		PartStat: prop.Params["PARTSTAT"],
+		RSVP:     strings.EqualFold(prop.Params["RSVP"], "TRUE"),
+	}
+}
+
+// parseICalTime parses DTSTART/DTEND values, honoring TZID and VALUE=DATE
+func parseICalTime(prop icalProperty) (time.Time, string, bool) {
+	value := prop.Value
+	if strings.EqualFold(prop.Params["VALUE"], "DATE") || len(value) == 8 {
+		t, err := time.Parse("20060102", value)
+		if err != nil {
+			return time.Time{}, "", false
+		}
+		return t, "", true
+	}
+
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse("20060102T150405Z", value)
+		if err != nil {
+			return time.Time{}, "", false
+		}
+		return t, "UTC", false
+	}
+
+	tzid := prop.Params["TZID"]
+	loc := time.UTC
+	if tzid != "" {
+		if l, err := time.LoadLocation(tzid); err == nil {
+			loc = l
+		}
+	}
+	t, err := time.ParseInLocation("20060102T150405", value, loc)
+	if err != nil {
+		return time.Time{}, tzid, false
+	}
+	return t, tzid, false
+}
+
+// escapeICalText escapes TEXT values per RFC 5545
+func escapeICalText(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+	return r.Replace(s)
+}
+
+// unescapeICalText reverses escapeICalText
+func unescapeICalText(s string) string {
+	r := strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n")
+	return r.Replace(s)
+}
+
+// icalBuilder writes folded iCalendar content lines
+type icalBuilder struct {
+	sb strings.Builder
+}
+
+// line writes a content line, folding it at 75 octets
+func (b *icalBuilder) line(s string) {
+	for len(s) > 75 {
+		// Don't split inside a multi-byte UTF-8 sequence
+		cut := 75
+		for cut > 0 && s[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		b.sb.WriteString(s[:cut] + "\r\n ")
+		s = s[cut:]
+	}
+	b.sb.WriteString(s + "\r\n")
+}
+
+func (b *icalBuilder) String() string {
+	return b.sb.String()
+}
+
+// quoteICalParam quotes a parameter value when it contains special characters
+func quoteICalParam(v string) string {
+	v = strings.ReplaceAll(v, `"`, "'")
+	if strings.ContainsAny(v, ";:,") {
+		return `"` + v + `"`
+	}
+	return v
+}
+
+// attendeeLine formats an ORGANIZER or ATTENDEE property
+func attendeeLine(name string, a CalendarAttendee) string {
+	var params []string
+	if a.Name != "" {
+		params = append(params, "CN="+quoteICalParam(a.Name))
+	}
+	if a.Role != "" {
+		params = append(params, "ROLE="+a.Role)
+	}
+	if a.PartStat != "" {
+		params = append(params, "PARTSTAT="+a.PartStat)
+	}
+	if a.RSVP {
+		params = append(params, "RSVP=TRUE")
+	}
+	if len(params) > 0 {
+		return fmt.Sprintf("%s;%s:mailto:%s", name, strings.Join(params, ";"), a.Email)
+	}
+	return fmt.Sprintf("%s:mailto:%s", name, a.Email)
+}
+
+// formatICalTime formats an event time, using TZID for named zones
+func formatICalTime(name string, t time.Time, allDay bool) string {
+	if allDay {
+		return fmt.Sprintf("%s;VALUE=DATE:%s", name, t.Format("20060102"))
+	}
+	loc := t.Location()
+	if !isNamedZone(loc) {
+		return fmt.Sprintf("%s:%s", name, t.UTC().Format("20060102T150405Z"))
+	}
+	return fmt.Sprintf("%s;TZID=%s:%s", name, loc.String(), t.Format("20060102T150405"))
+}
+
+// isNamedZone reports whether loc is an IANA zone that can be referenced by TZID.
+// Fixed offsets (e.g. times restored from the cache) are written in UTC instead.
+func isNamedZone(loc *time.Location) bool {
+	switch loc.String() {
+	case "", "UTC", "Local":
+		return false
+	}
+	_, err := time.LoadLocation(loc.String())
+	return err == nil
+}
+
+// NewEventUID generates a globally unique event UID for the given domain
+func NewEventUID(domain string) string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	if domain == "" {
+		domain = "email-mcp"
+	}
+	return fmt.Sprintf("%x@%s", b, domain)
+}
+
+// BuildInviteICS builds a METHOD:REQUEST iCalendar document for the event
+func BuildInviteICS(event CalendarEvent) (string, error) {
+	if event.UID == "" {
+		return "", fmt.Errorf("event UID is required")
+	}
+	if event.Organizer == nil || event.Organizer.Email == "" {
+		return "", fmt.Errorf("event organizer is required")
+	}
+	if event.Start.IsZero() {
+		return "", fmt.Errorf("event start is required")
+	}
+	if !event.End.IsZero() && event.End.Before(event.Start) {
+		return "", fmt.Errorf("event end must be after start")
+	}
+
+	b := &icalBuilder{}
+	b.line("BEGIN:VCALENDAR")
+	b.line("PRODID:-//email-mcp//Email MCP Server//EN")
+	b.line("VERSION:2.0")
+	b.line("CALSCALE:GREGORIAN")
+	b.line("METHOD:" + MethodRequest)
+
+	// Named zones need a VTIMEZONE definition so recurring events survive DST changes
+	if !event.AllDay {
+		if loc := event.Start.Location(); isNamedZone(loc) {
+			writeVTimezone(b, loc, event.Start.Year())
+		}
+	}
+
+	b.line("BEGIN:VEVENT")
+	b.line("UID:" + event.UID)
+	b.line("DTSTAMP:" + time.Now().UTC().Format("20060102T150405Z"))
+	b.line(formatICalTime("DTSTART", event.Start, event.AllDay))
+	if !event.End.IsZero() {
+		b.line(formatICalTime("DTEND", event.End, event.AllDay))
+	}
+	if event.RRule != "" {
+		b.line("RRULE:" + strings.TrimPrefix(event.RRule, "RRULE:"))
+	}
+	b.line(fmt.Sprintf("SEQUENCE:%d", event.Sequence))
+	b.line("STATUS:CONFIRMED")
+	if event.Summary != "" {
+		b.line("SUMMARY:" + escapeICalText(event.Summary))
+	}
+	if event.Description != "" {
+		b.line("DESCRIPTION:" + escapeICalText(event.Description))
+	}
+	if event.Location != "" {
+		b.line("LOCATION:" + escapeICalText(event.Location))
+	}
+	b.line(attendeeLine("ORGANIZER", *event.Organizer))
+	for _, a := range event.Attendees {
+		b.line(attendeeLine("ATTENDEE", a))
+	}
+	b.line("END:VEVENT")
+	b.line("END:VCALENDAR")
+
+	return b.String(), nil
+}
+
+// BuildReplyICS builds a METHOD:REPLY iCalendar document answering an invitation
+func BuildReplyICS(event CalendarEvent, attendee CalendarAttendee, partStat, comment string) (string, error) {
+	if event.UID == "" {
+		return "", fmt.Errorf("invitation has no UID")
+	}
+	if event.Organizer == nil || event.Organizer.Email == "" {
+		return "", fmt.Errorf("invitation has no organizer")
+	}
+	switch partStat {
+	case PartStatAccepted, PartStatDeclined, PartStatTentative:
+	default:
+		return "", fmt.Errorf("invalid participation status: %s", partStat)
+	}
+
+	attendee.PartStat = partStat
+	attendee.RSVP = false
+	attendee.Role = ""
+
+	b := &icalBuilder{}
+	b.line("BEGIN:VCALENDAR")
+	b.line("PRODID:-//email-mcp//Email MCP Server//EN")
+	b.line("VERSION:2.0")
+	b.line("METHOD:" + MethodReply)
+	b.line("BEGIN:VEVENT")
+	b.line("UID:" + event.UID)
+	if event.RecurrenceID != "" {
+		b.line("RECURRENCE-ID:" + event.RecurrenceID)
+	}
+	b.line("DTSTAMP:" + time.Now().UTC().Format("20060102T150405Z"))
+	b.line(fmt.Sprintf("SEQUENCE:%d", event.Sequence))
+	if !event.Start.IsZero() {
+		b.line(formatICalTime("DTSTART", event.Start, event.AllDay))
+	}
+	if !event.End.IsZero() {
+		b.line(formatICalTime("DTEND", event.End, event.AllDay))
+	}
+	if event.Summary != "" {
+		b.line("SUMMARY:" + escapeICalText(event.Summary))
+	}
+	b.line(attendeeLine("ORGANIZER", *event.Organizer))
+	b.line(attendeeLine("ATTENDEE", attendee))
+	if comment != "" {
+		b.line("COMMENT:" + escapeICalText(comment))
+	}
+	b.line("END:VEVENT")
+	b.line("END:VCALENDAR")
+
+	return b.String(), nil
+}
+
+// writeVTimezone writes a VTIMEZONE with yearly rules derived from the zone's transitions
+func writeVTimezone(b *icalBuilder, loc *time.Location, year int) {
+	b.line("BEGIN:VTIMEZONE")
+	b.line("TZID:" + loc.String())
+
+	start := time.Date(year, 1, 1, 0, 0, 0, 0, loc)
+	transitions := zoneTransitions(loc, year)
+
+	if len(transitions) == 0 {
+		// Zone without DST: a single STANDARD component
+		name, offset := start.Zone()
+		b.line("BEGIN:STANDARD")
+		b.line("DTSTART:19700101T000000")
+		b.line("TZOFFSETFROM:" + formatUTCOffset(offset))
+		b.line("TZOFFSETTO:" + formatUTCOffset(offset))
+		b.line("TZNAME:" + name)
+		b.line("END:STANDARD")
+		b.line("END:VTIMEZONE")
+		return
+	}
+
+	for _, tr := range transitions {
+		kind := "STANDARD"
+		if tr.isDST {
+			kind = "DAYLIGHT"
+		}
+		// Local wall-clock time of the transition, expressed in the old offset
+		local := tr.at.In(time.FixedZone("", tr.fromOffset))
+		b.line("BEGIN:" + kind)
+		b.line("DTSTART:" + local.Format("20060102T150405"))
+		b.line(fmt.Sprintf("RRULE:FREQ=YEARLY;BYMONTH=%d;BYDAY=%s", local.Month(), byDayRule(local)))
+		b.line("TZOFFSETFROM:" + formatUTCOffset(tr.fromOffset))
+		b.line("TZOFFSETTO:" + formatUTCOffset(tr.toOffset))
+		b.line("TZNAME:" + tr.name)
+		b.line("END:" + kind)
+	}
+	b.line("END:VTIMEZONE")
+}
+
+// zoneTransition describes an offset change within a year
+type zoneTransition struct {
+	at         time.Time
+	fromOffset int
+	toOffset   int
+	name       string
+	isDST      bool
+}
+
+// zoneTransitions finds the UTC offset changes of a location within a year
+func zoneTransitions(loc *time.Location, year int) []zoneTransition {
+	var transitions []zoneTransition
+	t := time.Date(year, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := t.AddDate(1, 0, 0)
+	_, prevOffset := t.In(loc).Zone()
+	_, stdOffset := time.Date(year, 1, 1, 0, 0, 0, 0, loc).Zone()
+	if _, julOffset := time.Date(year, 7, 1, 0, 0, 0, 0, loc).Zone(); julOffset < stdOffset {
+		// Southern hemisphere: standard time is in July
+		stdOffset = julOffset
+	}
+
+	for t.Before(end) {
+		next := t.Add(time.Hour)
+		_, offset := next.In(loc).Zone()
+		if offset != prevOffset {
+			// Narrow down to the exact minute
+			lo, hi := t, next
+			for hi.Sub(lo) > time.Minute {
+				mid := lo.Add(hi.Sub(lo) / 2)
+				if _, o := mid.In(loc).Zone(); o == prevOffset {
+					lo = mid
+				} else {
+					hi = mid
+				}
+			}
+			name, _ := hi.In(loc).Zone()
+			transitions = append(transitions, zoneTransition{
+				at:         hi,
+				fromOffset: prevOffset,
+				toOffset:   offset,
+				name:       name,
+				isDST:      offset > stdOffset,
+			})
+			prevOffset = offset
+		}
+		t = next
+	}
+	return transitions
+}
+
+// byDayRule expresses a date as an nth weekday of its month (e.g. 2SU or -1SU)
+func byDayRule(t time.Time) string {
+	day := strings.ToUpper(t.Weekday().String()[:2])
+	n := (t.Day()-1)/7 + 1
+	// Transitions in the last week of the month are "last weekday" rules
+	if t.AddDate(0, 0, 7).Month() != t.Month() {
+		return "-1" + day
+	}
+	return strconv.Itoa(n) + day
+}
+
+// formatUTCOffset formats seconds east of UTC as +HHMM
+func formatUTCOffset(seconds int) string {
+	sign := "+"
+	if seconds < 0 {
+		sign = "-"
+		seconds = -seconds
+	}
+	return fmt.Sprintf("%s%02d%02d", sign, seconds/3600, (seconds%3600)/60)
+}
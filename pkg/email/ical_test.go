@@ -0,0 +1,142 @@
+package email
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prasanthmj/email/pkg/config"
+)
+
+const sampleInvite = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"PRODID:-//Example//Calendar//EN\r\n" +
+	"METHOD:REQUEST\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:abc123@example.com\r\n" +
+	"SEQUENCE:2\r\n" +
+	"SUMMARY:Weekly sync\\, planning\r\n" +
+	"DESCRIPTION:Agenda:\\n1. Status\r\n" +
+	"LOCATION:Room 4\r\n" +
+	"DTSTART;TZID=America/New_York:20240115T100000\r\n" +
+	"DTEND;TZID=America/New_York:20240115T103000\r\n" +
+	"RRULE:FREQ=WEEKLY;BYDAY=MO\r\n" +
+	"ORGANIZER;CN=Alice:mailto:alice@example.com\r\n" +
+	"ATTENDEE;CN=Bob;ROLE=REQ-PARTICIPANT;PARTSTAT=NEEDS-ACTION;RSVP=TRUE:mailto:bob@example.com\r\n" +
+	"ATTENDEE;CN=\"Carol, PM\";PARTSTAT=ACCEPTED:\r\n" +
+	" mailto:carol@example.com\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestParseCalendar(t *testing.T) {
+	events, err := ParseCalendar(sampleInvite)
+	if err != nil {
+		t.Fatalf("Failed to parse calendar: %v", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("Expected 1 event, got %d", len(events))
+	}
+
+	ev := events[0]
+	if ev.Method != MethodRequest || ev.UID != "abc123@example.com" || ev.Sequence != 2 {
+		t.Errorf("Unexpected method/uid/sequence: %s %s %d", ev.Method, ev.UID, ev.Sequence)
+	}
+	if ev.Summary != "Weekly sync, planning" {
+		t.Errorf("Expected unescaped summary, got %q", ev.Summary)
+	}
+	if ev.Description != "Agenda:\n1. Status" {
+		t.Errorf("Expected unescaped description, got %q", ev.Description)
+	}
+	if ev.RRule != "FREQ=WEEKLY;BYDAY=MO" {
+		t.Errorf("Unexpected rrule: %s", ev.RRule)
+	}
+	if ev.TimeZone != "America/New_York" {
+		t.Errorf("Expected TZID to be kept, got %s", ev.TimeZone)
+	}
+	want := time.Date(2024, 1, 15, 15, 0, 0, 0, time.UTC)
+	if !ev.Start.Equal(want) {
+		t.Errorf("Expected start %v, got %v", want, ev.Start.UTC())
+	}
+	if ev.Organizer == nil || ev.Organizer.Email != "alice@example.com" || ev.Organizer.Name != "Alice" {
+		t.Errorf("Unexpected organizer: %+v", ev.Organizer)
+	}
+	if len(ev.Attendees) != 2 {
+		t.Fatalf("Expected 2 attendees, got %d", len(ev.Attendees))
+	}
+	if !ev.Attendees[0].RSVP || ev.Attendees[0].PartStat != "NEEDS-ACTION" {
+		t.Errorf("Unexpected first attendee: %+v", ev.Attendees[0])
+	}
+	if ev.Attendees[1].Name != "Carol, PM" || ev.Attendees[1].Email != "carol@example.com" {
+		t.Errorf("Folded/quoted attendee not parsed: %+v", ev.Attendees[1])
+	}
+}
+
+func TestBuildReplyICS(t *testing.T) {
+	events, err := ParseCalendar(sampleInvite)
+	if err != nil {
+		t.Fatalf("Failed to parse calendar: %v", err)
+	}
+
+	ics, err := BuildReplyICS(events[0], events[0].Attendees[0], PartStatAccepted, "See you there")
+	if err != nil {
+		t.Fatalf("Failed to build reply: %v", err)
+	}
+
+	replies, err := ParseCalendar(ics)
+	if err != nil {
+		t.Fatalf("Failed to parse reply: %v", err)
+	}
+	reply := replies[0]
+	if reply.Method != MethodReply || reply.UID != "abc123@example.com" || reply.Sequence != 2 {
+		t.Errorf("Reply must keep UID and SEQUENCE: %+v", reply)
+	}
+	if len(reply.Attendees) != 1 || reply.Attendees[0].PartStat != PartStatAccepted || reply.Attendees[0].Email != "bob@example.com" {
+		t.Errorf("Reply must contain only the responding attendee: %+v", reply.Attendees)
+	}
+	for _, line := range strings.Split(ics, "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("Line not folded: %q", line)
+		}
+	}
+}
+
+func TestBuildInviteMessage(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("time zone data not available")
+	}
+
+	ics, err := BuildInviteICS(CalendarEvent{
+		UID:       NewEventUID("example.com"),
+		Summary:   "Kickoff",
+		Start:     time.Date(2024, 7, 1, 9, 0, 0, 0, loc),
+		End:       time.Date(2024, 7, 1, 10, 0, 0, 0, loc),
+		Organizer: &CalendarAttendee{Email: "sender@example.com"},
+		Attendees: []CalendarAttendee{{Email: "bob@example.com", PartStat: "NEEDS-ACTION", RSVP: true}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to build invite: %v", err)
+	}
+	for _, want := range []string{"METHOD:REQUEST", "BEGIN:VTIMEZONE", "TZID:Europe/Berlin", "DTSTART;TZID=Europe/Berlin:20240701T090000"} {
+		if !strings.Contains(ics, want) {
+			t.Errorf("Expected %q in invite:\n%s", want, ics)
+		}
+	}
+
+	sc := NewSMTPClient(&config.AccountConfig{EmailAddress: "sender@example.com"})
+	raw, err := sc.buildMessage(SendOptions{
+		To:       []string{"bob@example.com"},
+		Subject:  "Invitation: Kickoff",
+		Body:     "Kickoff meeting",
+		Calendar: &CalendarPart{Method: MethodRequest, Content: ics},
+	})
+	if err != nil {
+		t.Fatalf("Failed to build message: %v", err)
+	}
+	msg := string(raw)
+	for _, want := range []string{"multipart/alternative", "text/calendar", "method=REQUEST", "invite.ics"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("Expected %q in message", want)
+		}
+	}
+}
@@ -1,8 +1,14 @@
 package email
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"io"
+	"net"
+	netmail "net/mail"
 	"strings"
 
 	"github.com/emersion/go-imap"
@@ -13,44 +19,110 @@ import (
 
 // IMAPClient handles IMAP operations
 type IMAPClient struct {
-	config *config.AccountConfig
+	config   *config.AccountConfig
+	resolver TXTResolver // DNS for local DKIM verification
 }
 
 // NewIMAPClient creates a new IMAP client
 func NewIMAPClient(cfg *config.AccountConfig) *IMAPClient {
 	return &IMAPClient{
-		config: cfg,
+		config:   cfg,
+		resolver: DefaultResolver,
 	}
 }
 
-// connect establishes a connection to the IMAP server
-func (ic *IMAPClient) connect() (*client.Client, error) {
+// SetResolver replaces the DNS resolver used to look up DKIM keys
+func (ic *IMAPClient) SetResolver(r TXTResolver) {
+	ic.resolver = r
+}
+
+// connect establishes a connection to the IMAP server. Cancelling ctx closes the
+// connection, aborting the command in progress. The returned function logs out.
+func (ic *IMAPClient) connect(ctx context.Context) (*client.Client, func(), error) {
+	password, err := ic.config.EmailPassword.Value()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get password: %w", err)
+	}
 	addr := fmt.Sprintf("%s:%d", ic.config.IMAPServer, ic.config.IMAPPort)
+	tlsConf, err := tlsConfig(ic.config, ic.config.IMAPServer)
+	if err != nil {
+		return nil, nil, err
+	}
+	
+	dialer := &tls.Dialer{NetDialer: &net.Dialer{Timeout: ic.config.Timeout}, Config: tlsConf}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to email server: %w", contextErr(ctx, err))
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
 	
-	c, err := client.DialTLS(addr, nil)
+	c, err := client.New(conn)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to email server: %w", err)
+		stop()
+		conn.Close()
+		return nil, nil, fmt.Errorf("failed to connect to email server: %w", contextErr(ctx, err))
 	}
 	
 	// Set timeout
 	c.Timeout = ic.config.Timeout
 	
 	// Login
-	if err := c.Login(ic.config.EmailAddress, ic.config.EmailPassword); err != nil {
+	if err := c.Login(ic.config.EmailAddress, password); err != nil {
+		stop()
 		c.Logout()
-		return nil, fmt.Errorf("authentication failed")
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+		return nil, nil, fmt.Errorf("authentication failed")
 	}
 	
-	return c, nil
+	logout := func() {
+		// After cancellation the connection is already closed
+		if stop() {
+			c.Logout()
+		}
+	}
+	return c, logout, nil
+}
+
+// tlsConfig returns the TLS settings for server, which also trust the certificates in the
+// account's TLS_CA_FILE
+func tlsConfig(cfg *config.AccountConfig, server string) (*tls.Config, error) {
+	conf := &tls.Config{ServerName: server}
+	if cfg.TLSCAFile == "" {
+		return conf, nil
+	}
+	certs, err := readCertificates(cfg.TLSCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read TLS_CA_FILE %s: %w", cfg.TLSCAFile, err)
+	}
+	roots, err := x509.SystemCertPool()
+	if err != nil {
+		roots = x509.NewCertPool()
+	}
+	for _, cert := range certs {
+		roots.AddCert(cert)
+	}
+	conf.RootCAs = roots
+	return conf, nil
+}
+
+// contextErr returns ctx's error when it is done, since a network error is then only a
+// consequence of the cancellation
+func contextErr(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	return err
 }
 
 // ListFolders returns all available folders
-func (ic *IMAPClient) ListFolders() ([]Folder, error) {
-	c, err := ic.connect()
+func (ic *IMAPClient) ListFolders(ctx context.Context) ([]Folder, error) {
+	c, logout, err := ic.connect(ctx)
 	if err != nil {
 		return nil, err
 	}
-	defer c.Logout()
+	defer logout()
 
 	mailboxes := make(chan *imap.MailboxInfo, 10)
 	done := make(chan error, 1)
@@ -77,19 +149,22 @@ func (ic *IMAPClient) ListFolders() ([]Folder, error) {
 	}
 
 	if err := <-done; err != nil {
-		return nil, fmt.Errorf("failed to list folders: %w", err)
+		return nil, fmt.Errorf("failed to list folders: %w", contextErr(ctx, err))
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
 
 	return folders, nil
 }
 
 // FetchHeaders fetches email headers based on options
-func (ic *IMAPClient) FetchHeaders(opts FetchOptions) ([]EmailHeader, error) {
-	c, err := ic.connect()
+func (ic *IMAPClient) FetchHeaders(ctx context.Context, opts FetchOptions) ([]EmailHeader, error) {
+	c, logout, err := ic.connect(ctx)
 	if err != nil {
 		return nil, err
 	}
-	defer c.Logout()
+	defer logout()
 
 	// Select folder
 	folder := opts.Folder
@@ -99,6 +174,9 @@ func (ic *IMAPClient) FetchHeaders(opts FetchOptions) ([]EmailHeader, error) {
 	
 	mbox, err := c.Select(folder, true) // read-only
 	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
 		return nil, fmt.Errorf("folder does not exist: %s", folder)
 	}
 
@@ -112,7 +190,7 @@ func (ic *IMAPClient) FetchHeaders(opts FetchOptions) ([]EmailHeader, error) {
 	// Search for messages
 	seqNums, err := c.Search(criteria)
 	if err != nil {
-		return nil, fmt.Errorf("search failed: %w", err)
+		return nil, fmt.Errorf("search failed: %w", contextErr(ctx, err))
 	}
 
 	if len(seqNums) == 0 {
@@ -160,33 +238,40 @@ func (ic *IMAPClient) FetchHeaders(opts FetchOptions) ([]EmailHeader, error) {
 		}
 		headers = append(headers, header)
 	}
+	// A cancelled fetch ends early with a partial list
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 
 	return headers, nil
 }
 
 // FetchEmail fetches a complete email by Message-ID
-func (ic *IMAPClient) FetchEmail(messageID string) (*Email, error) {
-	c, err := ic.connect()
+func (ic *IMAPClient) FetchEmail(ctx context.Context, messageID string) (*Email, error) {
+	c, logout, err := ic.connect(ctx)
 	if err != nil {
 		return nil, err
 	}
-	defer c.Logout()
+	defer logout()
 
 	// Search all folders for the message
-	email, err := ic.searchAndFetchEmail(c, messageID)
+	email, err := ic.searchAndFetchEmail(ctx, c, messageID)
 	if err != nil {
-		return nil, err
+		return nil, contextErr(ctx, err)
 	}
 
 	return email, nil
 }
 
 // searchAndFetchEmail searches for and fetches an email from any folder
-func (ic *IMAPClient) searchAndFetchEmail(c *client.Client, messageID string) (*Email, error) {
+func (ic *IMAPClient) searchAndFetchEmail(ctx context.Context, c *client.Client, messageID string) (*Email, error) {
 	// Try common folders first
 	commonFolders := []string{"INBOX", "Sent", "[Gmail]/Sent Mail", "Sent Items", "[Gmail]/All Mail"}
 	
 	for _, folder := range commonFolders {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		email, err := ic.fetchEmailFromFolder(c, folder, messageID)
 		if err == nil && email != nil {
 			return email, nil
@@ -201,6 +286,10 @@ func (ic *IMAPClient) searchAndFetchEmail(c *client.Client, messageID string) (*
 	}()
 
 	for m := range mailboxes {
+		// Keep draining so List can finish after a cancellation closed the connection
+		if ctx.Err() != nil {
+			continue
+		}
 		email, err := ic.fetchEmailFromFolder(c, m.Name, messageID)
 		if err == nil && email != nil {
 			return email, nil
@@ -208,7 +297,10 @@ func (ic *IMAPClient) searchAndFetchEmail(c *client.Client, messageID string) (*
 	}
 
 	if err := <-done; err != nil {
-		return nil, fmt.Errorf("failed to search folders: %w", err)
+		return nil, fmt.Errorf("failed to search folders: %w", contextErr(ctx, err))
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
 
 	return nil, fmt.Errorf("email not found: %s", messageID)
@@ -261,11 +353,22 @@ func (ic *IMAPClient) fetchEmailFromFolder(c *client.Client, folder, messageID s
 	var htmlBody string
 	var attachments []Attachment
 	var inReplyTo string
+	var replyTo []string
 	var references []string
+	var invites []CalendarEvent
+	var authentication *AuthVerdict
+	var smime *SMIMEInfo
+	var pgp *PGPInfo
 
 	r := msg.GetBody(&imap.BodySectionName{})
 	if r != nil {
-		mr, err := mail.CreateReader(r)
+		raw, _ := io.ReadAll(r)
+		authentication = ic.authenticate(raw)
+
+		// Decrypt and verify S/MIME and PGP/MIME layers before parsing the content
+		raw, smime, pgp = unwrapMessage(raw, ic.config, formatAddress(msg.Envelope.From))
+
+		mr, err := mail.CreateReader(bytes.NewReader(raw))
 		if err == nil {
 			// Extract headers
 			header := mr.Header
@@ -277,6 +380,11 @@ func (ic *IMAPClient) fetchEmailFromFolder(c *client.Client, folder, messageID s
 			if irt, err := header.Text("In-Reply-To"); err == nil {
 				inReplyTo = irt
 			}
+			if addrs, err := header.AddressList("Reply-To"); err == nil {
+				for _, addr := range addrs {
+					replyTo = append(replyTo, addr.String())
+				}
+			}
 
 			// Extract body and attachments
 			for {
@@ -297,6 +405,10 @@ func (ic *IMAPClient) fetchEmailFromFolder(c *client.Client, folder, messageID s
 						htmlBody = string(b)
 					} else if strings.Contains(ct, "text/plain") {
 						body = string(b)
+					} else if strings.Contains(ct, "text/calendar") {
+						if events, err := ParseCalendar(string(b)); err == nil {
+							invites = append(invites, events...)
+						}
 					}
 				case *mail.AttachmentHeader:
 					// This is an attachment
@@ -304,35 +416,73 @@ func (ic *IMAPClient) fetchEmailFromFolder(c *client.Client, folder, messageID s
 					contentType, _, _ := h.ContentType()
 					// Get size by reading (we won't store the content here)
 					b, _ := io.ReadAll(p.Body)
+					// Calendar files sent as attachments are invitations too,
+					// unless the same event was already parsed from the inline part
+					if isCalendarAttachment(contentType, filename) {
+						if events, err := ParseCalendar(string(b)); err == nil {
+							invites = mergeInvites(invites, events)
+						}
+					}
 					attachments = append(attachments, Attachment{
 						Filename:    filename,
 						Size:        int64(len(b)),
 						ContentType: contentType,
+						Encrypted:   IsEncryptedArchive(b),
 					})
 				}
 			}
 		}
 	}
 
+	// Inline PGP in plain-text bodies
+	if text, inline := DecryptInlinePGP(body, ic.config.PGP, formatAddress(msg.Envelope.From)); inline != nil {
+		body = text
+		if pgp == nil {
+			pgp = inline
+		}
+	}
+
 	email := &Email{
-		MessageID:   messageID,
-		Folder:      folder,
-		From:        formatAddress(msg.Envelope.From),
-		To:          formatAddresses(msg.Envelope.To),
-		CC:          formatAddresses(msg.Envelope.Cc),
-		BCC:         formatAddresses(msg.Envelope.Bcc),
-		Subject:     msg.Envelope.Subject,
-		Date:        msg.Envelope.Date,
-		Body:        body,
-		HTMLBody:    htmlBody,
-		Attachments: attachments,
-		InReplyTo:   inReplyTo,
-		References:  references,
+		MessageID:      messageID,
+		Folder:         folder,
+		From:           formatAddress(msg.Envelope.From),
+		To:             formatAddresses(msg.Envelope.To),
+		CC:             formatAddresses(msg.Envelope.Cc),
+		ReplyTo:        replyTo,
+		BCC:            formatAddresses(msg.Envelope.Bcc),
+		Subject:        msg.Envelope.Subject,
+		Date:           msg.Envelope.Date,
+		Body:           body,
+		HTMLBody:       htmlBody,
+		Attachments:    attachments,
+		InReplyTo:      inReplyTo,
+		References:     references,
+		Invites:        invites,
+		Authentication: authentication,
+		SMIME:          smime,
+		PGP:            pgp,
 	}
 
 	return email, nil
 }
 
+// authenticate parses the authentication results of a raw message and, if enabled,
+// verifies its DKIM signatures locally
+func (ic *IMAPClient) authenticate(raw []byte) *AuthVerdict {
+	msg, err := netmail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil
+	}
+	verdict := ParseAuthVerdict(msg.Header, ic.config.AuthServIDs)
+
+	if ic.config.VerifyDKIM {
+		ctx, cancel := context.WithTimeout(context.Background(), ic.config.Timeout)
+		defer cancel()
+		verdict.DKIM = append(verdict.DKIM, VerifyDKIM(ctx, raw, ic.resolver)...)
+	}
+	return verdict
+}
+
 // buildSearchCriteria builds IMAP search criteria from options
 func (ic *IMAPClient) buildSearchCriteria(opts FetchOptions) *imap.SearchCriteria {
 	criteria := imap.NewSearchCriteria()
@@ -362,6 +512,29 @@ func (ic *IMAPClient) buildSearchCriteria(opts FetchOptions) *imap.SearchCriteri
 
 // Helper functions
 
+// isCalendarAttachment reports whether an attachment holds iCalendar data
+func isCalendarAttachment(contentType, filename string) bool {
+	ct := strings.ToLower(contentType)
+	return ct == "text/calendar" || ct == "application/ics" || strings.HasSuffix(strings.ToLower(filename), ".ics")
+}
+
+// mergeInvites appends events whose UID and sequence are not already present
+func mergeInvites(existing, events []CalendarEvent) []CalendarEvent {
+	for _, ev := range events {
+		dup := false
+		for _, ex := range existing {
+			if ex.UID == ev.UID && ex.Sequence == ev.Sequence && ex.RecurrenceID == ev.RecurrenceID {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			existing = append(existing, ev)
+		}
+	}
+	return existing
+}
+
 func formatAddress(addrs []*imap.Address) string {
 	if len(addrs) == 0 {
 		return ""
@@ -0,0 +1,101 @@
+package email
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// dataURIPattern matches data: URIs used as src/background attribute values in HTML
+var dataURIPattern = regexp.MustCompile(`(?i)(src|background)\s*=\s*(["'])data:([a-z0-9.+-]+/[a-z0-9.+-]+)?((?:;[^,"']*)?),([^"']*)(["'])`)
+
+// inlinePart is an HTML-related MIME part referenced from the HTML body by Content-ID
+type inlinePart struct {
+	ContentID   string
+	Filename    string
+	ContentType string
+	Content     []byte
+}
+
+// NormalizeContentID strips angle brackets and a cid: prefix and validates the result
+func NormalizeContentID(contentID string) (string, error) {
+	cid := strings.TrimSpace(contentID)
+	cid = strings.TrimPrefix(cid, "cid:")
+	cid = strings.TrimSuffix(strings.TrimPrefix(cid, "<"), ">")
+	if cid == "" {
+		return "", fmt.Errorf("content_id is required for inline attachments")
+	}
+	if strings.ContainsAny(cid, "<>\"\\ \t\r\n") {
+		return "", fmt.Errorf("invalid content_id: %q", contentID)
+	}
+	return cid, nil
+}
+
+// embedDataURIs replaces data: URIs in the HTML body with cid: references
+// and returns the decoded parts to be attached as multipart/related content.
+func embedDataURIs(html string) (string, []inlinePart, error) {
+	var parts []inlinePart
+	var firstErr error
+	seen := make(map[string]string) // content hash -> content ID
+
+	result := dataURIPattern.ReplaceAllStringFunc(html, func(match string) string {
+		if firstErr != nil {
+			return match
+		}
+
+		m := dataURIPattern.FindStringSubmatch(match)
+		attr, quote, contentType, params, payload := m[1], m[2], m[3], m[4], m[5]
+		if quote != m[6] {
+			return match
+		}
+		if contentType == "" {
+			contentType = "text/plain"
+		}
+
+		var content []byte
+		var err error
+		if strings.Contains(strings.ToLower(params), ";base64") {
+			// Whitespace is allowed inside data URIs in HTML attributes
+			payload = strings.Join(strings.Fields(payload), "")
+			content, err = base64.StdEncoding.DecodeString(payload)
+		} else {
+			var s string
+			s, err = url.PathUnescape(payload)
+			content = []byte(s)
+		}
+		if err != nil {
+			firstErr = fmt.Errorf("failed to decode data URI: %w", err)
+			return match
+		}
+
+		// Reuse one part when the same image appears several times
+		sum := fmt.Sprintf("%x", md5.Sum(content))
+		cid, ok := seen[sum]
+		if !ok {
+			cid = fmt.Sprintf("inline-%s@email-mcp", sum[:12])
+			seen[sum] = cid
+
+			ext := ".bin"
+			if exts, _ := mime.ExtensionsByType(contentType); len(exts) > 0 {
+				ext = exts[0]
+			}
+			parts = append(parts, inlinePart{
+				ContentID:   cid,
+				Filename:    fmt.Sprintf("inline-%d%s", len(parts)+1, ext),
+				ContentType: contentType,
+				Content:     content,
+			})
+		}
+
+		return fmt.Sprintf("%s=%scid:%s%s", attr, quote, cid, quote)
+	})
+
+	if firstErr != nil {
+		return "", nil, firstErr
+	}
+	return result, parts, nil
+}
@@ -0,0 +1,149 @@
+package email
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prasanthmj/email/pkg/config"
+	"github.com/prasanthmj/email/pkg/securefs"
+)
+
+func TestEmbedDataURIs(t *testing.T) {
+	// 1x1 transparent GIF, used twice to check the part is deduplicated
+	gif := "R0lGODlhAQABAIAAAAAAAP///yH5BAEAAAAALAAAAAABAAEAAAIBRAA7"
+	html := `<p><img src="data:image/gif;base64,` + gif + `"></p><div background='data:image/gif;base64,` + gif + `'></div><img src="https://example.com/a.png">`
+
+	result, parts, err := embedDataURIs(html)
+	if err != nil {
+		t.Fatalf("Failed to embed data URIs: %v", err)
+	}
+	if len(parts) != 1 {
+		t.Fatalf("Expected 1 inline part, got %d", len(parts))
+	}
+	if parts[0].ContentType != "image/gif" {
+		t.Errorf("Expected image/gif, got %s", parts[0].ContentType)
+	}
+	if strings.Contains(result, "data:") {
+		t.Errorf("Data URI left in HTML: %s", result)
+	}
+	if strings.Count(result, "cid:"+parts[0].ContentID) != 2 {
+		t.Errorf("Expected both references rewritten to cid, got %s", result)
+	}
+	if !strings.Contains(result, `src="https://example.com/a.png"`) {
+		t.Errorf("Remote image should be untouched, got %s", result)
+	}
+}
+
+func TestNormalizeContentID(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"logo", "logo", false},
+		{"<logo@example.com>", "logo@example.com", false},
+		{"cid:banner", "banner", false},
+		{"", "", true},
+		{"bad id", "", true},
+		{"evil>\r\nBcc: x", "", true},
+	}
+
+	for _, test := range tests {
+		got, err := NormalizeContentID(test.in)
+		if (err != nil) != test.wantErr {
+			t.Errorf("NormalizeContentID(%q) error = %v, wantErr %v", test.in, err, test.wantErr)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("NormalizeContentID(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
+
+func TestBuildEmail_InlineAttachments(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "att_logo.png"), []byte("\x89PNG fake"), 0644)
+
+	sc := NewSMTPClient(&config.AccountConfig{
+		EmailAddress:  "sender@example.com",
+		AttachmentDir: tmpDir,
+	})
+
+	e, err := sc.buildEmail(SendOptions{
+		To:       []string{"recipient@example.com"},
+		Subject:  "Newsletter",
+		HTMLBody: `<img src="cid:logo">`,
+		InlineAttachments: []InlineAttachment{
+			{CacheID: "att_logo.png", ContentID: "logo"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to build email: %v", err)
+	}
+
+	raw, err := e.Bytes()
+	if err != nil {
+		t.Fatalf("Failed to render email: %v", err)
+	}
+	msg := string(raw)
+	if !strings.Contains(msg, "multipart/related") {
+		t.Error("Expected multipart/related structure")
+	}
+	if !strings.Contains(msg, "Content-Id: <logo>") && !strings.Contains(msg, "Content-ID: <logo>") {
+		t.Error("Expected Content-ID header for inline part")
+	}
+	if !strings.Contains(msg, "Content-Disposition: inline") {
+		t.Error("Expected inline disposition for related part")
+	}
+
+	// Inline parts without an HTML body are rejected
+	_, err = sc.buildEmail(SendOptions{
+		To:                []string{"recipient@example.com"},
+		Subject:           "Plain",
+		Body:              "text",
+		InlineAttachments: []InlineAttachment{{CacheID: "att_logo.png", ContentID: "logo"}},
+	})
+	if err == nil {
+		t.Error("Expected error for inline attachments without HTML body")
+	}
+}
+
+func TestBuildEmail_EncryptedAttachments(t *testing.T) {
+	if err := securefs.SetKey(bytes.Repeat([]byte{7}, securefs.KeySize)); err != nil {
+		t.Fatal(err)
+	}
+	defer securefs.SetKey(nil)
+
+	tmpDir := t.TempDir()
+	for name, content := range map[string]string{"att_report.txt": "quarterly report", "att_logo.png": "\x89PNG fake"} {
+		if err := securefs.WriteFile(filepath.Join(tmpDir, name), []byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sc := NewSMTPClient(&config.AccountConfig{EmailAddress: "sender@example.com", AttachmentDir: tmpDir})
+	e, err := sc.buildEmail(SendOptions{
+		To:                []string{"recipient@example.com"},
+		Subject:           "Report",
+		HTMLBody:          `<img src="cid:logo">`,
+		Attachments:       []string{"att_report.txt"},
+		InlineAttachments: []InlineAttachment{{CacheID: "att_logo.png", ContentID: "logo"}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to build email: %v", err)
+	}
+
+	contents := map[string]string{}
+	for _, a := range e.Attachments {
+		contents[a.Filename] = string(a.Content)
+	}
+	if contents["att_report.txt"] != "quarterly report" || contents["att_logo.png"] != "\x89PNG fake" {
+		t.Errorf("Expected decrypted attachment contents, got %q", contents)
+	}
+	if ct := e.Attachments[0].ContentType; !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("Expected the content type from the file extension, got %q", ct)
+	}
+}
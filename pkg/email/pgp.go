@@ -0,0 +1,656 @@
+package email
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/clearsign"
+	pgperrors "github.com/ProtonMail/go-crypto/openpgp/errors"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/prasanthmj/email/pkg/config"
+	"github.com/prasanthmj/email/pkg/securefs"
+)
+
+// Message protection methods accepted in SendOptions.Crypto
+const (
+	CryptoSMIME = "smime"
+	CryptoPGP   = "pgp"
+)
+
+// PGPInfo reports the OpenPGP protection of a fetched message
+type PGPInfo struct {
+	Encrypted bool          `yaml:"encrypted" json:"encrypted"`
+	Decrypted bool          `yaml:"decrypted" json:"decrypted"`
+	Signed    bool          `yaml:"signed" json:"signed"`
+	Inline    bool          `yaml:"inline,omitempty" json:"inline,omitempty"` // Inline PGP blocks in a plain-text body rather than PGP/MIME
+	Signature *PGPSignature `yaml:"signature,omitempty" json:"signature,omitempty"`
+	Error     string        `yaml:"error,omitempty" json:"error,omitempty"` // Why the message could not be decrypted
+}
+
+// PGPSignature describes the signer of a message and whether the signature holds
+type PGPSignature struct {
+	Valid       bool      `yaml:"valid" json:"valid"`   // Made by a key in the keyring and the content matches
+	KeyID       string    `yaml:"key_id" json:"key_id"` // Issuer key ID, also set for unknown keys
+	Fingerprint string    `yaml:"fingerprint,omitempty" json:"fingerprint,omitempty"`
+	Signer      string    `yaml:"signer,omitempty" json:"signer,omitempty"` // Primary user ID of the signing key
+	MatchesFrom bool      `yaml:"matches_from" json:"matches_from"`         // A user ID of the key has the From address
+	SigningTime time.Time `yaml:"signing_time,omitempty" json:"signing_time,omitempty"`
+	Error       string    `yaml:"error,omitempty" json:"error,omitempty"`
+}
+
+// PGPKey describes a key in an account keyring
+type PGPKey struct {
+	Fingerprint string     `json:"fingerprint"`
+	KeyID       string     `json:"key_id"`
+	UserIDs     []string   `json:"user_ids"`
+	Created     time.Time  `json:"created"`
+	Expires     *time.Time `json:"expires,omitempty"`
+	CanEncrypt  bool       `json:"can_encrypt"` // Has a valid, unexpired encryption key
+	Revoked     bool       `json:"revoked,omitempty"`
+	Secret      bool       `json:"secret,omitempty"` // The account's own key
+}
+
+// pgpMaxDepth limits nested signed and encrypted layers
+const pgpMaxDepth = 4
+
+// readPGPKeys parses armored or binary keys
+func readPGPKeys(data []byte) (openpgp.EntityList, error) {
+	if bytes.Contains(data, []byte("-----BEGIN PGP")) {
+		return openpgp.ReadArmoredKeyRing(bytes.NewReader(data))
+	}
+	return openpgp.ReadKeyRing(bytes.NewReader(data))
+}
+
+// loadPGPKeyring reads every key file in the keyring directory. Unreadable files are skipped.
+func loadPGPKeyring(dir string) openpgp.EntityList {
+	var keyring openpgp.EntityList
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		data, err := securefs.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		if keys, err := readPGPKeys(data); err == nil {
+			keyring = append(keyring, keys...)
+		}
+	}
+	return keyring
+}
+
+// loadPGPSecretKey reads the account's secret key and unlocks it with the passphrase
+func loadPGPSecretKey(cfg config.PGP) (*openpgp.Entity, error) {
+	data, err := os.ReadFile(cfg.PrivateKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read PGP private key: %w", err)
+	}
+	keys, err := readPGPKeys(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse PGP private key: %w", err)
+	}
+	for _, e := range keys {
+		if e.PrivateKey == nil {
+			continue
+		}
+		if e.PrivateKey.Encrypted {
+			if cfg.Passphrase == nil {
+				return nil, fmt.Errorf("PGP private key is protected by a passphrase but none is configured")
+			}
+			passphrase, err := cfg.Passphrase.Value()
+			if err != nil {
+				return nil, fmt.Errorf("failed to get PGP passphrase: %w", err)
+			}
+			if err := e.DecryptPrivateKeys([]byte(passphrase)); err != nil {
+				return nil, fmt.Errorf("failed to unlock PGP private key: %w", err)
+			}
+		}
+		return e, nil
+	}
+	return nil, fmt.Errorf("failed to parse PGP private key: no secret key in %s", cfg.PrivateKeyFile)
+}
+
+// pgpVerificationKeys returns the keyring plus the account's own key, if it can be read
+func pgpVerificationKeys(cfg config.PGP) openpgp.EntityList {
+	keyring := loadPGPKeyring(cfg.Keyring)
+	if cfg.Enabled() {
+		if own, err := loadPGPSecretKey(cfg); err == nil {
+			keyring = append(openpgp.EntityList{own}, keyring...)
+		}
+	}
+	return keyring
+}
+
+// pgpAddresses returns the lower-cased email addresses of an entity's user IDs
+func pgpAddresses(e *openpgp.Entity) []string {
+	var addrs []string
+	for _, id := range e.Identities {
+		if id.UserId != nil && id.UserId.Email != "" {
+			addrs = append(addrs, strings.ToLower(id.UserId.Email))
+		}
+	}
+	return addrs
+}
+
+// findPGPKey returns the newest key for an address that can encrypt now
+func findPGPKey(keyring openpgp.EntityList, address string) *openpgp.Entity {
+	address = strings.ToLower(address)
+	var best *openpgp.Entity
+	now := time.Now()
+	for _, e := range keyring {
+		if _, ok := e.EncryptionKey(now); !ok {
+			continue
+		}
+		for _, addr := range pgpAddresses(e) {
+			if addr == address && (best == nil || e.PrimaryKey.CreationTime.After(best.PrimaryKey.CreationTime)) {
+				best = e
+			}
+		}
+	}
+	return best
+}
+
+// describePGPKey summarizes an entity for list_keys
+func describePGPKey(e *openpgp.Entity) PGPKey {
+	now := time.Now()
+	key := PGPKey{
+		Fingerprint: strings.ToUpper(hex.EncodeToString(e.PrimaryKey.Fingerprint)),
+		KeyID:       fmt.Sprintf("%016X", e.PrimaryKey.KeyId),
+		Created:     e.PrimaryKey.CreationTime,
+		Revoked:     e.Revoked(now),
+		Secret:      e.PrivateKey != nil,
+	}
+	_, key.CanEncrypt = e.EncryptionKey(now)
+	for name := range e.Identities {
+		key.UserIDs = append(key.UserIDs, name)
+	}
+	sort.Strings(key.UserIDs)
+	if id := e.PrimaryIdentity(); id != nil && id.SelfSignature != nil && id.SelfSignature.KeyLifetimeSecs != nil && *id.SelfSignature.KeyLifetimeSecs > 0 {
+		expires := e.PrimaryKey.CreationTime.Add(time.Duration(*id.SelfSignature.KeyLifetimeSecs) * time.Second)
+		key.Expires = &expires
+	}
+	return key
+}
+
+// ImportPublicKeys stores the public part of armored or binary keys in the keyring,
+// one file per fingerprint. Secret key material is never written.
+func ImportPublicKeys(keyringDir string, data []byte) ([]PGPKey, error) {
+	keys, err := readPGPKeys(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse PGP key: %w", err)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("failed to parse PGP key: no keys found")
+	}
+
+	var imported []PGPKey
+	for _, e := range keys {
+		var b bytes.Buffer
+		w, err := armor.Encode(&b, "PGP PUBLIC KEY BLOCK", nil)
+		if err != nil {
+			return nil, err
+		}
+		if err := e.Serialize(w); err != nil {
+			return nil, fmt.Errorf("failed to serialize PGP key: %w", err)
+		}
+		w.Close()
+		b.WriteString("\n")
+
+		info := describePGPKey(e)
+		info.Secret = false
+		path := filepath.Join(keyringDir, info.Fingerprint+".asc")
+		if err := securefs.WriteFile(path, b.Bytes()); err != nil {
+			return nil, fmt.Errorf("failed to save PGP key: %w", err)
+		}
+		imported = append(imported, info)
+	}
+	return imported, nil
+}
+
+// ListPGPKeys lists the account's own key (if configured) and the keys in its keyring
+func ListPGPKeys(cfg config.PGP) ([]PGPKey, error) {
+	var keys []PGPKey
+	if cfg.Enabled() {
+		data, err := os.ReadFile(cfg.PrivateKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read PGP private key: %w", err)
+		}
+		own, err := readPGPKeys(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse PGP private key: %w", err)
+		}
+		for _, e := range own {
+			keys = append(keys, describePGPKey(e))
+		}
+	}
+	for _, e := range loadPGPKeyring(cfg.Keyring) {
+		keys = append(keys, describePGPKey(e))
+	}
+	return keys, nil
+}
+
+// pgpHashNames maps hash functions to their micalg names (RFC 3156 section 5)
+var pgpHashNames = map[crypto.Hash]string{
+	crypto.SHA1:   "pgp-sha1",
+	crypto.SHA224: "pgp-sha224",
+	crypto.SHA256: "pgp-sha256",
+	crypto.SHA384: "pgp-sha384",
+	crypto.SHA512: "pgp-sha512",
+}
+
+// armorBytes armors binary OpenPGP data
+func armorBytes(blockType string, data []byte) ([]byte, error) {
+	var b bytes.Buffer
+	w, err := armor.Encode(&b, blockType, nil)
+	if err != nil {
+		return nil, err
+	}
+	w.Write(data)
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return toCRLF(append(b.Bytes(), '\n')), nil
+}
+
+// pgpSignEntity wraps an entity in multipart/signed with a detached signature (RFC 3156 section 5)
+func pgpSignEntity(entity []byte, signer *openpgp.Entity) ([]byte, error) {
+	// The CRLF before the closing boundary belongs to the delimiter, not the signed content
+	entity = bytes.TrimSuffix(entity, []byte("\r\n"))
+	var sig bytes.Buffer
+	if err := openpgp.DetachSign(&sig, signer, bytes.NewReader(entity), nil); err != nil {
+		return nil, fmt.Errorf("failed to sign message: %w", err)
+	}
+	micalg := "pgp-sha256"
+	if p, err := packet.Read(bytes.NewReader(sig.Bytes())); err == nil {
+		if s, ok := p.(*packet.Signature); ok && pgpHashNames[s.Hash] != "" {
+			micalg = pgpHashNames[s.Hash]
+		}
+	}
+	armored, err := armorBytes("PGP SIGNATURE", sig.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	boundary := newBoundary("pgp")
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "Content-Type: multipart/signed; protocol=\"application/pgp-signature\"; micalg=%s;\r\n boundary=\"%s\"\r\n\r\n", micalg, boundary)
+	b.WriteString("This is an OpenPGP/MIME signed message (RFC 3156)\r\n")
+	fmt.Fprintf(&b, "--%s\r\n", boundary)
+	b.Write(entity)
+	fmt.Fprintf(&b, "\r\n--%s\r\n", boundary)
+	b.WriteString("Content-Type: application/pgp-signature; name=\"signature.asc\"\r\n")
+	b.WriteString("Content-Description: OpenPGP digital signature\r\n")
+	b.WriteString("Content-Disposition: attachment; filename=\"signature.asc\"\r\n\r\n")
+	b.Write(armored)
+	fmt.Fprintf(&b, "--%s--\r\n", boundary)
+	return b.Bytes(), nil
+}
+
+// pgpEncryptEntity replaces an entity with multipart/encrypted (RFC 3156 section 4),
+// signing inside the encryption when signer is set
+func pgpEncryptEntity(entity []byte, recipients []*openpgp.Entity, signer *openpgp.Entity) ([]byte, error) {
+	var ciphertext bytes.Buffer
+	w, err := openpgp.Encrypt(&ciphertext, recipients, signer, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt message: %w", err)
+	}
+	if _, err := w.Write(entity); err != nil {
+		return nil, fmt.Errorf("failed to encrypt message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encrypt message: %w", err)
+	}
+	armored, err := armorBytes("PGP MESSAGE", ciphertext.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	boundary := newBoundary("pgp")
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "Content-Type: multipart/encrypted; protocol=\"application/pgp-encrypted\";\r\n boundary=\"%s\"\r\n\r\n", boundary)
+	b.WriteString("This is an OpenPGP/MIME encrypted message (RFC 3156)\r\n")
+	fmt.Fprintf(&b, "--%s\r\n", boundary)
+	b.WriteString("Content-Type: application/pgp-encrypted\r\n")
+	b.WriteString("Content-Description: PGP/MIME version identification\r\n\r\n")
+	b.WriteString("Version: 1\r\n\r\n")
+	fmt.Fprintf(&b, "--%s\r\n", boundary)
+	b.WriteString("Content-Type: application/octet-stream; name=\"encrypted.asc\"\r\n")
+	b.WriteString("Content-Description: OpenPGP encrypted message\r\n")
+	b.WriteString("Content-Disposition: inline; filename=\"encrypted.asc\"\r\n\r\n")
+	b.Write(armored)
+	fmt.Fprintf(&b, "--%s--\r\n", boundary)
+	return b.Bytes(), nil
+}
+
+// applyPGP signs and/or encrypts a rendered message with PGP/MIME as requested in opts.
+// Messages are encrypted for every recipient and for the account itself.
+func (sc *SMTPClient) applyPGP(raw []byte, opts SendOptions) ([]byte, error) {
+	if !opts.Sign && !opts.Encrypt {
+		return raw, nil
+	}
+	if !sc.config.PGP.Enabled() {
+		return nil, fmt.Errorf("PGP is not configured for account %s (set ACCOUNT_%s_PGP_PRIVATE_KEY_FILE)",
+			sc.config.AccountID, sc.config.AccountID)
+	}
+	own, err := loadPGPSecretKey(sc.config.PGP)
+	if err != nil {
+		return nil, err
+	}
+
+	outer, entity := splitEntity(raw)
+	if !opts.Encrypt {
+		if entity, err = pgpSignEntity(entity, own); err != nil {
+			return nil, err
+		}
+		return append(outer, entity...), nil
+	}
+
+	keyring := loadPGPKeyring(sc.config.PGP.Keyring)
+	recipients := []*openpgp.Entity{own}
+	var missing []string
+	for _, addr := range envelopeRecipients(opts) {
+		key := findPGPKey(keyring, addr)
+		if key == nil {
+			missing = append(missing, addr)
+			continue
+		}
+		recipients = append(recipients, key)
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("cannot encrypt: no PGP key for %s in %s (use import_public_key)", strings.Join(missing, ", "), sc.config.PGP.Keyring)
+	}
+
+	var signer *openpgp.Entity
+	if opts.Sign {
+		signer = own
+	}
+	if entity, err = pgpEncryptEntity(entity, recipients, signer); err != nil {
+		return nil, err
+	}
+	return append(outer, entity...), nil
+}
+
+// protectMessage applies the S/MIME or PGP/MIME protection requested in opts
+func (sc *SMTPClient) protectMessage(raw []byte, opts SendOptions) ([]byte, error) {
+	method := opts.Crypto
+	if method == "" {
+		method = CryptoSMIME
+		if !sc.config.SMIME.Enabled() && sc.config.PGP.Enabled() {
+			method = CryptoPGP
+		}
+	}
+	if method == CryptoPGP {
+		return sc.applyPGP(raw, opts)
+	}
+	return sc.applySMIME(raw, opts)
+}
+
+// dearmor decodes an armored block, or returns binary data unchanged
+func dearmor(data []byte) ([]byte, error) {
+	if !bytes.Contains(data, []byte("-----BEGIN PGP")) {
+		return data, nil
+	}
+	block, err := armor.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid OpenPGP armor: %w", err)
+	}
+	return io.ReadAll(block.Body)
+}
+
+// signatureIssuer reads the issuer and creation time from a binary signature packet
+func signatureIssuer(signature []byte) *PGPSignature {
+	sig := &PGPSignature{}
+	p, err := packet.Read(bytes.NewReader(signature))
+	if err != nil {
+		return sig
+	}
+	if s, ok := p.(*packet.Signature); ok {
+		if s.IssuerKeyId != nil {
+			sig.KeyID = fmt.Sprintf("%016X", *s.IssuerKeyId)
+		}
+		if len(s.IssuerFingerprint) > 0 {
+			sig.Fingerprint = strings.ToUpper(hex.EncodeToString(s.IssuerFingerprint))
+		}
+		sig.SigningTime = s.CreationTime
+	}
+	return sig
+}
+
+// describePGPSigner fills in the signer of a verified signature and checks it against From
+func describePGPSigner(sig *PGPSignature, signer *openpgp.Entity, from string) {
+	if signer == nil {
+		return
+	}
+	sig.Fingerprint = strings.ToUpper(hex.EncodeToString(signer.PrimaryKey.Fingerprint))
+	if id := signer.PrimaryIdentity(); id != nil {
+		sig.Signer = id.Name
+	}
+	if _, fromAddr := splitFrom(from); fromAddr != "" {
+		sig.MatchesFrom = contains(pgpAddresses(signer), fromAddr)
+	}
+}
+
+// verifyPGPDetached verifies a binary detached signature over content
+func verifyPGPDetached(keyring openpgp.EntityList, content, signature []byte, from string) *PGPSignature {
+	sig := signatureIssuer(signature)
+	_, signer, err := openpgp.VerifyDetachedSignature(keyring, bytes.NewReader(content), bytes.NewReader(signature), nil)
+	if err == pgperrors.ErrUnknownIssuer {
+		sig.Error = "signing key is not in the keyring (use import_public_key)"
+		return sig
+	}
+	if err != nil {
+		sig.Error = err.Error()
+	}
+	sig.Valid = err == nil
+	describePGPSigner(sig, signer, from)
+	return sig
+}
+
+// decryptPGP decrypts a binary OpenPGP message and verifies an inner signature
+func decryptPGP(ciphertext []byte, keyring openpgp.EntityList, from string) ([]byte, *PGPSignature, error) {
+	md, err := openpgp.ReadMessage(bytes.NewReader(ciphertext), keyring, nil, nil)
+	if err != nil {
+		if err == pgperrors.ErrKeyIncorrect {
+			return nil, nil, fmt.Errorf("message is not encrypted for this account's PGP key")
+		}
+		return nil, nil, fmt.Errorf("failed to decrypt message: %w", err)
+	}
+	plain, err := io.ReadAll(md.UnverifiedBody)
+	if err != nil && md.SignatureError == nil {
+		return nil, nil, fmt.Errorf("failed to decrypt message: %w", err)
+	}
+	if !md.IsSigned {
+		return plain, nil, nil
+	}
+
+	sig := &PGPSignature{KeyID: fmt.Sprintf("%016X", md.SignedByKeyId)}
+	if md.Signature != nil {
+		sig.SigningTime = md.Signature.CreationTime
+	}
+	switch {
+	case md.SignedBy == nil:
+		sig.Error = "signing key is not in the keyring (use import_public_key)"
+	case md.SignatureError != nil:
+		sig.Error = md.SignatureError.Error()
+	default:
+		sig.Valid = true
+	}
+	if md.SignedBy != nil {
+		describePGPSigner(sig, md.SignedBy.Entity, from)
+	}
+	return plain, sig, nil
+}
+
+// UnwrapPGP decrypts and verifies PGP/MIME layers of a raw message, returning a plain
+// message with the original outer headers and a report. Messages without PGP/MIME are
+// returned unchanged with a nil report. Decryption needs the account's secret key.
+func UnwrapPGP(raw []byte, cfg config.PGP, from string) ([]byte, *PGPInfo) {
+	outer, entity := splitEntity(raw)
+	var info *PGPInfo
+	var keyring openpgp.EntityList
+
+	for depth := 0; depth < pgpMaxDepth; depth++ {
+		fields, body := splitRawMessage(entity)
+		mediaType, params := entityContentType(fields)
+		protocol := strings.ToLower(params["protocol"])
+
+		switch {
+		case mediaType == "multipart/signed" && protocol == "application/pgp-signature":
+			if info == nil {
+				info = &PGPInfo{}
+				keyring = pgpVerificationKeys(cfg)
+			}
+			info.Signed = true
+			content, sigBody, err := splitMultipartSigned(body, params["boundary"])
+			if err != nil {
+				info.Signature = &PGPSignature{Error: err.Error()}
+				return raw, info
+			}
+			signature, err := dearmor(sigBody)
+			if err != nil {
+				info.Signature = &PGPSignature{Error: err.Error()}
+				return raw, info
+			}
+			info.Signature = verifyPGPDetached(keyring, content, signature, from)
+			entity = append(append([]byte{}, content...), '\r', '\n')
+
+		case mediaType == "multipart/encrypted" && protocol == "application/pgp-encrypted":
+			if info == nil {
+				info = &PGPInfo{}
+				keyring = pgpVerificationKeys(cfg)
+			}
+			info.Encrypted = true
+			if !cfg.Enabled() {
+				info.Error = "message is encrypted but no PGP key is configured for this account"
+				return raw, info
+			}
+			ciphertext, err := encryptedPart(body, params["boundary"])
+			if err == nil {
+				ciphertext, err = dearmor(ciphertext)
+			}
+			if err != nil {
+				info.Error = err.Error()
+				return raw, info
+			}
+			plain, sig, err := decryptPGP(ciphertext, keyring, from)
+			if err != nil {
+				info.Error = err.Error()
+				return raw, info
+			}
+			info.Decrypted = true
+			if sig != nil {
+				info.Signed = true
+				info.Signature = sig
+			}
+			entity = toCRLF(plain)
+
+		default:
+			if info == nil {
+				return raw, nil
+			}
+			return append(outer, entity...), info
+		}
+	}
+	return append(outer, entity...), info
+}
+
+// unwrapMessage removes the S/MIME and PGP/MIME layers of a fetched message
+func unwrapMessage(raw []byte, cfg *config.AccountConfig, from string) ([]byte, *SMIMEInfo, *PGPInfo) {
+	raw, smime := UnwrapSMIME(raw, cfg.SMIME, from)
+	raw, pgp := UnwrapPGP(raw, cfg.PGP, from)
+	return raw, smime, pgp
+}
+
+// encryptedPart returns the body of the application/octet-stream part of a
+// multipart/encrypted body
+func encryptedPart(body []byte, boundary string) ([]byte, error) {
+	if boundary == "" {
+		return nil, fmt.Errorf("multipart/encrypted message has no boundary")
+	}
+	delimiter := "\r\n--" + boundary
+	parts := strings.Split("\r\n"+string(body), delimiter)
+	for _, part := range parts[1:] {
+		if strings.HasPrefix(part, "--") {
+			break
+		}
+		_, partBody, _ := strings.Cut(part, "\r\n")
+		fields, content := splitRawMessage([]byte(partBody))
+		if mediaType, _ := entityContentType(fields); mediaType == "application/octet-stream" {
+			return content, nil
+		}
+	}
+	return nil, fmt.Errorf("encrypted part not found")
+}
+
+// inlinePGPMessage matches armored messages embedded in a plain-text body
+var inlinePGPMessage = regexp.MustCompile(`(?s)-----BEGIN PGP MESSAGE-----.*?-----END PGP MESSAGE-----`)
+
+// DecryptInlinePGP decrypts armored PGP messages and verifies clearsigned text found in a
+// plain-text body, replacing them with their plaintext. It returns a nil report if the
+// body has no inline PGP.
+func DecryptInlinePGP(text string, cfg config.PGP, from string) (string, *PGPInfo) {
+	hasMessage := strings.Contains(text, "-----BEGIN PGP MESSAGE-----")
+	hasSigned := strings.Contains(text, "-----BEGIN PGP SIGNED MESSAGE-----")
+	if !hasMessage && !hasSigned {
+		return text, nil
+	}
+	info := &PGPInfo{Inline: true}
+	keyring := pgpVerificationKeys(cfg)
+
+	if hasMessage {
+		info.Encrypted = true
+		if !cfg.Enabled() {
+			info.Error = "message is encrypted but no PGP key is configured for this account"
+		} else {
+			decrypted := true
+			text = inlinePGPMessage.ReplaceAllStringFunc(text, func(block string) string {
+				ciphertext, err := dearmor([]byte(block))
+				var plain []byte
+				var sig *PGPSignature
+				if err == nil {
+					plain, sig, err = decryptPGP(ciphertext, keyring, from)
+				}
+				if err != nil {
+					decrypted = false
+					info.Error = err.Error()
+					return block
+				}
+				if sig != nil {
+					info.Signed = true
+					info.Signature = sig
+				}
+				return string(plain)
+			})
+			info.Decrypted = decrypted
+		}
+	}
+
+	// Clearsigned text, either in the body or inside a decrypted block
+	if block, rest := clearsign.Decode([]byte(text)); block != nil {
+		info.Signed = true
+		start := strings.Index(text, "-----BEGIN PGP SIGNED MESSAGE-----")
+		signature, err := io.ReadAll(block.ArmoredSignature.Body)
+		if err != nil {
+			info.Signature = &PGPSignature{Error: err.Error()}
+		} else {
+			info.Signature = verifyPGPDetached(keyring, block.Bytes, signature, from)
+		}
+		text = text[:start] + string(block.Plaintext) + "\n" + string(rest)
+	}
+	return text, info
+}
@@ -0,0 +1,251 @@
+package email
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/clearsign"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/prasanthmj/email/pkg/config"
+)
+
+// testPGPAccount creates a key for address and returns the account's PGP settings and its
+// armored public key
+func testPGPAccount(t *testing.T, dir, name, address string) (config.PGP, *openpgp.Entity, string) {
+	t.Helper()
+	entity, err := openpgp.NewEntity(name, "", address, &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.PGP{
+		Keyring:        filepath.Join(dir, name+"-keyring"),
+		PrivateKeyFile: filepath.Join(dir, name+".key"),
+	}
+	if err := os.MkdirAll(cfg.Keyring, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	var secret, public bytes.Buffer
+	w, _ := armor.Encode(&secret, "PGP PRIVATE KEY BLOCK", nil)
+	if err := entity.SerializePrivate(w, nil); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	if err := os.WriteFile(cfg.PrivateKeyFile, secret.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	w, _ = armor.Encode(&public, "PGP PUBLIC KEY BLOCK", nil)
+	if err := entity.Serialize(w); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	return cfg, entity, public.String()
+}
+
+func TestPGPMIMERoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	aliceCfg, _, alicePublic := testPGPAccount(t, dir, "alice", "alice@example.com")
+	bobCfg, _, bobPublic := testPGPAccount(t, dir, "bob", "bob@example.org")
+
+	// An account without S/MIME uses PGP by default
+	sc := NewSMTPClient(&config.AccountConfig{AccountID: "alice", EmailAddress: "alice@example.com", PGP: aliceCfg})
+	opts := SendOptions{
+		To:      []string{"Bob <bob@example.org>"},
+		Subject: "Quarterly numbers",
+		Body:    "Revenue is up.\n",
+		Sign:    true,
+		Encrypt: true,
+	}
+
+	if _, err := sc.buildMessage(opts); err == nil || !strings.Contains(err.Error(), "bob@example.org") {
+		t.Fatalf("Expected an error for the missing recipient key, got %v", err)
+	}
+	if _, err := ImportPublicKeys(aliceCfg.Keyring, []byte(bobPublic)); err != nil {
+		t.Fatalf("Failed to import key: %v", err)
+	}
+
+	raw, err := sc.buildMessage(opts)
+	if err != nil {
+		t.Fatalf("Failed to build message: %v", err)
+	}
+	if strings.Contains(string(raw), "Revenue") || !strings.Contains(string(raw), "multipart/encrypted") {
+		t.Fatalf("Expected a PGP/MIME encrypted message, got:\n%.500s", raw)
+	}
+
+	// Bob decrypts, but cannot verify the signature until he imports Alice's key
+	plain, info := UnwrapPGP(raw, bobCfg, "alice@example.com")
+	if info == nil || !info.Decrypted || !info.Signed || info.Signature.Valid || info.Signature.KeyID == "" {
+		t.Fatalf("Expected a decrypted message with an unknown signer, got %+v", info)
+	}
+	if !strings.Contains(string(plain), "Revenue is up.") || !strings.Contains(string(plain), "Subject: Quarterly numbers") {
+		t.Errorf("Expected the plain message with outer headers, got:\n%s", plain)
+	}
+
+	if _, err := ImportPublicKeys(bobCfg.Keyring, []byte(alicePublic)); err != nil {
+		t.Fatalf("Failed to import key: %v", err)
+	}
+	_, info = UnwrapPGP(raw, bobCfg, "Alice <alice@example.com>")
+	if sig := info.Signature; !sig.Valid || !sig.MatchesFrom || sig.Signer != "alice <alice@example.com>" {
+		t.Errorf("Expected a valid signature from alice, got %+v", sig)
+	}
+
+	// The sent copy is encrypted for the sender too
+	if _, info := UnwrapPGP(raw, aliceCfg, "alice@example.com"); info == nil || !info.Decrypted {
+		t.Errorf("Expected the sender to decrypt their own copy, got %+v", info)
+	}
+}
+
+func TestPGPMIMESignedOnly(t *testing.T) {
+	dir := t.TempDir()
+	aliceCfg, _, alicePublic := testPGPAccount(t, dir, "alice", "alice@example.com")
+	bobCfg, _, _ := testPGPAccount(t, dir, "bob", "bob@example.org")
+	if _, err := ImportPublicKeys(bobCfg.Keyring, []byte(alicePublic)); err != nil {
+		t.Fatal(err)
+	}
+
+	sc := NewSMTPClient(&config.AccountConfig{AccountID: "alice", EmailAddress: "alice@example.com", PGP: aliceCfg})
+	raw, err := sc.buildMessage(SendOptions{To: []string{"bob@example.org"}, Subject: "Hello", Body: "Signed text\n", Sign: true, Crypto: CryptoPGP})
+	if err != nil {
+		t.Fatalf("Failed to build message: %v", err)
+	}
+	if !strings.Contains(string(raw), "application/pgp-signature") {
+		t.Fatalf("Expected a multipart/signed message, got:\n%.500s", raw)
+	}
+
+	_, info := UnwrapPGP(raw, bobCfg, "mallory@example.com")
+	if info == nil || info.Encrypted || !info.Signed || !info.Signature.Valid || info.Signature.MatchesFrom {
+		t.Errorf("Expected a valid signature not matching From, got %+v", info)
+	}
+
+	tampered := strings.Replace(string(raw), "Signed text", "Forged text", 1)
+	if _, info := UnwrapPGP([]byte(tampered), bobCfg, "alice@example.com"); info == nil || info.Signature.Valid {
+		t.Errorf("Expected tampered content to fail verification, got %+v", info)
+	}
+
+	// S/MIME is not configured, so explicitly requesting it fails
+	if _, err := sc.buildMessage(SendOptions{To: []string{"bob@example.org"}, Subject: "x", Body: "x", Sign: true, Crypto: CryptoSMIME}); err == nil {
+		t.Error("Expected an error when S/MIME is not configured")
+	}
+}
+
+func TestPGPMIMESignedTruncated(t *testing.T) {
+	cfg, _, _ := testPGPAccount(t, t.TempDir(), "bob", "bob@example.org")
+	for _, body := range []string{"--b", "x\r\n--b\r\ncontent\r\n--b"} {
+		raw := "From: a@example.com\r\nContent-Type: multipart/signed; protocol=\"application/pgp-signature\"; boundary=b\r\n\r\n" + body
+		if _, info := UnwrapPGP([]byte(raw), cfg, "a@example.com"); info == nil || info.Signature == nil || !strings.Contains(info.Signature.Error, "malformed multipart/signed") {
+			t.Errorf("Expected a malformed message error for %q, got %+v", body, info)
+		}
+	}
+}
+
+func TestLoadPGPSecretKeyPassphrase(t *testing.T) {
+	dir := t.TempDir()
+	cfg, entity, _ := testPGPAccount(t, dir, "alice", "alice@example.com")
+	if err := entity.EncryptPrivateKeys([]byte("hunter2"), nil); err != nil {
+		t.Fatal(err)
+	}
+	var secret bytes.Buffer
+	w, _ := armor.Encode(&secret, "PGP PRIVATE KEY BLOCK", nil)
+	if err := entity.SerializePrivateWithoutSigning(w, nil); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	if err := os.WriteFile(cfg.PrivateKeyFile, secret.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := loadPGPSecretKey(cfg); err == nil || !strings.Contains(err.Error(), "none is configured") {
+		t.Errorf("Expected a missing passphrase error, got %v", err)
+	}
+	cfg.Passphrase = config.StaticSecret("wrong")
+	if _, err := loadPGPSecretKey(cfg); err == nil {
+		t.Error("Expected a wrong passphrase to fail")
+	}
+	cfg.Passphrase = config.NewSecret("ACCOUNT_alice_PGP_PASSPHRASE_CMD", "pass show pgp", func() (string, error) {
+		return "hunter2", nil
+	})
+	if key, err := loadPGPSecretKey(cfg); err != nil || key.PrivateKey.Encrypted {
+		t.Errorf("Expected the key to be unlocked, got %v", err)
+	}
+}
+
+func TestDecryptInlinePGP(t *testing.T) {
+	dir := t.TempDir()
+	_, alice, alicePublic := testPGPAccount(t, dir, "alice", "alice@example.com")
+	bobCfg, bob, _ := testPGPAccount(t, dir, "bob", "bob@example.org")
+	if _, err := ImportPublicKeys(bobCfg.Keyring, []byte(alicePublic)); err != nil {
+		t.Fatal(err)
+	}
+
+	var encrypted bytes.Buffer
+	aw, _ := armor.Encode(&encrypted, "PGP MESSAGE", nil)
+	w, err := openpgp.Encrypt(aw, []*openpgp.Entity{bob}, alice, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("The code is 4711.\n"))
+	w.Close()
+	aw.Close()
+
+	body := "Hi Bob,\n\n" + encrypted.String() + "\n\nAlice\n"
+	text, info := DecryptInlinePGP(body, bobCfg, "alice@example.com")
+	if info == nil || !info.Inline || !info.Decrypted || !info.Signature.Valid {
+		t.Fatalf("Expected a decrypted, verified inline message, got %+v", info)
+	}
+	if !strings.Contains(text, "The code is 4711.") || strings.Contains(text, "BEGIN PGP") || !strings.HasPrefix(text, "Hi Bob,") {
+		t.Errorf("Expected the block to be replaced by its plaintext, got:\n%s", text)
+	}
+
+	var signed bytes.Buffer
+	cw, err := clearsign.Encode(&signed, alice.PrivateKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cw.Write([]byte("Meeting moved to 3pm.\n"))
+	cw.Close()
+	text, info = DecryptInlinePGP(signed.String(), bobCfg, "alice@example.com")
+	if info == nil || info.Encrypted || !info.Signed || !info.Signature.Valid || !info.Signature.MatchesFrom {
+		t.Fatalf("Expected a verified clearsigned message, got %+v", info)
+	}
+	if strings.Contains(text, "BEGIN PGP") || !strings.Contains(text, "Meeting moved to 3pm.") {
+		t.Errorf("Expected the clearsigned text without armor, got:\n%s", text)
+	}
+
+	if text, info := DecryptInlinePGP("Plain text", bobCfg, "alice@example.com"); info != nil || text != "Plain text" {
+		t.Errorf("Expected plain text to pass through, got %q %+v", text, info)
+	}
+}
+
+func TestImportAndListPGPKeys(t *testing.T) {
+	dir := t.TempDir()
+	aliceCfg, _, _ := testPGPAccount(t, dir, "alice", "alice@example.com")
+	bobCfg, _, _ := testPGPAccount(t, dir, "bob", "bob@example.org")
+
+	// Importing a secret key stores only its public part
+	secret, _ := os.ReadFile(bobCfg.PrivateKeyFile)
+	imported, err := ImportPublicKeys(aliceCfg.Keyring, secret)
+	if err != nil || len(imported) != 1 || imported[0].Secret || !imported[0].CanEncrypt {
+		t.Fatalf("Expected one public key to be imported, got %+v (%v)", imported, err)
+	}
+	stored, _ := os.ReadFile(filepath.Join(aliceCfg.Keyring, imported[0].Fingerprint+".asc"))
+	if !strings.Contains(string(stored), "PUBLIC KEY BLOCK") || strings.Contains(string(stored), "PRIVATE") {
+		t.Errorf("Expected only public key material, got:\n%s", stored)
+	}
+
+	keys, err := ListPGPKeys(aliceCfg)
+	if err != nil || len(keys) != 2 {
+		t.Fatalf("Expected own and imported keys, got %+v (%v)", keys, err)
+	}
+	if !keys[0].Secret || keys[0].UserIDs[0] != "alice <alice@example.com>" || keys[1].UserIDs[0] != "bob <bob@example.org>" {
+		t.Errorf("Unexpected keys: %+v", keys)
+	}
+
+	if _, err := ImportPublicKeys(aliceCfg.Keyring, []byte("not a key")); err == nil {
+		t.Error("Expected invalid input to fail")
+	}
+}
@@ -0,0 +1,138 @@
+package email
+
+import (
+	"fmt"
+	"mime"
+	"net/mail"
+	"path/filepath"
+	"strings"
+
+	"github.com/prasanthmj/email/pkg/config"
+)
+
+// PolicyError is returned when a message violates the account's outbound policy
+type PolicyError struct {
+	Rule   string
+	Detail string
+}
+
+func (e *PolicyError) Error() string {
+	return fmt.Sprintf("blocked by outbound policy (%s): %s", e.Rule, e.Detail)
+}
+
+// ConfirmationRequiredError is returned when a message to external recipients needs confirm_send
+type ConfirmationRequiredError struct {
+	External []string
+}
+
+func (e *ConfirmationRequiredError) Error() string {
+	return fmt.Sprintf("sending to external recipients %s requires confirmation", strings.Join(e.External, ", "))
+}
+
+// applyPolicy checks a message against the account policy and adds the required BCC recipients
+func (sc *SMTPClient) applyPolicy(opts SendOptions) (SendOptions, error) {
+	policy := sc.config.Policy
+	if err := validateRecipients(opts); err != nil {
+		return opts, err
+	}
+	recipients := envelopeRecipients(opts)
+
+	if policy.MaxRecipients > 0 && len(recipients) > policy.MaxRecipients {
+		return opts, &PolicyError{
+			Rule:   "max_recipients",
+			Detail: fmt.Sprintf("%d recipients exceeds the limit of %d", len(recipients), policy.MaxRecipients),
+		}
+	}
+
+	var external []string
+	for _, rcpt := range recipients {
+		domain := config.AddressDomain(rcpt)
+		if config.DomainMatches(domain, policy.BlockedDomains) {
+			return opts, &PolicyError{Rule: "blocked_domain", Detail: fmt.Sprintf("recipient %s is in a blocked domain", rcpt)}
+		}
+		if len(policy.AllowedDomains) > 0 && !config.DomainMatches(domain, policy.AllowedDomains) {
+			return opts, &PolicyError{Rule: "allowed_domains", Detail: fmt.Sprintf("recipient %s is not in an allowed domain", rcpt)}
+		}
+		if !config.DomainMatches(domain, policy.InternalDomains) {
+			external = append(external, rcpt)
+		}
+	}
+
+	files := append([]string{}, opts.Attachments...)
+	for _, inline := range opts.InlineAttachments {
+		files = append(files, inline.CacheID)
+	}
+	for _, name := range files {
+		if blockedAttachment(name, policy.BlockedAttachments) {
+			return opts, &PolicyError{Rule: "blocked_attachment", Detail: fmt.Sprintf("attachment %s has a blocked file type", name)}
+		}
+	}
+
+	// Parts decoded from data: URIs are attachments too
+	if opts.EmbedDataURIs && opts.HTMLBody != "" && len(policy.BlockedAttachments) > 0 {
+		_, parts, err := embedDataURIs(opts.HTMLBody)
+		if err != nil {
+			return opts, err
+		}
+		for _, part := range parts {
+			mimeType, _, _ := mime.ParseMediaType(part.ContentType)
+			if blockedAttachment(part.Filename, policy.BlockedAttachments) || containsFold(policy.BlockedAttachments, mimeType) {
+				return opts, &PolicyError{Rule: "blocked_attachment", Detail: fmt.Sprintf("embedded %s data URI has a blocked file type", part.ContentType)}
+			}
+		}
+	}
+
+	if policy.ConfirmExternal && len(external) > 0 && !opts.PolicyConfirmed {
+		return opts, &ConfirmationRequiredError{External: external}
+	}
+
+	// Add compliance BCC copies that are not already recipients
+	if len(policy.RequiredBCC) > 0 {
+		opts.BCC = append([]string{}, opts.BCC...)
+		for _, bcc := range policy.RequiredBCC {
+			if !containsFold(recipients, bcc) {
+				opts.BCC = append(opts.BCC, bcc)
+			}
+		}
+	}
+
+	return opts, nil
+}
+
+// validateRecipients rejects recipients that are not exactly one valid address, so the
+// policy checks the same addresses the message is sent to
+func validateRecipients(opts SendOptions) error {
+	for _, list := range [][]string{opts.To, opts.CC, opts.BCC} {
+		for _, r := range list {
+			if _, err := mail.ParseAddress(r); err != nil {
+				return fmt.Errorf("invalid recipient %q: %w", r, err)
+			}
+		}
+	}
+	return nil
+}
+
+// blockedAttachment reports whether a file name matches a blocked extension or MIME type
+func blockedAttachment(name string, blocked []string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	if ext == "" {
+		return false
+	}
+	mimeType, _, _ := mime.ParseMediaType(mime.TypeByExtension(ext))
+	for _, b := range blocked {
+		if b == ext || (mimeType != "" && b == mimeType) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsFold checks if a string slice contains a value, ignoring case
+func containsFold(slice []string, value string) bool {
+	for _, s := range slice {
+		if strings.EqualFold(s, value) {
+			return true
+		}
+	}
+	return false
+}
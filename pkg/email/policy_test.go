@@ -0,0 +1,118 @@
+package email
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/prasanthmj/email/pkg/config"
+)
+
+func TestApplyPolicy(t *testing.T) {
+	sc := NewSMTPClient(&config.AccountConfig{
+		EmailAddress: "me@example.com",
+		Policy: config.Policy{
+			BlockedDomains:     []string{"competitor.com"},
+			MaxRecipients:      3,
+			BlockedAttachments: []string{".exe", "application/pdf"},
+			RequiredBCC:        []string{"archive@example.com"},
+			ConfirmExternal:    true,
+			InternalDomains:    []string{"example.com"},
+		},
+	})
+
+	tests := []struct {
+		name string
+		opts SendOptions
+		rule string
+	}{
+		{"blocked domain", SendOptions{To: []string{"Bob <bob@sales.competitor.com>"}}, "blocked_domain"},
+		{"too many recipients", SendOptions{To: []string{"a@example.com", "b@example.com"}, CC: []string{"c@example.com"}, BCC: []string{"d@example.com"}}, "max_recipients"},
+		{"blocked extension", SendOptions{To: []string{"a@example.com"}, Attachments: []string{"abc_setup.EXE"}}, "blocked_attachment"},
+		{"blocked MIME type", SendOptions{To: []string{"a@example.com"}, Attachments: []string{"abc_invoice.pdf"}}, "blocked_attachment"},
+	}
+	for _, tt := range tests {
+		_, err := sc.applyPolicy(tt.opts)
+		var policyErr *PolicyError
+		if !errors.As(err, &policyErr) || policyErr.Rule != tt.rule {
+			t.Errorf("%s: expected %s policy error, got %v", tt.name, tt.rule, err)
+		}
+	}
+
+	// Internal recipients pass and get the compliance BCC
+	opts, err := sc.applyPolicy(SendOptions{To: []string{"Team <team@example.com>"}, BCC: []string{"boss@example.com"}})
+	if err != nil {
+		t.Fatalf("Internal message rejected: %v", err)
+	}
+	if want := []string{"boss@example.com", "archive@example.com"}; !reflect.DeepEqual(opts.BCC, want) {
+		t.Errorf("Expected BCC %v, got %v", want, opts.BCC)
+	}
+
+	// External recipients need confirmation
+	external := SendOptions{To: []string{"team@example.com", "client@customer.org"}}
+	_, err = sc.applyPolicy(external)
+	var held *ConfirmationRequiredError
+	if !errors.As(err, &held) || !reflect.DeepEqual(held.External, []string{"client@customer.org"}) {
+		t.Fatalf("Expected confirmation for client@customer.org, got %v", err)
+	}
+	external.PolicyConfirmed = true
+	if _, err := sc.applyPolicy(external); err != nil {
+		t.Errorf("Confirmed message rejected: %v", err)
+	}
+}
+
+func TestApplyPolicyAllowedDomains(t *testing.T) {
+	sc := NewSMTPClient(&config.AccountConfig{
+		EmailAddress: "me@example.com",
+		Policy:       config.Policy{AllowedDomains: []string{"example.com", "*.partner.net"}},
+	})
+
+	if _, err := sc.applyPolicy(SendOptions{To: []string{"a@example.com", "b@eu.partner.net"}}); err != nil {
+		t.Errorf("Allowed recipients rejected: %v", err)
+	}
+	_, err := sc.applyPolicy(SendOptions{To: []string{"a@example.com"}, CC: []string{"x@elsewhere.io"}})
+	var policyErr *PolicyError
+	if !errors.As(err, &policyErr) || policyErr.Rule != "allowed_domains" {
+		t.Errorf("Expected allowed_domains error, got %v", err)
+	}
+
+	// Entries that are not exactly one address are rejected before the domain check
+	for _, rcpt := range []string{"evil@attacker.com, ok@example.com", "evil@attacker.com <ok@example.com", "nobody"} {
+		if _, err := sc.applyPolicy(SendOptions{To: []string{rcpt}}); err == nil || !strings.Contains(err.Error(), "invalid recipient") {
+			t.Errorf("Expected an invalid recipient error for %q, got %v", rcpt, err)
+		}
+	}
+}
+
+func TestApplyPolicyEmbeddedDataURIs(t *testing.T) {
+	sc := NewSMTPClient(&config.AccountConfig{
+		EmailAddress: "me@example.com",
+		Policy:       config.Policy{BlockedAttachments: []string{".pdf", "text/html"}},
+	})
+
+	// Parts are checked by the extension of their generated filename and by content type
+	for _, contentType := range []string{"application/pdf", "text/html"} {
+		opts := SendOptions{
+			To:            []string{"a@example.com"},
+			HTMLBody:      `<img src="data:` + contentType + `;base64,aGVsbG8=">`,
+			EmbedDataURIs: true,
+		}
+		_, err := sc.applyPolicy(opts)
+		var policyErr *PolicyError
+		if !errors.As(err, &policyErr) || policyErr.Rule != "blocked_attachment" {
+			t.Errorf("Expected blocked_attachment error for %s, got %v", contentType, err)
+		}
+
+		// Without embedding, the data URI stays in the HTML and is not an attachment
+		opts.EmbedDataURIs = false
+		if _, err := sc.applyPolicy(opts); err != nil {
+			t.Errorf("Expected the message without embedded parts to pass, got %v", err)
+		}
+	}
+
+	png := SendOptions{To: []string{"a@example.com"}, HTMLBody: `<img src="data:image/png;base64,aGVsbG8=">`, EmbedDataURIs: true}
+	if _, err := sc.applyPolicy(png); err != nil {
+		t.Errorf("Expected an embedded image to pass, got %v", err)
+	}
+}
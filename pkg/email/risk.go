@@ -0,0 +1,506 @@
+package email
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"html"
+	"net"
+	"net/mail"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/prasanthmj/email/pkg/config"
+)
+
+// Risk levels derived from the total score
+const (
+	RiskNone   = "none"
+	RiskLow    = "low"
+	RiskMedium = "medium"
+	RiskHigh   = "high"
+)
+
+// RiskReport is the scored result of the phishing heuristics for one email
+type RiskReport struct {
+	Score    int           `json:"score"` // 0-100: the highest finding score of each rule, summed and capped
+	Level    string        `json:"level"` // none, low, medium or high
+	Findings []RiskFinding `json:"findings"`
+}
+
+// RiskFinding is one suspicious trait of an email
+type RiskFinding struct {
+	Rule     string `json:"rule"`
+	Score    int    `json:"score"`
+	Detail   string `json:"detail"`
+	Evidence string `json:"evidence,omitempty"`
+}
+
+// RiskInput is the cached data the heuristics work on
+type RiskInput struct {
+	From        string
+	ReplyTo     []string
+	Subject     string
+	HTMLBody    string
+	TextBody    string // Used for language checks when there is no HTML body
+	Attachments []Attachment
+	OwnDomains  []string // Domains of the account and its identities
+}
+
+// executableExtensions run code when opened
+var executableExtensions = map[string]bool{
+	".exe": true, ".scr": true, ".com": true, ".pif": true, ".bat": true, ".cmd": true,
+	".msi": true, ".cpl": true, ".hta": true, ".jar": true, ".js": true, ".jse": true,
+	".vbs": true, ".vbe": true, ".wsf": true, ".wsh": true, ".ps1": true, ".lnk": true,
+	".reg": true, ".iso": true, ".img": true,
+}
+
+// macroExtensions are macro-enabled Office formats
+var macroExtensions = map[string]bool{
+	".docm": true, ".dotm": true, ".xlsm": true, ".xltm": true, ".xlam": true,
+	".pptm": true, ".potm": true, ".ppsm": true, ".ppam": true, ".sldm": true,
+}
+
+// anchorPattern matches a link and its content
+var anchorPattern = regexp.MustCompile(`(?is)<a\b((?:[^>"']|"[^"]*"|'[^']*')*)>(.*?)</a\s*>`)
+
+// hrefPattern extracts the href attribute of a link
+var hrefPattern = regexp.MustCompile(`(?i)\bhref\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s>]+))`)
+
+// urlTextPattern matches link text that reads as a URL or domain name
+var urlTextPattern = regexp.MustCompile(`(?i)^(https?://)?(www\.)?([a-z0-9-]+\.)+[a-z]{2,}(:\d+)?([/?#]\S*)?$`)
+
+// urgencyPattern matches pressure to act quickly
+var urgencyPattern = regexp.MustCompile(`(?i)\b(urgent(ly)?|immediately|asap|right away|as soon as possible|within (24|48) hours|by (today|end of day|eod)|final notice|overdue|past due|account (will be )?(suspended|closed|locked))\b`)
+
+// paymentPattern matches requests to move money or change payment details
+var paymentPattern = regexp.MustCompile(`(?i)\b(wire transfer|bank transfer|wire the|payment (is )?(due|required|pending)|outstanding (invoice|payment|balance)|gift cards?|(new|updated|change[ds]?|update) (to )?(our |my |the )?(bank|banking|payment|account) (details|information|info)|routing number|iban|bitcoin|crypto(currency)? wallet|remit(tance)?)\b`)
+
+// confusables maps look-alike characters to the letters they imitate
+var confusables = strings.NewReplacer(
+	"rn", "m", "vv", "w", "cl", "d",
+	"0", "o", "1", "l", "i", "l", "5", "s", "3", "e",
+	"а", "a", "е", "e", "о", "o", "р", "p", "с", "c", "х", "x", "у", "y", "і", "l", "ј", "j", "ѕ", "s",
+)
+
+// AnalyzeRisk runs the phishing heuristics over an email's headers, HTML body and attachment metadata
+func AnalyzeRisk(in RiskInput) *RiskReport {
+	var findings []RiskFinding
+	fromName, fromAddr := splitFrom(in.From)
+	fromDomain := domainOf(fromAddr)
+
+	findings = append(findings, displayNameFindings(fromName, fromAddr, fromDomain, in.OwnDomains)...)
+	findings = append(findings, replyToFindings(in.ReplyTo, fromAddr, fromDomain)...)
+
+	links := linkFindings(in.HTMLBody)
+	findings = append(findings, links.findings...)
+
+	// Sender, Reply-To and link domains that imitate our own
+	domains := []string{fromDomain}
+	for _, addr := range in.ReplyTo {
+		_, a := splitFrom(addr)
+		domains = append(domains, domainOf(a))
+	}
+	domains = append(domains, links.hosts...)
+	findings = append(findings, lookalikeFindings(domains, in.OwnDomains)...)
+
+	findings = append(findings, attachmentFindings(in.Attachments)...)
+
+	text := in.TextBody
+	if in.HTMLBody != "" {
+		if converted, err := ConvertHTMLToText(in.HTMLBody); err == nil {
+			text = converted
+		}
+	}
+	findings = append(findings, languageFindings(in.Subject+"\n"+text)...)
+
+	return scoreFindings(findings)
+}
+
+// scoreFindings sums the highest score of each rule, so repeated findings don't inflate the total
+func scoreFindings(findings []RiskFinding) *RiskReport {
+	best := make(map[string]int)
+	for _, f := range findings {
+		if f.Score > best[f.Rule] {
+			best[f.Rule] = f.Score
+		}
+	}
+	total := 0
+	for _, score := range best {
+		total += score
+	}
+	if total > 100 {
+		total = 100
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool { return findings[i].Score > findings[j].Score })
+	if findings == nil {
+		findings = []RiskFinding{}
+	}
+
+	report := &RiskReport{Score: total, Findings: findings}
+	switch {
+	case total == 0:
+		report.Level = RiskNone
+	case total < 30:
+		report.Level = RiskLow
+	case total < 60:
+		report.Level = RiskMedium
+	default:
+		report.Level = RiskHigh
+	}
+	return report
+}
+
+// splitFrom splits an address header value into display name and lowercased address
+func splitFrom(value string) (string, string) {
+	if parsed, err := mail.ParseAddress(value); err == nil {
+		return parsed.Name, strings.ToLower(parsed.Address)
+	}
+	if open, end := strings.LastIndexByte(value, '<'), strings.LastIndexByte(value, '>'); open >= 0 && end > open {
+		return strings.Trim(strings.TrimSpace(value[:open]), `"`), strings.ToLower(strings.TrimSpace(value[open+1 : end]))
+	}
+	return "", strings.ToLower(strings.TrimSpace(value))
+}
+
+// isOwnDomain reports whether domain is one of ours or a subdomain of one
+func isOwnDomain(domain string, own []string) bool {
+	return domain != "" && config.DomainMatches(domain, own)
+}
+
+// displayNameAddressPattern finds addresses and domains written into a display name
+var displayNameAddressPattern = regexp.MustCompile(`(?i)[a-z0-9._%+-]+@[a-z0-9.-]+\.[a-z]{2,}|\b([a-z0-9-]+\.)+[a-z]{2,}\b`)
+
+// displayNameFindings flags display names that name our domain, or an address other than the sender's
+func displayNameFindings(name, addr, domain string, own []string) []RiskFinding {
+	if name == "" {
+		return nil
+	}
+	var findings []RiskFinding
+	if !isOwnDomain(domain, own) {
+		lower := strings.ToLower(name)
+		for _, d := range own {
+			if d != "" && strings.Contains(lower, strings.ToLower(d)) {
+				return append(findings, RiskFinding{
+					Rule:     "display_name_spoof",
+					Score:    40,
+					Detail:   fmt.Sprintf("display name mentions our domain %s but the message is from %s", d, domain),
+					Evidence: name,
+				})
+			}
+		}
+		words := strings.FieldsFunc(lower, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+		for _, d := range own {
+			if base := baseName(strings.ToLower(d)); len(base) >= 4 && slices.Contains(words, base) {
+				return append(findings, RiskFinding{
+					Rule:     "display_name_spoof",
+					Score:    30,
+					Detail:   fmt.Sprintf("display name uses our name %q but the message is from %s", base, domain),
+					Evidence: name,
+				})
+			}
+		}
+	}
+	for _, m := range displayNameAddressPattern.FindAllString(name, -1) {
+		m = strings.ToLower(m)
+		if m != addr && m != domain && !strings.HasSuffix(domain, "."+m) {
+			findings = append(findings, RiskFinding{
+				Rule:     "display_name_spoof",
+				Score:    25,
+				Detail:   fmt.Sprintf("display name shows %s but the message is from %s", m, addr),
+				Evidence: name,
+			})
+			break
+		}
+	}
+	return findings
+}
+
+// replyToFindings flags replies that would go somewhere other than the sender
+func replyToFindings(replyTo []string, fromAddr, fromDomain string) []RiskFinding {
+	var findings []RiskFinding
+	for _, value := range replyTo {
+		_, addr := splitFrom(value)
+		if addr == "" || addr == fromAddr {
+			continue
+		}
+		if domain := domainOf(addr); domain != fromDomain && !aligned(domain, fromDomain) {
+			findings = append(findings, RiskFinding{
+				Rule:     "reply_to_mismatch",
+				Score:    25,
+				Detail:   fmt.Sprintf("replies go to %s, a different domain than the sender %s", addr, fromDomain),
+				Evidence: value,
+			})
+		} else {
+			findings = append(findings, RiskFinding{
+				Rule:     "reply_to_mismatch",
+				Score:    5,
+				Detail:   fmt.Sprintf("replies go to %s instead of the sender %s", addr, fromAddr),
+				Evidence: value,
+			})
+		}
+	}
+	return findings
+}
+
+// linkResult holds the link findings and the hosts linked to
+type linkResult struct {
+	findings []RiskFinding
+	hosts    []string
+}
+
+// linkFindings flags links whose visible text names a different host than the one they open
+func linkFindings(htmlBody string) linkResult {
+	var result linkResult
+	seen := make(map[string]bool)
+	for _, m := range anchorPattern.FindAllStringSubmatch(htmlBody, -1) {
+		href := attrValue(hrefPattern, m[1])
+		target, err := url.Parse(strings.TrimSpace(html.UnescapeString(href)))
+		if err != nil || (target.Scheme != "http" && target.Scheme != "https") {
+			continue
+		}
+		host := normalizeHost(target.Hostname())
+		if host == "" {
+			continue
+		}
+		if !seen[host] {
+			seen[host] = true
+			result.hosts = append(result.hosts, host)
+		}
+		if net.ParseIP(host) != nil {
+			result.findings = append(result.findings, RiskFinding{
+				Rule:     "ip_link",
+				Score:    20,
+				Detail:   fmt.Sprintf("link opens a bare IP address %s", host),
+				Evidence: truncateEvidence(href),
+			})
+		}
+
+		text := strings.TrimSpace(html.UnescapeString(htmlTagPattern.ReplaceAllString(m[2], "")))
+		if !urlTextPattern.MatchString(text) {
+			continue
+		}
+		shown := text
+		if !strings.Contains(shown, "://") {
+			shown = "http://" + shown
+		}
+		shownURL, err := url.Parse(shown)
+		if err != nil {
+			continue
+		}
+		shownHost := normalizeHost(shownURL.Hostname())
+		if shownHost != host && !aligned(shownHost, host) {
+			result.findings = append(result.findings, RiskFinding{
+				Rule:     "link_mismatch",
+				Score:    35,
+				Detail:   fmt.Sprintf("link text shows %s but opens %s", shownHost, host),
+				Evidence: truncateEvidence(text + " -> " + href),
+			})
+		}
+	}
+	return result
+}
+
+// attrValue returns the first non-empty capture group of an attribute pattern
+func attrValue(pattern *regexp.Regexp, attrs string) string {
+	m := pattern.FindStringSubmatch(attrs)
+	for _, v := range m[1:] {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// normalizeHost lowercases a host and drops a leading www.
+func normalizeHost(host string) string {
+	return strings.TrimPrefix(strings.TrimSuffix(strings.ToLower(host), "."), "www.")
+}
+
+// truncateEvidence keeps evidence strings short
+func truncateEvidence(s string) string {
+	if len(s) <= 120 {
+		return s
+	}
+	cut := 120
+	for cut > 0 && !isRuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + "..."
+}
+
+// lookalikeFindings flags domains that imitate one of ours or use internationalized labels
+func lookalikeFindings(domains, own []string) []RiskFinding {
+	var findings []RiskFinding
+	seen := make(map[string]bool)
+	for _, domain := range domains {
+		if domain == "" || seen[domain] || isOwnDomain(domain, own) {
+			continue
+		}
+		seen[domain] = true
+		if reason, target := lookalikeOf(domain, own); reason != "" {
+			findings = append(findings, RiskFinding{
+				Rule:     "lookalike_domain",
+				Score:    40,
+				Detail:   fmt.Sprintf("%s imitates %s (%s)", domain, target, reason),
+				Evidence: domain,
+			})
+		} else if isInternationalized(domain) {
+			findings = append(findings, RiskFinding{
+				Rule:     "lookalike_domain",
+				Score:    15,
+				Detail:   fmt.Sprintf("%s uses internationalized characters that can imitate other domains", domain),
+				Evidence: domain,
+			})
+		}
+	}
+	return findings
+}
+
+// lookalikeOf returns why domain looks like one of the own domains, and which one
+func lookalikeOf(domain string, own []string) (string, string) {
+	name := baseName(domain)
+	for _, target := range own {
+		target = strings.ToLower(target)
+		targetName := baseName(target)
+		if len(targetName) < 3 {
+			continue
+		}
+		switch {
+		case name == targetName:
+			return "same name, different domain", target
+		case confusables.Replace(name) == confusables.Replace(targetName):
+			return "look-alike characters", target
+		case len(targetName) >= 5 && editDistance(name, targetName) <= 1:
+			return "one character different", target
+		case strings.HasPrefix(name, targetName+"-") || strings.HasSuffix(name, "-"+targetName):
+			return "our name with extra words", target
+		}
+	}
+	return "", ""
+}
+
+// baseName returns the label left of the public suffix, e.g. "example" for mail.example.co.uk
+func baseName(domain string) string {
+	labels := strings.Split(strings.TrimSuffix(domain, "."), ".")
+	if len(labels) < 2 {
+		return domain
+	}
+	i := len(labels) - 2
+	// Treat two-letter country code second levels (co.uk, com.au) as part of the suffix
+	if i > 0 && len(labels[len(labels)-1]) == 2 && len(labels[i]) <= 3 {
+		i--
+	}
+	return labels[i]
+}
+
+// isInternationalized reports whether a domain has punycode labels or non-ASCII characters
+func isInternationalized(domain string) bool {
+	if utf8.RuneCountInString(domain) != len(domain) {
+		return true
+	}
+	for _, label := range strings.Split(domain, ".") {
+		if strings.HasPrefix(label, "xn--") {
+			return true
+		}
+	}
+	return false
+}
+
+// editDistance returns the Levenshtein distance between two strings
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+// attachmentFindings flags executables, macro-enabled Office files and encrypted archives
+func attachmentFindings(attachments []Attachment) []RiskFinding {
+	var findings []RiskFinding
+	for _, att := range attachments {
+		name := strings.ToLower(att.Filename)
+		ext := filepath.Ext(name)
+		inner := filepath.Ext(strings.TrimSuffix(name, ext))
+		switch {
+		case executableExtensions[ext] || att.ContentType == "application/x-msdownload":
+			detail := fmt.Sprintf("executable attachment (%s)", ext)
+			if inner != "" && !executableExtensions[inner] {
+				detail = fmt.Sprintf("executable disguised as %s (%s)", inner, ext)
+			}
+			findings = append(findings, RiskFinding{Rule: "dangerous_attachment", Score: 50, Detail: detail, Evidence: att.Filename})
+		case macroExtensions[ext]:
+			findings = append(findings, RiskFinding{
+				Rule:     "dangerous_attachment",
+				Score:    35,
+				Detail:   fmt.Sprintf("macro-enabled Office document (%s)", ext),
+				Evidence: att.Filename,
+			})
+		case att.Encrypted:
+			findings = append(findings, RiskFinding{
+				Rule:     "dangerous_attachment",
+				Score:    35,
+				Detail:   "password-protected archive; its contents cannot be scanned",
+				Evidence: att.Filename,
+			})
+		}
+	}
+	return findings
+}
+
+// languageFindings flags requests for payment, weighted up when combined with urgency
+func languageFindings(text string) []RiskFinding {
+	payment := paymentPattern.FindStringIndex(text)
+	if payment == nil {
+		return nil
+	}
+	finding := RiskFinding{
+		Rule:     "urgent_payment",
+		Score:    10,
+		Detail:   "asks for a payment or a change of payment details",
+		Evidence: excerpt(text, payment[0], payment[1]),
+	}
+	if urgent := urgencyPattern.FindStringIndex(text); urgent != nil {
+		finding.Score = 30
+		finding.Detail = "asks for a payment or a change of payment details under time pressure"
+		finding.Evidence += " | " + excerpt(text, urgent[0], urgent[1])
+	}
+	return []RiskFinding{finding}
+}
+
+// IsEncryptedArchive reports whether content is a ZIP archive with password-protected entries
+func IsEncryptedArchive(content []byte) bool {
+	if !bytes.HasPrefix(content, []byte("PK\x03\x04")) {
+		return false
+	}
+	r, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return false
+	}
+	for _, f := range r.File {
+		if f.Flags&0x1 != 0 {
+			return true
+		}
+	}
+	return false
+}
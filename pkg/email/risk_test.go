@@ -0,0 +1,137 @@
+package email
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+)
+
+// findingScore returns the highest score reported for a rule, or 0
+func findingScore(report *RiskReport, rule string) int {
+	best := 0
+	for _, f := range report.Findings {
+		if f.Rule == rule && f.Score > best {
+			best = f.Score
+		}
+	}
+	return best
+}
+
+func TestAnalyzeRisk(t *testing.T) {
+	report := AnalyzeRisk(RiskInput{
+		From:    `"IT Desk it@acme.com" <helpdesk@acrne.com>`,
+		ReplyTo: []string{"payments@mailbox.example"},
+		Subject: "URGENT: outstanding invoice",
+		HTMLBody: `<p>Please pay immediately by wire transfer.</p>` +
+			`<a href="https://login.evil.example/acme">https://www.acme.com/login</a>` +
+			`<a href="https://acme.com/help">Help center</a>` +
+			`<a href="http://192.0.2.7/x">here</a>`,
+		Attachments: []Attachment{
+			{Filename: "invoice.pdf.exe"},
+			{Filename: "Budget.xlsm"},
+			{Filename: "docs.zip", Encrypted: true},
+			{Filename: "report.pdf"},
+		},
+		OwnDomains: []string{"acme.com"},
+	})
+
+	for rule, want := range map[string]int{
+		"display_name_spoof":   40,
+		"lookalike_domain":     40,
+		"reply_to_mismatch":    25,
+		"link_mismatch":        35,
+		"ip_link":              20,
+		"dangerous_attachment": 50,
+		"urgent_payment":       30,
+	} {
+		if got := findingScore(report, rule); got != want {
+			t.Errorf("Expected %s score %d, got %d", rule, want, got)
+		}
+	}
+	attachments := 0
+	for _, f := range report.Findings {
+		if f.Rule == "dangerous_attachment" {
+			attachments++
+		}
+	}
+	if attachments != 3 {
+		t.Errorf("Expected 3 dangerous attachments, got %d", attachments)
+	}
+	if report.Score != 100 || report.Level != RiskHigh {
+		t.Errorf("Expected a capped high score, got %d (%s)", report.Score, report.Level)
+	}
+}
+
+func TestAnalyzeRiskClean(t *testing.T) {
+	report := AnalyzeRisk(RiskInput{
+		From:        "Jane Doe <jane@acme.com>",
+		ReplyTo:     []string{"jane@acme.com"},
+		Subject:     "Lunch on Friday?",
+		HTMLBody:    `<p>See <a href="https://www.example.org/menu">example.org/menu</a>.</p>`,
+		Attachments: []Attachment{{Filename: "menu.pdf"}},
+		OwnDomains:  []string{"acme.com"},
+	})
+	if report.Score != 0 || report.Level != RiskNone || len(report.Findings) != 0 {
+		t.Errorf("Expected no findings, got %+v", report)
+	}
+}
+
+func TestLookalikeOf(t *testing.T) {
+	own := []string{"example.com"}
+	tests := []struct {
+		domain string
+		want   bool
+	}{
+		{"examp1e.com", true},
+		{"exarnple.com", true},
+		{"exampel.com", false}, // transposition is two edits
+		{"exmple.com", true},
+		{"example.net", true},
+		{"example-billing.com", true},
+		{"mail.example.co.uk", true},
+		{"sample.org", false},
+		{"unrelated.io", false},
+	}
+	for _, tt := range tests {
+		reason, _ := lookalikeOf(tt.domain, own)
+		if (reason != "") != tt.want {
+			t.Errorf("lookalikeOf(%s) = %q, want lookalike %v", tt.domain, reason, tt.want)
+		}
+	}
+
+	// Same-domain senders are never lookalikes
+	if findings := lookalikeFindings([]string{"mail.example.com"}, own); len(findings) != 0 {
+		t.Errorf("Expected no findings for a subdomain, got %+v", findings)
+	}
+	if findings := lookalikeFindings([]string{"xn--80ak6aa92e.com"}, own); len(findings) != 1 || findings[0].Score != 15 {
+		t.Errorf("Expected an internationalized domain finding, got %+v", findings)
+	}
+}
+
+func TestIsEncryptedArchive(t *testing.T) {
+	build := func(encrypted bool) []byte {
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		header := &zip.FileHeader{Name: "payload.txt", Method: zip.Store}
+		if encrypted {
+			header.Flags |= 0x1
+		}
+		w, err := zw.CreateHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte("data"))
+		zw.Close()
+		return buf.Bytes()
+	}
+
+	if !IsEncryptedArchive(build(true)) {
+		t.Error("Expected encrypted archive to be detected")
+	}
+	if IsEncryptedArchive(build(false)) {
+		t.Error("Expected plain archive not to be flagged")
+	}
+	if IsEncryptedArchive([]byte("%PDF-1.4")) {
+		t.Error("Expected non-archive not to be flagged")
+	}
+}
@@ -0,0 +1,27 @@
+package email
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/textproto"
+)
+
+// IsTemporarySendError reports whether a failed send may succeed when retried.
+// SMTP 4xx replies and network failures are temporary; 5xx replies and message errors are not.
+func IsTemporarySendError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) {
+		return protoErr.Code >= 400 && protoErr.Code < 500
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
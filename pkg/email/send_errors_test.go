@@ -0,0 +1,74 @@
+package email
+
+import (
+	"crypto/tls"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http/httptest"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prasanthmj/email/pkg/config"
+)
+
+func TestIsTemporarySendError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"4xx reply", fmt.Errorf("failed to send email: %w", &textproto.Error{Code: 421, Msg: "try again later"}), true},
+		{"5xx reply", fmt.Errorf("failed to send email: %w", &textproto.Error{Code: 550, Msg: "no such user"}), false},
+		{"connection refused", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, true},
+		{"dropped connection", fmt.Errorf("failed to send email: %w", io.EOF), true},
+		{"message error", errors.New("attachment not found"), false},
+	}
+	for _, tt := range tests {
+		if got := IsTemporarySendError(tt.err); got != tt.want {
+			t.Errorf("%s: IsTemporarySendError() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTLSConfigTrustsCAFile(t *testing.T) {
+	// Stands in for Proton Mail Bridge, which serves a self-signed certificate
+	srv := httptest.NewTLSServer(nil)
+	defer srv.Close()
+	addr := strings.TrimPrefix(srv.URL, "https://")
+
+	dial := func(cfg *config.AccountConfig) error {
+		conf, err := tlsConfig(cfg, "127.0.0.1")
+		if err != nil {
+			return err
+		}
+		conn, err := tls.Dial("tcp", addr, conf)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	if err := dial(&config.AccountConfig{}); err == nil {
+		t.Fatal("expected the self-signed certificate to be rejected without TLS_CA_FILE")
+	}
+
+	caFile := filepath.Join(t.TempDir(), "cert.pem")
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(caFile, cert, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := dial(&config.AccountConfig{TLSCAFile: caFile}); err != nil {
+		t.Fatalf("expected the certificate in TLS_CA_FILE to be trusted: %v", err)
+	}
+
+	if _, err := tlsConfig(&config.AccountConfig{TLSCAFile: filepath.Join(t.TempDir(), "missing.pem")}, "127.0.0.1"); err == nil {
+		t.Error("expected an error for a missing TLS_CA_FILE")
+	}
+}
@@ -0,0 +1,71 @@
+package email
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/mail"
+	"path/filepath"
+
+	"github.com/prasanthmj/email/pkg/securefs"
+)
+
+// SentMessage describes a message accepted by the SMTP server, without its body
+type SentMessage struct {
+	MessageID   string           `json:"message_id"`
+	From        string           `json:"from"`
+	To          []string         `json:"to"`
+	CC          []string         `json:"cc,omitempty"`
+	BCC         []string         `json:"bcc,omitempty"`
+	Subject     string           `json:"subject"`
+	Attachments []SentAttachment `json:"attachments,omitempty"`
+}
+
+// SentAttachment identifies an attached file by its content hash
+type SentAttachment struct {
+	Name   string `json:"name"`
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+}
+
+// SendRecorder is notified of every message the SMTP client sends
+type SendRecorder interface {
+	RecordSent(msg SentMessage)
+}
+
+// sentMessage summarizes a delivered message from its options and rendered bytes
+func (sc *SMTPClient) sentMessage(opts SendOptions, raw []byte) SentMessage {
+	sent := SentMessage{
+		To:      opts.To,
+		CC:      opts.CC,
+		BCC:     opts.BCC,
+		Subject: opts.Subject,
+	}
+	if msg, err := mail.ReadMessage(bytes.NewReader(raw)); err == nil {
+		sent.MessageID = msg.Header.Get("Message-Id")
+		if from, err := msg.Header.AddressList("From"); err == nil && len(from) > 0 {
+			sent.From = from[0].Address
+		}
+	}
+
+	paths := make([]string, 0, len(opts.Attachments)+len(opts.InlineAttachments))
+	for _, cacheID := range opts.Attachments {
+		paths = append(paths, filepath.Join(sc.config.AttachmentDir, cacheID))
+	}
+	for _, inline := range opts.InlineAttachments {
+		paths = append(paths, filepath.Join(sc.config.AttachmentDir, filepath.Base(inline.CacheID)))
+	}
+	for _, path := range paths {
+		data, err := securefs.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		sum := sha256.Sum256(data)
+		sent.Attachments = append(sent.Attachments, SentAttachment{
+			Name:   filepath.Base(path),
+			SHA256: hex.EncodeToString(sum[:]),
+			Size:   int64(len(data)),
+		})
+	}
+	return sent
+}
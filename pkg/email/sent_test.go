@@ -0,0 +1,47 @@
+package email
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prasanthmj/email/pkg/config"
+)
+
+func TestSentMessage(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "abc_report.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	sc := NewSMTPClient(&config.AccountConfig{EmailAddress: "me@example.com", AttachmentDir: dir})
+	opts := SendOptions{
+		To:          []string{"customer@example.org"},
+		BCC:         []string{"archive@example.com"},
+		Subject:     "Report",
+		Body:        "See attached",
+		Attachments: []string{"abc_report.txt"},
+	}
+	raw, err := sc.buildMessage(opts)
+	if err != nil {
+		t.Fatalf("Failed to build message: %v", err)
+	}
+
+	sent := sc.sentMessage(opts, raw)
+	if sent.MessageID == "" {
+		t.Error("Expected Message-ID to be recorded")
+	}
+	if sent.From != "me@example.com" {
+		t.Errorf("Expected From me@example.com, got %q", sent.From)
+	}
+	if len(sent.BCC) != 1 || sent.BCC[0] != "archive@example.com" {
+		t.Errorf("Expected BCC to be recorded, got %v", sent.BCC)
+	}
+	if len(sent.Attachments) != 1 {
+		t.Fatalf("Expected 1 attachment, got %d", len(sent.Attachments))
+	}
+	// sha256("hello")
+	if got := sent.Attachments[0].SHA256; got != "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824" {
+		t.Errorf("Unexpected attachment hash %s", got)
+	}
+}
@@ -0,0 +1,40 @@
+package email
+
+import (
+	"html"
+	"strings"
+)
+
+// signatureDelimiter is the conventional "-- " line that separates a signature (RFC 3676)
+const signatureDelimiter = "-- "
+
+// AppendSignature appends a signature to the plain text and HTML bodies.
+// A missing form is derived from the other so both bodies get a signature.
+func AppendSignature(opts SendOptions, plain, htmlSig string) SendOptions {
+	if plain == "" && htmlSig == "" {
+		return opts
+	}
+	if plain == "" {
+		plain, _ = ConvertHTMLToText(htmlSig)
+	}
+	if htmlSig == "" {
+		htmlSig = strings.ReplaceAll(html.EscapeString(plain), "\n", "<br>\n")
+	}
+
+	if opts.Body != "" {
+		opts.Body = strings.TrimRight(opts.Body, "\n") + "\n\n" + signatureDelimiter + "\n" + plain
+	}
+	if opts.HTMLBody != "" {
+		block := `<div class="signature">` + signatureDelimiter + "<br>\n" + htmlSig + "</div>"
+		opts.HTMLBody = appendHTMLSignature(opts.HTMLBody, block)
+	}
+	return opts
+}
+
+// appendHTMLSignature inserts the signature before </body> when present, otherwise appends it
+func appendHTMLSignature(body, signature string) string {
+	if i := strings.LastIndex(strings.ToLower(body), "</body>"); i >= 0 {
+		return body[:i] + signature + body[i:]
+	}
+	return body + signature
+}
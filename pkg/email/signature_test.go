@@ -0,0 +1,35 @@
+package email
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAppendSignature(t *testing.T) {
+	opts := AppendSignature(SendOptions{
+		Body:     "Hello\n",
+		HTMLBody: "<html><body><p>Hello</p></body></html>",
+	}, "Jane Doe\nAcme & Co", "")
+
+	if opts.Body != "Hello\n\n-- \nJane Doe\nAcme & Co" {
+		t.Errorf("Unexpected plain body: %q", opts.Body)
+	}
+	if !strings.Contains(opts.HTMLBody, "Jane Doe<br>\nAcme &amp; Co</div></body>") {
+		t.Errorf("Expected escaped HTML signature before </body>, got %q", opts.HTMLBody)
+	}
+
+	// Only an HTML signature: the plain body gets a text rendering of it
+	opts = AppendSignature(SendOptions{Body: "Hi"}, "", "<p><b>Legal</b> footer</p>")
+	if !strings.HasSuffix(opts.Body, "-- \nLegal footer") {
+		t.Errorf("Expected converted HTML signature, got %q", opts.Body)
+	}
+	if opts.HTMLBody != "" {
+		t.Errorf("HTML body should stay empty, got %q", opts.HTMLBody)
+	}
+
+	// No signature leaves the message untouched
+	opts = AppendSignature(SendOptions{Body: "Hi"}, "", "")
+	if opts.Body != "Hi" {
+		t.Errorf("Expected unchanged body, got %q", opts.Body)
+	}
+}
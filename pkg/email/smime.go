@@ -0,0 +1,518 @@
+package email
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"mime"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/prasanthmj/email/pkg/config"
+	"github.com/prasanthmj/email/pkg/securefs"
+)
+
+// SMIMEInfo reports the S/MIME protection of a fetched message
+type SMIMEInfo struct {
+	Encrypted bool            `yaml:"encrypted" json:"encrypted"`
+	Decrypted bool            `yaml:"decrypted" json:"decrypted"`
+	Signed    bool            `yaml:"signed" json:"signed"`
+	Signature *SMIMESignature `yaml:"signature,omitempty" json:"signature,omitempty"`
+	Error     string          `yaml:"error,omitempty" json:"error,omitempty"` // Why the message could not be decrypted
+}
+
+// SMIMESignature describes the signer of a message and whether the signature holds
+type SMIMESignature struct {
+	Valid       bool      `yaml:"valid" json:"valid"`               // The content matches the signature
+	Trusted     bool      `yaml:"trusted" json:"trusted"`           // The certificate chains to a trusted root for email protection
+	Signer      string    `yaml:"signer" json:"signer"`             // Certificate email address, or common name
+	MatchesFrom bool      `yaml:"matches_from" json:"matches_from"` // The certificate is issued to the From address
+	Subject     string    `yaml:"subject" json:"subject"`
+	Issuer      string    `yaml:"issuer" json:"issuer"`
+	NotBefore   time.Time `yaml:"not_before" json:"not_before"`
+	NotAfter    time.Time `yaml:"not_after" json:"not_after"`
+	SigningTime time.Time `yaml:"signing_time,omitempty" json:"signing_time,omitempty"` // Claimed by the sender, for information only
+	Error       string    `yaml:"error,omitempty" json:"error,omitempty"`
+}
+
+// smimeCredentials are an account's certificate, chain and private key
+type smimeCredentials struct {
+	cert  *x509.Certificate
+	chain []*x509.Certificate
+	key   crypto.Signer
+}
+
+// loadSMIMECredentials reads the account certificate (with optional chain) and private key
+func loadSMIMECredentials(cfg config.SMIME) (*smimeCredentials, error) {
+	certs, err := readCertificates(cfg.CertFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read S/MIME certificate: %w", err)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("failed to read S/MIME certificate: no certificate in %s", cfg.CertFile)
+	}
+
+	data, err := os.ReadFile(cfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read S/MIME private key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("failed to parse S/MIME private key: no PEM block in %s", cfg.KeyFile)
+	}
+	var key interface{}
+	if key, err = x509.ParsePKCS8PrivateKey(block.Bytes); err != nil {
+		if key, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+			if key, err = x509.ParseECPrivateKey(block.Bytes); err != nil {
+				return nil, fmt.Errorf("failed to parse S/MIME private key: %w", err)
+			}
+		}
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported S/MIME private key type %T", key)
+	}
+	return &smimeCredentials{cert: certs[0], chain: certs[1:], key: signer}, nil
+}
+
+// readCertificates parses every PEM certificate in a file, or a single DER certificate
+func readCertificates(path string) ([]*x509.Certificate, error) {
+	data, err := securefs.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var certs []*x509.Certificate
+	for rest := data; ; {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return x509.ParseCertificates(data)
+	}
+	return certs, nil
+}
+
+// certificateAddresses returns the lower-cased email addresses a certificate is issued to
+func certificateAddresses(cert *x509.Certificate) []string {
+	var addrs []string
+	for _, addr := range cert.EmailAddresses {
+		addrs = append(addrs, strings.ToLower(addr))
+	}
+	// Older certificates carry the address in the subject's emailAddress attribute
+	oidEmailAddress := asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 1}
+	for _, name := range cert.Subject.Names {
+		if value, ok := name.Value.(string); ok && name.Type.Equal(oidEmailAddress) {
+			addrs = append(addrs, strings.ToLower(value))
+		}
+	}
+	return addrs
+}
+
+// FindCertificate returns the newest valid certificate for address in a certificate store
+func FindCertificate(store, address string) (*x509.Certificate, error) {
+	address = strings.ToLower(address)
+	entries, err := os.ReadDir(store)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certificate store: %w", err)
+	}
+
+	var best *x509.Certificate
+	now := time.Now()
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		certs, err := readCertificates(filepath.Join(store, entry.Name()))
+		if err != nil {
+			continue
+		}
+		for _, cert := range certs {
+			if now.Before(cert.NotBefore) || now.After(cert.NotAfter) || !contains(certificateAddresses(cert), address) {
+				continue
+			}
+			if best == nil || cert.NotAfter.After(best.NotAfter) {
+				best = cert
+			}
+		}
+	}
+	if best == nil {
+		return nil, fmt.Errorf("no valid S/MIME certificate for %s in %s", address, store)
+	}
+	return best, nil
+}
+
+// unsafeFileChars matches characters not used in certificate store file names
+var unsafeFileChars = regexp.MustCompile(`[^a-z0-9@._+-]`)
+
+// saveCertificate stores a certificate in the store under each of its addresses
+func saveCertificate(store string, cert *x509.Certificate) error {
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	for _, addr := range certificateAddresses(cert) {
+		name := unsafeFileChars.ReplaceAllString(addr, "_") + ".pem"
+		if err := securefs.WriteFile(filepath.Join(store, name), data); err != nil {
+			return fmt.Errorf("failed to save certificate: %w", err)
+		}
+	}
+	return nil
+}
+
+// splitEntity separates a rendered message into its outer headers and the MIME entity
+// (Content-* headers and body) that S/MIME protects
+func splitEntity(raw []byte) (outer, entity []byte) {
+	fields, body := splitRawMessage(toCRLF(raw))
+	var content bytes.Buffer
+	for _, f := range fields {
+		if strings.HasPrefix(strings.ToLower(f.name), "content-") {
+			content.WriteString(f.raw)
+		} else {
+			outer = append(outer, f.raw...)
+		}
+	}
+	content.WriteString("\r\n")
+	content.Write(body)
+	return outer, content.Bytes()
+}
+
+// base64Lines encodes data as base64 in 76-character lines
+func base64Lines(data []byte) string {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	var b strings.Builder
+	for len(encoded) > 76 {
+		b.WriteString(encoded[:76])
+		b.WriteString("\r\n")
+		encoded = encoded[76:]
+	}
+	b.WriteString(encoded)
+	b.WriteString("\r\n")
+	return b.String()
+}
+
+// newBoundary returns a random multipart boundary starting with prefix
+func newBoundary(prefix string) string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return prefix + "-" + hex.EncodeToString(b)
+}
+
+// signEntity wraps an entity in multipart/signed with a detached signature (RFC 8551 3.5.3)
+func signEntity(entity []byte, creds *smimeCredentials) ([]byte, error) {
+	// The CRLF before the closing boundary belongs to the delimiter, not the signed content
+	entity = bytes.TrimSuffix(entity, []byte("\r\n"))
+	p7, err := SignCMS(entity, creds.cert, creds.chain, creds.key, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	boundary := newBoundary("smime")
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "Content-Type: multipart/signed; protocol=\"application/pkcs7-signature\"; micalg=sha-256;\r\n boundary=\"%s\"\r\n\r\n", boundary)
+	b.WriteString("This is an S/MIME signed message\r\n")
+	fmt.Fprintf(&b, "--%s\r\n", boundary)
+	b.Write(entity)
+	fmt.Fprintf(&b, "\r\n--%s\r\n", boundary)
+	b.WriteString("Content-Type: application/pkcs7-signature; name=\"smime.p7s\"\r\n")
+	b.WriteString("Content-Transfer-Encoding: base64\r\n")
+	b.WriteString("Content-Disposition: attachment; filename=\"smime.p7s\"\r\n\r\n")
+	b.WriteString(base64Lines(p7))
+	fmt.Fprintf(&b, "--%s--\r\n", boundary)
+	return b.Bytes(), nil
+}
+
+// encryptEntity replaces an entity with an application/pkcs7-mime enveloped-data part
+func encryptEntity(entity []byte, recipients []*x509.Certificate) ([]byte, error) {
+	p7, err := EncryptCMS(entity, recipients)
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	b.WriteString("Content-Type: application/pkcs7-mime; smime-type=enveloped-data; name=\"smime.p7m\"\r\n")
+	b.WriteString("Content-Transfer-Encoding: base64\r\n")
+	b.WriteString("Content-Disposition: attachment; filename=\"smime.p7m\"\r\n\r\n")
+	b.WriteString(base64Lines(p7))
+	return b.Bytes(), nil
+}
+
+// applySMIME signs and/or encrypts a rendered message as requested in opts. Messages
+// are encrypted for every recipient and for the account itself, so the sent copy stays readable.
+func (sc *SMTPClient) applySMIME(raw []byte, opts SendOptions) ([]byte, error) {
+	if !opts.Sign && !opts.Encrypt {
+		return raw, nil
+	}
+	if !sc.config.SMIME.Enabled() {
+		return nil, fmt.Errorf("S/MIME is not configured for account %s (set ACCOUNT_%s_SMIME_CERT_FILE and ACCOUNT_%s_SMIME_KEY_FILE)",
+			sc.config.AccountID, sc.config.AccountID, sc.config.AccountID)
+	}
+	creds, err := loadSMIMECredentials(sc.config.SMIME)
+	if err != nil {
+		return nil, err
+	}
+
+	outer, entity := splitEntity(raw)
+	if opts.Sign {
+		if entity, err = signEntity(entity, creds); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Encrypt {
+		recipients := []*x509.Certificate{creds.cert}
+		var missing []string
+		for _, addr := range envelopeRecipients(opts) {
+			cert, err := FindCertificate(sc.config.SMIME.CertStore, addr)
+			if err != nil {
+				missing = append(missing, addr)
+				continue
+			}
+			recipients = append(recipients, cert)
+		}
+		if len(missing) > 0 {
+			return nil, fmt.Errorf("cannot encrypt: no S/MIME certificate for %s in %s", strings.Join(missing, ", "), sc.config.SMIME.CertStore)
+		}
+		if entity, err = encryptEntity(entity, recipients); err != nil {
+			return nil, err
+		}
+	}
+	return append(outer, entity...), nil
+}
+
+// smimeMaxDepth limits nested signed and encrypted layers
+const smimeMaxDepth = 4
+
+// UnwrapSMIME decrypts and verifies S/MIME layers of a raw message, returning a plain
+// message with the original outer headers and a report. Messages without S/MIME are
+// returned unchanged with a nil report. Decryption needs the account's credentials.
+func UnwrapSMIME(raw []byte, cfg config.SMIME, from string) ([]byte, *SMIMEInfo) {
+	outer, entity := splitEntity(raw)
+	var info *SMIMEInfo
+
+	for depth := 0; depth < smimeMaxDepth; depth++ {
+		fields, body := splitRawMessage(entity)
+		mediaType, params := entityContentType(fields)
+
+		switch {
+		case mediaType == "multipart/signed" && strings.Contains(strings.ToLower(params["protocol"]), "pkcs7-signature"):
+			if info == nil {
+				info = &SMIMEInfo{}
+			}
+			info.Signed = true
+			content, signature, err := splitSignedParts(body, params["boundary"])
+			if err != nil {
+				info.Signature = &SMIMESignature{Error: err.Error()}
+				return raw, info
+			}
+			info.Signature = verifySignedContent(signature, content, cfg, from)
+			entity = append(append([]byte{}, content...), '\r', '\n')
+
+		case mediaType == "application/pkcs7-mime" || mediaType == "application/x-pkcs7-mime":
+			if info == nil {
+				info = &SMIMEInfo{}
+			}
+			p7, err := base64.StdEncoding.DecodeString(stripWhitespace(string(body)))
+			if err != nil {
+				info.Error = "invalid base64 in S/MIME part"
+				return raw, info
+			}
+			ci, err := parseContentInfo(p7)
+			if err != nil {
+				info.Error = err.Error()
+				return raw, info
+			}
+
+			if ci.ContentType.Equal(oidSignedData) {
+				info.Signed = true
+				content, signer, err := VerifyCMSSignature(p7, nil)
+				info.Signature = describeSigner(signer, err, cfg, from)
+				if content == nil {
+					return raw, info
+				}
+				entity = toCRLF(content)
+				continue
+			}
+
+			info.Encrypted = true
+			if !cfg.Enabled() {
+				info.Error = "message is encrypted but no S/MIME certificate is configured for this account"
+				return raw, info
+			}
+			creds, err := loadSMIMECredentials(cfg)
+			if err != nil {
+				info.Error = err.Error()
+				return raw, info
+			}
+			decrypter, ok := creds.key.(crypto.Decrypter)
+			if !ok {
+				info.Error = "the account's S/MIME key cannot decrypt"
+				return raw, info
+			}
+			plain, err := DecryptCMS(p7, creds.cert, decrypter)
+			if err != nil {
+				info.Error = err.Error()
+				return raw, info
+			}
+			info.Decrypted = true
+			entity = toCRLF(plain)
+
+		default:
+			if info == nil {
+				return raw, nil
+			}
+			return append(outer, entity...), info
+		}
+	}
+	return append(outer, entity...), info
+}
+
+// entityContentType returns the media type and parameters of an entity's Content-Type
+func entityContentType(fields []rawHeaderField) (string, map[string]string) {
+	for _, f := range fields {
+		if strings.EqualFold(f.name, "Content-Type") {
+			value := f.raw[strings.IndexByte(f.raw, ':')+1:]
+			mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(strings.ReplaceAll(value, "\r\n", "")))
+			if err == nil {
+				return mediaType, params
+			}
+		}
+	}
+	return "text/plain", nil
+}
+
+// splitSignedParts returns the exact signed content and the decoded signature of a
+// multipart/signed body
+func splitSignedParts(body []byte, boundary string) ([]byte, []byte, error) {
+	content, sigBody, err := splitMultipartSigned(body, boundary)
+	if err != nil {
+		return nil, nil, err
+	}
+	signature, err := base64.StdEncoding.DecodeString(stripWhitespace(string(sigBody)))
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid base64 in signature part")
+	}
+	return content, signature, nil
+}
+
+// splitMultipartSigned returns the exact signed content and the body of the signature
+// part of a multipart/signed body
+func splitMultipartSigned(body []byte, boundary string) ([]byte, []byte, error) {
+	if boundary == "" {
+		return nil, nil, fmt.Errorf("multipart/signed message has no boundary")
+	}
+	delimiter := []byte("\r\n--" + boundary)
+	body = append([]byte("\r\n"), body...)
+
+	start := bytes.Index(body, delimiter)
+	if start < 0 {
+		return nil, nil, fmt.Errorf("signed content not found")
+	}
+	start += len(delimiter)
+	lineEnd := bytes.Index(body[start:], []byte("\r\n"))
+	if lineEnd < 0 {
+		return nil, nil, fmt.Errorf("malformed multipart/signed message: truncated boundary")
+	}
+	start += lineEnd + 2
+	end := bytes.Index(body[start:], delimiter)
+	if end < 0 {
+		return nil, nil, fmt.Errorf("signature part not found")
+	}
+	content := body[start : start+end]
+
+	rest := body[start+end+len(delimiter):]
+	lineEnd = bytes.Index(rest, []byte("\r\n"))
+	if lineEnd < 0 {
+		return nil, nil, fmt.Errorf("malformed multipart/signed message: truncated boundary")
+	}
+	rest = rest[lineEnd+2:]
+	if close := bytes.Index(rest, delimiter); close >= 0 {
+		rest = rest[:close]
+	}
+	_, sigBody := splitRawMessage(rest)
+	return content, sigBody, nil
+}
+
+// stripWhitespace removes all whitespace from base64 text
+func stripWhitespace(s string) string {
+	return strings.Join(strings.Fields(s), "")
+}
+
+// verifySignedContent verifies a detached signature over content
+func verifySignedContent(p7, content []byte, cfg config.SMIME, from string) *SMIMESignature {
+	_, signer, err := VerifyCMSSignature(p7, content)
+	return describeSigner(signer, err, cfg, from)
+}
+
+// describeSigner reports a verification result, checks the certificate chain and, for
+// trusted signers, saves the certificate to the store so replies can be encrypted
+func describeSigner(signer *CMSSigner, verifyErr error, cfg config.SMIME, from string) *SMIMESignature {
+	sig := &SMIMESignature{Valid: verifyErr == nil}
+	if verifyErr != nil {
+		sig.Error = verifyErr.Error()
+	}
+	if signer == nil || signer.Certificate == nil {
+		return sig
+	}
+
+	cert := signer.Certificate
+	sig.Subject = cert.Subject.String()
+	sig.Issuer = cert.Issuer.String()
+	sig.NotBefore = cert.NotBefore
+	sig.NotAfter = cert.NotAfter
+	sig.SigningTime = signer.SigningTime
+	sig.Signer = cert.Subject.CommonName
+	addrs := certificateAddresses(cert)
+	if len(addrs) > 0 {
+		sig.Signer = addrs[0]
+	}
+	if _, fromAddr := splitFrom(from); fromAddr != "" {
+		sig.MatchesFrom = contains(addrs, fromAddr)
+	}
+
+	roots, err := x509.SystemCertPool()
+	if err != nil {
+		roots = x509.NewCertPool()
+	}
+	if cfg.CAFile != "" {
+		if cas, err := readCertificates(cfg.CAFile); err == nil {
+			for _, ca := range cas {
+				roots.AddCert(ca)
+			}
+		}
+	}
+	intermediates := x509.NewCertPool()
+	for _, c := range signer.Chain {
+		intermediates.AddCert(c)
+	}
+	// The signing time is a signed attribute chosen by the sender, so it is reported
+	// but never used to judge whether the certificate was valid
+	_, err = cert.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   time.Now(),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection},
+	})
+	sig.Trusted = err == nil
+	if err != nil && sig.Error == "" {
+		sig.Error = "certificate not trusted: " + err.Error()
+	}
+
+	if sig.Valid && sig.Trusted && cfg.CertStore != "" {
+		saveCertificate(cfg.CertStore, cert)
+	}
+	return sig
+}
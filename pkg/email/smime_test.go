@@ -0,0 +1,176 @@
+package email
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prasanthmj/email/pkg/config"
+)
+
+// writeSMIMECredentials stores a certificate and key as PEM and returns the S/MIME settings
+func writeSMIMECredentials(t *testing.T, dir, name string, cert *x509.Certificate, key *rsa.PrivateKey) config.SMIME {
+	t.Helper()
+	cfg := config.SMIME{
+		CertFile:  filepath.Join(dir, name+".crt"),
+		KeyFile:   filepath.Join(dir, name+".key"),
+		CertStore: filepath.Join(dir, name+"-certs"),
+	}
+	if err := os.MkdirAll(cfg.CertStore, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(cfg.CertFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(cfg.KeyFile, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+func TestSMIMERoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	aliceKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	bobKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	alice := testCertificate(t, "alice@example.com", aliceKey, nil, nil)
+	bob := testCertificate(t, "bob@example.org", bobKey, nil, nil)
+	aliceCfg := writeSMIMECredentials(t, dir, "alice", alice, aliceKey)
+	bobCfg := writeSMIMECredentials(t, dir, "bob", bob, bobKey)
+	bobCfg.CAFile = aliceCfg.CertFile // Bob trusts Alice's self-signed certificate
+
+	sc := NewSMTPClient(&config.AccountConfig{AccountID: "alice", EmailAddress: "alice@example.com", SMIME: aliceCfg})
+	opts := SendOptions{
+		To:      []string{"bob@example.org"},
+		Subject: "Quarterly numbers",
+		Body:    "Revenue is up.\n",
+		Sign:    true,
+		Encrypt: true,
+	}
+
+	if _, err := sc.buildMessage(opts); err == nil || !strings.Contains(err.Error(), "bob@example.org") {
+		t.Fatalf("Expected an error for the missing recipient certificate, got %v", err)
+	}
+	if err := saveCertificate(aliceCfg.CertStore, bob); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := sc.buildMessage(opts)
+	if err != nil {
+		t.Fatalf("Failed to build message: %v", err)
+	}
+	if strings.Contains(string(raw), "Revenue") || !strings.Contains(string(raw), "application/pkcs7-mime") {
+		t.Fatalf("Expected an encrypted message, got:\n%.500s", raw)
+	}
+
+	plain, info := UnwrapSMIME(raw, bobCfg, "alice@example.com")
+	if info == nil || !info.Encrypted || !info.Decrypted || !info.Signed || info.Error != "" {
+		t.Fatalf("Expected a decrypted, signed message, got %+v", info)
+	}
+	if sig := info.Signature; sig == nil || !sig.Valid || !sig.Trusted || !sig.MatchesFrom || sig.Signer != "alice@example.com" {
+		t.Errorf("Expected a valid, trusted signature from alice, got %+v", info.Signature)
+	}
+	if !strings.Contains(string(plain), "Revenue is up.") || !strings.Contains(string(plain), "Subject: Quarterly numbers") {
+		t.Errorf("Expected the plain message with outer headers, got:\n%s", plain)
+	}
+	if _, err := FindCertificate(bobCfg.CertStore, "alice@example.com"); err != nil {
+		t.Errorf("Expected the trusted signer certificate to be stored: %v", err)
+	}
+
+	// The sent copy is encrypted for the sender too
+	if _, info := UnwrapSMIME(raw, aliceCfg, "alice@example.com"); info == nil || !info.Decrypted {
+		t.Errorf("Expected the sender to decrypt their own copy, got %+v", info)
+	}
+}
+
+func TestSMIMESignedOnly(t *testing.T) {
+	dir := t.TempDir()
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	cert := testCertificate(t, "alice@example.com", key, nil, nil)
+	cfg := writeSMIMECredentials(t, dir, "alice", cert, key)
+
+	sc := NewSMTPClient(&config.AccountConfig{AccountID: "alice", EmailAddress: "alice@example.com", SMIME: cfg})
+	raw, err := sc.buildMessage(SendOptions{To: []string{"bob@example.org"}, Subject: "Hello", Body: "Signed text\n", Sign: true})
+	if err != nil {
+		t.Fatalf("Failed to build message: %v", err)
+	}
+	if !strings.Contains(string(raw), "multipart/signed") {
+		t.Fatalf("Expected a multipart/signed message, got:\n%.500s", raw)
+	}
+
+	// Without a trust anchor the signature is valid but untrusted
+	_, info := UnwrapSMIME(raw, config.SMIME{}, "mallory@example.com")
+	if info == nil || info.Encrypted || !info.Signed || !info.Signature.Valid || info.Signature.Trusted || info.Signature.MatchesFrom {
+		t.Errorf("Expected a valid, untrusted signature not matching From, got %+v", info)
+	}
+
+	tampered := strings.Replace(string(raw), "Signed text", "Forged text", 1)
+	if _, info := UnwrapSMIME([]byte(tampered), config.SMIME{}, "alice@example.com"); info == nil || info.Signature.Valid {
+		t.Errorf("Expected tampered content to fail verification, got %+v", info)
+	}
+
+	plain := []byte("From: a@example.com\r\nSubject: x\r\n\r\nbody\r\n")
+	if out, info := UnwrapSMIME(plain, cfg, "a@example.com"); info != nil || string(out) != string(plain) {
+		t.Errorf("Expected a plain message to pass through unchanged, got %+v", info)
+	}
+
+	sc = NewSMTPClient(&config.AccountConfig{AccountID: "work", EmailAddress: "alice@example.com"})
+	if _, err := sc.buildMessage(SendOptions{To: []string{"bob@example.org"}, Subject: "Hello", Body: "x", Sign: true}); err == nil {
+		t.Error("Expected an error when S/MIME is not configured")
+	}
+}
+
+func TestSplitMultipartSignedTruncated(t *testing.T) {
+	for _, body := range []string{"--b", "x\r\n--b\r\ncontent\r\n--b"} {
+		if _, _, err := splitMultipartSigned([]byte(body), "b"); err == nil || !strings.Contains(err.Error(), "malformed multipart/signed") {
+			t.Errorf("Expected a malformed message error for %q, got %v", body, err)
+		}
+
+		raw := "From: a@example.com\r\nContent-Type: multipart/signed; protocol=\"application/pkcs7-signature\"; boundary=b\r\n\r\n" + body
+		if _, info := UnwrapSMIME([]byte(raw), config.SMIME{}, "a@example.com"); info == nil || info.Signature == nil || info.Signature.Error == "" {
+			t.Errorf("Expected a signature error for %q, got %+v", body, info)
+		}
+	}
+}
+
+func TestDescribeSignerIgnoresSigningTime(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "alice@example.com"},
+		EmailAddresses:        []string{"alice@example.com"},
+		NotBefore:             time.Now().AddDate(-2, 0, 0),
+		NotAfter:              time.Now().AddDate(-1, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, _ := x509.ParseCertificate(der)
+	cfg := writeSMIMECredentials(t, t.TempDir(), "alice", expired, key)
+	cfg.CAFile = cfg.CertFile
+
+	// A signing time inside the validity period does not make an expired certificate trusted
+	signer := &CMSSigner{Certificate: expired, SigningTime: time.Now().AddDate(-1, -6, 0)}
+	sig := describeSigner(signer, nil, cfg, "alice@example.com")
+	if sig.Trusted || !strings.Contains(sig.Error, "not trusted") {
+		t.Errorf("Expected the expired certificate to be untrusted, got %+v", sig)
+	}
+	if !sig.SigningTime.Equal(signer.SigningTime) {
+		t.Errorf("Expected the claimed signing time to be reported, got %s", sig.SigningTime)
+	}
+	if _, err := FindCertificate(cfg.CertStore, "alice@example.com"); err == nil {
+		t.Error("Expected the untrusted certificate not to be stored")
+	}
+}
@@ -1,19 +1,34 @@
 package email
 
 import (
-	"crypto/tls"
+	"bytes"
+	"context"
 	"fmt"
+	"mime"
+	"net"
+	"net/mail"
 	"net/smtp"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/jordan-wright/email"
 	"github.com/prasanthmj/email/pkg/config"
+	"github.com/prasanthmj/email/pkg/securefs"
 )
 
+// SendLimiter throttles outgoing messages
+type SendLimiter interface {
+	Take(now time.Time) error
+	Refund(now time.Time)
+}
+
 // SMTPClient handles SMTP operations
 type SMTPClient struct {
-	config *config.AccountConfig
+	config   *config.AccountConfig
+	limiter  SendLimiter
+	recorder SendRecorder
 }
 
 // NewSMTPClient creates a new SMTP client
@@ -23,16 +38,212 @@ func NewSMTPClient(cfg *config.AccountConfig) *SMTPClient {
 	}
 }
 
-// SendEmail sends an email with the given options
-func (sc *SMTPClient) SendEmail(opts SendOptions) error {
+// SetLimiter sets the rate limiter consulted before every message is sent
+func (sc *SMTPClient) SetLimiter(l SendLimiter) {
+	sc.limiter = l
+}
+
+// SetRecorder sets the recorder notified after each message is sent
+func (sc *SMTPClient) SetRecorder(r SendRecorder) {
+	sc.recorder = r
+}
+
+// SendEmail sends an email with the given options. Cancelling ctx aborts the SMTP
+// session unless the server has already accepted the message.
+func (sc *SMTPClient) SendEmail(ctx context.Context, opts SendOptions) error {
+	// Every send path is checked against the account's outbound policy
+	opts, err := sc.applyPolicy(opts)
+	if err != nil {
+		return err
+	}
+	
+	raw, err := sc.buildMessage(opts)
+	if err != nil {
+		return err
+	}
+	
+	if sc.limiter != nil {
+		if err := sc.limiter.Take(time.Now()); err != nil {
+			return err
+		}
+	}
+	
+	if err := sc.sendRaw(ctx, envelopeRecipients(opts), raw); err != nil {
+		// The message did not go out, so it does not count against the quota
+		if sc.limiter != nil {
+			sc.limiter.Refund(time.Now())
+		}
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	
+	if sc.recorder != nil {
+		sc.recorder.RecordSent(sc.sentMessage(opts, raw))
+	}
+	
+	return nil
+}
+
+// CheckMessage applies the outbound policy and builds the message without sending it, so
+// problems such as missing attachments or invalid headers are reported before a message is queued
+func (sc *SMTPClient) CheckMessage(opts SendOptions) error {
+	opts, err := sc.applyPolicy(opts)
+	if err != nil {
+		return err
+	}
+	_, err = sc.buildMessage(opts)
+	return err
+}
+
+// buildMessage renders the RFC 5322 message bytes for the given options, protected with
+// S/MIME or PGP/MIME if requested and DKIM-signed if configured
+func (sc *SMTPClient) buildMessage(opts SendOptions) ([]byte, error) {
+	// Resolve the sender identity before validating the final headers
+	opts, err := sc.applyIdentity(opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	
+	// Calendar messages need text/calendar inside multipart/alternative
+	var raw []byte
+	if opts.Calendar != nil {
+		raw, err = sc.buildCalendarMessage(opts)
+	} else {
+		var e *email.Email
+		if e, err = sc.buildEmail(opts); err == nil {
+			raw, err = e.Bytes()
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if raw, err = sc.protectMessage(raw, opts); err != nil {
+		return nil, err
+	}
+	return sc.signMessage(raw)
+}
+
+// sendRaw submits pre-rendered message bytes over SMTP with STARTTLS
+func (sc *SMTPClient) sendRaw(ctx context.Context, recipients []string, raw []byte) error {
+	if len(recipients) == 0 {
+		return fmt.Errorf("at least one recipient is required")
+	}
+	password, err := sc.config.EmailPassword.Value()
+	if err != nil {
+		return fmt.Errorf("failed to get password: %w", err)
+	}
+	
+	addr := net.JoinHostPort(sc.config.SMTPServer, strconv.Itoa(sc.config.SMTPPort))
+	dialer := &net.Dialer{Timeout: sc.config.Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return contextErr(ctx, err)
+	}
+	// Closing the connection on cancellation aborts the command in progress
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	
+	c, err := smtp.NewClient(conn, sc.config.SMTPServer)
+	if err != nil {
+		conn.Close()
+		return contextErr(ctx, err)
+	}
+	defer c.Close()
+	
+	if err := sc.converse(c, password, recipients, raw); err != nil {
+		return contextErr(ctx, err)
+	}
+	if !stop() {
+		// Cancelled after the server accepted the message, which has been sent
+		return nil
+	}
+	return c.Quit()
+}
+
+// converse runs the SMTP session up to the end of the message data
+func (sc *SMTPClient) converse(c *smtp.Client, password string, recipients []string, raw []byte) error {
+	if err := c.Hello("localhost"); err != nil {
+		return err
+	}
+	
+	// Use TLS if available
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		tlsConf, err := tlsConfig(sc.config, sc.config.SMTPServer)
+		if err != nil {
+			return err
+		}
+		if err := c.StartTLS(tlsConf); err != nil {
+			return err
+		}
+	}
+	
+	// Create auth
+	if ok, _ := c.Extension("AUTH"); ok {
+		auth := smtp.PlainAuth("", sc.config.EmailAddress, password, sc.config.SMTPServer)
+		if err := c.Auth(auth); err != nil {
+			return err
+		}
+	}
+	
+	if err := c.Mail(sc.config.EmailAddress); err != nil {
+		return err
+	}
+	for _, rcpt := range recipients {
+		if err := c.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+	
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(raw); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// envelopeRecipients returns the bare addresses of all To, CC and BCC recipients
+func envelopeRecipients(opts SendOptions) []string {
+	var recipients []string
+	for _, list := range [][]string{opts.To, opts.CC, opts.BCC} {
+		for _, r := range list {
+			if addr, err := mail.ParseAddress(r); err == nil {
+				recipients = append(recipients, addr.Address)
+			} else {
+				recipients = append(recipients, strings.TrimSpace(r))
+			}
+		}
+	}
+	return recipients
+}
+
+// attachCachedFile attaches a file from the attachment cache, decrypting it if the store
+// is encrypted
+func attachCachedFile(e *email.Email, path string) (*email.Attachment, error) {
+	data, err := securefs.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return e.Attach(bytes.NewReader(data), filepath.Base(path), mime.TypeByExtension(filepath.Ext(path)))
+}
+
+// buildEmail composes the message for the given options without sending it
+func (sc *SMTPClient) buildEmail(opts SendOptions) (*email.Email, error) {
 	e := email.NewEmail()
 	
 	// Set from address
-	e.From = sc.config.EmailAddress
+	e.From = sc.fromHeader(opts)
+	if len(opts.ReplyTo) > 0 {
+		e.ReplyTo = encodeAddressList(opts.ReplyTo)
+	}
 	
 	// Set recipients
 	if len(opts.To) == 0 {
-		return fmt.Errorf("at least one recipient is required")
+		return nil, fmt.Errorf("at least one recipient is required")
 	}
 	e.To = opts.To
 	
@@ -46,7 +257,7 @@ func (sc *SMTPClient) SendEmail(opts SendOptions) error {
 	
 	// Set subject
 	if opts.Subject == "" {
-		return fmt.Errorf("subject is required")
+		return nil, fmt.Errorf("subject is required")
 	}
 	e.Subject = opts.Subject
 	
@@ -59,9 +270,14 @@ func (sc *SMTPClient) SendEmail(opts SendOptions) error {
 		e.HTML = []byte(opts.HTMLBody)
 	}
 	
+	// Inline parts are only meaningful alongside an HTML body
+	if opts.HTMLBody == "" && len(opts.InlineAttachments) > 0 {
+		return nil, fmt.Errorf("inline attachments require an HTML body")
+	}
+	
 	// If neither body is provided
 	if opts.Body == "" && opts.HTMLBody == "" {
-		return fmt.Errorf("email body is required")
+		return nil, fmt.Errorf("email body is required")
 	}
 	
 	// Set threading headers if this is a reply
@@ -78,31 +294,53 @@ func (sc *SMTPClient) SendEmail(opts SendOptions) error {
 		}
 	}
 	
+	// Priority, read receipt, List-Unsubscribe and custom headers
+	for _, field := range sc.extraHeaders(opts) {
+		e.Headers.Add(field.Name, field.Value)
+	}
+	
 	// Add attachments from cache
 	for _, cacheID := range opts.Attachments {
 		attachmentPath := filepath.Join(sc.config.AttachmentDir, cacheID)
-		_, err := e.AttachFile(attachmentPath)
+		_, err := attachCachedFile(e, attachmentPath)
 		if err != nil {
-			return fmt.Errorf("failed to attach file %s: %w", cacheID, err)
+			return nil, fmt.Errorf("failed to attach file %s: %w", cacheID, err)
 		}
 	}
 	
-	// Send the email
-	addr := fmt.Sprintf("%s:%d", sc.config.SMTPServer, sc.config.SMTPPort)
-	
-	// Create auth
-	auth := smtp.PlainAuth("", sc.config.EmailAddress, sc.config.EmailPassword, sc.config.SMTPServer)
-	
-	// Send with TLS
-	err := e.SendWithStartTLS(addr, auth, &tls.Config{
-		ServerName: sc.config.SMTPServer,
-	})
+	// Add inline attachments referenced from the HTML body as cid:{content_id}
+	for _, inline := range opts.InlineAttachments {
+		cid, err := NormalizeContentID(inline.ContentID)
+		if err != nil {
+			return nil, err
+		}
+		attachmentPath := filepath.Join(sc.config.AttachmentDir, filepath.Base(inline.CacheID))
+		a, err := attachCachedFile(e, attachmentPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to attach inline file %s: %w", inline.CacheID, err)
+		}
+		a.HTMLRelated = true
+		a.Header.Set("Content-ID", "<"+cid+">")
+	}
 	
-	if err != nil {
-		return fmt.Errorf("failed to send email: %w", err)
+	// Convert embedded data: URIs into CID parts so clients like Outlook and Gmail render them
+	if opts.EmbedDataURIs && opts.HTMLBody != "" {
+		html, parts, err := embedDataURIs(opts.HTMLBody)
+		if err != nil {
+			return nil, err
+		}
+		e.HTML = []byte(html)
+		for _, part := range parts {
+			a, err := e.Attach(bytes.NewReader(part.Content), part.Filename, part.ContentType)
+			if err != nil {
+				return nil, fmt.Errorf("failed to attach inline image: %w", err)
+			}
+			a.HTMLRelated = true
+			a.Header.Set("Content-ID", "<"+part.ContentID+">")
+		}
 	}
 	
-	return nil
+	return e, nil
 }
 
 // contains checks if a string slice contains a value
@@ -18,20 +18,29 @@ type EmailHeader struct {
 
 // Email represents a full email with body
 type Email struct {
-	MessageID      string       `yaml:"message_id" json:"message_id"`
-	Folder         string       `yaml:"folder" json:"folder"`
-	From           string       `yaml:"from" json:"from"`
-	To             []string     `yaml:"to" json:"to"`
-	CC             []string     `yaml:"cc,omitempty" json:"cc,omitempty"`
-	BCC            []string     `yaml:"bcc,omitempty" json:"bcc,omitempty"`
-	Subject        string       `yaml:"subject" json:"subject"`
-	Date           time.Time    `yaml:"date" json:"date"`
-	Body           string       `yaml:"body" json:"body"`
-	HTMLBody       string       `yaml:"html_body,omitempty" json:"html_body,omitempty"`
-	Attachments    []Attachment `yaml:"attachments,omitempty" json:"attachments,omitempty"`
-	InReplyTo      string       `yaml:"in_reply_to,omitempty" json:"in_reply_to,omitempty"`
-	References     []string     `yaml:"references,omitempty" json:"references,omitempty"`
-	CachedAt       time.Time    `yaml:"cached_at,omitempty" json:"-"`
+	MessageID   string          `yaml:"message_id" json:"message_id"`
+	Folder      string          `yaml:"folder" json:"folder"`
+	From        string          `yaml:"from" json:"from"`
+	To          []string        `yaml:"to" json:"to"`
+	CC          []string        `yaml:"cc,omitempty" json:"cc,omitempty"`
+	ReplyTo     []string        `yaml:"reply_to,omitempty" json:"reply_to,omitempty"`
+	BCC         []string        `yaml:"bcc,omitempty" json:"bcc,omitempty"`
+	Subject     string          `yaml:"subject" json:"subject"`
+	Date        time.Time       `yaml:"date" json:"date"`
+	Body        string          `yaml:"body" json:"body"`
+	HTMLBody    string          `yaml:"html_body,omitempty" json:"html_body,omitempty"`
+	Attachments []Attachment    `yaml:"attachments,omitempty" json:"attachments,omitempty"`
+	InReplyTo   string          `yaml:"in_reply_to,omitempty" json:"in_reply_to,omitempty"`
+	References  []string        `yaml:"references,omitempty" json:"references,omitempty"`
+	Invites     []CalendarEvent `yaml:"invites,omitempty" json:"invites,omitempty"`
+	CachedAt    time.Time       `yaml:"cached_at,omitempty" json:"-"`
+
+	// SPF, DKIM and DMARC results from the headers and local DKIM verification
+	Authentication *AuthVerdict `yaml:"authentication,omitempty" json:"authentication,omitempty"`
+
+	// S/MIME and OpenPGP decryption and signature verification results
+	SMIME *SMIMEInfo `yaml:"smime,omitempty" json:"smime,omitempty"`
+	PGP   *PGPInfo   `yaml:"pgp,omitempty" json:"pgp,omitempty"`
 }
 
 // Attachment represents an email attachment
@@ -40,6 +49,7 @@ type Attachment struct {
 	Size        int64  `yaml:"size" json:"size"`
 	ContentType string `yaml:"content_type,omitempty" json:"content_type,omitempty"`
 	CacheID     string `yaml:"cache_id,omitempty" json:"cache_id,omitempty"`
+	Encrypted   bool   `yaml:"encrypted,omitempty" json:"encrypted,omitempty"` // Password-protected archive
 }
 
 // FetchOptions represents email fetching parameters
@@ -64,6 +74,38 @@ type SendOptions struct {
 	Attachments      []string `json:"attachments"` // Cache IDs
 	ReplyToMessageID string   `json:"reply_to_message_id"`
 	References       []string `json:"references"`
+
+	// Inline (multipart/related) content referenced from the HTML body
+	InlineAttachments []InlineAttachment `json:"inline_attachments"`
+	EmbedDataURIs     bool               `json:"embed_data_uris"` // Convert data: URIs in HTMLBody to CID parts
+
+	// Sender presentation and extra headers
+	FromIdentity            string            `json:"from_identity"`              // Identity ID or alias address to send from
+	FromName                string            `json:"from_name"`                  // Display name for the From address
+	ReplyTo                 []string          `json:"reply_to"`                   // Reply-To addresses
+	Priority                string            `json:"priority"`                   // high, normal or low
+	ReadReceipt             bool              `json:"read_receipt"`               // Request a Disposition-Notification-To receipt
+	ListUnsubscribe         []string          `json:"list_unsubscribe"`           // mailto: or https: unsubscribe URIs
+	ListUnsubscribeOneClick bool              `json:"list_unsubscribe_one_click"` // RFC 8058 one-click unsubscribe
+	Headers                 map[string]string `json:"headers"`                    // Custom headers such as X-Campaign-ID
+
+	// S/MIME or PGP/MIME protection. Crypto selects smime or pgp; by default S/MIME
+	// is used if the account has a certificate and PGP otherwise.
+	Sign    bool   `json:"sign"`
+	Encrypt bool   `json:"encrypt"`
+	Crypto  string `json:"crypto"`
+
+	// Calendar invitation or reply sent alongside the body (not stored in drafts)
+	Calendar *CalendarPart `json:"-"`
+
+	// Set only by confirm_send: external recipients were explicitly confirmed
+	PolicyConfirmed bool `json:"-"`
+}
+
+// InlineAttachment is a cached file embedded in the HTML body via a cid: reference
+type InlineAttachment struct {
+	CacheID   string `yaml:"cache_id" json:"cache_id"`
+	ContentID string `yaml:"content_id" json:"content_id"`
 }
 
 // Folder represents an IMAP folder
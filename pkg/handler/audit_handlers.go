@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/gomcpgo/mcp/pkg/protocol"
+	"github.com/prasanthmj/email/pkg/audit"
+)
+
+// getAuditLog returns the audit logger for the account
+func (h *Handler) getAuditLog(accountID string) (*audit.Logger, error) {
+	clients, _, err := h.getAccountClients(accountID)
+	if err != nil {
+		return nil, err
+	}
+	if clients.auditLog == nil {
+		return nil, fmt.Errorf("audit log is disabled (AUDIT_LOG=false)")
+	}
+	return clients.auditLog, nil
+}
+
+// recordCall appends a tool invocation to the audit log of the account it targets.
+// Calls naming an unknown account are not recorded.
+func (h *Handler) recordCall(req *protocol.CallToolRequest, callErr error) {
+	accountID, _ := req.Arguments["account_id"].(string)
+	if _, ok := h.getConfig().Accounts[h.resolveAccountID(accountID)]; !ok {
+		return
+	}
+	logger, err := h.getAuditLog(accountID)
+	if err != nil {
+		return
+	}
+	if err := logger.RecordCall(req.Name, req.Arguments, callErr); err != nil {
+		fmt.Fprintf(os.Stderr, "Audit warning (%s): %v\n", h.resolveAccountID(accountID), err)
+	}
+}
+
+// handleQueryAuditLog handles the query_audit_log tool
+func (h *Handler) handleQueryAuditLog(ctx context.Context, args map[string]interface{}) (*protocol.CallToolResponse, error) {
+	// Extract account_id
+	var accountID string
+	if id, ok := args["account_id"].(string); ok {
+		accountID = id
+	}
+
+	logger, err := h.getAuditLog(accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	q := audit.Query{Limit: 50}
+	if event, ok := args["event"].(string); ok {
+		q.Event = event
+	}
+	if tool, ok := args["tool"].(string); ok {
+		q.Tool = tool
+	}
+	if status, ok := args["status"].(string); ok {
+		q.Status = status
+	}
+	if recipient, ok := args["recipient"].(string); ok {
+		q.Recipient = recipient
+	}
+	if sinceDate, ok := args["since_date"].(string); ok && sinceDate != "" {
+		t, err := time.ParseInLocation("2006-01-02", sinceDate, time.Local)
+		if err != nil {
+			return nil, fmt.Errorf("invalid since_date format (use YYYY-MM-DD): %w", err)
+		}
+		q.Since = t
+	}
+	if untilDate, ok := args["until_date"].(string); ok && untilDate != "" {
+		t, err := time.ParseInLocation("2006-01-02", untilDate, time.Local)
+		if err != nil {
+			return nil, fmt.Errorf("invalid until_date format (use YYYY-MM-DD): %w", err)
+		}
+		// Include the whole day
+		q.Until = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+	if limit, ok := args["limit"].(float64); ok && limit > 0 {
+		q.Limit = int(limit)
+	}
+
+	records, err := logger.Query(q)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit log: %w", err)
+	}
+	if records == nil {
+		records = []audit.Record{}
+	}
+	return jsonResponse(records)
+}
@@ -0,0 +1,383 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/gomcpgo/mcp/pkg/protocol"
+	"github.com/prasanthmj/email/pkg/email"
+)
+
+// handleRespondToInvite handles the respond_to_invite tool
+// Sends a METHOD:REPLY iTIP message to the organizer of a cached invitation.
+func (h *Handler) handleRespondToInvite(ctx context.Context, args map[string]interface{}) (*protocol.CallToolResponse, error) {
+	// Extract account_id
+	var accountID string
+	if id, ok := args["account_id"].(string); ok {
+		accountID = id
+	}
+	accountID = h.resolveAccountID(accountID)
+
+	messageID, ok := args["message_id"].(string)
+	if !ok || messageID == "" {
+		return nil, fmt.Errorf("message_id parameter is required")
+	}
+
+	response, _ := args["response"].(string)
+	var partStat, verb string
+	switch strings.ToLower(response) {
+	case "accept", "accepted":
+		partStat, verb = email.PartStatAccepted, "Accepted"
+	case "decline", "declined":
+		partStat, verb = email.PartStatDeclined, "Declined"
+	case "tentative":
+		partStat, verb = email.PartStatTentative, "Tentative"
+	default:
+		return nil, fmt.Errorf("invalid response: %q (must be 'accept', 'decline' or 'tentative')", response)
+	}
+
+	comment, _ := args["comment"].(string)
+	uid, _ := args["uid"].(string)
+
+	// The invitation must have been fetched into the cache first
+	emailCache, err := h.getEmailCache(accountID)
+	if err != nil {
+		return nil, err
+	}
+	metadata, err := emailCache.LoadMetadata(messageID)
+	if err != nil {
+		return nil, fmt.Errorf("email not in cache. Call fetch_email first with message_id: %s", messageID)
+	}
+	if len(metadata.Invites) == 0 {
+		return nil, fmt.Errorf("email %s does not contain a calendar invitation", messageID)
+	}
+
+	var event *email.CalendarEvent
+	for i := range metadata.Invites {
+		if uid == "" || metadata.Invites[i].UID == uid {
+			event = &metadata.Invites[i]
+			break
+		}
+	}
+	if event == nil {
+		return nil, fmt.Errorf("no invitation with uid %s in email %s", uid, messageID)
+	}
+	if uid == "" && len(metadata.Invites) > 1 {
+		return nil, fmt.Errorf("email contains %d events; specify uid to choose one", len(metadata.Invites))
+	}
+	if event.Method != "" && event.Method != email.MethodRequest {
+		return nil, fmt.Errorf("cannot respond to a calendar message with method %s", event.Method)
+	}
+	if event.Organizer == nil || event.Organizer.Email == "" {
+		return nil, fmt.Errorf("invitation has no organizer to reply to")
+	}
+
+	_, acctCfg, err := h.getAccountClients(accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Reuse our attendee entry so the organizer sees the same name they invited;
+	// invitations addressed to an alias are answered from that identity
+	attendee := email.CalendarAttendee{Email: acctCfg.EmailAddress}
+	var fromIdentity string
+	for _, a := range event.Attendees {
+		if strings.EqualFold(a.Email, acctCfg.EmailAddress) {
+			attendee = a
+			break
+		}
+		if identity := acctCfg.MatchIdentity([]string{a.Email}); identity != nil {
+			attendee = a
+			fromIdentity = identity.ID
+			break
+		}
+	}
+
+	ics, err := email.BuildReplyICS(*event, attendee, partStat, comment)
+	if err != nil {
+		return nil, err
+	}
+
+	organizer := event.Organizer.Email
+	if event.Organizer.Name != "" {
+		organizer = (&mail.Address{Name: event.Organizer.Name, Address: event.Organizer.Email}).String()
+	}
+
+	body := fmt.Sprintf("%s has %s the invitation: %s", attendee.Email, strings.ToLower(partStatVerb(partStat)), event.Summary)
+	if comment != "" {
+		body += "\n\n" + comment
+	}
+
+	opts := email.SendOptions{
+		To:               []string{organizer},
+		Subject:          fmt.Sprintf("%s: %s", verb, event.Summary),
+		Body:             body,
+		ReplyToMessageID: messageID,
+		References:       metadata.References,
+		FromIdentity:     fromIdentity,
+		Calendar: &email.CalendarPart{
+			Method:  email.MethodReply,
+			Content: ics,
+		},
+	}
+
+	smtpClient, err := h.getSMTPClient(accountID)
+	if err != nil {
+		return nil, err
+	}
+	if err := smtpClient.SendEmail(ctx, opts); err != nil {
+		return nil, fmt.Errorf("failed to send invitation reply: %w", err)
+	}
+
+	return &protocol.CallToolResponse{
+		Content: []protocol.ToolContent{
+			{
+				Type: "text",
+				Text: fmt.Sprintf("Invitation %s (%s) sent to %s", strings.ToLower(partStatVerb(partStat)), event.Summary, event.Organizer.Email),
+			},
+		},
+	}, nil
+}
+
+// partStatVerb returns a human-readable past tense for a participation status
+func partStatVerb(partStat string) string {
+	switch partStat {
+	case email.PartStatAccepted:
+		return "Accepted"
+	case email.PartStatDeclined:
+		return "Declined"
+	default:
+		return "Tentatively accepted"
+	}
+}
+
+// handleSendInvite handles the send_invite tool
+// Composes a METHOD:REQUEST invitation and sends it to all attendees.
+func (h *Handler) handleSendInvite(ctx context.Context, args map[string]interface{}) (*protocol.CallToolResponse, error) {
+	// Extract account_id
+	var accountID string
+	if id, ok := args["account_id"].(string); ok {
+		accountID = id
+	}
+	accountID = h.resolveAccountID(accountID)
+
+	var to, cc []string
+	if list, ok := args["to"].([]interface{}); ok {
+		for _, t := range list {
+			if addr, ok := t.(string); ok {
+				to = append(to, addr)
+			}
+		}
+	}
+	if len(to) == 0 {
+		return nil, fmt.Errorf("at least one 'to' attendee is required")
+	}
+	if list, ok := args["cc"].([]interface{}); ok {
+		for _, c := range list {
+			if addr, ok := c.(string); ok {
+				cc = append(cc, addr)
+			}
+		}
+	}
+
+	summary, _ := args["summary"].(string)
+	if summary == "" {
+		return nil, fmt.Errorf("summary is required")
+	}
+
+	allDay, _ := args["all_day"].(bool)
+
+	loc := time.UTC
+	if tz, ok := args["time_zone"].(string); ok && tz != "" {
+		l, err := time.LoadLocation(tz)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time_zone: %s", tz)
+		}
+		loc = l
+	}
+
+	startStr, _ := args["start"].(string)
+	if startStr == "" {
+		return nil, fmt.Errorf("start is required")
+	}
+	start, err := parseEventTime(startStr, loc, allDay)
+	if err != nil {
+		return nil, fmt.Errorf("invalid start: %w", err)
+	}
+
+	var end time.Time
+	if endStr, ok := args["end"].(string); ok && endStr != "" {
+		end, err = parseEventTime(endStr, loc, allDay)
+		if err != nil {
+			return nil, fmt.Errorf("invalid end: %w", err)
+		}
+	} else if allDay {
+		end = start.AddDate(0, 0, 1)
+	} else {
+		end = start.Add(time.Hour)
+	}
+
+	_, acctCfg, err := h.getAccountClients(accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	// The organizer is the identity the invitation is sent from
+	fromIdentity, _ := args["from_identity"].(string)
+	organizer := &email.CalendarAttendee{Email: acctCfg.EmailAddress}
+	identity, err := acctCfg.FindIdentity(fromIdentity)
+	if err != nil {
+		return nil, err
+	}
+	if identity != nil {
+		organizer = &email.CalendarAttendee{Email: identity.EmailAddress, Name: identity.DisplayName}
+	}
+
+	event := email.CalendarEvent{
+		Method:    email.MethodRequest,
+		Summary:   summary,
+		Start:     start,
+		End:       end,
+		AllDay:    allDay,
+		Organizer: organizer,
+	}
+	if v, ok := args["location"].(string); ok {
+		event.Location = v
+	}
+	if v, ok := args["description"].(string); ok {
+		event.Description = v
+	}
+	if v, ok := args["rrule"].(string); ok {
+		event.RRule = v
+	}
+	if v, ok := args["sequence"].(float64); ok {
+		event.Sequence = int(v)
+	}
+
+	// Reusing a UID with a higher sequence updates an invitation that was already sent
+	event.UID, _ = args["uid"].(string)
+	if event.UID == "" {
+		domain := ""
+		if at := strings.LastIndex(organizer.Email, "@"); at >= 0 {
+			domain = organizer.Email[at+1:]
+		}
+		event.UID = email.NewEventUID(domain)
+	}
+
+	for _, list := range []struct {
+		addrs []string
+		role  string
+	}{{to, "REQ-PARTICIPANT"}, {cc, "OPT-PARTICIPANT"}} {
+		for _, a := range list.addrs {
+			addr, err := mail.ParseAddress(a)
+			if err != nil {
+				return nil, fmt.Errorf("invalid attendee address %q: %w", a, err)
+			}
+			event.Attendees = append(event.Attendees, email.CalendarAttendee{
+				Email:    addr.Address,
+				Name:     addr.Name,
+				Role:     list.role,
+				PartStat: "NEEDS-ACTION",
+				RSVP:     true,
+			})
+		}
+	}
+
+	ics, err := email.BuildInviteICS(event)
+	if err != nil {
+		return nil, err
+	}
+
+	body, _ := args["body"].(string)
+	if body == "" {
+		body = describeEvent(event)
+	}
+
+	opts := email.SendOptions{
+		To:           to,
+		CC:           cc,
+		Subject:      fmt.Sprintf("Invitation: %s", summary),
+		Body:         body,
+		FromIdentity: fromIdentity,
+		Calendar: &email.CalendarPart{
+			Method:  email.MethodRequest,
+			Content: ics,
+		},
+	}
+	if htmlBody, ok := args["html_body"].(string); ok {
+		opts.HTMLBody = htmlBody
+	}
+
+	smtpClient, err := h.getSMTPClient(accountID)
+	if err != nil {
+		return nil, err
+	}
+	if err := smtpClient.SendEmail(ctx, opts); err != nil {
+		return nil, fmt.Errorf("failed to send invitation: %w", err)
+	}
+
+	result := map[string]interface{}{
+		"uid":       event.UID,
+		"sequence":  event.Sequence,
+		"start":     event.Start,
+		"end":       event.End,
+		"attendees": event.Attendees,
+		"status":    "sent",
+	}
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to format response: %w", err)
+	}
+
+	return &protocol.CallToolResponse{
+		Content: []protocol.ToolContent{
+			{
+				Type: "text",
+				Text: string(data),
+			},
+		},
+	}, nil
+}
+
+// parseEventTime parses RFC 3339 timestamps or local date/times in the given location
+func parseEventTime(value string, loc *time.Location, allDay bool) (time.Time, error) {
+	if allDay {
+		return time.Parse("2006-01-02", value[:min(len(value), 10)])
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.In(loc), nil
+	}
+	for _, layout := range []string{"2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02 15:04"} {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("use RFC 3339 (2024-01-20T10:00:00-05:00) or local time (2024-01-20T10:00) with time_zone")
+}
+
+// describeEvent renders a plain text summary of an event for the message body
+func describeEvent(event email.CalendarEvent) string {
+	var sb strings.Builder
+	sb.WriteString(event.Summary + "\n\n")
+	if event.AllDay {
+		sb.WriteString("When: " + event.Start.Format("Monday, January 2, 2006") + " (all day)\n")
+	} else {
+		sb.WriteString("When: " + event.Start.Format("Monday, January 2, 2006 15:04 MST"))
+		sb.WriteString(" - " + event.End.Format("15:04 MST") + "\n")
+	}
+	if event.RRule != "" {
+		sb.WriteString("Repeats: " + event.RRule + "\n")
+	}
+	if event.Location != "" {
+		sb.WriteString("Where: " + event.Location + "\n")
+	}
+	sb.WriteString("Organizer: " + event.Organizer.Email + "\n")
+	if event.Description != "" {
+		sb.WriteString("\n" + event.Description + "\n")
+	}
+	return sb.String()
+}
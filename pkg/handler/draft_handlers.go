@@ -4,10 +4,12 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"os"
 	"time"
 
 	"github.com/gomcpgo/mcp/pkg/protocol"
 	"github.com/prasanthmj/email/pkg/email"
+	"github.com/prasanthmj/email/pkg/storage"
 )
 
 // handleCreateDraft handles the create_draft tool
@@ -69,6 +71,16 @@ func (h *Handler) handleCreateDraft(ctx context.Context, args map[string]interfa
 		}
 	}
 
+	// Parse inline attachments
+	inlineAttachments, err := parseInlineAttachments(args)
+	if err != nil {
+		return nil, err
+	}
+	opts.InlineAttachments = inlineAttachments
+	if embed, ok := args["embed_data_uris"].(bool); ok {
+		opts.EmbedDataURIs = embed
+	}
+
 	// Parse threading parameters
 	if replyTo, ok := args["reply_to_message_id"].(string); ok {
 		opts.ReplyToMessageID = replyTo
@@ -81,6 +93,17 @@ func (h *Handler) handleCreateDraft(ctx context.Context, args map[string]interfa
 		}
 	}
 
+	// Parse sender and extra header options
+	if err := parseHeaderOptions(args, &opts); err != nil {
+		return nil, err
+	}
+	if err := h.selectIdentity(accountID, &opts); err != nil {
+		return nil, err
+	}
+	if err := h.appendSignature(accountID, args, &opts); err != nil {
+		return nil, err
+	}
+
 	// Get account-specific storage
 	stor, err := h.getStorage(accountID)
 	if err != nil {
@@ -121,6 +144,9 @@ func (h *Handler) handleListDrafts(ctx context.Context, args map[string]interfac
 	if err != nil {
 		return nil, fmt.Errorf("failed to list drafts: %w", err)
 	}
+	if batchID, ok := args["batch_id"].(string); ok && batchID != "" {
+		drafts = filterDraftsByBatch(drafts, batchID)
+	}
 
 	// Convert to JSON for response
 	data, err := json.MarshalIndent(drafts, "", "  ")
@@ -138,6 +164,17 @@ func (h *Handler) handleListDrafts(ctx context.Context, args map[string]interfac
 	}, nil
 }
 
+// filterDraftsByBatch keeps the drafts created by the given mail merge batch
+func filterDraftsByBatch(drafts []storage.DraftSummary, batchID string) []storage.DraftSummary {
+	filtered := []storage.DraftSummary{}
+	for _, d := range drafts {
+		if d.BatchID == batchID {
+			filtered = append(filtered, d)
+		}
+	}
+	return filtered
+}
+
 // handleGetDraft handles the get_draft tool
 func (h *Handler) handleGetDraft(ctx context.Context, args map[string]interface{}) (*protocol.CallToolResponse, error) {
 	// Extract account_id
@@ -204,17 +241,7 @@ func (h *Handler) handleUpdateDraft(ctx context.Context, args map[string]interfa
 	}
 
 	// Build updated SendOptions from existing draft
-	opts := email.SendOptions{
-		To:               existingDraft.To,
-		CC:               existingDraft.CC,
-		BCC:              existingDraft.BCC,
-		Subject:          existingDraft.Subject,
-		Body:             existingDraft.Body,
-		HTMLBody:         existingDraft.HTMLBody,
-		Attachments:      existingDraft.Attachments,
-		ReplyToMessageID: existingDraft.ReplyToMessageID,
-		References:       existingDraft.References,
-	}
+	opts := existingDraft.SendOptions()
 
 	// Apply updates
 	if to, ok := args["to"].([]interface{}); ok {
@@ -267,6 +294,26 @@ func (h *Handler) handleUpdateDraft(ctx context.Context, args map[string]interfa
 		}
 	}
 
+	if _, ok := args["inline_attachments"]; ok {
+		inlineAttachments, err := parseInlineAttachments(args)
+		if err != nil {
+			return nil, err
+		}
+		opts.InlineAttachments = inlineAttachments
+	}
+
+	if embed, ok := args["embed_data_uris"].(bool); ok {
+		opts.EmbedDataURIs = embed
+	}
+
+	// Parse sender and extra header options
+	if err := parseHeaderOptions(args, &opts); err != nil {
+		return nil, err
+	}
+	if err := h.selectIdentity(accountID, &opts); err != nil {
+		return nil, err
+	}
+
 	// Update the draft (preserves ID and created_at)
 	fmt.Printf("DEBUG: Updating draft %s with subject: %s\n", draftID, opts.Subject)
 	if err := stor.UpdateDraft(draftID, opts); err != nil {
@@ -310,17 +357,7 @@ func (h *Handler) handleSendDraft(ctx context.Context, args map[string]interface
 	}
 
 	// Convert draft to SendOptions
-	opts := email.SendOptions{
-		To:               draft.To,
-		CC:               draft.CC,
-		BCC:              draft.BCC,
-		Subject:          draft.Subject,
-		Body:             draft.Body,
-		HTMLBody:         draft.HTMLBody,
-		Attachments:      draft.Attachments,
-		ReplyToMessageID: draft.ReplyToMessageID,
-		References:       draft.References,
-	}
+	opts := draft.SendOptions()
 
 	// Validate required fields
 	if len(opts.To) == 0 {
@@ -333,13 +370,42 @@ func (h *Handler) handleSendDraft(ctx context.Context, args map[string]interface
 		return nil, fmt.Errorf("draft has no content")
 	}
 
+	// Scheduled drafts move to the outbox for the background worker
+	sendAt, err := parseSendAt(args)
+	if err != nil {
+		return nil, err
+	}
+	if !sendAt.IsZero() {
+		entry, err := h.enqueueMessage(accountID, opts, sendAt, draft.BatchID, 0)
+		if held := heldByPolicy(err); held != nil {
+			return h.holdForConfirmation(accountID, draftID, held)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to schedule draft: %w", err)
+		}
+		if err := stor.DeleteDraft(draftID); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to delete draft after scheduling: %v\n", err)
+		}
+		return &protocol.CallToolResponse{
+			Content: []protocol.ToolContent{
+				{
+					Type: "text",
+					Text: fmt.Sprintf("Draft to %v scheduled for %s (outbox ID: %s) and removed from drafts", opts.To, entry.SendAt.Format(time.RFC3339), entry.ID),
+				},
+			},
+		}, nil
+	}
+
 	// Send the email
 	smtpClient, err := h.getSMTPClient(accountID)
 	if err != nil {
 		return nil, err
 	}
 
-	if err := smtpClient.SendEmail(opts); err != nil {
+	if err := smtpClient.SendEmail(ctx, opts); err != nil {
+		if held := heldByPolicy(err); held != nil {
+			return h.holdForConfirmation(accountID, draftID, held)
+		}
 		return nil, fmt.Errorf("failed to send draft: %w", err)
 	}
 
@@ -393,6 +459,7 @@ func (h *Handler) handleDeleteDraft(ctx context.Context, args map[string]interfa
 }
 
 // handleSendAllDrafts handles the send_all_drafts tool
+// Queues the drafts in the outbox instead of sending them inline, so the call returns immediately.
 func (h *Handler) handleSendAllDrafts(ctx context.Context, args map[string]interface{}) (*protocol.CallToolResponse, error) {
 	// Extract account_id
 	var accountID string
@@ -432,6 +499,9 @@ func (h *Handler) handleSendAllDrafts(ctx context.Context, args map[string]inter
 	if err != nil {
 		return nil, fmt.Errorf("failed to list drafts: %w", err)
 	}
+	if batchID, ok := args["batch_id"].(string); ok && batchID != "" {
+		drafts = filterDraftsByBatch(drafts, batchID)
+	}
 
 	if len(drafts) == 0 {
 		return &protocol.CallToolResponse{
@@ -444,116 +514,92 @@ func (h *Handler) handleSendAllDrafts(ctx context.Context, args map[string]inter
 		}, nil
 	}
 
-	// Prepare SMTP client if not dry run
-	var smtpClient *email.SMTPClient
-	if !dryRun {
-		smtpClient, err = h.getSMTPClient(accountID)
-		if err != nil {
-			return nil, err
-		}
+	// Drafts are queued one delay apart starting at send_at (default now)
+	startAt, err := parseSendAt(args)
+	if err != nil {
+		return nil, err
+	}
+	if startAt.IsZero() {
+		startAt = time.Now()
 	}
 
-	// Send results tracking
-	type sendResult struct {
-		DraftID string `json:"draft_id"`
-		Subject string `json:"subject"`
-		To      []string `json:"to"`
-		Status  string `json:"status"`
-		Error   string `json:"error,omitempty"`
+	// Queue results tracking
+	type queueResult struct {
+		DraftID  string    `json:"draft_id"`
+		OutboxID string    `json:"outbox_id,omitempty"`
+		Subject  string    `json:"subject"`
+		To       []string  `json:"to"`
+		SendAt   time.Time `json:"send_at"`
+		Status   string    `json:"status"`
+		Error    string    `json:"error,omitempty"`
+		Token    string    `json:"confirm_token,omitempty"`
 	}
 
-	var results []sendResult
-	successCount := 0
+	var results []queueResult
+	queuedCount := 0
+	heldCount := 0
 	failCount := 0
 
-	for i, draftSummary := range drafts {
+	for _, draftSummary := range drafts {
+		sendAt := startAt.Add(time.Duration(queuedCount*delaySeconds) * time.Second)
+		result := queueResult{
+			DraftID: draftSummary.ID,
+			Subject: draftSummary.Subject,
+			To:      draftSummary.To,
+			SendAt:  sendAt,
+		}
+
 		// Load full draft
 		draft, err := stor.LoadDraft(draftSummary.ID)
 		if err != nil {
-			result := sendResult{
-				DraftID: draftSummary.ID,
-				Subject: draftSummary.Subject,
-				To:      draftSummary.To,
-				Status:  "failed",
-				Error:   fmt.Sprintf("failed to load draft: %v", err),
+			result.Status = "failed"
+			result.Error = fmt.Sprintf("failed to load draft: %v", err)
+		} else if dryRun {
+			result.Status = "simulated"
+		} else if entry, err := h.enqueueMessage(accountID, draft.SendOptions(), sendAt, draft.BatchID, delaySeconds); err != nil {
+			result.Status = "failed"
+			result.Error = fmt.Sprintf("queue failed: %v", err)
+
+			// Drafts held by the outbound policy stay in drafts until confirm_send
+			if held := heldByPolicy(err); held != nil {
+				if token, _, err := h.issueConfirmToken(accountID, draft.ID, held); err == nil {
+					result.Status = "confirmation_required"
+					result.Error = held.Error()
+					result.Token = token
+				}
 			}
-			results = append(results, result)
-			failCount++
+		} else {
+			// Queued - the outbox now owns the message
+			stor.DeleteDraft(draft.ID)
+			result.OutboxID = entry.ID
+			result.Status = "queued"
+		}
 
+		results = append(results, result)
+		if result.Status == "failed" {
+			failCount++
 			if stopOnError {
 				break
 			}
 			continue
 		}
-
-		if !dryRun {
-			// Convert to SendOptions
-			opts := email.SendOptions{
-				To:               draft.To,
-				CC:               draft.CC,
-				BCC:              draft.BCC,
-				Subject:          draft.Subject,
-				Body:             draft.Body,
-				HTMLBody:         draft.HTMLBody,
-				Attachments:      draft.Attachments,
-				ReplyToMessageID: draft.ReplyToMessageID,
-				References:       draft.References,
-			}
-
-			// Send the email
-			if err := smtpClient.SendEmail(opts); err != nil {
-				result := sendResult{
-					DraftID: draft.ID,
-					Subject: draft.Subject,
-					To:      draft.To,
-					Status:  "failed",
-					Error:   fmt.Sprintf("send failed: %v", err),
-				}
-				results = append(results, result)
-				failCount++
-
-				if stopOnError {
-					break
-				}
-			} else {
-				// Success - delete the draft
-				stor.DeleteDraft(draft.ID)
-				
-				result := sendResult{
-					DraftID: draft.ID,
-					Subject: draft.Subject,
-					To:      draft.To,
-					Status:  "sent",
-				}
-				results = append(results, result)
-				successCount++
-			}
-
-			// Delay between sends (except for last one)
-			if i < len(drafts)-1 {
-				time.Sleep(time.Duration(delaySeconds) * time.Second)
-			}
-		} else {
-			// Dry run - just simulate
-			result := sendResult{
-				DraftID: draft.ID,
-				Subject: draft.Subject,
-				To:      draft.To,
-				Status:  "simulated",
-			}
-			results = append(results, result)
-			successCount++
+		if result.Status == "confirmation_required" {
+			heldCount++
+			continue
 		}
+		queuedCount++
 	}
 
 	// Prepare summary
 	summary := map[string]interface{}{
-		"total_drafts": len(drafts),
-		"sent":         successCount,
-		"failed":       failCount,
-		"dry_run":      dryRun,
+		"total_drafts":  len(drafts),
+		"queued":        queuedCount,
+		"held":          heldCount,
+		"failed":        failCount,
+		"dry_run":       dryRun,
 		"delay_seconds": delaySeconds,
-		"results":      results,
+		"results":       results,
+		"message":       "Drafts are sent in the background; use list_outbox to follow delivery",
 	}
 
 	data, err := json.MarshalIndent(summary, "", "  ")
@@ -9,13 +9,14 @@ import (
 
 	"github.com/gomcpgo/mcp/pkg/protocol"
 	"github.com/prasanthmj/email/pkg/email"
+	"github.com/prasanthmj/email/pkg/ratelimit"
 	"github.com/prasanthmj/email/pkg/storage"
 )
 
 // handleListAccounts handles the list_accounts tool
 func (h *Handler) handleListAccounts(ctx context.Context, args map[string]interface{}) (*protocol.CallToolResponse, error) {
 	// Handle case where no accounts are configured
-	if len(h.config.Accounts) == 0 {
+	if len(h.getConfig().Accounts) == 0 {
 		return &protocol.CallToolResponse{
 			Content: []protocol.ToolContent{
 				{
@@ -37,21 +38,47 @@ func (h *Handler) handleListAccounts(ctx context.Context, args map[string]interf
 		}, nil
 	}
 
-	type AccountInfo struct {
+	type IdentityInfo struct {
 		ID           string `json:"id"`
 		EmailAddress string `json:"email"`
-		Provider     string `json:"provider"`
-		IsDefault    bool   `json:"is_default"`
+		DisplayName  string `json:"display_name,omitempty"`
+		ReplyTo      string `json:"reply_to,omitempty"`
+		HasSignature bool   `json:"has_signature,omitempty"`
 	}
 
-	accounts := make([]AccountInfo, 0, len(h.config.Accounts))
-	for id, acct := range h.config.Accounts {
-		accounts = append(accounts, AccountInfo{
+	type AccountInfo struct {
+		ID           string           `json:"id"`
+		EmailAddress string           `json:"email"`
+		Provider     string           `json:"provider"`
+		IsDefault    bool             `json:"is_default"`
+		Mode         string           `json:"mode"`
+		Identities   []IdentityInfo   `json:"identities,omitempty"`
+		Quota        *ratelimit.Quota `json:"quota,omitempty"`
+	}
+
+	accounts := make([]AccountInfo, 0, len(h.getConfig().Accounts))
+	for id, acct := range h.getConfig().Accounts {
+		info := AccountInfo{
 			ID:           id,
 			EmailAddress: acct.EmailAddress,
 			Provider:     acct.Provider,
-			IsDefault:    id == h.config.DefaultAccountID,
-		})
+			IsDefault:    id == h.getConfig().DefaultAccountID,
+			Mode:         h.accountMode(id),
+		}
+		for _, identity := range acct.Identities {
+			info.Identities = append(info.Identities, IdentityInfo{
+				ID:           identity.ID,
+				EmailAddress: identity.EmailAddress,
+				DisplayName:  identity.DisplayName,
+				ReplyTo:      identity.ReplyTo,
+				HasSignature: identity.Signature != "",
+			})
+		}
+		if limiter, err := h.getRateLimiter(id); err == nil {
+			quota := limiter.Quota(time.Now())
+			info.Quota = &quota
+		}
+		accounts = append(accounts, info)
 	}
 
 	// Sort by default first, then alphabetically
@@ -90,7 +117,7 @@ func (h *Handler) handleListFolders(ctx context.Context, args map[string]interfa
 		return nil, err
 	}
 
-	folders, err := imapClient.ListFolders()
+	folders, err := imapClient.ListFolders(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list folders: %w", err)
 	}
@@ -170,7 +197,7 @@ func (h *Handler) handleFetchEmailHeaders(ctx context.Context, args map[string]i
 		return nil, err
 	}
 
-	headers, err := imapClient.FetchHeaders(opts)
+	headers, err := imapClient.FetchHeaders(ctx, opts)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch email headers: %w", err)
 	}
@@ -227,13 +254,13 @@ func (h *Handler) handleFetchEmail(ctx context.Context, args map[string]interfac
 			return nil, err
 		}
 
-		emailMsg, err := imapClient.FetchEmail(messageID)
+		emailMsg, err := imapClient.FetchEmail(ctx, messageID)
 		if err != nil {
 			return nil, fmt.Errorf("failed to fetch email: %w", err)
 		}
 
 		// Save to cache with separate body files
-		if _, err := emailCache.SaveEmail(emailMsg, accountID); err != nil {
+		if _, err := emailCache.SaveEmail(ctx, emailMsg, accountID); err != nil {
 			return nil, fmt.Errorf("failed to cache email: %w", err)
 		}
 	}
@@ -330,6 +357,108 @@ func (h *Handler) handleReadEmailBody(ctx context.Context, args map[string]inter
 	}, nil
 }
 
+// handleReadAttachment handles the read_attachment tool
+// Extracts text from a cached attachment and returns it with pagination support.
+func (h *Handler) handleReadAttachment(ctx context.Context, args map[string]interface{}) (*protocol.CallToolResponse, error) {
+	// Extract account_id
+	var accountID string
+	if id, ok := args["account_id"].(string); ok {
+		accountID = id
+	}
+	accountID = h.resolveAccountID(accountID)
+
+	cacheID, ok := args["cache_id"].(string)
+	if !ok || cacheID == "" {
+		return nil, fmt.Errorf("cache_id parameter is required")
+	}
+
+	var offset int64 = 0
+	if o, ok := args["offset"].(float64); ok {
+		offset = int64(o)
+	}
+
+	var limit int64 = 10000 // default 10k characters
+	if l, ok := args["limit"].(float64); ok {
+		limit = int64(l)
+	}
+
+	// Get email cache
+	emailCache, err := h.getEmailCache(accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := emailCache.ReadAttachment(cacheID, offset, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read attachment: %w", err)
+	}
+
+	// Convert to JSON for response
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to format response: %w", err)
+	}
+
+	return &protocol.CallToolResponse{
+		Content: []protocol.ToolContent{
+			{
+				Type: "text",
+				Text: string(data),
+			},
+		},
+	}, nil
+}
+
+// selectIdentity validates the requested sender identity. For replies without an explicit
+// identity, it picks the alias the original message was addressed to.
+func (h *Handler) selectIdentity(accountID string, opts *email.SendOptions) error {
+	_, acctCfg, err := h.getAccountClients(accountID)
+	if err != nil {
+		return err
+	}
+
+	if opts.FromIdentity != "" {
+		if _, err := acctCfg.FindIdentity(opts.FromIdentity); err != nil {
+			return err
+		}
+		return nil
+	}
+
+	if opts.ReplyToMessageID == "" || len(acctCfg.Identities) == 0 {
+		return nil
+	}
+
+	// The original must be cached to know which alias it was sent to
+	emailCache, err := h.getEmailCache(accountID)
+	if err != nil {
+		return nil
+	}
+	metadata, err := emailCache.LoadMetadata(opts.ReplyToMessageID)
+	if err != nil {
+		return nil
+	}
+	if identity := acctCfg.MatchIdentity(append(append([]string{}, metadata.To...), metadata.CC...)); identity != nil {
+		opts.FromIdentity = identity.ID
+	}
+	return nil
+}
+
+// appendSignature appends the signature of the selected identity (or the account) to new messages
+func (h *Handler) appendSignature(accountID string, args map[string]interface{}, opts *email.SendOptions) error {
+	if noSignature, ok := args["no_signature"].(bool); ok && noSignature {
+		return nil
+	}
+
+	_, acctCfg, err := h.getAccountClients(accountID)
+	if err != nil {
+		return err
+	}
+
+	plain, html := acctCfg.SignatureFor(opts.FromIdentity)
+	*opts = email.AppendSignature(*opts, plain, html)
+	return nil
+}
+
 // getEmailCache returns the email cache for the account
 func (h *Handler) getEmailCache(accountID string) (*storage.EmailCache, error) {
 	clients, acctCfg, err := h.getAccountClients(accountID)
@@ -337,10 +466,13 @@ func (h *Handler) getEmailCache(accountID string) (*storage.EmailCache, error) {
 		return nil, err
 	}
 
+	clients.mu.Lock()
+	defer clients.mu.Unlock()
 	if clients.emailCache == nil {
 		// Get the files root from drafts dir (remove /drafts suffix)
 		filesRoot := acctCfg.DraftsDir[:len(acctCfg.DraftsDir)-len("/drafts")]
-		clients.emailCache = storage.NewEmailCache(filesRoot, h.config.CacheMaxSize)
+		clients.emailCache = storage.NewEmailCache(filesRoot, h.getConfig().CacheMaxSize)
+		clients.emailCache.SetContentSafety(acctCfg.ContentSafety)
 	}
 	return clients.emailCache, nil
 }
@@ -413,6 +545,16 @@ func (h *Handler) handleSendEmail(ctx context.Context, args map[string]interface
 		}
 	}
 
+	// Parse inline attachments
+	inlineAttachments, err := parseInlineAttachments(args)
+	if err != nil {
+		return nil, err
+	}
+	opts.InlineAttachments = inlineAttachments
+	if embed, ok := args["embed_data_uris"].(bool); ok {
+		opts.EmbedDataURIs = embed
+	}
+
 	// Parse threading parameters
 	if replyTo, ok := args["reply_to_message_id"].(string); ok {
 		opts.ReplyToMessageID = replyTo
@@ -425,13 +567,52 @@ func (h *Handler) handleSendEmail(ctx context.Context, args map[string]interface
 		}
 	}
 
+	// Parse sender and extra header options
+	if err := parseHeaderOptions(args, &opts); err != nil {
+		return nil, err
+	}
+
+	// Pick the sender identity and its signature
+	if err := h.selectIdentity(accountID, &opts); err != nil {
+		return nil, err
+	}
+	if err := h.appendSignature(accountID, args, &opts); err != nil {
+		return nil, err
+	}
+
+	// Scheduled messages go to the outbox for the background worker
+	sendAt, err := parseSendAt(args)
+	if err != nil {
+		return nil, err
+	}
+	if !sendAt.IsZero() {
+		entry, err := h.enqueueMessage(accountID, opts, sendAt, "", 0)
+		if held := heldByPolicy(err); held != nil {
+			return h.holdNewMessage(accountID, opts, held)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to schedule email: %w", err)
+		}
+		return &protocol.CallToolResponse{
+			Content: []protocol.ToolContent{
+				{
+					Type: "text",
+					Text: fmt.Sprintf("Email to %v scheduled for %s (outbox ID: %s)", opts.To, entry.SendAt.Format(time.RFC3339), entry.ID),
+				},
+			},
+		}, nil
+	}
+
 	// Send the email
 	smtpClient, err := h.getSMTPClient(accountID)
 	if err != nil {
 		return nil, err
 	}
 
-	if err := smtpClient.SendEmail(opts); err != nil {
+	if err := smtpClient.SendEmail(ctx, opts); err != nil {
+		if held := heldByPolicy(err); held != nil {
+			return h.holdNewMessage(accountID, opts, held)
+		}
 		return nil, fmt.Errorf("failed to send email: %w", err)
 	}
 
@@ -478,7 +659,7 @@ func (h *Handler) handleFetchEmailAttachment(ctx context.Context, args map[strin
 		return nil, err
 	}
 	
-	results, err := attFetcher.FetchAttachments(messageID, attachmentNames, fetchAll)
+	results, err := attFetcher.FetchAttachments(ctx, messageID, attachmentNames, fetchAll)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch attachments: %w", err)
 	}
@@ -497,4 +678,103 @@ func (h *Handler) handleFetchEmailAttachment(ctx context.Context, args map[strin
 			},
 		},
 	}, nil
-}
\ No newline at end of file
+}
+
+// parseInlineAttachments parses the inline_attachments argument
+func parseInlineAttachments(args map[string]interface{}) ([]email.InlineAttachment, error) {
+	var inlineAttachments []email.InlineAttachment
+
+	items, ok := args["inline_attachments"].([]interface{})
+	if !ok {
+		return nil, nil
+	}
+
+	for _, item := range items {
+		obj, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("inline_attachments entries must be objects with cache_id and content_id")
+		}
+		cacheID, _ := obj["cache_id"].(string)
+		contentID, _ := obj["content_id"].(string)
+		if cacheID == "" {
+			return nil, fmt.Errorf("inline attachment is missing cache_id")
+		}
+		cid, err := email.NormalizeContentID(contentID)
+		if err != nil {
+			return nil, err
+		}
+		inlineAttachments = append(inlineAttachments, email.InlineAttachment{
+			CacheID:   cacheID,
+			ContentID: cid,
+		})
+	}
+
+	return inlineAttachments, nil
+}
+
+// parseHeaderOptions applies sender display name, Reply-To, priority, read receipt,
+// S/MIME or PGP, List-Unsubscribe and custom header arguments that are present in args
+func parseHeaderOptions(args map[string]interface{}, opts *email.SendOptions) error {
+	if identity, ok := args["from_identity"].(string); ok {
+		opts.FromIdentity = identity
+	}
+	if fromName, ok := args["from_name"].(string); ok {
+		opts.FromName = fromName
+	}
+	if replyTo, ok := args["reply_to"].([]interface{}); ok {
+		opts.ReplyTo = nil
+		for _, r := range replyTo {
+			if addr, ok := r.(string); ok {
+				opts.ReplyTo = append(opts.ReplyTo, addr)
+			}
+		}
+	} else if replyTo, ok := args["reply_to"].(string); ok {
+		opts.ReplyTo = []string{replyTo}
+	}
+	if priority, ok := args["priority"].(string); ok {
+		opts.Priority = priority
+	}
+	if readReceipt, ok := args["read_receipt"].(bool); ok {
+		opts.ReadReceipt = readReceipt
+	}
+	if sign, ok := args["sign"].(bool); ok {
+		opts.Sign = sign
+	}
+	if encrypt, ok := args["encrypt"].(bool); ok {
+		opts.Encrypt = encrypt
+	}
+	if method, ok := args["crypto"].(string); ok {
+		opts.Crypto = method
+	}
+	if uris, ok := args["list_unsubscribe"].([]interface{}); ok {
+		opts.ListUnsubscribe = nil
+		for _, u := range uris {
+			if uri, ok := u.(string); ok {
+				opts.ListUnsubscribe = append(opts.ListUnsubscribe, uri)
+			}
+		}
+	}
+	if oneClick, ok := args["list_unsubscribe_one_click"].(bool); ok {
+		opts.ListUnsubscribeOneClick = oneClick
+	}
+	if raw, ok := args["headers"]; ok {
+		headers, ok := raw.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("headers must be an object of header names to values")
+		}
+		opts.Headers = nil
+		for name, v := range headers {
+			value, ok := v.(string)
+			if !ok {
+				return fmt.Errorf("header %s must be a string", name)
+			}
+			if opts.Headers == nil {
+				opts.Headers = make(map[string]string)
+			}
+			opts.Headers[name] = value
+		}
+	}
+
+	// Reject header injection up front so bad drafts are never stored
+	return opts.Validate()
+}
@@ -2,57 +2,97 @@ package handler
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
 
 	"github.com/gomcpgo/mcp/pkg/protocol"
+	"github.com/prasanthmj/email/pkg/audit"
 	"github.com/prasanthmj/email/pkg/config"
 	"github.com/prasanthmj/email/pkg/email"
+	"github.com/prasanthmj/email/pkg/ratelimit"
 	"github.com/prasanthmj/email/pkg/storage"
 )
 
-// AccountClients holds per-account client instances
+// AccountClients holds per-account client instances. The lazily created clients are
+// guarded by mu; the others are set when the AccountClients is created.
 type AccountClients struct {
-	imapClient   *email.IMAPClient
-	smtpClient   *email.SMTPClient
-	attFetcher   *email.AttachmentFetcher
+	mu         sync.Mutex
+	imapClient *email.IMAPClient
+	smtpClient *email.SMTPClient
+	attFetcher *email.AttachmentFetcher
+	emailCache *storage.EmailCache
+
 	storage      *storage.Storage
 	cacheManager *storage.CacheManager
-	emailCache   *storage.EmailCache
+	rateLimiter  *ratelimit.Limiter
+	auditLog     *audit.Logger // nil when AUDIT_LOG is disabled
 }
 
 // Handler handles MCP protocol operations
 type Handler struct {
-	config  *config.MultiAccountConfig
-	clients map[string]*AccountClients // Per-account clients (lazy-initialized)
+	config        atomic.Pointer[config.MultiAccountConfig] // Current configuration, swapped by Reload
+	mu            sync.Mutex                                // Guards clients and globalLimiter
+	clients       map[string]*AccountClients                // Per-account clients (lazy-initialized)
+	globalLimiter *ratelimit.Limiter                        // Sending limits across all accounts (nil if unset)
+	outboxWake    chan struct{}                             // Wakes the outbox worker when a message is queued
 }
 
 // NewHandler creates a new handler instance
 func NewHandler(cfg *config.MultiAccountConfig) (*Handler, error) {
-	return &Handler{
-		config:  cfg,
-		clients: make(map[string]*AccountClients),
-	}, nil
+	h := &Handler{
+		clients:    make(map[string]*AccountClients),
+		outboxWake: make(chan struct{}, 1),
+	}
+	h.config.Store(cfg)
+	h.globalLimiter = newGlobalLimiter(cfg)
+	return h, nil
+}
+
+// newGlobalLimiter creates the limiter shared by all accounts, or nil if there are no global limits
+func newGlobalLimiter(cfg *config.MultiAccountConfig) *ratelimit.Limiter {
+	if cfg.GlobalRateLimits.IsZero() {
+		return nil
+	}
+	return ratelimit.New("global", filepath.Join(cfg.FilesRoot, "ratelimit.yaml"), cfg.GlobalRateLimits, nil)
+}
+
+// getConfig returns the current configuration. Callers that read several settings should
+// keep the returned pointer, as a reload may swap it at any time.
+func (h *Handler) getConfig() *config.MultiAccountConfig {
+	return h.config.Load()
 }
 
 // resolveAccountID returns the actual account ID to use (default if empty)
 func (h *Handler) resolveAccountID(requestedID string) string {
 	if requestedID == "" {
-		return h.config.DefaultAccountID
+		return h.getConfig().DefaultAccountID
 	}
 	return requestedID
 }
 
 // getAccountClients returns or creates the account clients for the given account ID
 func (h *Handler) getAccountClients(accountID string) (*AccountClients, *config.AccountConfig, error) {
-	accountID = h.resolveAccountID(accountID)
+	// Holding the lock keeps Reload from swapping the configuration until the clients
+	// created here are registered
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	cfg := h.getConfig()
+	if accountID == "" {
+		accountID = cfg.DefaultAccountID
+	}
 
 	// Check if any accounts are configured
-	if len(h.config.Accounts) == 0 {
+	if len(cfg.Accounts) == 0 {
 		return nil, nil, fmt.Errorf("no email accounts configured. Please set environment variables: ACCOUNT_{name}_EMAIL, ACCOUNT_{name}_PASSWORD, and DEFAULT_ACCOUNT_ID")
 	}
 
 	// Get account config
-	acctCfg, err := h.config.GetAccount(accountID)
+	acctCfg, err := cfg.GetAccount(accountID)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -62,14 +102,24 @@ func (h *Handler) getAccountClients(accountID string) (*AccountClients, *config.
 		return clients, acctCfg, nil
 	}
 
-	// Create new clients for this account
+	clients := h.newAccountClientsLocked(cfg, acctCfg)
+	return clients, acctCfg, nil
+}
+
+// newAccountClientsLocked creates and registers the clients of an account. h.mu must be held.
+func (h *Handler) newAccountClientsLocked(cfg *config.MultiAccountConfig, acctCfg *config.AccountConfig) *AccountClients {
+	accountRoot := acctCfg.DraftsDir[:len(acctCfg.DraftsDir)-len("/drafts")]
 	clients := &AccountClients{
-		storage:      storage.NewStorage(acctCfg.DraftsDir[:len(acctCfg.DraftsDir)-len("/drafts")], h.config.CacheMaxSize),
-		cacheManager: storage.NewCacheManager(acctCfg.DraftsDir[:len(acctCfg.DraftsDir)-len("/drafts")], h.config.CacheMaxSize),
+		storage:      storage.NewStorage(accountRoot, cfg.CacheMaxSize),
+		cacheManager: storage.NewCacheManager(accountRoot, cfg.CacheMaxSize),
+		rateLimiter:  ratelimit.New(acctCfg.AccountID, filepath.Join(accountRoot, "ratelimit.yaml"), acctCfg.RateLimits, h.globalLimiter),
+	}
+	if cfg.AuditEnabled {
+		clients.auditLog = audit.New(acctCfg.AccountID, filepath.Join(accountRoot, "audit", "audit.jsonl"), cfg.AuditMaxSize, cfg.AuditMaxFiles)
 	}
 
-	h.clients[accountID] = clients
-	return clients, acctCfg, nil
+	h.clients[acctCfg.AccountID] = clients
+	return clients
 }
 
 // getIMAPClient returns the IMAP client for the account, initializing if necessary
@@ -83,10 +133,17 @@ func (h *Handler) getIMAPClient(accountID string) (*email.IMAPClient, error) {
 		return nil, err
 	}
 
-	if clients.imapClient == nil {
-		clients.imapClient = email.NewIMAPClient(acctCfg)
+	clients.mu.Lock()
+	defer clients.mu.Unlock()
+	return clients.imapClientLocked(acctCfg), nil
+}
+
+// imapClientLocked returns the IMAP client, creating it if needed. clients.mu must be held.
+func (c *AccountClients) imapClientLocked(acctCfg *config.AccountConfig) *email.IMAPClient {
+	if c.imapClient == nil {
+		c.imapClient = email.NewIMAPClient(acctCfg)
 	}
-	return clients.imapClient, nil
+	return c.imapClient
 }
 
 // getSMTPClient returns the SMTP client for the account, initializing if necessary
@@ -100,8 +157,14 @@ func (h *Handler) getSMTPClient(accountID string) (*email.SMTPClient, error) {
 		return nil, err
 	}
 
+	clients.mu.Lock()
+	defer clients.mu.Unlock()
 	if clients.smtpClient == nil {
 		clients.smtpClient = email.NewSMTPClient(acctCfg)
+		clients.smtpClient.SetLimiter(clients.rateLimiter)
+		if clients.auditLog != nil {
+			clients.smtpClient.SetRecorder(clients.auditLog)
+		}
 	}
 	return clients.smtpClient, nil
 }
@@ -113,13 +176,14 @@ func (h *Handler) getAttachmentFetcher(accountID string) (*email.AttachmentFetch
 		return nil, err
 	}
 
-	imapClient, err := h.getIMAPClient(accountID)
-	if err != nil {
+	if err := acctCfg.ValidateForOperation(); err != nil {
 		return nil, err
 	}
 
+	clients.mu.Lock()
+	defer clients.mu.Unlock()
 	if clients.attFetcher == nil {
-		clients.attFetcher = email.NewAttachmentFetcher(acctCfg, imapClient, h.config.MaxAttachmentSize)
+		clients.attFetcher = email.NewAttachmentFetcher(acctCfg, clients.imapClientLocked(acctCfg), h.getConfig().MaxAttachmentSize)
 	}
 	return clients.attFetcher, nil
 }
@@ -133,6 +197,15 @@ func (h *Handler) getStorage(accountID string) (*storage.Storage, error) {
 	return clients.storage, nil
 }
 
+// getRateLimiter returns the sending rate limiter for the account
+func (h *Handler) getRateLimiter(accountID string) (*ratelimit.Limiter, error) {
+	clients, _, err := h.getAccountClients(accountID)
+	if err != nil {
+		return nil, err
+	}
+	return clients.rateLimiter, nil
+}
+
 // getCacheManager returns the cache manager for the account
 func (h *Handler) getCacheManager(accountID string) (*storage.CacheManager, error) {
 	clients, _, err := h.getAccountClients(accountID)
@@ -144,6 +217,34 @@ func (h *Handler) getCacheManager(accountID string) (*storage.CacheManager, erro
 
 // CallTool handles MCP tool calls
 func (h *Handler) CallTool(ctx context.Context, req *protocol.CallToolRequest) (*protocol.CallToolResponse, error) {
+	if err := h.checkToolAllowed(req.Name, req.Arguments); err != nil {
+		h.recordCall(req, err)
+		return nil, err
+	}
+
+	timeout := h.getConfig().ToolTimeout(req.Name)
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	resp, err := h.dispatchTool(ctx, req)
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("%s timed out after %s (raise TOOL_TIMEOUT_SECONDS or TOOL_TIMEOUTS): %w", req.Name, timeout, err)
+	}
+	h.recordCall(req, err)
+
+	// Rate limits are reported as a structured result so clients can wait and retry
+	var limited *ratelimit.Error
+	if errors.As(err, &limited) {
+		return rateLimitedResponse(limited)
+	}
+	return resp, err
+}
+
+// dispatchTool routes a tool call to its handler
+func (h *Handler) dispatchTool(ctx context.Context, req *protocol.CallToolRequest) (*protocol.CallToolResponse, error) {
 	switch req.Name {
 	case "list_accounts":
 		return h.handleListAccounts(ctx, req.Arguments)
@@ -155,6 +256,14 @@ func (h *Handler) CallTool(ctx context.Context, req *protocol.CallToolRequest) (
 		return h.handleFetchEmail(ctx, req.Arguments)
 	case "read_email_body":
 		return h.handleReadEmailBody(ctx, req.Arguments)
+	case "analyze_email_risk":
+		return h.handleAnalyzeEmailRisk(ctx, req.Arguments)
+	case "import_public_key":
+		return h.handleImportPublicKey(ctx, req.Arguments)
+	case "list_keys":
+		return h.handleListKeys(ctx, req.Arguments)
+	case "read_attachment":
+		return h.handleReadAttachment(ctx, req.Arguments)
 	case "send_email":
 		return h.handleSendEmail(ctx, req.Arguments)
 	case "fetch_email_attachment":
@@ -173,14 +282,53 @@ func (h *Handler) CallTool(ctx context.Context, req *protocol.CallToolRequest) (
 		return h.handleDeleteDraft(ctx, req.Arguments)
 	case "send_all_drafts":
 		return h.handleSendAllDrafts(ctx, req.Arguments)
+	case "confirm_send":
+		return h.handleConfirmSend(ctx, req.Arguments)
+	case "create_template":
+		return h.handleCreateTemplate(ctx, req.Arguments)
+	case "list_templates":
+		return h.handleListTemplates(ctx, req.Arguments)
+	case "render_template":
+		return h.handleRenderTemplate(ctx, req.Arguments)
+	case "mail_merge":
+		return h.handleMailMerge(ctx, req.Arguments)
+	case "list_outbox":
+		return h.handleListOutbox(ctx, req.Arguments)
+	case "cancel_scheduled":
+		return h.handleCancelScheduled(ctx, req.Arguments)
+	case "query_audit_log":
+		return h.handleQueryAuditLog(ctx, req.Arguments)
+	case "respond_to_invite":
+		return h.handleRespondToInvite(ctx, req.Arguments)
+	case "send_invite":
+		return h.handleSendInvite(ctx, req.Arguments)
 	default:
 		return nil, fmt.Errorf("unknown tool: %s", req.Name)
 	}
 }
 
-// ListTools returns available tools
+// rateLimitedResponse builds the error result returned when a send exceeds a rate limit
+func rateLimitedResponse(limited *ratelimit.Error) (*protocol.CallToolResponse, error) {
+	details := map[string]interface{}{
+		"error":               "rate_limited",
+		"message":             limited.Error(),
+		"scope":               limited.Scope,
+		"window":              limited.Window,
+		"limit":               limited.Limit,
+		"retry_after_seconds": int(math.Ceil(limited.RetryAfter.Seconds())),
+	}
+	resp, err := jsonResponse(details)
+	if err != nil {
+		return nil, err
+	}
+	resp.IsError = true
+	resp.StructuredContent = details
+	return resp, nil
+}
+
+// ListTools returns the tools permitted by the configured modes and tool lists
 func (h *Handler) ListTools(ctx context.Context) (*protocol.ListToolsResponse, error) {
 	return &protocol.ListToolsResponse{
-		Tools: GetTools(),
+		Tools: h.permittedTools(),
 	}, nil
 }
\ No newline at end of file
@@ -0,0 +1,526 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gomcpgo/mcp/pkg/protocol"
+	"github.com/prasanthmj/email/pkg/config"
+	"github.com/prasanthmj/email/pkg/email"
+	"github.com/prasanthmj/email/pkg/storage"
+)
+
+// newTestHandler creates a handler for accounts a and b, and a second configuration that
+// changes account b, to reload while calls are running
+func newTestHandler(t *testing.T) (*Handler, [2]*config.MultiAccountConfig) {
+	t.Setenv("FILES_ROOT", t.TempDir())
+	t.Setenv("AUDIT_LOG", "true")
+	t.Setenv("DEFAULT_ACCOUNT_ID", "a")
+	for _, id := range []string{"a", "b"} {
+		t.Setenv("ACCOUNT_"+id+"_EMAIL", id+"@example.com")
+		t.Setenv("ACCOUNT_"+id+"_PASSWORD", "secret")
+	}
+
+	var cfgs [2]*config.MultiAccountConfig
+	for i := range cfgs {
+		t.Setenv("ACCOUNT_b_TIMEOUT_SECONDS", fmt.Sprint(60+i))
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			t.Fatalf("Failed to load config: %v", err)
+		}
+		cfgs[i] = cfg
+	}
+
+	h, err := NewHandler(cfgs[0])
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+	return h, cfgs
+}
+
+// callTool calls a tool and returns the text of its response
+func callTool(h *Handler, name string, args map[string]interface{}) (string, error) {
+	resp, err := h.CallTool(context.Background(), &protocol.CallToolRequest{Name: name, Arguments: args})
+	if err != nil {
+		return "", err
+	}
+	var text strings.Builder
+	for _, c := range resp.Content {
+		text.WriteString(c.Text)
+	}
+	return text.String(), nil
+}
+
+func TestConcurrentToolCalls(t *testing.T) {
+	h, cfgs := newTestHandler(t)
+
+	// A cached message lets read_email_body and analyze_email_risk run without a server
+	for _, id := range []string{"a", "b"} {
+		cache := storage.NewEmailCache(filepath.Dir(cfgs[0].Accounts[id].DraftsDir), cfgs[0].CacheMaxSize)
+		msg := &email.Email{
+			MessageID: "<cached@example.com>",
+			From:      "sender@example.org",
+			To:        []string{id + "@example.com"},
+			Subject:   "Cached",
+			Date:      time.Now(),
+			Body:      "Hello from the cache",
+		}
+		if _, err := cache.SaveEmail(context.Background(), msg, id); err != nil {
+			t.Fatalf("Failed to cache email: %v", err)
+		}
+	}
+
+	const workers = 8
+	var wg sync.WaitGroup
+	for _, account := range []string{"a", "b"} {
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func(account string, i int) {
+				defer wg.Done()
+				args := func(extra map[string]interface{}) map[string]interface{} {
+					extra["account_id"] = account
+					return extra
+				}
+
+				text, err := callTool(h, "create_draft", args(map[string]interface{}{
+					"to":      []interface{}{"client@example.org"},
+					"subject": fmt.Sprintf("Draft %d", i),
+					"body":    "Hi",
+				}))
+				if err != nil {
+					t.Errorf("create_draft failed: %v", err)
+					return
+				}
+				draftID := strings.TrimPrefix(text, "Draft saved with ID: ")
+
+				calls := []struct {
+					name string
+					args map[string]interface{}
+				}{
+					{"list_accounts", map[string]interface{}{}},
+					{"list_drafts", args(map[string]interface{}{})},
+					{"get_draft", args(map[string]interface{}{"draft_id": draftID})},
+					{"update_draft", args(map[string]interface{}{
+						"draft_id": draftID,
+						"to":       []interface{}{"client@example.org"},
+						"subject":  fmt.Sprintf("Updated %d", i),
+						"body":     "Hi again",
+					})},
+					{"create_template", args(map[string]interface{}{
+						"name":      fmt.Sprintf("template%d", i),
+						"subject":   "Hello {{.name}}",
+						"body":      "Hi {{.name}}",
+						"overwrite": true,
+					})},
+					{"list_templates", args(map[string]interface{}{})},
+					{"read_email_body", args(map[string]interface{}{"message_id": "<cached@example.com>"})},
+					{"analyze_email_risk", args(map[string]interface{}{"message_id": "<cached@example.com>"})},
+					{"list_outbox", args(map[string]interface{}{})},
+					{"query_audit_log", args(map[string]interface{}{})},
+				}
+				for _, c := range calls {
+					if _, err := callTool(h, c.name, c.args); err != nil {
+						t.Errorf("%s failed for account %s: %v", c.name, account, err)
+					}
+				}
+			}(account, i)
+		}
+	}
+
+	// Reloads drop account b's clients while its calls are running
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			if _, err := h.Reload(cfgs[(i+1)%2]); err != nil {
+				t.Errorf("Reload failed: %v", err)
+			}
+		}
+	}()
+	wg.Wait()
+
+	for _, account := range []string{"a", "b"} {
+		stor, err := h.getStorage(account)
+		if err != nil {
+			t.Fatalf("Failed to get storage: %v", err)
+		}
+		drafts, err := stor.ListDrafts()
+		if err != nil {
+			t.Fatalf("Failed to list drafts: %v", err)
+		}
+		if len(drafts) != workers {
+			t.Errorf("Expected %d drafts for account %s, got %d", workers, account, len(drafts))
+		}
+		for _, d := range drafts {
+			if !strings.HasPrefix(d.Subject, "Updated") {
+				t.Errorf("Expected draft %s to be updated, got subject %q", d.ID, d.Subject)
+			}
+		}
+	}
+}
+
+func TestConcurrentClientInitialization(t *testing.T) {
+	h, _ := newTestHandler(t)
+
+	// Every caller must get the same lazily created clients
+	const callers = 16
+	imap := make([]*email.IMAPClient, callers)
+	smtp := make([]*email.SMTPClient, callers)
+	caches := make([]*storage.EmailCache, callers)
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var err error
+			if imap[i], err = h.getIMAPClient("a"); err != nil {
+				t.Errorf("getIMAPClient failed: %v", err)
+			}
+			if smtp[i], err = h.getSMTPClient("a"); err != nil {
+				t.Errorf("getSMTPClient failed: %v", err)
+			}
+			if caches[i], err = h.getEmailCache("a"); err != nil {
+				t.Errorf("getEmailCache failed: %v", err)
+			}
+			if _, err = h.getAttachmentFetcher("a"); err != nil {
+				t.Errorf("getAttachmentFetcher failed: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 1; i < callers; i++ {
+		if imap[i] != imap[0] || smtp[i] != smtp[0] || caches[i] != caches[0] {
+			t.Fatal("Expected concurrent callers to share the account's clients")
+		}
+	}
+}
+
+// silentServer accepts connections and never answers, like a stalled mail server
+func silentServer(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	var mu sync.Mutex
+	var conns []net.Conn
+	t.Cleanup(func() {
+		listener.Close()
+		mu.Lock()
+		defer mu.Unlock()
+		for _, conn := range conns {
+			conn.Close()
+		}
+	})
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			conns = append(conns, conn)
+			mu.Unlock()
+		}
+	}()
+	return fmt.Sprint(listener.Addr().(*net.TCPAddr).Port)
+}
+
+func TestToolTimeout(t *testing.T) {
+	port := silentServer(t)
+	t.Setenv("ACCOUNT_a_IMAP_SERVER", "127.0.0.1")
+	t.Setenv("ACCOUNT_a_IMAP_PORT", port)
+	t.Setenv("ACCOUNT_a_SMTP_SERVER", "127.0.0.1")
+	t.Setenv("ACCOUNT_a_SMTP_PORT", port)
+	t.Setenv("TOOL_TIMEOUTS", "list_folders=1")
+	h, _ := newTestHandler(t)
+
+	start := time.Now()
+	_, err := callTool(h, "list_folders", map[string]interface{}{})
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "list_folders timed out after 1s") {
+		t.Errorf("Expected list_folders to time out, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("Expected the deadline to abort the connection, took %s", elapsed)
+	}
+
+	// Cancelling the call aborts it without waiting for the deadline
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	start = time.Now()
+	_, err = h.CallTool(ctx, &protocol.CallToolRequest{Name: "fetch_email", Arguments: map[string]interface{}{"message_id": "<missing@example.com>"}})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected fetch_email to be cancelled, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("Expected cancellation to abort the connection, took %s", elapsed)
+	}
+}
+
+func TestReloadPreparesStorageOnlyWhenAccepted(t *testing.T) {
+	h, cfgs := newTestHandler(t)
+
+	// A reload rejected for moving FILES_ROOT leaves the new root untouched
+	newRoot := t.TempDir()
+	t.Setenv("FILES_ROOT", newRoot)
+	moved, err := config.ReadConfig()
+	if err != nil {
+		t.Fatalf("Failed to read config: %v", err)
+	}
+	if _, err := h.Reload(moved); err == nil {
+		t.Fatal("Expected a FILES_ROOT change to be rejected")
+	}
+	if entries, _ := os.ReadDir(newRoot); len(entries) != 0 {
+		t.Errorf("Expected a rejected reload not to create account folders, found %d entries", len(entries))
+	}
+
+	// An accepted reload migrates the folder of a renamed account
+	t.Setenv("FILES_ROOT", cfgs[0].FilesRoot)
+	os.Unsetenv("ACCOUNT_b_EMAIL")
+	t.Setenv("ACCOUNT_c_EMAIL", "b@example.com")
+	t.Setenv("ACCOUNT_c_PASSWORD", "secret")
+	renamed, err := config.ReadConfig()
+	if err != nil {
+		t.Fatalf("Failed to read config: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(cfgs[0].FilesRoot, "c")); !os.IsNotExist(err) {
+		t.Fatalf("Expected ReadConfig not to create the folder of account c, got %v", err)
+	}
+	if _, err := h.Reload(renamed); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(cfgs[0].FilesRoot, "b")); !os.IsNotExist(err) {
+		t.Errorf("Expected the folder of account b to be migrated, got %v", err)
+	}
+	if _, err := os.Stat(renamed.Accounts["c"].DraftsDir); err != nil {
+		t.Errorf("Expected the folders of account c to exist: %v", err)
+	}
+}
+
+func TestReloadDoesNotRunPasswordCommands(t *testing.T) {
+	h, _ := newTestHandler(t)
+	counter := filepath.Join(t.TempDir(), "runs")
+	t.Setenv("ACCOUNT_a_PASSWORD", "")
+	t.Setenv("ACCOUNT_a_PASSWORD_CMD", fmt.Sprintf("echo run >> %s && echo secret", counter))
+	runs := func() int {
+		data, _ := os.ReadFile(counter)
+		return strings.Count(string(data), "run")
+	}
+
+	cfg, err := config.ReadConfig()
+	if err != nil {
+		t.Fatalf("Failed to read config: %v", err)
+	}
+	if _, err := h.Reload(cfg); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if _, err := h.getIMAPClient("a"); err != nil {
+		t.Fatalf("getIMAPClient failed: %v", err)
+	}
+	if _, err := cfg.Accounts["a"].EmailPassword.Value(); err != nil || runs() != 1 {
+		t.Fatalf("Expected the password command to run once, ran %d times (%v)", runs(), err)
+	}
+
+	for i := 0; i < 3; i++ {
+		next, err := config.ReadConfig()
+		if err != nil {
+			t.Fatalf("Failed to read config: %v", err)
+		}
+		result, err := h.Reload(next)
+		if err != nil || len(result.Changed) != 0 {
+			t.Fatalf("Expected an unchanged reload, got %+v (%v)", result, err)
+		}
+	}
+	if runs() != 1 {
+		t.Errorf("Expected reloads not to run the password command, ran %d times", runs())
+	}
+
+	// The kept client reads the password again on next use
+	if _, err := cfg.Accounts["a"].EmailPassword.Value(); err != nil || runs() != 2 {
+		t.Errorf("Expected the password to be read again after a reload, ran %d times (%v)", runs(), err)
+	}
+}
+
+func TestMailMergeEscapesHTMLBody(t *testing.T) {
+	h, _ := newTestHandler(t)
+	text, err := callTool(h, "mail_merge", map[string]interface{}{
+		"subject":   "Hi {{.name}}",
+		"body":      "Hi {{.name}}",
+		"html_body": `<p>Hi {{.name}}</p>`,
+		"data":      "email,name\nann@example.com,<b>x</b>\n",
+		"format":    "csv",
+		"dry_run":   true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result struct {
+		Preview struct {
+			Body     string `json:"body"`
+			HTMLBody string `json:"html_body"`
+		} `json:"preview"`
+	}
+	if err := json.Unmarshal([]byte(text), &result); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if result.Preview.HTMLBody != "<p>Hi &lt;b&gt;x&lt;/b&gt;</p>" {
+		t.Errorf("Expected dataset values to be escaped in the HTML body, got %q", result.Preview.HTMLBody)
+	}
+	if result.Preview.Body != "Hi <b>x</b>" {
+		t.Errorf("Expected the plain body to be unescaped, got %q", result.Preview.Body)
+	}
+}
+
+func TestProcessOutboxSpacing(t *testing.T) {
+	// Connections are refused, which is a temporary failure the outbox retries later
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	port := fmt.Sprint(listener.Addr().(*net.TCPAddr).Port)
+	listener.Close()
+	for _, id := range []string{"a", "b"} {
+		t.Setenv("ACCOUNT_"+id+"_SMTP_SERVER", "127.0.0.1")
+		t.Setenv("ACCOUNT_"+id+"_SMTP_PORT", port)
+	}
+	h, _ := newTestHandler(t)
+	stor, err := h.getStorage("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	attempted := func() int {
+		list, _ := stor.ListOutbox()
+		n := 0
+		for _, entry := range list {
+			n += entry.Attempts
+		}
+		return n
+	}
+
+	// Messages queued by send_all_drafts are sent one spacing apart even when all are due
+	for i := 0; i < 2; i++ {
+		if _, err := stor.EnqueueMessage(email.SendOptions{To: []string{"ann@example.com"}, Subject: "Spaced", Body: "x"}, time.Time{}, "", 30); err != nil {
+			t.Fatal(err)
+		}
+	}
+	start := time.Now()
+	next, spaced := h.processOutbox(context.Background(), "a")
+	if !spaced || next.Before(start.Add(30*time.Second)) || attempted() != 1 {
+		t.Errorf("Expected one attempt and a 30s pause, got %d attempts until %v (spaced %v)", attempted(), next, spaced)
+	}
+
+	// Without spacing, every due message is attempted and the worker is told when the
+	// earliest retry is due
+	stor, err = h.getStorage("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := stor.EnqueueMessage(email.SendOptions{To: []string{"bob@example.com"}, Subject: "Now", Body: "x"}, time.Time{}, "", 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	next, spaced = h.processOutbox(context.Background(), "b")
+	if spaced || attempted() != 2 {
+		t.Errorf("Expected both messages to be attempted, got %d attempts (spaced %v)", attempted(), spaced)
+	}
+	if due, _ := stor.NextOutboxDue(); !next.Equal(due) || !next.After(start) {
+		t.Errorf("Expected to be woken when the next retry is due (%v), got %v", due, next)
+	}
+}
+
+func TestReloadRecoversAddedAccountOutbox(t *testing.T) {
+	h, cfgs := newTestHandler(t)
+
+	// Account c was configured when an earlier run stopped while sending its message
+	stor := storage.NewStorage(filepath.Join(cfgs[0].FilesRoot, "c"), cfgs[0].CacheMaxSize)
+	if _, err := stor.EnqueueMessage(email.SendOptions{To: []string{"ann@example.com"}, Subject: "Hi", Body: "x"}, time.Time{}, "", 0); err != nil {
+		t.Fatal(err)
+	}
+	if claimed, err := stor.ClaimNextDue(time.Now()); err != nil || claimed == nil {
+		t.Fatalf("Failed to claim: %v", err)
+	}
+
+	t.Setenv("ACCOUNT_c_EMAIL", "c@example.com")
+	t.Setenv("ACCOUNT_c_PASSWORD", "secret")
+	cfg, err := config.ReadConfig()
+	if err != nil {
+		t.Fatalf("Failed to read config: %v", err)
+	}
+	if _, err := h.Reload(cfg); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	list, err := stor.ListOutbox()
+	if err != nil || len(list) != 1 || list[0].Status != storage.OutboxStatusPending {
+		t.Errorf("Expected the claimed message to be queued again, got %+v (%v)", list, err)
+	}
+}
+
+func TestConfirmTokenDelivery(t *testing.T) {
+	t.Setenv("ACCOUNT_a_POLICY_CONFIRM_EXTERNAL", "true")
+	h, _ := newTestHandler(t)
+	send := func() (map[string]interface{}, string) {
+		t.Helper()
+		stderr := os.Stderr
+		logFile, err := os.Create(filepath.Join(t.TempDir(), "stderr"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		os.Stderr = logFile
+		text, err := callTool(h, "send_email", map[string]interface{}{
+			"to": []interface{}{"ann@external.example"}, "subject": "Hi", "body": "x",
+		})
+		os.Stderr = stderr
+		logFile.Close()
+		if err != nil {
+			t.Fatalf("send_email failed: %v", err)
+		}
+		var result map[string]interface{}
+		if err := json.Unmarshal([]byte(text), &result); err != nil || result["status"] != "confirmation_required" {
+			t.Fatalf("Expected the message to be held, got %s (%v)", text, err)
+		}
+		log, _ := os.ReadFile(logFile.Name())
+		return result, string(log)
+	}
+	stor, err := h.getStorage("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// By default the token only reaches the operator, not the agent that sent the message
+	result, log := send()
+	if _, ok := result["confirm_token"]; ok {
+		t.Errorf("Expected no confirm_token in the response, got %v", result)
+	}
+	_, token, ok := strings.Cut(strings.TrimSpace(log), "confirm_token ")
+	token, _, _ = strings.Cut(token, " ")
+	if !ok || !strings.Contains(log, "ann@external.example") {
+		t.Fatalf("Expected the token on stderr, got %q", log)
+	}
+	if _, err := stor.ConsumeConfirmToken(result["draft_id"].(string), token); err != nil {
+		t.Errorf("Expected the logged token to confirm the draft: %v", err)
+	}
+
+	// Returning it to the caller is opt-in
+	t.Setenv("ACCOUNT_a_POLICY_CONFIRM_DELIVERY", "response")
+	cfg, err := config.ReadConfig()
+	if err != nil {
+		t.Fatalf("Failed to read config: %v", err)
+	}
+	if _, err := h.Reload(cfg); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	result, log = send()
+	if token, _ := result["confirm_token"].(string); token == "" || strings.Contains(log, token) {
+		t.Errorf("Expected the token only in the response, got %v and %q", result, log)
+	}
+}
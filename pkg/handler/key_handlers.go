@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gomcpgo/mcp/pkg/protocol"
+	"github.com/prasanthmj/email/pkg/email"
+)
+
+// KeysResult is returned by import_public_key and list_keys
+type KeysResult struct {
+	AccountID string         `json:"account_id"`
+	Keyring   string         `json:"keyring"`
+	Keys      []email.PGPKey `json:"keys"`
+}
+
+// handleImportPublicKey handles the import_public_key tool
+func (h *Handler) handleImportPublicKey(ctx context.Context, args map[string]interface{}) (*protocol.CallToolResponse, error) {
+	// Extract account_id
+	var accountID string
+	if id, ok := args["account_id"].(string); ok {
+		accountID = id
+	}
+
+	key, ok := args["key"].(string)
+	if !ok || key == "" {
+		return nil, fmt.Errorf("key parameter is required")
+	}
+
+	_, acctCfg, err := h.getAccountClients(accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	imported, err := email.ImportPublicKeys(acctCfg.PGP.Keyring, []byte(key))
+	if err != nil {
+		return nil, err
+	}
+
+	return jsonResponse(KeysResult{
+		AccountID: acctCfg.AccountID,
+		Keyring:   acctCfg.PGP.Keyring,
+		Keys:      imported,
+	})
+}
+
+// handleListKeys handles the list_keys tool
+func (h *Handler) handleListKeys(ctx context.Context, args map[string]interface{}) (*protocol.CallToolResponse, error) {
+	// Extract account_id
+	var accountID string
+	if id, ok := args["account_id"].(string); ok {
+		accountID = id
+	}
+
+	_, acctCfg, err := h.getAccountClients(accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := email.ListPGPKeys(acctCfg.PGP)
+	if err != nil {
+		return nil, err
+	}
+	if keys == nil {
+		keys = []email.PGPKey{}
+	}
+
+	return jsonResponse(KeysResult{
+		AccountID: acctCfg.AccountID,
+		Keyring:   acctCfg.PGP.Keyring,
+		Keys:      keys,
+	})
+}
@@ -0,0 +1,218 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/mail"
+	"path/filepath"
+
+	"github.com/gomcpgo/mcp/pkg/protocol"
+	"github.com/prasanthmj/email/pkg/securefs"
+	"github.com/prasanthmj/email/pkg/storage"
+)
+
+// handleMailMerge handles the mail_merge tool
+// Validates a CSV/JSON dataset against a template and creates one draft per row, tagged with a batch ID.
+func (h *Handler) handleMailMerge(ctx context.Context, args map[string]interface{}) (*protocol.CallToolResponse, error) {
+	// Extract account_id
+	var accountID string
+	if id, ok := args["account_id"].(string); ok {
+		accountID = id
+	}
+
+	// Get account-specific storage
+	stor, err := h.getStorage(accountID)
+	if err != nil {
+		return nil, err
+	}
+	_, acctCfg, err := h.getAccountClients(accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Use a stored template or an inline one
+	var tmpl *storage.Template
+	if name, ok := args["template"].(string); ok && name != "" {
+		tmpl, err = stor.LoadTemplate(name)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		tmpl = &storage.Template{Name: "inline"}
+		tmpl.Subject, _ = args["subject"].(string)
+		tmpl.Body, _ = args["body"].(string)
+		tmpl.HTMLBody, _ = args["html_body"].(string)
+		if tmpl.Subject == "" || (tmpl.Body == "" && tmpl.HTMLBody == "") {
+			return nil, fmt.Errorf("either 'template' or 'subject' with 'body'/'html_body' is required")
+		}
+	}
+
+	// Load the dataset inline or from a cached attachment
+	var data []byte
+	if inline, ok := args["data"].(string); ok && inline != "" {
+		data = []byte(inline)
+	} else if cacheID, ok := args["data_cache_id"].(string); ok && cacheID != "" {
+		data, err = securefs.ReadFile(filepath.Join(acctCfg.AttachmentDir, filepath.Base(cacheID)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read dataset %s: %w", cacheID, err)
+		}
+	} else {
+		return nil, fmt.Errorf("either 'data' or 'data_cache_id' is required")
+	}
+
+	format, _ := args["format"].(string)
+	rows, err := storage.ParseMergeDataset(data, format)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("dataset has no rows")
+	}
+
+	emailField := "email"
+	if field, ok := args["email_field"].(string); ok && field != "" {
+		emailField = field
+	}
+	nameField, _ := args["name_field"].(string)
+
+	var optional []string
+	if fields, ok := args["optional_fields"].([]interface{}); ok {
+		for _, f := range fields {
+			if name, ok := f.(string); ok {
+				optional = append(optional, name)
+			}
+		}
+	}
+	if nameField != "" {
+		optional = append(optional, nameField)
+	}
+
+	problems, err := tmpl.ValidateMergeRows(rows, emailField, optional)
+	if err != nil {
+		return nil, err
+	}
+	invalid := make(map[int]bool)
+	for _, p := range problems {
+		invalid[p.Row] = true
+	}
+
+	skipInvalid, _ := args["skip_invalid"].(bool)
+	dryRun, _ := args["dry_run"].(bool)
+
+	// Recipients and attachments shared by every draft
+	var cc, bcc, attachments []string
+	if list, ok := args["cc"].([]interface{}); ok {
+		for _, c := range list {
+			if addr, ok := c.(string); ok {
+				cc = append(cc, addr)
+			}
+		}
+	}
+	if list, ok := args["bcc"].([]interface{}); ok {
+		for _, b := range list {
+			if addr, ok := b.(string); ok {
+				bcc = append(bcc, addr)
+			}
+		}
+	}
+	if list, ok := args["attachments"].([]interface{}); ok {
+		for _, a := range list {
+			if cacheID, ok := a.(string); ok {
+				attachments = append(attachments, cacheID)
+			}
+		}
+	}
+
+	result := map[string]interface{}{
+		"total_rows":   len(rows),
+		"valid_rows":   len(rows) - len(problems),
+		"invalid_rows": problems,
+		"dry_run":      dryRun,
+	}
+
+	// Refuse to create a partial batch unless asked to
+	if len(problems) > 0 && !skipInvalid {
+		result["drafts_created"] = 0
+		result["message"] = "Dataset has invalid rows; fix them or set skip_invalid to create drafts for the valid rows only"
+		return jsonResponse(result)
+	}
+
+	batchID := storage.NewBatchID()
+	var draftIDs []string
+	for i, row := range rows {
+		if invalid[i+1] {
+			continue
+		}
+
+		opts, err := tmpl.Render(row)
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %w", i+1, err)
+		}
+
+		to, _ := row[emailField].(string)
+		if name, ok := row[nameField].(string); ok && name != "" {
+			if addr, err := mail.ParseAddress(to); err == nil {
+				to = (&mail.Address{Name: name, Address: addr.Address}).String()
+			}
+		}
+		opts.To = []string{to}
+		opts.CC = cc
+		opts.BCC = bcc
+		opts.Attachments = attachments
+
+		if err := parseHeaderOptions(args, &opts); err != nil {
+			return nil, err
+		}
+		if err := h.selectIdentity(accountID, &opts); err != nil {
+			return nil, err
+		}
+		if err := h.appendSignature(accountID, args, &opts); err != nil {
+			return nil, err
+		}
+
+		// Dry runs render every row but only preview the first one
+		if dryRun {
+			if _, ok := result["preview"]; !ok {
+				result["preview"] = map[string]interface{}{
+					"to":        opts.To,
+					"subject":   opts.Subject,
+					"body":      opts.Body,
+					"html_body": opts.HTMLBody,
+				}
+			}
+			continue
+		}
+
+		draftID, err := stor.SaveBatchDraft(opts, batchID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to save draft for row %d: %w", i+1, err)
+		}
+		draftIDs = append(draftIDs, draftID)
+	}
+
+	if !dryRun {
+		result["batch_id"] = batchID
+		result["draft_ids"] = draftIDs
+	}
+	result["drafts_created"] = len(draftIDs)
+
+	return jsonResponse(result)
+}
+
+// jsonResponse formats a value as an indented JSON text response
+func jsonResponse(v interface{}) (*protocol.CallToolResponse, error) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to format response: %w", err)
+	}
+
+	return &protocol.CallToolResponse{
+		Content: []protocol.ToolContent{
+			{
+				Type: "text",
+				Text: string(data),
+			},
+		},
+	}, nil
+}
@@ -0,0 +1,268 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/gomcpgo/mcp/pkg/protocol"
+	"github.com/prasanthmj/email/pkg/config"
+	"github.com/prasanthmj/email/pkg/email"
+	"github.com/prasanthmj/email/pkg/ratelimit"
+	"github.com/prasanthmj/email/pkg/storage"
+)
+
+// StartOutboxWorker delivers queued messages for all accounts in the background until ctx is cancelled.
+// It wakes when a message is queued and when the earliest queued message is due, and at
+// least once per poll interval.
+func (h *Handler) StartOutboxWorker(ctx context.Context) {
+	interval := h.getConfig().OutboxPollInterval
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+
+	// Messages claimed by a previous run that never finished go back to the queue
+	for accountID := range h.getConfig().Accounts {
+		stor, err := h.getStorage(accountID)
+		if err != nil {
+			continue
+		}
+		if err := stor.RecoverOutbox(); err != nil {
+			fmt.Fprintf(os.Stderr, "Outbox warning (%s): %v\n", accountID, err)
+		}
+	}
+
+	go func() {
+		// Accounts that sent a spaced message send nothing else until the spacing has passed
+		spacedUntil := make(map[string]time.Time)
+		timer := time.NewTimer(interval)
+		defer timer.Stop()
+		for {
+			wake := time.Now().Add(interval)
+			for accountID := range h.getConfig().Accounts {
+				if ctx.Err() != nil {
+					return
+				}
+				// Queued messages stay put while sending is disabled for the account
+				if !config.ModeAllows(h.accountMode(accountID), config.ModeFull) {
+					continue
+				}
+				next, spaced := spacedUntil[accountID], true
+				if !time.Now().Before(next) {
+					next, spaced = h.processOutbox(ctx, accountID)
+				}
+				if spaced {
+					spacedUntil[accountID] = next
+				} else {
+					delete(spacedUntil, accountID)
+				}
+				if !next.IsZero() && next.Before(wake) {
+					wake = next
+				}
+			}
+
+			timer.Reset(max(time.Until(wake), time.Second))
+			select {
+			case <-ctx.Done():
+				return
+			case <-h.outboxWake:
+			case <-timer.C:
+			}
+		}
+	}()
+}
+
+// processOutbox sends the account's messages that are due and returns when it should be
+// processed again, or the zero time if its outbox is empty. spaced is set when it stopped
+// after a message queued with spacing, and must not send before then.
+func (h *Handler) processOutbox(ctx context.Context, accountID string) (next time.Time, spaced bool) {
+	stor, err := h.getStorage(accountID)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	for {
+		entry, err := stor.ClaimNextDue(time.Now())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Outbox warning (%s): %v\n", accountID, err)
+			return time.Time{}, false
+		}
+		if entry == nil {
+			break
+		}
+		if !h.deliverOutboxEntry(ctx, accountID, stor, entry) {
+			break
+		}
+		if entry.Spacing > 0 {
+			return time.Now().Add(time.Duration(entry.Spacing) * time.Second), true
+		}
+	}
+
+	next, err = stor.NextOutboxDue()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Outbox warning (%s): %v\n", accountID, err)
+	}
+	return next, false
+}
+
+// deliverOutboxEntry sends a claimed entry and records the outcome.
+// It returns false when the account is rate limited or the worker is stopping, and the
+// account should not be tried again yet.
+func (h *Handler) deliverOutboxEntry(ctx context.Context, accountID string, stor *storage.Storage, entry *storage.OutboxEntry) bool {
+	smtpClient, err := h.getSMTPClient(accountID)
+	if err == nil {
+		err = smtpClient.SendEmail(ctx, entry.Message.SendOptions())
+	}
+
+	var limited *ratelimit.Error
+	switch {
+	case errors.As(err, &limited):
+		if err := stor.DeferOutboxEntry(entry, err, time.Now().Add(limited.RetryAfter)); err != nil {
+			fmt.Fprintf(os.Stderr, "Outbox warning (%s): %v\n", accountID, err)
+		}
+		return false
+	case err == nil:
+		err = stor.CompleteOutboxEntry(entry.ID)
+	case ctx.Err() != nil:
+		// Interrupted by shutdown, which does not count as an attempt
+		if err := stor.DeferOutboxEntry(entry, err, time.Now()); err != nil {
+			fmt.Fprintf(os.Stderr, "Outbox warning (%s): %v\n", accountID, err)
+		}
+		return false
+	case email.IsTemporarySendError(err) && entry.Attempts+1 < h.getConfig().OutboxMaxAttempts:
+		err = stor.RetryOutboxEntry(entry, err, time.Now())
+	default:
+		fmt.Fprintf(os.Stderr, "Outbox (%s): message %s moved to dead-letter queue: %v\n", accountID, entry.ID, err)
+		err = stor.DeadLetterOutboxEntry(entry, err)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Outbox warning (%s): %v\n", accountID, err)
+	}
+	return true
+}
+
+// wakeOutbox makes the worker look at the outboxes now instead of at its next poll
+func (h *Handler) wakeOutbox() {
+	select {
+	case h.outboxWake <- struct{}{}:
+	default:
+	}
+}
+
+// enqueueMessage validates a message and queues it for the background worker. After
+// sending it, the worker waits spacingSeconds before sending the account's next message.
+func (h *Handler) enqueueMessage(accountID string, opts email.SendOptions, sendAt time.Time, batchID string, spacingSeconds int) (*storage.OutboxEntry, error) {
+	smtpClient, err := h.getSMTPClient(accountID)
+	if err != nil {
+		return nil, err
+	}
+	if err := smtpClient.CheckMessage(opts); err != nil {
+		return nil, err
+	}
+
+	stor, err := h.getStorage(accountID)
+	if err != nil {
+		return nil, err
+	}
+	entry, err := stor.EnqueueMessage(opts, sendAt, batchID, spacingSeconds)
+	if err != nil {
+		return nil, fmt.Errorf("failed to queue message: %w", err)
+	}
+
+	h.wakeOutbox()
+	return entry, nil
+}
+
+// parseSendAt reads the optional send_at argument (RFC 3339, or "YYYY-MM-DD HH:MM" in local time)
+func parseSendAt(args map[string]interface{}) (time.Time, error) {
+	value, ok := args["send_at"].(string)
+	if !ok || value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02 15:04", value, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid send_at %q (use RFC 3339, e.g. 2024-05-01T09:00:00+02:00)", value)
+}
+
+// handleListOutbox handles the list_outbox tool
+func (h *Handler) handleListOutbox(ctx context.Context, args map[string]interface{}) (*protocol.CallToolResponse, error) {
+	// Extract account_id
+	var accountID string
+	if id, ok := args["account_id"].(string); ok {
+		accountID = id
+	}
+
+	// Get account-specific storage
+	stor, err := h.getStorage(accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := stor.ListOutbox()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list outbox: %w", err)
+	}
+
+	if status, ok := args["status"].(string); ok && status != "" {
+		filtered := []storage.OutboxSummary{}
+		for _, e := range entries {
+			if e.Status == status {
+				filtered = append(filtered, e)
+			}
+		}
+		entries = filtered
+	}
+
+	return jsonResponse(entries)
+}
+
+// handleCancelScheduled handles the cancel_scheduled tool
+// Removes a queued or dead-lettered message and returns it to drafts unless discard is set.
+func (h *Handler) handleCancelScheduled(ctx context.Context, args map[string]interface{}) (*protocol.CallToolResponse, error) {
+	// Extract account_id
+	var accountID string
+	if id, ok := args["account_id"].(string); ok {
+		accountID = id
+	}
+
+	outboxID, ok := args["outbox_id"].(string)
+	if !ok || outboxID == "" {
+		return nil, fmt.Errorf("outbox_id parameter is required")
+	}
+	discard, _ := args["discard"].(bool)
+
+	// Get account-specific storage
+	stor, err := h.getStorage(accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	entry, err := stor.CancelOutboxEntry(outboxID)
+	if err != nil {
+		return nil, err
+	}
+
+	text := fmt.Sprintf("Cancelled %s and discarded the message", outboxID)
+	if !discard {
+		draftID, err := stor.SaveBatchDraft(entry.Message.SendOptions(), entry.Message.BatchID)
+		if err != nil {
+			return nil, fmt.Errorf("cancelled %s but failed to restore it as a draft: %w", outboxID, err)
+		}
+		text = fmt.Sprintf("Cancelled %s. The message was returned to drafts with ID: %s", outboxID, draftID)
+	}
+
+	return &protocol.CallToolResponse{
+		Content: []protocol.ToolContent{
+			{
+				Type: "text",
+				Text: text,
+			},
+		},
+	}, nil
+}
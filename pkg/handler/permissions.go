@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"fmt"
+
+	"github.com/gomcpgo/mcp/pkg/protocol"
+	"github.com/prasanthmj/email/pkg/config"
+)
+
+// toolModes maps each tool to the least permissive mode that allows it.
+// Tools missing from the map are treated as sending tools.
+var toolModes = map[string]string{
+	// Reading mail and local state
+	"list_accounts":          config.ModeReadOnly,
+	"list_folders":           config.ModeReadOnly,
+	"fetch_email_headers":    config.ModeReadOnly,
+	"fetch_email":            config.ModeReadOnly,
+	"read_email_body":        config.ModeReadOnly,
+	"read_attachment":        config.ModeReadOnly,
+	"analyze_email_risk":     config.ModeReadOnly,
+	"list_keys":              config.ModeReadOnly,
+	"fetch_email_attachment": config.ModeReadOnly,
+	"list_drafts":            config.ModeReadOnly,
+	"get_draft":              config.ModeReadOnly,
+	"list_templates":         config.ModeReadOnly,
+	"list_outbox":            config.ModeReadOnly,
+	"query_audit_log":        config.ModeReadOnly,
+
+	// Creating and changing drafts, templates and keys
+	"create_draft":      config.ModeDraftsOnly,
+	"update_draft":      config.ModeDraftsOnly,
+	"delete_draft":      config.ModeDraftsOnly,
+	"create_template":   config.ModeDraftsOnly,
+	"render_template":   config.ModeDraftsOnly,
+	"mail_merge":        config.ModeDraftsOnly,
+	"cancel_scheduled":  config.ModeDraftsOnly,
+	"import_public_key": config.ModeDraftsOnly,
+}
+
+// requiredMode returns the mode a tool needs
+func requiredMode(tool string) string {
+	if mode, ok := toolModes[tool]; ok {
+		return mode
+	}
+	return config.ModeFull
+}
+
+// toolListed reports whether ENABLED_TOOLS and DISABLED_TOOLS permit a tool
+func (h *Handler) toolListed(tool string) bool {
+	if h.getConfig().EnabledTools != nil && !h.getConfig().EnabledTools[tool] {
+		return false
+	}
+	return !h.getConfig().DisabledTools[tool]
+}
+
+// accountMode returns the effective mode of an account, falling back to the server mode
+func (h *Handler) accountMode(accountID string) string {
+	if acct, ok := h.getConfig().Accounts[h.resolveAccountID(accountID)]; ok && acct.Mode != "" {
+		return acct.Mode
+	}
+	if h.getConfig().Mode != "" {
+		return h.getConfig().Mode
+	}
+	return config.ModeFull
+}
+
+// checkToolAllowed returns an error if the tool is disabled or the account's mode does not permit it
+func (h *Handler) checkToolAllowed(tool string, args map[string]interface{}) error {
+	if !h.toolListed(tool) {
+		return fmt.Errorf("tool %s is disabled on this server", tool)
+	}
+
+	accountID, _ := args["account_id"].(string)
+	mode := h.accountMode(accountID)
+	if !config.ModeAllows(mode, requiredMode(tool)) {
+		return fmt.Errorf("tool %s is not available: account %s is in %s mode", tool, h.resolveAccountID(accountID), mode)
+	}
+	return nil
+}
+
+// permittedTools returns the tools allowed by the tool lists and by the mode of at least one account
+func (h *Handler) permittedTools() []protocol.Tool {
+	// The most permissive account decides what is advertised; calls are checked per account
+	mode := config.ModeReadOnly
+	for id := range h.getConfig().Accounts {
+		if m := h.accountMode(id); config.ModeAllows(m, mode) {
+			mode = m
+		}
+	}
+	if len(h.getConfig().Accounts) == 0 {
+		mode = h.accountMode("")
+	}
+
+	var tools []protocol.Tool
+	for _, tool := range GetTools() {
+		if h.toolListed(tool.Name) && config.ModeAllows(mode, requiredMode(tool.Name)) {
+			tools = append(tools, tool)
+		}
+	}
+	return tools
+}
@@ -0,0 +1,134 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gomcpgo/mcp/pkg/protocol"
+	"github.com/prasanthmj/email/pkg/config"
+	"github.com/prasanthmj/email/pkg/email"
+)
+
+// heldByPolicy returns the confirmation error if the outbound policy held a message back
+func heldByPolicy(err error) *email.ConfirmationRequiredError {
+	var held *email.ConfirmationRequiredError
+	if errors.As(err, &held) {
+		return held
+	}
+	return nil
+}
+
+// holdNewMessage saves a message held by the outbound policy as a draft awaiting confirm_send
+func (h *Handler) holdNewMessage(accountID string, opts email.SendOptions, held *email.ConfirmationRequiredError) (*protocol.CallToolResponse, error) {
+	stor, err := h.getStorage(accountID)
+	if err != nil {
+		return nil, err
+	}
+	draftID, err := stor.SaveDraft(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save draft: %w", err)
+	}
+	return h.holdForConfirmation(accountID, draftID, held)
+}
+
+// holdForConfirmation issues a confirm_send token for a draft the outbound policy held back
+func (h *Handler) holdForConfirmation(accountID, draftID string, held *email.ConfirmationRequiredError) (*protocol.CallToolResponse, error) {
+	token, expiresAt, err := h.issueConfirmToken(accountID, draftID, held)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hold message for confirmation: %w", err)
+	}
+
+	result := map[string]interface{}{
+		"status":             "confirmation_required",
+		"message":            fmt.Sprintf("Not sent: %v. The message is saved as a draft; call confirm_send with the draft_id and confirm_token to send it.", held),
+		"external":           held.External,
+		"draft_id":           draftID,
+		"confirm_expires_at": expiresAt.Format(time.RFC3339),
+	}
+	if token != "" {
+		result["confirm_token"] = token
+	} else {
+		result["message"] = fmt.Sprintf("Not sent: %v. The message is saved as a draft and its confirm_token was given to the user outside this conversation. Ask the user to review the recipients; if they approve, they can provide the token for confirm_send.", held)
+	}
+	return jsonResponse(result)
+}
+
+// issueConfirmToken issues a confirm_send token for a held draft. Unless the account's
+// policy returns tokens to the caller, the token is only written to stderr for the
+// operator, so the agent that sent the message cannot confirm it by itself, and the
+// returned token is empty.
+func (h *Handler) issueConfirmToken(accountID, draftID string, held *email.ConfirmationRequiredError) (string, time.Time, error) {
+	clients, acctCfg, err := h.getAccountClients(accountID)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	token, expiresAt, err := clients.storage.IssueConfirmToken(draftID)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if acctCfg.Policy.ConfirmDelivery == config.ConfirmDeliveryResponse {
+		return token, expiresAt, nil
+	}
+	fmt.Fprintf(os.Stderr, "Confirmation required (%s): draft %s to %s; confirm_token %s (expires %s)\n",
+		acctCfg.AccountID, draftID, strings.Join(held.External, ", "), token, expiresAt.Format(time.RFC3339))
+	return "", expiresAt, nil
+}
+
+// handleConfirmSend handles the confirm_send tool
+// Sends a draft held by the outbound policy after checking its one-time confirmation token.
+func (h *Handler) handleConfirmSend(ctx context.Context, args map[string]interface{}) (*protocol.CallToolResponse, error) {
+	// Extract account_id
+	var accountID string
+	if id, ok := args["account_id"].(string); ok {
+		accountID = id
+	}
+
+	draftID, ok := args["draft_id"].(string)
+	if !ok || draftID == "" {
+		return nil, fmt.Errorf("draft_id parameter is required")
+	}
+	token, ok := args["confirm_token"].(string)
+	if !ok || token == "" {
+		return nil, fmt.Errorf("confirm_token parameter is required")
+	}
+
+	// Get account-specific storage
+	stor, err := h.getStorage(accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	draft, err := stor.ConsumeConfirmToken(draftID, token)
+	if err != nil {
+		return nil, err
+	}
+
+	smtpClient, err := h.getSMTPClient(accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	// The other policy rules still apply; only the external confirmation is satisfied
+	opts := draft.SendOptions()
+	opts.PolicyConfirmed = true
+	if err := smtpClient.SendEmail(ctx, opts); err != nil {
+		return nil, fmt.Errorf("failed to send draft: %w", err)
+	}
+
+	if err := stor.DeleteDraft(draftID); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to delete draft after sending: %v\n", err)
+	}
+
+	return &protocol.CallToolResponse{
+		Content: []protocol.ToolContent{
+			{
+				Type: "text",
+				Text: fmt.Sprintf("Confirmed draft sent successfully to %v and removed from drafts", opts.To),
+			},
+		},
+	}, nil
+}
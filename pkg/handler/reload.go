@@ -0,0 +1,165 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/prasanthmj/email/pkg/config"
+)
+
+// configPollInterval is how often the config file is checked for changes
+const configPollInterval = 5 * time.Second
+
+// ReloadResult lists the accounts affected by a reload
+type ReloadResult struct {
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+	Changed []string `json:"changed,omitempty"`
+}
+
+// Reload swaps in a new configuration. Account folders are migrated and created only once
+// the configuration is accepted, so cfg may come from config.ReadConfig. Cached clients are
+// dropped only for accounts that were removed or changed, so they are recreated with the
+// new settings on next use. Calls in flight keep the clients and settings they started with.
+func (h *Handler) Reload(cfg *config.MultiAccountConfig) (*ReloadResult, error) {
+	old := h.getConfig()
+	if cfg.FilesRoot != old.FilesRoot {
+		return nil, fmt.Errorf("FILES_ROOT cannot change while the server is running; restart it instead")
+	}
+
+	// Settings shared by all accounts' clients invalidate all of them
+	limitsChanged := !reflect.DeepEqual(cfg.GlobalRateLimits, old.GlobalRateLimits)
+	sharedChanged := limitsChanged ||
+		cfg.CacheMaxSize != old.CacheMaxSize ||
+		cfg.MaxAttachmentSize != old.MaxAttachmentSize ||
+		cfg.AuditEnabled != old.AuditEnabled ||
+		cfg.AuditMaxSize != old.AuditMaxSize ||
+		cfg.AuditMaxFiles != old.AuditMaxFiles
+
+	result := &ReloadResult{}
+	for id, acct := range cfg.Accounts {
+		prev, ok := old.Accounts[id]
+		switch {
+		case !ok:
+			result.Added = append(result.Added, id)
+		case sharedChanged || !prev.Equal(acct):
+			result.Changed = append(result.Changed, id)
+		}
+	}
+	for id := range old.Accounts {
+		if _, ok := cfg.Accounts[id]; !ok {
+			result.Removed = append(result.Removed, id)
+		}
+	}
+	sort.Strings(result.Added)
+	sort.Strings(result.Removed)
+	sort.Strings(result.Changed)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.getConfig() != old {
+		return nil, fmt.Errorf("the configuration was reloaded concurrently; try again")
+	}
+	if err := cfg.PrepareStorage(); err != nil {
+		return nil, err
+	}
+	for _, id := range result.Changed {
+		delete(h.clients, id)
+	}
+	for _, id := range result.Removed {
+		delete(h.clients, id)
+	}
+
+	// Accounts that keep their clients share one password and PGP passphrase secret
+	// across reloads. They are read again on next use, so a password rotated in a file,
+	// command or the vault takes effect.
+	for id := range h.clients {
+		prev, acct := old.Accounts[id], cfg.Accounts[id]
+		acct.EmailPassword, acct.PGP.Passphrase = prev.EmailPassword, prev.PGP.Passphrase
+		prev.EmailPassword.Reset()
+		prev.PGP.Passphrase.Reset()
+	}
+	if limitsChanged {
+		h.globalLimiter = newGlobalLimiter(cfg)
+	}
+	h.config.Store(cfg)
+
+	// Messages left claimed by a run that stopped while an added account was configured go
+	// back to its queue, as StartOutboxWorker does for the accounts present at startup
+	for _, id := range result.Added {
+		clients := h.newAccountClientsLocked(cfg, cfg.Accounts[id])
+		if err := clients.storage.RecoverOutbox(); err != nil {
+			fmt.Fprintf(os.Stderr, "Outbox warning (%s): %v\n", id, err)
+		}
+	}
+	if len(result.Added) > 0 {
+		h.wakeOutbox()
+	}
+	return result, nil
+}
+
+// StartConfigWatcher reloads the configuration with load on SIGHUP and, when it was read
+// from a file, whenever the file changes. Failed reloads keep the current configuration.
+func (h *Handler) StartConfigWatcher(ctx context.Context, load func() (*config.MultiAccountConfig, error)) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	path := h.getConfig().ConfigFile
+	modTime := fileModTime(path)
+
+	go func() {
+		defer signal.Stop(hup)
+		ticker := time.NewTicker(configPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+			case <-ticker.C:
+				if path == "" {
+					continue
+				}
+				current := fileModTime(path)
+				if current.Equal(modTime) {
+					continue
+				}
+				modTime = current
+			}
+			h.reloadFrom(load)
+		}
+	}()
+}
+
+// reloadFrom loads and applies a new configuration, reporting the outcome on stderr
+func (h *Handler) reloadFrom(load func() (*config.MultiAccountConfig, error)) {
+	cfg, err := load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Config reload failed, keeping the current configuration: %v\n", err)
+		return
+	}
+	result, err := h.Reload(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Config reload failed, keeping the current configuration: %v\n", err)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Config reloaded (added: %v, removed: %v, changed: %v)\n", result.Added, result.Removed, result.Changed)
+}
+
+// fileModTime returns the modification time of path, or the zero time if it cannot be read
+func fileModTime(path string) time.Time {
+	if path == "" {
+		return time.Time{}
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
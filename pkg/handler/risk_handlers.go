@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gomcpgo/mcp/pkg/protocol"
+	"github.com/prasanthmj/email/pkg/email"
+)
+
+// RiskResult is returned by analyze_email_risk
+type RiskResult struct {
+	MessageID string `json:"message_id"`
+	*email.RiskReport
+	SenderTrust email.SenderTrust `json:"sender_trust"`
+}
+
+// handleAnalyzeEmailRisk handles the analyze_email_risk tool
+func (h *Handler) handleAnalyzeEmailRisk(ctx context.Context, args map[string]interface{}) (*protocol.CallToolResponse, error) {
+	// Extract account_id
+	var accountID string
+	if id, ok := args["account_id"].(string); ok {
+		accountID = id
+	}
+
+	messageID, ok := args["message_id"].(string)
+	if !ok || messageID == "" {
+		return nil, fmt.Errorf("message_id parameter is required")
+	}
+
+	_, acctCfg, err := h.getAccountClients(accountID)
+	if err != nil {
+		return nil, err
+	}
+	emailCache, err := h.getEmailCache(accountID)
+	if err != nil {
+		return nil, err
+	}
+	if !emailCache.IsCached(messageID) {
+		return nil, fmt.Errorf("email not in cache. Call fetch_email first with message_id: %s", messageID)
+	}
+
+	// Internal domains default to the account and identity domains
+	report, err := emailCache.AnalyzeRisk(messageID, acctCfg.Policy.InternalDomains)
+	if err != nil {
+		return nil, fmt.Errorf("failed to analyze email: %w", err)
+	}
+	metadata, err := emailCache.LoadMetadata(messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	return jsonResponse(RiskResult{
+		MessageID:   messageID,
+		RiskReport:  report,
+		SenderTrust: metadata.Authentication.Trust(),
+	})
+}
@@ -0,0 +1,225 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/gomcpgo/mcp/pkg/protocol"
+	"github.com/prasanthmj/email/pkg/storage"
+)
+
+// handleCreateTemplate handles the create_template tool
+func (h *Handler) handleCreateTemplate(ctx context.Context, args map[string]interface{}) (*protocol.CallToolResponse, error) {
+	// Extract account_id
+	var accountID string
+	if id, ok := args["account_id"].(string); ok {
+		accountID = id
+	}
+
+	tmpl := storage.Template{}
+	if name, ok := args["name"].(string); ok {
+		tmpl.Name = name
+	}
+	if tmpl.Name == "" {
+		return nil, fmt.Errorf("name parameter is required")
+	}
+	if description, ok := args["description"].(string); ok {
+		tmpl.Description = description
+	}
+	if subject, ok := args["subject"].(string); ok {
+		tmpl.Subject = subject
+	}
+	if body, ok := args["body"].(string); ok {
+		tmpl.Body = body
+	}
+	if htmlBody, ok := args["html_body"].(string); ok {
+		tmpl.HTMLBody = htmlBody
+	}
+	overwrite, _ := args["overwrite"].(bool)
+
+	// Get account-specific storage
+	stor, err := h.getStorage(accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := stor.SaveTemplate(tmpl, overwrite); err != nil {
+		return nil, fmt.Errorf("failed to save template: %w", err)
+	}
+
+	variables, _ := tmpl.Variables()
+	return &protocol.CallToolResponse{
+		Content: []protocol.ToolContent{
+			{
+				Type: "text",
+				Text: fmt.Sprintf("Template %s saved. Variables: %v", tmpl.Name, variables),
+			},
+		},
+	}, nil
+}
+
+// handleListTemplates handles the list_templates tool
+func (h *Handler) handleListTemplates(ctx context.Context, args map[string]interface{}) (*protocol.CallToolResponse, error) {
+	// Extract account_id
+	var accountID string
+	if id, ok := args["account_id"].(string); ok {
+		accountID = id
+	}
+
+	// Get account-specific storage
+	stor, err := h.getStorage(accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	templates, err := stor.ListTemplates()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list templates: %w", err)
+	}
+
+	// Convert to JSON for response
+	data, err := json.MarshalIndent(templates, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to format response: %w", err)
+	}
+
+	return &protocol.CallToolResponse{
+		Content: []protocol.ToolContent{
+			{
+				Type: "text",
+				Text: string(data),
+			},
+		},
+	}, nil
+}
+
+// handleRenderTemplate handles the render_template tool
+// Renders a stored template and either returns a preview or saves it as a draft.
+func (h *Handler) handleRenderTemplate(ctx context.Context, args map[string]interface{}) (*protocol.CallToolResponse, error) {
+	// Extract account_id
+	var accountID string
+	if id, ok := args["account_id"].(string); ok {
+		accountID = id
+	}
+
+	name, ok := args["name"].(string)
+	if !ok || name == "" {
+		return nil, fmt.Errorf("name parameter is required")
+	}
+
+	var variables map[string]interface{}
+	if raw, ok := args["variables"]; ok {
+		variables, ok = raw.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("variables must be an object")
+		}
+	}
+
+	// Get account-specific storage
+	stor, err := h.getStorage(accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl, err := stor.LoadTemplate(name)
+	if err != nil {
+		return nil, err
+	}
+
+	opts, err := tmpl.Render(variables)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse recipients
+	if to, ok := args["to"].([]interface{}); ok {
+		for _, t := range to {
+			if addr, ok := t.(string); ok {
+				opts.To = append(opts.To, addr)
+			}
+		}
+	}
+
+	if cc, ok := args["cc"].([]interface{}); ok {
+		for _, c := range cc {
+			if addr, ok := c.(string); ok {
+				opts.CC = append(opts.CC, addr)
+			}
+		}
+	}
+
+	if bcc, ok := args["bcc"].([]interface{}); ok {
+		for _, b := range bcc {
+			if addr, ok := b.(string); ok {
+				opts.BCC = append(opts.BCC, addr)
+			}
+		}
+	}
+
+	// Parse attachments
+	if attachments, ok := args["attachments"].([]interface{}); ok {
+		for _, a := range attachments {
+			if cacheID, ok := a.(string); ok {
+				opts.Attachments = append(opts.Attachments, cacheID)
+			}
+		}
+	}
+
+	// Parse threading parameters
+	if replyTo, ok := args["reply_to_message_id"].(string); ok {
+		opts.ReplyToMessageID = replyTo
+	}
+
+	// Parse sender and extra header options
+	if err := parseHeaderOptions(args, &opts); err != nil {
+		return nil, err
+	}
+	if err := h.selectIdentity(accountID, &opts); err != nil {
+		return nil, err
+	}
+
+	// Without create_draft the rendered content is only previewed
+	if createDraft, _ := args["create_draft"].(bool); !createDraft {
+		data, err := json.MarshalIndent(map[string]interface{}{
+			"template":  tmpl.Name,
+			"to":        opts.To,
+			"cc":        opts.CC,
+			"subject":   opts.Subject,
+			"body":      opts.Body,
+			"html_body": opts.HTMLBody,
+		}, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to format response: %w", err)
+		}
+		return &protocol.CallToolResponse{
+			Content: []protocol.ToolContent{
+				{
+					Type: "text",
+					Text: string(data),
+				},
+			},
+		}, nil
+	}
+
+	if len(opts.To) == 0 {
+		return nil, fmt.Errorf("at least one 'to' recipient is required to create a draft")
+	}
+	if err := h.appendSignature(accountID, args, &opts); err != nil {
+		return nil, err
+	}
+
+	draftID, err := stor.SaveDraft(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save draft: %w", err)
+	}
+
+	return &protocol.CallToolResponse{
+		Content: []protocol.ToolContent{
+			{
+				Type: "text",
+				Text: fmt.Sprintf("Template %s rendered. Draft saved with ID: %s", tmpl.Name, draftID),
+			},
+		},
+	}, nil
+}
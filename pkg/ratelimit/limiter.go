@@ -0,0 +1,252 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/prasanthmj/email/pkg/config"
+	"github.com/prasanthmj/email/pkg/securefs"
+	"gopkg.in/yaml.v3"
+)
+
+// Window names used in quotas and errors
+const (
+	WindowMinute = "minute"
+	WindowHour   = "hour"
+	WindowDay    = "day"
+)
+
+// Error is returned when a send would exceed a limit
+type Error struct {
+	Scope      string        // Account ID, or "global"
+	Window     string        // minute, hour or day
+	Limit      int           // Messages allowed per window
+	RetryAfter time.Duration // Time until a message can be sent
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("rate limited: %s limit of %d messages per %s reached, retry after %ds",
+		e.Scope, e.Limit, e.Window, int(math.Ceil(e.RetryAfter.Seconds())))
+}
+
+// WindowQuota is the remaining capacity of one window
+type WindowQuota struct {
+	Limit     int `json:"limit"`
+	Remaining int `json:"remaining"`
+}
+
+// Quota summarizes the limits and usage of a limiter
+type Quota struct {
+	PerMinute *WindowQuota `json:"per_minute,omitempty"`
+	PerHour   *WindowQuota `json:"per_hour,omitempty"`
+	PerDay    *WindowQuota `json:"per_day,omitempty"`
+	SentToday int          `json:"sent_today"`
+	SentTotal int          `json:"sent_total"`
+}
+
+// bucket is a token bucket refilled continuously at limit tokens per window
+type bucket struct {
+	Tokens    float64   `yaml:"tokens"`
+	UpdatedAt time.Time `yaml:"updated_at"`
+}
+
+// state is the persisted limiter state
+type state struct {
+	Buckets   map[string]*bucket `yaml:"buckets"`
+	Day       string             `yaml:"day"`
+	SentToday int                `yaml:"sent_today"`
+	SentTotal int                `yaml:"sent_total"`
+}
+
+// Limiter throttles outgoing messages with token buckets per minute, hour and day.
+// State is persisted to a YAML file so counts survive restarts.
+type Limiter struct {
+	mu     sync.Mutex
+	scope  string
+	path   string
+	limits config.RateLimits
+	parent *Limiter // Shared global limiter, checked in addition to this one
+	state  state
+}
+
+// New creates a limiter for scope, loading any state persisted at path.
+// A parent limiter, if given, must also allow each message.
+func New(scope, path string, limits config.RateLimits, parent *Limiter) *Limiter {
+	l := &Limiter{
+		scope:  scope,
+		path:   path,
+		limits: limits,
+		parent: parent,
+	}
+
+	if data, err := securefs.ReadFile(path); err == nil {
+		if err := yaml.Unmarshal(data, &l.state); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: ignoring invalid rate limit state %s: %v\n", path, err)
+			l.state = state{}
+		}
+	}
+	if l.state.Buckets == nil {
+		l.state.Buckets = make(map[string]*bucket)
+	}
+	return l
+}
+
+// window is one rate limit period
+type window struct {
+	name   string
+	limit  int
+	period time.Duration
+}
+
+// windows returns the windows with their limits and durations
+func (l *Limiter) windows() []window {
+	return []window{
+		{WindowMinute, l.limits.PerMinute, time.Minute},
+		{WindowHour, l.limits.PerHour, time.Hour},
+		{WindowDay, l.limits.PerDay, 24 * time.Hour},
+	}
+}
+
+// refill brings every bucket up to date and returns them by window name
+func (l *Limiter) refill(now time.Time) map[string]*bucket {
+	for _, w := range l.windows() {
+		if w.limit <= 0 {
+			delete(l.state.Buckets, w.name)
+			continue
+		}
+		b, ok := l.state.Buckets[w.name]
+		if !ok {
+			b = &bucket{Tokens: float64(w.limit), UpdatedAt: now}
+			l.state.Buckets[w.name] = b
+		}
+		if elapsed := now.Sub(b.UpdatedAt); elapsed > 0 {
+			b.Tokens += elapsed.Seconds() * float64(w.limit) / w.period.Seconds()
+		}
+		b.Tokens = math.Min(b.Tokens, float64(w.limit))
+		b.UpdatedAt = now
+	}
+	if day := now.Format("2006-01-02"); day != l.state.Day {
+		l.state.Day = day
+		l.state.SentToday = 0
+	}
+	return l.state.Buckets
+}
+
+// check returns an error if any window has no token left
+func (l *Limiter) check(now time.Time) error {
+	buckets := l.refill(now)
+	var limited *Error
+	for _, w := range l.windows() {
+		b, ok := buckets[w.name]
+		if !ok || b.Tokens >= 1 {
+			continue
+		}
+		wait := time.Duration((1 - b.Tokens) * w.period.Seconds() / float64(w.limit) * float64(time.Second))
+		if limited == nil || wait > limited.RetryAfter {
+			limited = &Error{Scope: l.scope, Window: w.name, Limit: w.limit, RetryAfter: wait}
+		}
+	}
+	if limited != nil {
+		return limited
+	}
+	return nil
+}
+
+// consume takes n tokens from every window and records the sends (negative n refunds)
+func (l *Limiter) consume(n int) {
+	for _, b := range l.state.Buckets {
+		b.Tokens -= float64(n)
+	}
+	l.state.SentToday += n
+	l.state.SentTotal += n
+	if l.state.SentToday < 0 {
+		l.state.SentToday = 0
+	}
+	if l.state.SentTotal < 0 {
+		l.state.SentTotal = 0
+	}
+	l.save()
+}
+
+// save persists the state, logging rather than failing sends on write errors
+func (l *Limiter) save() {
+	data, err := yaml.Marshal(&l.state)
+	if err == nil {
+		if err = securefs.MkdirAll(filepath.Dir(l.path)); err == nil {
+			tmpPath := l.path + ".tmp"
+			if err = securefs.WriteFile(tmpPath, data); err == nil {
+				err = os.Rename(tmpPath, l.path)
+			}
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to save rate limit state: %v\n", err)
+	}
+}
+
+// Take reserves capacity for one message, or returns an *Error with the time to wait
+func (l *Limiter) Take(now time.Time) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.check(now); err != nil {
+		return err
+	}
+	if l.parent != nil {
+		l.parent.mu.Lock()
+		defer l.parent.mu.Unlock()
+		if err := l.parent.check(now); err != nil {
+			return err
+		}
+		l.parent.consume(1)
+	}
+	l.consume(1)
+	return nil
+}
+
+// Refund returns the capacity reserved by Take when the message was not sent
+func (l *Limiter) Refund(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.refill(now)
+	l.consume(-1)
+	if l.parent != nil {
+		l.parent.mu.Lock()
+		defer l.parent.mu.Unlock()
+		l.parent.refill(now)
+		l.parent.consume(-1)
+	}
+}
+
+// Quota returns the remaining capacity in each configured window
+func (l *Limiter) Quota(now time.Time) Quota {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	buckets := l.refill(now)
+	quota := Quota{
+		SentToday: l.state.SentToday,
+		SentTotal: l.state.SentTotal,
+	}
+	for _, w := range l.windows() {
+		b, ok := buckets[w.name]
+		if !ok {
+			continue
+		}
+		wq := &WindowQuota{Limit: w.limit, Remaining: int(math.Max(0, math.Floor(b.Tokens)))}
+		switch w.name {
+		case WindowMinute:
+			quota.PerMinute = wq
+		case WindowHour:
+			quota.PerHour = wq
+		case WindowDay:
+			quota.PerDay = wq
+		}
+	}
+	return quota
+}
@@ -0,0 +1,89 @@
+package ratelimit
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prasanthmj/email/pkg/config"
+)
+
+func TestLimiterTakeAndRefill(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ratelimit.yaml")
+	l := New("work", path, config.RateLimits{PerMinute: 2, PerDay: 10}, nil)
+	now := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 2; i++ {
+		if err := l.Take(now); err != nil {
+			t.Fatalf("Take %d failed: %v", i+1, err)
+		}
+	}
+
+	err := l.Take(now)
+	var limited *Error
+	if !errors.As(err, &limited) {
+		t.Fatalf("Expected rate limit error, got %v", err)
+	}
+	if limited.Scope != "work" || limited.Window != WindowMinute || limited.Limit != 2 {
+		t.Errorf("Unexpected error details: %+v", limited)
+	}
+	if limited.RetryAfter != 30*time.Second {
+		t.Errorf("Expected retry after 30s, got %v", limited.RetryAfter)
+	}
+
+	// Half a minute refills one token
+	if err := l.Take(now.Add(30 * time.Second)); err != nil {
+		t.Errorf("Expected token after refill, got %v", err)
+	}
+
+	quota := l.Quota(now.Add(30 * time.Second))
+	if quota.PerMinute == nil || quota.PerMinute.Remaining != 0 || quota.PerHour != nil {
+		t.Errorf("Unexpected quota: %+v", quota)
+	}
+	if quota.PerDay == nil || quota.PerDay.Remaining != 7 || quota.SentToday != 3 {
+		t.Errorf("Unexpected daily quota: %+v, sent today %d", quota.PerDay, quota.SentToday)
+	}
+}
+
+func TestLimiterPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ratelimit.yaml")
+	limits := config.RateLimits{PerHour: 3}
+	now := time.Now()
+
+	l := New("work", path, limits, nil)
+	l.Take(now)
+	l.Take(now)
+	l.Take(now)
+	l.Refund(now)
+
+	// A new limiter (e.g. after a restart) continues from the saved state
+	restarted := New("work", path, limits, nil)
+	quota := restarted.Quota(now)
+	if quota.SentToday != 2 || quota.SentTotal != 2 {
+		t.Errorf("Expected 2 sends after refund, got %+v", quota)
+	}
+	if quota.PerHour.Remaining != 1 {
+		t.Errorf("Expected 1 remaining, got %d", quota.PerHour.Remaining)
+	}
+}
+
+func TestLimiterGlobalParent(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	global := New("global", filepath.Join(dir, "global.yaml"), config.RateLimits{PerMinute: 1}, nil)
+	work := New("work", filepath.Join(dir, "work.yaml"), config.RateLimits{}, global)
+	home := New("home", filepath.Join(dir, "home.yaml"), config.RateLimits{}, global)
+
+	if err := work.Take(now); err != nil {
+		t.Fatalf("First send failed: %v", err)
+	}
+	err := home.Take(now)
+	var limited *Error
+	if !errors.As(err, &limited) || limited.Scope != "global" {
+		t.Fatalf("Expected global rate limit, got %v", err)
+	}
+	if quota := home.Quota(now); quota.SentToday != 0 {
+		t.Errorf("Rejected send should not be counted, got %d", quota.SentToday)
+	}
+}
@@ -0,0 +1,206 @@
+package securefs
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// checkFile records which key encrypted a store
+const checkFile = ".encryption-check"
+
+// checkText is the content of the check file
+const checkText = "email-mcp encrypted store"
+
+// CheckKey verifies that the key matches the store under root, recording it on first use.
+// Without a key it fails if the store has been encrypted.
+func CheckKey(root string) error {
+	path := filepath.Join(root, checkFile)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		if !Encrypting() {
+			return nil
+		}
+		if err := MkdirAll(root); err != nil {
+			return fmt.Errorf("failed to create %s: %w", root, err)
+		}
+		return WriteFile(path, []byte(checkText))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	if !Encrypting() {
+		return fmt.Errorf("%s is encrypted: set FILES_ENCRYPTION_KEY, FILES_ENCRYPTION_KEY_FILE or FILES_ENCRYPTION_KEY_CMD", root)
+	}
+	if plain, err := Open(data); err != nil || string(plain) != checkText {
+		return fmt.Errorf("the encryption key does not match the key %s was encrypted with", root)
+	}
+	return nil
+}
+
+// UseKey checks k against the store under root and makes it the key for all reads and
+// writes. Once a key is in use it cannot be replaced, so reloading the configuration with
+// a different key fails instead of leaving files unreadable.
+func UseKey(root string, k []byte) error {
+	mu.Lock()
+	if used {
+		same := bytes.Equal(key, k)
+		mu.Unlock()
+		if !same {
+			return fmt.Errorf("the encryption key cannot change while the server is running; restart it instead")
+		}
+		return nil
+	}
+	mu.Unlock()
+
+	// Verify against the check file before switching keys
+	if k != nil {
+		gcm, err := newAEAD(k)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(filepath.Join(root, checkFile))
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to read %s: %w", checkFile, err)
+		}
+		if err == nil {
+			if !IsEncrypted(data) {
+				return fmt.Errorf("invalid %s in %s", checkFile, root)
+			}
+			if plain, err := open(gcm, data); err != nil || string(plain) != checkText {
+				return fmt.Errorf("the encryption key does not match the key %s was encrypted with", root)
+			}
+		}
+	}
+
+	if err := SetKey(k); err != nil {
+		return err
+	}
+	if err := CheckKey(root); err != nil {
+		SetKey(nil)
+		return err
+	}
+	mu.Lock()
+	used = true
+	mu.Unlock()
+	return nil
+}
+
+// MigrationResult counts the files changed by Migrate
+type MigrationResult struct {
+	Encrypted int `json:"encrypted"` // Plaintext files that were encrypted
+	Skipped   int `json:"skipped"`   // Files that were already encrypted
+	Chmodded  int `json:"chmodded"`  // Files and directories whose permissions were tightened
+}
+
+// Migrate encrypts every plaintext file under root with the current key and tightens
+// permissions to 0600/0700. Without a key only permissions are changed. Line-oriented
+// logs (*.jsonl) are encrypted line by line so they can still be appended to.
+func Migrate(root string) (*MigrationResult, error) {
+	if err := CheckKey(root); err != nil {
+		return nil, err
+	}
+	result := &MigrationResult{}
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if info.Mode().Perm() != DirMode {
+				if err := os.Chmod(path, DirMode); err != nil {
+					return err
+				}
+				result.Chmodded++
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		if info.Mode().Perm() != FileMode {
+			if err := os.Chmod(path, FileMode); err != nil {
+				return err
+			}
+			result.Chmodded++
+		}
+		if !Encrypting() || d.Name() == checkFile {
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var sealed []byte
+		if isLineFile(d.Name()) {
+			sealed, err = sealLines(data)
+		} else if IsEncrypted(data) {
+			result.Skipped++
+			return nil
+		} else {
+			sealed, err = Seal(data)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to encrypt %s: %w", path, err)
+		}
+		if sealed == nil {
+			result.Skipped++
+			return nil
+		}
+
+		// Replace the file atomically so an interrupted migration leaves it readable
+		tmpPath := path + ".encrypting"
+		if err := os.WriteFile(tmpPath, sealed, FileMode); err != nil {
+			return err
+		}
+		if err := os.Rename(tmpPath, path); err != nil {
+			os.Remove(tmpPath)
+			return err
+		}
+		result.Encrypted++
+		return nil
+	})
+	if err != nil {
+		return result, fmt.Errorf("failed to migrate %s: %w", root, err)
+	}
+	return result, nil
+}
+
+// isLineFile reports whether a file is an append-only log, including rotated ones
+func isLineFile(name string) bool {
+	return strings.HasSuffix(name, ".jsonl") || strings.Contains(name, ".jsonl.")
+}
+
+// sealLines encrypts the plaintext lines of a log. It returns nil if all lines are
+// already encrypted.
+func sealLines(data []byte) ([]byte, error) {
+	var out bytes.Buffer
+	changed := false
+	for _, line := range bytes.SplitAfter(data, []byte("\n")) {
+		content := bytes.TrimSuffix(line, []byte("\n"))
+		if len(content) == 0 || bytes.HasPrefix(content, []byte(linePrefix)) {
+			out.Write(line)
+			continue
+		}
+		sealed, err := SealLine(content)
+		if err != nil {
+			return nil, err
+		}
+		out.Write(sealed)
+		out.WriteByte('\n')
+		changed = true
+	}
+	if !changed {
+		return nil, nil
+	}
+	return out.Bytes(), nil
+}
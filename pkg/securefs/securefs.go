@@ -0,0 +1,220 @@
+// Package securefs reads and writes the server's files with owner-only permissions
+// and, when a key is set, AES-256-GCM encryption at rest.
+package securefs
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Permissions of files and directories created by the server
+const (
+	FileMode os.FileMode = 0600
+	DirMode  os.FileMode = 0700
+)
+
+// KeySize is the length of an encryption key (AES-256)
+const KeySize = 32
+
+// magic starts every encrypted file, followed by the nonce and the sealed content
+var magic = []byte("EMCPENC1")
+
+// linePrefix marks an encrypted line of a line-oriented file such as the audit log
+const linePrefix = "enc1:"
+
+// ErrNoKey is returned when reading an encrypted file without a key
+var ErrNoKey = errors.New("file is encrypted but no FILES_ENCRYPTION_KEY is configured")
+
+var (
+	mu   sync.RWMutex
+	aead cipher.AEAD
+	key  []byte // The key behind aead
+	used bool   // Set by UseKey, which refuses to change the key afterwards
+)
+
+// SetKey enables encryption of everything written from now on. A nil key disables it;
+// encrypted files then can no longer be read.
+func SetKey(k []byte) error {
+	mu.Lock()
+	defer mu.Unlock()
+	used = false
+	if k == nil {
+		aead, key = nil, nil
+		return nil
+	}
+	gcm, err := newAEAD(k)
+	if err != nil {
+		return err
+	}
+	aead, key = gcm, bytes.Clone(k)
+	return nil
+}
+
+// newAEAD creates an AES-256-GCM cipher for key
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("encryption key must be %d bytes, got %d", KeySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Encrypting reports whether a key is set
+func Encrypting() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return aead != nil
+}
+
+// IsEncrypted reports whether data was produced by Seal
+func IsEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, magic)
+}
+
+// Seal encrypts data if a key is set and returns it unchanged otherwise
+func Seal(data []byte) ([]byte, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+	if aead == nil {
+		return data, nil
+	}
+	return seal(aead, data)
+}
+
+// Open decrypts data produced by Seal. Plaintext data is returned unchanged, so stores
+// written before encryption was enabled stay readable until they are migrated.
+func Open(data []byte) ([]byte, error) {
+	if !IsEncrypted(data) {
+		return data, nil
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	if aead == nil {
+		return nil, ErrNoKey
+	}
+	return open(aead, data)
+}
+
+// SealWith encrypts data with key instead of the store key
+func SealWith(key, data []byte) ([]byte, error) {
+	gcm, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return seal(gcm, data)
+}
+
+// OpenWith decrypts data produced by SealWith. Unlike Open it rejects plaintext.
+func OpenWith(key, data []byte) ([]byte, error) {
+	if !IsEncrypted(data) {
+		return nil, fmt.Errorf("data is not encrypted")
+	}
+	gcm, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return open(gcm, data)
+}
+
+// seal prefixes the magic and a random nonce to the sealed data
+func seal(gcm cipher.AEAD, data []byte) ([]byte, error) {
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	out := make([]byte, 0, len(magic)+len(nonce)+len(data)+gcm.Overhead())
+	out = append(out, magic...)
+	out = append(out, nonce...)
+	return gcm.Seal(out, nonce, data, magic), nil
+}
+
+// open reverses seal
+func open(gcm cipher.AEAD, data []byte) ([]byte, error) {
+	rest := data[len(magic):]
+	if len(rest) < gcm.NonceSize() {
+		return nil, fmt.Errorf("encrypted file is truncated")
+	}
+	plain, err := gcm.Open(nil, rest[:gcm.NonceSize()], rest[gcm.NonceSize():], magic)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt file (wrong key or corrupted data): %w", err)
+	}
+	return plain, nil
+}
+
+// SealLine encrypts one line of a line-oriented file. The result contains no newlines.
+func SealLine(line []byte) ([]byte, error) {
+	if !Encrypting() {
+		return line, nil
+	}
+	sealed, err := Seal(line)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(linePrefix + base64.StdEncoding.EncodeToString(sealed)), nil
+}
+
+// OpenLine decrypts a line written by SealLine; plaintext lines are returned unchanged
+func OpenLine(line []byte) ([]byte, error) {
+	if !bytes.HasPrefix(line, []byte(linePrefix)) {
+		return line, nil
+	}
+	sealed, err := base64.StdEncoding.DecodeString(string(line[len(linePrefix):]))
+	if err != nil {
+		return nil, fmt.Errorf("invalid encrypted line: %w", err)
+	}
+	return Open(sealed)
+}
+
+// WriteFile writes data with owner-only permissions, encrypted if a key is set
+func WriteFile(path string, data []byte) error {
+	sealed, err := Seal(data)
+	if err != nil {
+		return err
+	}
+	// Write to a temporary file and rename it so concurrent readers never see a partial file
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(sealed); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), FileMode); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// ReadFile reads a file written by WriteFile, or a plaintext file
+func ReadFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := Open(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	return plain, nil
+}
+
+// MkdirAll creates a directory and its parents with owner-only permissions
+func MkdirAll(path string) error {
+	return os.MkdirAll(path, DirMode)
+}
@@ -0,0 +1,157 @@
+package securefs
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// useKey sets a test key and disables encryption again when the test ends
+func useKey(t *testing.T, b byte) {
+	t.Helper()
+	if err := SetKey(bytes.Repeat([]byte{b}, KeySize)); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { SetKey(nil) })
+}
+
+func TestReadWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "data.json")
+
+	// Without a key files are plaintext with owner-only permissions
+	if err := WriteFile(path, []byte("plain")); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != FileMode {
+		t.Errorf("Expected mode %v, got %v", FileMode, info.Mode().Perm())
+	}
+
+	useKey(t, 1)
+	if data, err := ReadFile(path); err != nil || string(data) != "plain" {
+		t.Errorf("Expected plaintext files to stay readable, got %q (%v)", data, err)
+	}
+
+	if err := WriteFile(path, []byte("secret content")); err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := os.ReadFile(path)
+	if !IsEncrypted(raw) || bytes.Contains(raw, []byte("secret")) {
+		t.Fatalf("Expected the file to be encrypted, got %q", raw)
+	}
+	if data, err := ReadFile(path); err != nil || string(data) != "secret content" {
+		t.Errorf("Expected the decrypted content, got %q (%v)", data, err)
+	}
+
+	useKey(t, 2)
+	if _, err := ReadFile(path); err == nil {
+		t.Error("Expected a wrong key to fail")
+	}
+	SetKey(nil)
+	if _, err := ReadFile(path); err == nil || !strings.Contains(err.Error(), "no FILES_ENCRYPTION_KEY") {
+		t.Errorf("Expected ErrNoKey, got %v", err)
+	}
+	if _, err := ReadFile(filepath.Join(dir, "missing")); !os.IsNotExist(err) {
+		t.Errorf("Expected a not-exist error, got %v", err)
+	}
+}
+
+func TestSealLine(t *testing.T) {
+	useKey(t, 1)
+	line, err := SealLine([]byte(`{"event":"send"}`))
+	if err != nil || bytes.ContainsAny(line, "\n{") || !strings.HasPrefix(string(line), linePrefix) {
+		t.Fatalf("Expected a single encrypted line, got %q (%v)", line, err)
+	}
+	if plain, err := OpenLine(line); err != nil || string(plain) != `{"event":"send"}` {
+		t.Errorf("Expected the original line, got %q (%v)", plain, err)
+	}
+	if plain, _ := OpenLine([]byte(`{"old":true}`)); string(plain) != `{"old":true}` {
+		t.Errorf("Expected plaintext lines to pass through, got %q", plain)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	root := t.TempDir()
+	account := filepath.Join(root, "work")
+	os.MkdirAll(filepath.Join(account, "drafts"), 0755)
+	os.WriteFile(filepath.Join(account, "drafts", "d1.json"), []byte(`{"subject":"hi"}`), 0644)
+	os.WriteFile(filepath.Join(account, "audit.jsonl"), []byte("{\"n\":1}\n{\"n\":2}\n"), 0644)
+
+	useKey(t, 1)
+	result, err := Migrate(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Encrypted != 2 || result.Chmodded == 0 {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+
+	raw, _ := os.ReadFile(filepath.Join(account, "drafts", "d1.json"))
+	if !IsEncrypted(raw) {
+		t.Errorf("Expected the draft to be encrypted, got %q", raw)
+	}
+	if data, err := ReadFile(filepath.Join(account, "drafts", "d1.json")); err != nil || string(data) != `{"subject":"hi"}` {
+		t.Errorf("Expected the draft to decrypt, got %q (%v)", data, err)
+	}
+	log, _ := os.ReadFile(filepath.Join(account, "audit.jsonl"))
+	lines := strings.Split(strings.TrimSpace(string(log)), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], linePrefix) {
+		t.Errorf("Expected two encrypted lines, got %q", log)
+	}
+	if info, _ := os.Stat(account); info.Mode().Perm() != DirMode {
+		t.Errorf("Expected mode %v, got %v", DirMode, info.Mode().Perm())
+	}
+
+	// A second run changes nothing
+	if result, err := Migrate(root); err != nil || result.Encrypted != 0 || result.Skipped != 2 {
+		t.Errorf("Expected an idempotent migration, got %+v (%v)", result, err)
+	}
+}
+
+func TestCheckKey(t *testing.T) {
+	root := t.TempDir()
+	if err := CheckKey(root); err != nil {
+		t.Fatalf("Expected an unencrypted store to pass without a key: %v", err)
+	}
+
+	useKey(t, 1)
+	if err := CheckKey(root); err != nil {
+		t.Fatalf("Expected the key to be recorded: %v", err)
+	}
+	if err := CheckKey(root); err != nil {
+		t.Errorf("Expected the same key to match: %v", err)
+	}
+
+	useKey(t, 2)
+	if err := CheckKey(root); err == nil {
+		t.Error("Expected a different key to be rejected")
+	}
+	SetKey(nil)
+	if err := CheckKey(root); err == nil {
+		t.Error("Expected a missing key to be rejected for an encrypted store")
+	}
+}
+
+func TestUseKey(t *testing.T) {
+	root := t.TempDir()
+	t.Cleanup(func() { SetKey(nil) })
+	key := bytes.Repeat([]byte{1}, KeySize)
+
+	if err := UseKey(root, key); err != nil || !Encrypting() {
+		t.Fatalf("Expected the key to be used: %v", err)
+	}
+	if err := UseKey(root, key); err != nil {
+		t.Errorf("Expected the same key to be accepted again: %v", err)
+	}
+	if err := UseKey(root, bytes.Repeat([]byte{2}, KeySize)); err == nil {
+		t.Error("Expected a different key to be refused while one is in use")
+	}
+
+	// A fresh process with the wrong key is rejected before the key is switched
+	SetKey(nil)
+	if err := UseKey(root, bytes.Repeat([]byte{2}, KeySize)); err == nil || Encrypting() {
+		t.Errorf("Expected a wrong key to be rejected without being set: %v", err)
+	}
+}
@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/prasanthmj/email/pkg/email"
+	"github.com/prasanthmj/email/pkg/securefs"
+)
+
+// attachmentDir returns the directory holding fetched attachments
+func (ec *EmailCache) attachmentDir() string {
+	// cacheDir is {filesRoot}/cache/emails, attachments live next to it
+	return filepath.Join(filepath.Dir(ec.cacheDir), "attachments")
+}
+
+// ReadAttachment extracts text from a cached attachment and returns it with pagination support.
+// Extracted text is cached next to the attachment so subsequent pages don't re-parse the file.
+func (ec *EmailCache) ReadAttachment(cacheID string, offset, limit int64) (*ReadBodyResult, error) {
+	// Cache IDs are plain file names, never paths
+	if cacheID == "" || filepath.Base(cacheID) != cacheID {
+		return nil, fmt.Errorf("invalid attachment cache_id: %s", cacheID)
+	}
+
+	attachmentPath := filepath.Join(ec.attachmentDir(), cacheID)
+	info, err := os.Stat(attachmentPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("attachment not in cache. Call fetch_email_attachment first: %s", cacheID)
+		}
+		return nil, fmt.Errorf("failed to read attachment: %w", err)
+	}
+
+	textDir := filepath.Join(ec.attachmentDir(), "text")
+	textPath := filepath.Join(textDir, cacheID+".txt")
+	kindPath := filepath.Join(textDir, cacheID+".kind")
+
+	// Re-extract if there is no cached text or the attachment changed since extraction
+	textInfo, err := os.Stat(textPath)
+	kind, kindErr := securefs.ReadFile(kindPath)
+	var text []byte
+	if err == nil && kindErr == nil && !textInfo.ModTime().Before(info.ModTime()) {
+		text, err = securefs.ReadFile(textPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read extracted text: %w", err)
+		}
+	} else {
+		extracted, detected, err := email.ExtractText(attachmentPath)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := securefs.MkdirAll(textDir); err != nil {
+			return nil, fmt.Errorf("failed to create attachment text dir: %w", err)
+		}
+		if err := securefs.WriteFile(textPath, []byte(extracted)); err != nil {
+			return nil, fmt.Errorf("failed to cache extracted text: %w", err)
+		}
+		securefs.WriteFile(kindPath, []byte(detected))
+
+		kind = []byte(detected)
+		text = []byte(extracted)
+	}
+
+	if len(text) == 0 {
+		return &ReadBodyResult{
+			Content:    "",
+			Format:     "text",
+			Source:     string(kind),
+			TotalSize:  0,
+			Offset:     0,
+			Limit:      limit,
+			Remaining:  0,
+			IsComplete: true,
+		}, nil
+	}
+
+	if ec.safety {
+		content, report := email.ShieldText(string(text))
+		return shieldedPage(content, "attachment", "text", string(kind), report, offset, limit), nil
+	}
+
+	return ec.readBodyFile(textPath, "text", string(kind), int64(len(text)), offset, limit)
+}
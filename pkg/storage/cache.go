@@ -7,6 +7,7 @@ import (
 	"sort"
 	"time"
 
+	"github.com/prasanthmj/email/pkg/securefs"
 	"gopkg.in/yaml.v3"
 )
 
@@ -58,7 +59,7 @@ func (cm *CacheManager) migrateOldMetadata() {
 	newPath := cm.metadataFile
 
 	// Check if old metadata exists
-	data, err := os.ReadFile(oldPath)
+	data, err := securefs.ReadFile(oldPath)
 	if err != nil {
 		// Old metadata doesn't exist, nothing to migrate
 		return
@@ -79,7 +80,7 @@ func (cm *CacheManager) migrateOldMetadata() {
 
 	// Ensure cache directory exists
 	cacheDir := filepath.Dir(newPath)
-	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+	if err := securefs.MkdirAll(cacheDir); err != nil {
 		// Can't create directory, skip migration
 		return
 	}
@@ -95,7 +96,7 @@ func (cm *CacheManager) migrateOldMetadata() {
 	// Move the file to new location
 	if err := os.Rename(oldPath, newPath); err != nil {
 		// If rename fails, try copy+delete
-		if writeErr := os.WriteFile(newPath, data, 0644); writeErr == nil {
+		if writeErr := securefs.WriteFile(newPath, data); writeErr == nil {
 			os.Remove(oldPath)
 		}
 	}
@@ -103,7 +104,7 @@ func (cm *CacheManager) migrateOldMetadata() {
 
 // LoadMetadata loads cache metadata from disk
 func (cm *CacheManager) LoadMetadata() (*CacheMetadata, error) {
-	data, err := os.ReadFile(cm.metadataFile)
+	data, err := securefs.ReadFile(cm.metadataFile)
 	if err != nil {
 		if os.IsNotExist(err) {
 			// Return empty metadata if file doesn't exist
@@ -132,73 +133,86 @@ func (cm *CacheManager) SaveMetadata(metadata *CacheMetadata) error {
 
 	// Ensure directory exists
 	metadataDir := filepath.Dir(cm.metadataFile)
-	if err := os.MkdirAll(metadataDir, 0755); err != nil {
+	if err := securefs.MkdirAll(metadataDir); err != nil {
 		return fmt.Errorf("failed to create metadata directory: %w", err)
 	}
 
-	if err := os.WriteFile(cm.metadataFile, data, 0644); err != nil {
+	if err := securefs.WriteFile(cm.metadataFile, data); err != nil {
 		return fmt.Errorf("failed to write metadata: %w", err)
 	}
 
 	return nil
 }
 
-// AddEntry adds a new cache entry
-func (cm *CacheManager) AddEntry(id, entryType, filePath string, size int64) error {
+// update runs a read-modify-write cycle on the metadata while holding its lock, so
+// concurrent calls and processes do not lose each other's changes
+func (cm *CacheManager) update(fn func(metadata *CacheMetadata) error) error {
+	unlock, err := lockFile(cm.metadataFile)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	metadata, err := cm.LoadMetadata()
 	if err != nil {
 		return err
 	}
+	if err := fn(metadata); err != nil {
+		return err
+	}
+	return cm.SaveMetadata(metadata)
+}
 
-	// Check if entry already exists
-	for i, entry := range metadata.Entries {
-		if entry.ID == id {
-			// Update existing entry
-			metadata.Entries[i].AccessedAt = time.Now()
-			return cm.SaveMetadata(metadata)
+// AddEntry adds a new cache entry
+func (cm *CacheManager) AddEntry(id, entryType, filePath string, size int64) error {
+	return cm.update(func(metadata *CacheMetadata) error {
+		// Check if entry already exists
+		for i, entry := range metadata.Entries {
+			if entry.ID == id {
+				// Update existing entry
+				metadata.Entries[i].AccessedAt = time.Now()
+				return nil
+			}
 		}
-	}
 
-	// Add new entry
-	entry := CacheEntry{
-		ID:         id,
-		Type:       entryType,
-		Size:       size,
-		CachedAt:   time.Now(),
-		AccessedAt: time.Now(),
-		FilePath:   filePath,
-	}
-	
-	metadata.Entries = append(metadata.Entries, entry)
-	metadata.TotalSize += size
-
-	// Check if cleanup is needed
-	if metadata.TotalSize > cm.maxSize {
-		if err := cm.cleanup(metadata); err != nil {
-			return err
+		// Add new entry
+		entry := CacheEntry{
+			ID:         id,
+			Type:       entryType,
+			Size:       size,
+			CachedAt:   time.Now(),
+			AccessedAt: time.Now(),
+			FilePath:   filePath,
 		}
-	}
+		metadata.Entries = append(metadata.Entries, entry)
+		metadata.TotalSize += size
 
-	return cm.SaveMetadata(metadata)
+		// Check if cleanup is needed
+		if metadata.TotalSize > cm.maxSize {
+			return cm.cleanup(metadata)
+		}
+		return nil
+	})
 }
 
 // GetEntry retrieves a cache entry and updates access time
 func (cm *CacheManager) GetEntry(id string) (*CacheEntry, error) {
-	metadata, err := cm.LoadMetadata()
+	var found *CacheEntry
+	err := cm.update(func(metadata *CacheMetadata) error {
+		for i, entry := range metadata.Entries {
+			if entry.ID == id {
+				// Update access time
+				metadata.Entries[i].AccessedAt = time.Now()
+				found = &entry
+				return nil
+			}
+		}
+		return fmt.Errorf("cache entry not found: %s", id)
+	})
 	if err != nil {
 		return nil, err
 	}
-
-	for i, entry := range metadata.Entries {
-		if entry.ID == id {
-			// Update access time
-			metadata.Entries[i].AccessedAt = time.Now()
-			cm.SaveMetadata(metadata)
-			return &entry, nil
-		}
-	}
-
-	return nil, fmt.Errorf("cache entry not found: %s", id)
+	return found, nil
 }
 
 // cleanup removes old or excess cache entries
@@ -242,21 +256,17 @@ func (cm *CacheManager) cleanup(metadata *CacheMetadata) error {
 
 // ClearCache removes all cache entries
 func (cm *CacheManager) ClearCache() error {
-	metadata, err := cm.LoadMetadata()
-	if err != nil {
-		return err
-	}
-
-	// Delete all cached files
-	for _, entry := range metadata.Entries {
-		os.Remove(entry.FilePath)
-	}
-
-	// Reset metadata
-	metadata.Entries = []CacheEntry{}
-	metadata.TotalSize = 0
+	return cm.update(func(metadata *CacheMetadata) error {
+		// Delete all cached files
+		for _, entry := range metadata.Entries {
+			os.Remove(entry.FilePath)
+		}
 
-	return cm.SaveMetadata(metadata)
+		// Reset metadata
+		metadata.Entries = []CacheEntry{}
+		metadata.TotalSize = 0
+		return nil
+	})
 }
 
 // GetCacheInfo returns cache statistics
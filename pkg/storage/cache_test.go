@@ -1,10 +1,16 @@
 package storage
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/prasanthmj/email/pkg/email"
 )
 
 func TestCacheManager(t *testing.T) {
@@ -168,4 +174,87 @@ func TestCacheInfo(t *testing.T) {
 	if info.AttachmentCount != 1 {
 		t.Errorf("Expected 1 attachment, got %d", info.AttachmentCount)
 	}
-}
\ No newline at end of file
+}
+
+func TestCacheManagerConcurrent(t *testing.T) {
+	tempDir := t.TempDir()
+
+	// Separate managers share the metadata file, as the handler's and the email cache's do
+	managers := []*CacheManager{NewCacheManager(tempDir, 1<<20), NewCacheManager(tempDir, 1<<20)}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 40; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			cm := managers[i%len(managers)]
+			id := fmt.Sprintf("entry%d", i)
+			if err := cm.AddEntry(id, "email", filepath.Join(tempDir, id), 10); err != nil {
+				t.Errorf("Failed to add entry: %v", err)
+			}
+			if _, err := cm.GetEntry(id); err != nil {
+				t.Errorf("Failed to get entry: %v", err)
+			}
+			if _, err := cm.GetCacheInfo(); err != nil {
+				t.Errorf("Failed to get cache info: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	metadata, err := managers[0].LoadMetadata()
+	if err != nil {
+		t.Fatalf("Failed to load metadata: %v", err)
+	}
+	if len(metadata.Entries) != 40 || metadata.TotalSize != 400 {
+		t.Errorf("Expected 40 entries totalling 400 bytes, got %d entries, %d bytes", len(metadata.Entries), metadata.TotalSize)
+	}
+}
+
+func TestSaveEmailCancelled(t *testing.T) {
+	cache := NewEmailCache(t.TempDir(), 1<<20)
+	msg := &email.Email{MessageID: "<cancelled@example.com>", Subject: "Cancelled", Body: "Hello", HTMLBody: "<p>Hello</p>"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := cache.SaveEmail(ctx, msg, "default"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+	if cache.IsCached(msg.MessageID) {
+		t.Error("Expected a cancelled save not to cache the email")
+	}
+	if _, err := os.Stat(cache.getEmailDir(msg.MessageID)); !os.IsNotExist(err) {
+		t.Errorf("Expected the partial cache directory to be removed, got %v", err)
+	}
+
+	if _, err := cache.SaveEmail(context.Background(), msg, "default"); err != nil || !cache.IsCached(msg.MessageID) {
+		t.Errorf("Expected the email to be cached, got %v", err)
+	}
+}
+
+func TestReadBodyOutOfRange(t *testing.T) {
+	cache := NewEmailCache(t.TempDir(), 1<<20)
+	msg := &email.Email{MessageID: "<range@example.com>", Subject: "Range", Body: "Hello world"}
+	if _, err := cache.SaveEmail(context.Background(), msg, "default"); err != nil {
+		t.Fatalf("Failed to cache email: %v", err)
+	}
+
+	tests := []struct {
+		offset, limit int64
+		want          string
+	}{
+		{-5, 5, "Hello"},
+		{6, -3, ""},
+		{20, 5, ""},
+		{6, 100, "world"},
+	}
+	for _, tt := range tests {
+		result, err := cache.ReadBody(msg.MessageID, "text", tt.offset, tt.limit)
+		if err != nil {
+			t.Fatalf("ReadBody(%d, %d) failed: %v", tt.offset, tt.limit, err)
+		}
+		if result.Content != tt.want {
+			t.Errorf("ReadBody(%d, %d): expected %q, got %q", tt.offset, tt.limit, tt.want, result.Content)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/prasanthmj/email/pkg/securefs"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfirmTokenTTL is how long a confirm_send token stays valid
+const ConfirmTokenTTL = time.Hour
+
+// hashConfirmToken returns the stored form of a confirmation token
+func hashConfirmToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// IssueConfirmToken creates a one-time token that allows a held draft to be sent with confirm_send.
+// Any previous token for the draft is replaced; editing the draft invalidates it.
+func (s *Storage) IssueConfirmToken(draftID string) (string, time.Time, error) {
+	unlock, err := s.lockDrafts()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	defer unlock()
+
+	draft, err := s.LoadDraft(draftID)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to generate confirmation token: %w", err)
+	}
+	token := hex.EncodeToString(b)
+
+	draft.ConfirmTokenHash = hashConfirmToken(token)
+	draft.ConfirmExpiresAt = time.Now().Add(ConfirmTokenTTL)
+	if err := s.writeDraft(draft); err != nil {
+		return "", time.Time{}, err
+	}
+	return token, draft.ConfirmExpiresAt, nil
+}
+
+// ConsumeConfirmToken checks a confirmation token and invalidates it so it cannot be reused
+func (s *Storage) ConsumeConfirmToken(draftID, token string) (*Draft, error) {
+	unlock, err := s.lockDrafts()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	draft, err := s.LoadDraft(draftID)
+	if err != nil {
+		return nil, err
+	}
+	if draft.ConfirmTokenHash == "" {
+		return nil, fmt.Errorf("draft %s has no pending confirmation (send it with send_draft first)", draftID)
+	}
+	if time.Now().After(draft.ConfirmExpiresAt) {
+		return nil, fmt.Errorf("confirmation token for draft %s has expired (send it with send_draft to get a new one)", draftID)
+	}
+	if subtle.ConstantTimeCompare([]byte(hashConfirmToken(token)), []byte(draft.ConfirmTokenHash)) != 1 {
+		return nil, fmt.Errorf("invalid confirmation token for draft %s", draftID)
+	}
+
+	draft.ConfirmTokenHash = ""
+	draft.ConfirmExpiresAt = time.Time{}
+	if err := s.writeDraft(draft); err != nil {
+		return nil, err
+	}
+	return draft, nil
+}
+
+// writeDraft overwrites a draft file as-is
+func (s *Storage) writeDraft(draft *Draft) error {
+	data, err := yaml.Marshal(draft)
+	if err != nil {
+		return fmt.Errorf("failed to marshal draft: %w", err)
+	}
+
+	filePath := filepath.Join(s.draftsDir, fmt.Sprintf("draft_%s.yaml", draft.ID))
+	if err := securefs.WriteFile(filePath, data); err != nil {
+		return fmt.Errorf("failed to write draft: %w", err)
+	}
+	return nil
+}
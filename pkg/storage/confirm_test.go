@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/prasanthmj/email/pkg/email"
+)
+
+func TestConfirmToken(t *testing.T) {
+	s := NewStorage(t.TempDir(), 10485760)
+
+	draftID, err := s.SaveDraft(email.SendOptions{To: []string{"client@customer.org"}, Subject: "Quote", Body: "Hi"})
+	if err != nil {
+		t.Fatalf("Failed to save draft: %v", err)
+	}
+
+	if _, err := s.ConsumeConfirmToken(draftID, "anything"); err == nil {
+		t.Error("Expected error without a pending confirmation")
+	}
+
+	token, _, err := s.IssueConfirmToken(draftID)
+	if err != nil {
+		t.Fatalf("Failed to issue token: %v", err)
+	}
+	if _, err := s.ConsumeConfirmToken(draftID, "wrong"); err == nil {
+		t.Error("Expected error for wrong token")
+	}
+
+	draft, err := s.ConsumeConfirmToken(draftID, token)
+	if err != nil {
+		t.Fatalf("Valid token rejected: %v", err)
+	}
+	if draft.Subject != "Quote" {
+		t.Errorf("Unexpected draft: %+v", draft)
+	}
+
+	// Tokens are single use
+	if _, err := s.ConsumeConfirmToken(draftID, token); err == nil {
+		t.Error("Expected reused token to be rejected")
+	}
+
+	// Editing the draft invalidates a pending token
+	token, _, _ = s.IssueConfirmToken(draftID)
+	if err := s.UpdateDraft(draftID, email.SendOptions{To: []string{"other@customer.org"}, Subject: "Quote", Body: "Hi"}); err != nil {
+		t.Fatalf("Failed to update draft: %v", err)
+	}
+	if _, err := s.ConsumeConfirmToken(draftID, token); err == nil {
+		t.Error("Expected token to be invalidated by the update")
+	}
+}
+
+func TestConfirmTokenConcurrent(t *testing.T) {
+	s := NewStorage(t.TempDir(), 10485760)
+
+	draftID, err := s.SaveDraft(email.SendOptions{To: []string{"client@customer.org"}, Subject: "Quote", Body: "Hi"})
+	if err != nil {
+		t.Fatalf("Failed to save draft: %v", err)
+	}
+	token, _, err := s.IssueConfirmToken(draftID)
+	if err != nil {
+		t.Fatalf("Failed to issue token: %v", err)
+	}
+
+	// A token must confirm exactly one send even when presented concurrently
+	var wg sync.WaitGroup
+	var accepted int32
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := s.ConsumeConfirmToken(draftID, token); err == nil {
+				atomic.AddInt32(&accepted, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	if accepted != 1 {
+		t.Errorf("Expected the token to be accepted once, got %d", accepted)
+	}
+}
@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/prasanthmj/email/pkg/email"
+	"github.com/prasanthmj/email/pkg/securefs"
+)
+
+// SetContentSafety enables stripping hidden content, flagging instruction-like passages and
+// wrapping message content in untrusted-content delimiters before it is returned
+func (ec *EmailCache) SetContentSafety(enabled bool) {
+	ec.safety = enabled
+}
+
+// shieldedBody returns the sanitized body of a cached email in the given format, with its source
+func (ec *EmailCache) shieldedBody(emailDir string, metadata *CachedEmailMetadata, format string) (string, string, email.SafetyReport, error) {
+	if format != "raw_html" && metadata.TextBodySize > 0 {
+		text, err := securefs.ReadFile(filepath.Join(emailDir, "body_text.txt"))
+		if err != nil {
+			return "", "", email.SafetyReport{}, fmt.Errorf("failed to read text body: %w", err)
+		}
+		content, report := email.ShieldText(string(text))
+		return content, "text_body", report, nil
+	}
+
+	if metadata.HTMLBodySize == 0 {
+		return "", "none", email.SafetyReport{}, nil
+	}
+	html, err := securefs.ReadFile(filepath.Join(emailDir, "body_html.txt"))
+	if err != nil {
+		return "", "", email.SafetyReport{}, fmt.Errorf("failed to read HTML body: %w", err)
+	}
+	// Hidden elements are removed before conversion, so the cached conversion is not used
+	content, report := email.ShieldHTML(string(html))
+	if format == "raw_html" {
+		return content, "html_body", report, nil
+	}
+	text, err := email.ConvertHTMLToText(content)
+	if err != nil {
+		return "", "", email.SafetyReport{}, fmt.Errorf("failed to convert HTML: %w", err)
+	}
+	return text, "html_converted", report, nil
+}
+
+// readShieldedBody is ReadBody with the content-safety layer applied
+func (ec *EmailCache) readShieldedBody(messageID, format string, offset, limit int64) (*ReadBodyResult, error) {
+	metadata, err := ec.LoadMetadata(messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	content, source, report, err := ec.shieldedBody(ec.getEmailDir(messageID), metadata, format)
+	if err != nil {
+		return nil, err
+	}
+	return shieldedPage(content, "email content", format, source, report, offset, limit), nil
+}
+
+// shieldedPage paginates sanitized content and wraps the page in untrusted-content delimiters
+// naming what it is. Offsets and sizes refer to the sanitized content.
+func shieldedPage(content, label, format, source string, report email.SafetyReport, offset, limit int64) *ReadBodyResult {
+	total := int64(len(content))
+	if offset < 0 {
+		offset = 0
+	}
+	if offset > total {
+		offset = total
+	}
+	end := offset + limit
+	if limit <= 0 || end > total {
+		end = total
+	}
+	page := content[offset:end]
+
+	report.Envelope = email.NewEnvelopeID()
+	if page != "" {
+		page = email.WrapUntrusted(page, label, report.Envelope)
+	}
+
+	return &ReadBodyResult{
+		Content:    page,
+		Format:     format,
+		Source:     source,
+		TotalSize:  total,
+		Offset:     offset,
+		Limit:      limit,
+		Remaining:  total - end,
+		IsComplete: end == total,
+		Safety:     &report,
+	}
+}
+
+// shieldCacheInfo sanitizes the sender, subject and preview of a cached email and adds a safety report
+func (ec *EmailCache) shieldCacheInfo(info *EmailCacheInfo, metadata *CachedEmailMetadata, previewLength int) error {
+	content, _, report, err := ec.shieldedBody(ec.getEmailDir(metadata.MessageID), metadata, "text")
+	if err != nil {
+		return err
+	}
+
+	var subjectReport email.SafetyReport
+	info.Subject, subjectReport = email.ShieldText(info.Subject)
+	report.Merge(subjectReport)
+	var removed int
+	info.From, removed = email.StripInvisibleChars(info.From)
+	report.InvisibleCharsRemoved += removed
+	for i := range info.ReplyTo {
+		info.ReplyTo[i], removed = email.StripInvisibleChars(info.ReplyTo[i])
+		report.InvisibleCharsRemoved += removed
+	}
+
+	if len(content) > previewLength {
+		content = content[:previewLength]
+	}
+	report.Envelope = email.NewEnvelopeID()
+	info.Body.Preview = ""
+	if content != "" {
+		info.Body.Preview = email.WrapUntrusted(content, "email content", report.Envelope)
+	}
+	info.Safety = &report
+	return nil
+}
@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"context"
 	"crypto/md5"
 	"fmt"
 	"os"
@@ -9,6 +10,7 @@ import (
 	"time"
 
 	"github.com/prasanthmj/email/pkg/email"
+	"github.com/prasanthmj/email/pkg/securefs"
 	"gopkg.in/yaml.v3"
 )
 
@@ -19,18 +21,27 @@ const (
 
 // CachedEmailMetadata stores email metadata separately from body content
 type CachedEmailMetadata struct {
-	MessageID   string             `yaml:"message_id" json:"message_id"`
-	AccountID   string             `yaml:"account_id" json:"account_id"`
-	Folder      string             `yaml:"folder" json:"folder"`
-	From        string             `yaml:"from" json:"from"`
-	To          []string           `yaml:"to" json:"to"`
-	CC          []string           `yaml:"cc,omitempty" json:"cc,omitempty"`
-	Subject     string             `yaml:"subject" json:"subject"`
-	Date        time.Time          `yaml:"date" json:"date"`
-	InReplyTo   string             `yaml:"in_reply_to,omitempty" json:"in_reply_to,omitempty"`
-	References  []string           `yaml:"references,omitempty" json:"references,omitempty"`
-	Attachments []email.Attachment `yaml:"attachments,omitempty" json:"attachments,omitempty"`
-	CachedAt    time.Time          `yaml:"cached_at" json:"cached_at"`
+	MessageID   string                `yaml:"message_id" json:"message_id"`
+	AccountID   string                `yaml:"account_id" json:"account_id"`
+	Folder      string                `yaml:"folder" json:"folder"`
+	From        string                `yaml:"from" json:"from"`
+	To          []string              `yaml:"to" json:"to"`
+	CC          []string              `yaml:"cc,omitempty" json:"cc,omitempty"`
+	ReplyTo     []string              `yaml:"reply_to,omitempty" json:"reply_to,omitempty"`
+	Subject     string                `yaml:"subject" json:"subject"`
+	Date        time.Time             `yaml:"date" json:"date"`
+	InReplyTo   string                `yaml:"in_reply_to,omitempty" json:"in_reply_to,omitempty"`
+	References  []string              `yaml:"references,omitempty" json:"references,omitempty"`
+	Attachments []email.Attachment    `yaml:"attachments,omitempty" json:"attachments,omitempty"`
+	Invites     []email.CalendarEvent `yaml:"invites,omitempty" json:"invites,omitempty"`
+	CachedAt    time.Time             `yaml:"cached_at" json:"cached_at"`
+
+	// Sender authentication results recorded when the email was fetched
+	Authentication *email.AuthVerdict `yaml:"authentication,omitempty" json:"authentication,omitempty"`
+
+	// S/MIME and OpenPGP decryption and signature results
+	SMIME *email.SMIMEInfo `yaml:"smime,omitempty" json:"smime,omitempty"`
+	PGP   *email.PGPInfo   `yaml:"pgp,omitempty" json:"pgp,omitempty"`
 
 	// Body size info
 	TextBodySize      int64 `yaml:"text_body_size" json:"text_body_size"`
@@ -40,16 +51,27 @@ type CachedEmailMetadata struct {
 
 // EmailCacheInfo is returned by fetch_email to give LLM info about the cached email
 type EmailCacheInfo struct {
-	MessageID   string             `json:"message_id"`
-	From        string             `json:"from"`
-	To          []string           `json:"to"`
-	CC          []string           `json:"cc,omitempty"`
-	Subject     string             `json:"subject"`
-	Date        time.Time          `json:"date"`
-	InReplyTo   string             `json:"in_reply_to,omitempty"`
-	References  []string           `json:"references,omitempty"`
-	Attachments []email.Attachment `json:"attachments,omitempty"`
-	Body        BodyInfo           `json:"body"`
+	MessageID   string                `json:"message_id"`
+	From        string                `json:"from"`
+	To          []string              `json:"to"`
+	CC          []string              `json:"cc,omitempty"`
+	ReplyTo     []string              `json:"reply_to,omitempty"`
+	Subject     string                `json:"subject"`
+	Date        time.Time             `json:"date"`
+	InReplyTo   string                `json:"in_reply_to,omitempty"`
+	References  []string              `json:"references,omitempty"`
+	Attachments []email.Attachment    `json:"attachments,omitempty"`
+	Invites     []email.CalendarEvent `json:"invites,omitempty"`
+	Body        BodyInfo              `json:"body"`
+	Safety      *email.SafetyReport   `json:"safety,omitempty"` // Set when content safety is enabled
+
+	// SPF/DKIM/DMARC results and whether they authenticate the From domain
+	Authentication *email.AuthVerdict `json:"authentication,omitempty"`
+	SenderTrust    email.SenderTrust  `json:"sender_trust"`
+
+	// Set for S/MIME or OpenPGP encrypted or signed emails
+	SMIME *email.SMIMEInfo `json:"smime,omitempty"`
+	PGP   *email.PGPInfo   `json:"pgp,omitempty"`
 }
 
 // BodyInfo contains information about email body content
@@ -65,24 +87,31 @@ type BodyInfo struct {
 type ReadBodyResult struct {
 	Content    string `json:"content"`
 	Format     string `json:"format"`      // "text" or "raw_html"
-	Source     string `json:"source"`      // "text_body", "html_converted", "html_body", "none"
+	Source     string `json:"source"`      // "text_body", "html_converted", "html_body", "none", or attachment kind
 	TotalSize  int64  `json:"total_size"`
 	Offset     int64  `json:"offset"`
 	Limit      int64  `json:"limit"`
 	Remaining  int64  `json:"remaining"`
 	IsComplete bool   `json:"is_complete"`
+
+	Safety *email.SafetyReport `json:"safety,omitempty"` // Set when content safety is enabled
+
+	// Decryption and signature verification of S/MIME or OpenPGP email bodies
+	SMIME *email.SMIMEInfo `json:"smime,omitempty"`
+	PGP   *email.PGPInfo   `json:"pgp,omitempty"`
 }
 
 // EmailCache handles caching of emails with separate body files
 type EmailCache struct {
 	cacheDir     string
 	cacheManager *CacheManager
+	safety       bool // Apply the content-safety layer to returned content
 }
 
 // NewEmailCache creates a new email cache instance
 func NewEmailCache(filesRoot string, cacheMaxSize int64) *EmailCache {
 	cacheDir := filepath.Join(filesRoot, "cache", "emails")
-	os.MkdirAll(cacheDir, 0755)
+	securefs.MkdirAll(cacheDir)
 
 	return &EmailCache{
 		cacheDir:     cacheDir,
@@ -115,46 +144,78 @@ func (ec *EmailCache) getEmailDir(messageID string) string {
 	return filepath.Join(ec.cacheDir, cacheID)
 }
 
-// SaveEmail saves an email to cache with separate body files
-func (ec *EmailCache) SaveEmail(e *email.Email, accountID string) (*CachedEmailMetadata, error) {
+// SaveEmail saves an email to cache with separate body files. If ctx is cancelled or a
+// write fails, the partially written files are removed.
+func (ec *EmailCache) SaveEmail(ctx context.Context, e *email.Email, accountID string) (*CachedEmailMetadata, error) {
 	emailDir := ec.getEmailDir(e.MessageID)
 
+	metadata, totalSize, err := ec.writeEmail(ctx, emailDir, e, accountID)
+	if err != nil {
+		// The metadata file is written last, so without it the email is fetched again
+		os.RemoveAll(emailDir)
+		return nil, err
+	}
+
+	// Update cache manager
+	cacheID := ec.generateCacheID(e.MessageID)
+	if err := ec.cacheManager.AddEntry(cacheID, "email", emailDir, totalSize); err != nil {
+		// Log but don't fail
+		fmt.Printf("Warning: failed to update cache metadata: %v\n", err)
+	}
+
+	return metadata, nil
+}
+
+// writeEmail writes the body files and metadata of an email, returning the metadata and
+// the total size written
+func (ec *EmailCache) writeEmail(ctx context.Context, emailDir string, e *email.Email, accountID string) (*CachedEmailMetadata, int64, error) {
 	// Create directory for this email
-	if err := os.MkdirAll(emailDir, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create email cache dir: %w", err)
+	if err := securefs.MkdirAll(emailDir); err != nil {
+		return nil, 0, fmt.Errorf("failed to create email cache dir: %w", err)
 	}
 
 	// Create metadata
 	metadata := &CachedEmailMetadata{
-		MessageID:    e.MessageID,
-		AccountID:    accountID,
-		Folder:       e.Folder,
-		From:         e.From,
-		To:           e.To,
-		CC:           e.CC,
-		Subject:      e.Subject,
-		Date:         e.Date,
-		InReplyTo:    e.InReplyTo,
-		References:   e.References,
-		Attachments:  e.Attachments,
-		CachedAt:     time.Now(),
-		TextBodySize: int64(len(e.Body)),
-		HTMLBodySize: int64(len(e.HTMLBody)),
+		MessageID:      e.MessageID,
+		AccountID:      accountID,
+		Folder:         e.Folder,
+		From:           e.From,
+		To:             e.To,
+		CC:             e.CC,
+		ReplyTo:        e.ReplyTo,
+		Subject:        e.Subject,
+		Date:           e.Date,
+		InReplyTo:      e.InReplyTo,
+		References:     e.References,
+		Attachments:    e.Attachments,
+		Invites:        e.Invites,
+		CachedAt:       time.Now(),
+		TextBodySize:   int64(len(e.Body)),
+		HTMLBodySize:   int64(len(e.HTMLBody)),
+		Authentication: e.Authentication,
+		SMIME:          e.SMIME,
+		PGP:            e.PGP,
 	}
 
 	// Save text body if present
 	if e.Body != "" {
+		if err := ctx.Err(); err != nil {
+			return nil, 0, err
+		}
 		textPath := filepath.Join(emailDir, "body_text.txt")
-		if err := os.WriteFile(textPath, []byte(e.Body), 0644); err != nil {
-			return nil, fmt.Errorf("failed to write text body: %w", err)
+		if err := securefs.WriteFile(textPath, []byte(e.Body)); err != nil {
+			return nil, 0, fmt.Errorf("failed to write text body: %w", err)
 		}
 	}
 
 	// Save HTML body if present
 	if e.HTMLBody != "" {
+		if err := ctx.Err(); err != nil {
+			return nil, 0, err
+		}
 		htmlPath := filepath.Join(emailDir, "body_html.txt")
-		if err := os.WriteFile(htmlPath, []byte(e.HTMLBody), 0644); err != nil {
-			return nil, fmt.Errorf("failed to write HTML body: %w", err)
+		if err := securefs.WriteFile(htmlPath, []byte(e.HTMLBody)); err != nil {
+			return nil, 0, fmt.Errorf("failed to write HTML body: %w", err)
 		}
 
 		// Pre-convert HTML to text and cache it
@@ -162,7 +223,7 @@ func (ec *EmailCache) SaveEmail(e *email.Email, accountID string) (*CachedEmailM
 			convertedText, err := email.ConvertHTMLToText(e.HTMLBody)
 			if err == nil && convertedText != "" {
 				convertedPath := filepath.Join(emailDir, "body_converted.txt")
-				if err := os.WriteFile(convertedPath, []byte(convertedText), 0644); err == nil {
+				if err := securefs.WriteFile(convertedPath, []byte(convertedText)); err == nil {
 					metadata.ConvertedTextSize = int64(len(convertedText))
 				}
 			}
@@ -170,24 +231,20 @@ func (ec *EmailCache) SaveEmail(e *email.Email, accountID string) (*CachedEmailM
 	}
 
 	// Save metadata
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
 	metadataPath := filepath.Join(emailDir, "metadata.yaml")
 	metadataBytes, err := yaml.Marshal(metadata)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal metadata: %w", err)
+		return nil, 0, fmt.Errorf("failed to marshal metadata: %w", err)
 	}
-	if err := os.WriteFile(metadataPath, metadataBytes, 0644); err != nil {
-		return nil, fmt.Errorf("failed to write metadata: %w", err)
+	if err := securefs.WriteFile(metadataPath, metadataBytes); err != nil {
+		return nil, 0, fmt.Errorf("failed to write metadata: %w", err)
 	}
 
-	// Update cache manager
 	totalSize := metadata.TextBodySize + metadata.HTMLBodySize + metadata.ConvertedTextSize + int64(len(metadataBytes))
-	cacheID := ec.generateCacheID(e.MessageID)
-	if err := ec.cacheManager.AddEntry(cacheID, "email", emailDir, totalSize); err != nil {
-		// Log but don't fail
-		fmt.Printf("Warning: failed to update cache metadata: %v\n", err)
-	}
-
-	return metadata, nil
+	return metadata, totalSize, nil
 }
 
 // LoadMetadata loads email metadata from cache
@@ -195,7 +252,7 @@ func (ec *EmailCache) LoadMetadata(messageID string) (*CachedEmailMetadata, erro
 	emailDir := ec.getEmailDir(messageID)
 	metadataPath := filepath.Join(emailDir, "metadata.yaml")
 
-	data, err := os.ReadFile(metadataPath)
+	data, err := securefs.ReadFile(metadataPath)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return nil, fmt.Errorf("email not in cache")
@@ -226,16 +283,18 @@ func (ec *EmailCache) GetCacheInfo(messageID string, previewLength int) (*EmailC
 	// Generate preview
 	preview := ec.generatePreview(messageID, metadata, previewLength)
 
-	return &EmailCacheInfo{
+	info := &EmailCacheInfo{
 		MessageID:   metadata.MessageID,
 		From:        metadata.From,
 		To:          metadata.To,
 		CC:          metadata.CC,
+		ReplyTo:     metadata.ReplyTo,
 		Subject:     metadata.Subject,
 		Date:        metadata.Date,
 		InReplyTo:   metadata.InReplyTo,
 		References:  metadata.References,
 		Attachments: metadata.Attachments,
+		Invites:     metadata.Invites,
 		Body: BodyInfo{
 			TextSize: metadata.TextBodySize,
 			HTMLSize: metadata.HTMLBodySize,
@@ -243,7 +302,18 @@ func (ec *EmailCache) GetCacheInfo(messageID string, previewLength int) (*EmailC
 			HasHTML:  metadata.HTMLBodySize > 0,
 			Preview:  preview,
 		},
-	}, nil
+		Authentication: metadata.Authentication,
+		SenderTrust:    metadata.Authentication.Trust(),
+		SMIME:          metadata.SMIME,
+		PGP:            metadata.PGP,
+	}
+
+	if ec.safety {
+		if err := ec.shieldCacheInfo(info, metadata, previewLength); err != nil {
+			return nil, err
+		}
+	}
+	return info, nil
 }
 
 // generatePreview creates a text preview from the email body
@@ -271,13 +341,13 @@ func (ec *EmailCache) generatePreview(messageID string, metadata *CachedEmailMet
 	// As last resort, try to convert HTML on the fly
 	if metadata.HTMLBodySize > 0 {
 		htmlPath := filepath.Join(emailDir, "body_html.txt")
-		htmlContent, err := os.ReadFile(htmlPath)
+		htmlContent, err := securefs.ReadFile(htmlPath)
 		if err == nil {
 			converted, err := email.ConvertHTMLToText(string(htmlContent))
 			if err == nil {
 				// Cache the converted text for future use
 				convertedPath := filepath.Join(emailDir, "body_converted.txt")
-				os.WriteFile(convertedPath, []byte(converted), 0644)
+				securefs.WriteFile(convertedPath, []byte(converted))
 
 				if len(converted) > maxLength {
 					return converted[:maxLength]
@@ -299,13 +369,24 @@ func (ec *EmailCache) ReadBody(messageID string, format string, offset, limit in
 
 	emailDir := ec.getEmailDir(messageID)
 
-	// Handle format selection
-	if format == "raw_html" {
-		return ec.readRawHTML(emailDir, metadata, offset, limit)
+	// Handle format selection (default: text format)
+	var result *ReadBodyResult
+	switch {
+	case ec.safety:
+		result, err = ec.readShieldedBody(messageID, format, offset, limit)
+	case format == "raw_html":
+		result, err = ec.readRawHTML(emailDir, metadata, offset, limit)
+	default:
+		result, err = ec.readText(emailDir, metadata, offset, limit)
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	// Default: text format
-	return ec.readText(emailDir, metadata, offset, limit)
+	// The cached body is plaintext; report how it was protected
+	result.SMIME = metadata.SMIME
+	result.PGP = metadata.PGP
+	return result, nil
 }
 
 // readText reads text content (from text body or converted HTML)
@@ -325,7 +406,7 @@ func (ec *EmailCache) readText(emailDir string, metadata *CachedEmailMetadata, o
 	// Convert HTML on the fly if needed
 	if metadata.HTMLBodySize > 0 {
 		htmlPath := filepath.Join(emailDir, "body_html.txt")
-		htmlContent, err := os.ReadFile(htmlPath)
+		htmlContent, err := securefs.ReadFile(htmlPath)
 		if err != nil {
 			return nil, fmt.Errorf("failed to read HTML body: %w", err)
 		}
@@ -337,13 +418,13 @@ func (ec *EmailCache) readText(emailDir string, metadata *CachedEmailMetadata, o
 
 		// Cache the converted text
 		convertedPath := filepath.Join(emailDir, "body_converted.txt")
-		os.WriteFile(convertedPath, []byte(converted), 0644)
+		securefs.WriteFile(convertedPath, []byte(converted))
 
 		// Update metadata with converted size
 		metadata.ConvertedTextSize = int64(len(converted))
 		metadataPath := filepath.Join(emailDir, "metadata.yaml")
 		metadataBytes, _ := yaml.Marshal(metadata)
-		os.WriteFile(metadataPath, metadataBytes, 0644)
+		securefs.WriteFile(metadataPath, metadataBytes)
 
 		// Now read from the converted file
 		return ec.readBodyFile(convertedPath, "text", "html_converted", metadata.ConvertedTextSize, offset, limit)
@@ -383,6 +464,9 @@ func (ec *EmailCache) readRawHTML(emailDir string, metadata *CachedEmailMetadata
 
 // readBodyFile reads a chunk from a body file
 func (ec *EmailCache) readBodyFile(filePath, format, source string, totalSize, offset, limit int64) (*ReadBodyResult, error) {
+	if offset < 0 {
+		offset = 0
+	}
 	content, err := ec.readFileChunk(filePath, offset, limit)
 	if err != nil {
 		return nil, err
@@ -405,30 +489,28 @@ func (ec *EmailCache) readBodyFile(filePath, format, source string, totalSize, o
 	}, nil
 }
 
-// readFileChunk reads a chunk of a file starting at offset with max length limit
+// readFileChunk reads a chunk of a file starting at offset with max length limit.
+// Files may be encrypted, so the whole file is decrypted and sliced.
 func (ec *EmailCache) readFileChunk(filePath string, offset, limit int64) (string, error) {
-	file, err := os.Open(filePath)
+	data, err := securefs.ReadFile(filePath)
 	if err != nil {
-		return "", fmt.Errorf("failed to open file: %w", err)
+		return "", fmt.Errorf("failed to read file: %w", err)
 	}
-	defer file.Close()
 
-	// Seek to offset
-	if offset > 0 {
-		_, err = file.Seek(offset, 0)
-		if err != nil {
-			return "", fmt.Errorf("failed to seek: %w", err)
-		}
+	if offset < 0 {
+		offset = 0
 	}
-
-	// Read up to limit bytes
-	buffer := make([]byte, limit)
-	n, err := file.Read(buffer)
-	if err != nil && err.Error() != "EOF" {
-		return "", fmt.Errorf("failed to read: %w", err)
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
 	}
-
-	return string(buffer[:n]), nil
+	end := offset + limit
+	if end < offset {
+		end = offset
+	}
+	if end > int64(len(data)) {
+		end = int64(len(data))
+	}
+	return string(data[offset:end]), nil
 }
 
 // IsCached checks if an email is in cache and not expired
@@ -0,0 +1,35 @@
+package storage
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"github.com/prasanthmj/email/pkg/securefs"
+)
+
+// fileLocks serializes read-modify-write cycles on a file within this process, keyed by path
+var fileLocks sync.Map
+
+// lockFile takes an exclusive lock on path, held until the returned function is called.
+// A lock on path+".lock" also excludes other processes sharing FILES_ROOT, such as
+// terminal mode commands run next to the server.
+func lockFile(path string) (func(), error) {
+	m, _ := fileLocks.LoadOrStore(path, &sync.Mutex{})
+	mu := m.(*sync.Mutex)
+	mu.Lock()
+
+	if err := securefs.MkdirAll(filepath.Dir(path)); err != nil {
+		mu.Unlock()
+		return nil, fmt.Errorf("failed to create directory for lock: %w", err)
+	}
+	release, err := lockProcess(path + ".lock")
+	if err != nil {
+		mu.Unlock()
+		return nil, fmt.Errorf("failed to lock %s: %w", filepath.Base(path), err)
+	}
+	return func() {
+		release()
+		mu.Unlock()
+	}, nil
+}
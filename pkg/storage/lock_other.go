@@ -0,0 +1,8 @@
+//go:build !unix
+
+package storage
+
+// lockProcess is a no-op where flock is unavailable; the in-process lock still applies
+func lockProcess(lockPath string) (func(), error) {
+	return func() {}, nil
+}
@@ -0,0 +1,26 @@
+//go:build unix
+
+package storage
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/prasanthmj/email/pkg/securefs"
+)
+
+// lockProcess takes an advisory flock on lockPath
+func lockProcess(lockPath string) (func(), error) {
+	f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, securefs.FileMode)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
@@ -0,0 +1,136 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// Mail merge dataset formats
+const (
+	MergeFormatCSV  = "csv"
+	MergeFormatJSON = "json"
+)
+
+// MergeRowError describes why a dataset row cannot be merged
+type MergeRowError struct {
+	Row    int      `json:"row"` // 1-based data row (CSV header excluded)
+	Errors []string `json:"errors"`
+}
+
+// ParseMergeDataset parses a CSV (with header row) or JSON array of objects into rows.
+// When format is empty, JSON is assumed if the data starts with '['.
+func ParseMergeDataset(data []byte, format string) ([]map[string]interface{}, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")) // UTF-8 BOM from spreadsheet exports
+	if format == "" {
+		format = MergeFormatCSV
+		if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+			format = MergeFormatJSON
+		}
+	}
+
+	switch strings.ToLower(format) {
+	case MergeFormatJSON:
+		var rows []map[string]interface{}
+		if err := json.Unmarshal(data, &rows); err != nil {
+			return nil, fmt.Errorf("invalid JSON dataset (expected an array of objects): %w", err)
+		}
+		return rows, nil
+	case MergeFormatCSV:
+		return parseMergeCSV(data)
+	default:
+		return nil, fmt.Errorf("unsupported dataset format: %s (must be 'csv' or 'json')", format)
+	}
+}
+
+// parseMergeCSV reads a CSV dataset keyed by its header row
+func parseMergeCSV(data []byte) ([]map[string]interface{}, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.TrimLeadingSpace = true
+
+	header, err := r.Read()
+	if err != nil {
+		if err == io.EOF {
+			return nil, fmt.Errorf("CSV dataset is empty")
+		}
+		return nil, fmt.Errorf("invalid CSV header: %w", err)
+	}
+	for i := range header {
+		header[i] = strings.TrimSpace(header[i])
+		if header[i] == "" {
+			return nil, fmt.Errorf("CSV header column %d is empty", i+1)
+		}
+	}
+
+	var rows []map[string]interface{}
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV dataset: %w", err)
+		}
+		row := make(map[string]interface{}, len(header))
+		for i, name := range header {
+			row[name] = strings.TrimSpace(record[i])
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// ValidateMergeRows checks that every row has a valid recipient address in emailField and
+// a non-empty value for each required template variable. Variables listed in optional may be empty.
+func (t *Template) ValidateMergeRows(rows []map[string]interface{}, emailField string, optional []string) ([]MergeRowError, error) {
+	variables, err := t.Variables()
+	if err != nil {
+		return nil, err
+	}
+	skip := make(map[string]bool)
+	for _, name := range optional {
+		skip[name] = true
+	}
+
+	var problems []MergeRowError
+	for i, row := range rows {
+		var errs []string
+
+		value, _ := row[emailField].(string)
+		if strings.TrimSpace(value) == "" {
+			errs = append(errs, fmt.Sprintf("missing %s", emailField))
+		} else if _, err := mail.ParseAddress(value); err != nil {
+			errs = append(errs, fmt.Sprintf("invalid %s %q", emailField, value))
+		}
+
+		for _, name := range variables {
+			if skip[name] {
+				continue
+			}
+			v, ok := row[name]
+			if !ok || v == nil {
+				errs = append(errs, fmt.Sprintf("missing field %s", name))
+			} else if s, isString := v.(string); isString && strings.TrimSpace(s) == "" {
+				errs = append(errs, fmt.Sprintf("empty field %s", name))
+			}
+		}
+
+		if len(errs) > 0 {
+			problems = append(problems, MergeRowError{Row: i + 1, Errors: errs})
+		}
+	}
+	return problems, nil
+}
+
+// NewBatchID generates an ID used to tag the drafts created by one mail merge
+func NewBatchID() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return fmt.Sprintf("batch_%s_%x", time.Now().Format("20060102T150405"), b)
+}
@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prasanthmj/email/pkg/email"
+)
+
+func TestParseMergeDataset(t *testing.T) {
+	csvData := "\xef\xbb\xbfemail, FirstName\nann@example.com, Ann\n\"bob@example.com\",\"Bob, Jr\"\n"
+	rows, err := ParseMergeDataset([]byte(csvData), "")
+	if err != nil {
+		t.Fatalf("Failed to parse CSV: %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("Expected 2 rows, got %d", len(rows))
+	}
+	if rows[0]["email"] != "ann@example.com" || rows[1]["FirstName"] != "Bob, Jr" {
+		t.Errorf("Unexpected CSV rows: %v", rows)
+	}
+
+	jsonData := `[{"email": "ann@example.com", "FirstName": "Ann", "Seats": 3}]`
+	rows, err = ParseMergeDataset([]byte(jsonData), "")
+	if err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	if len(rows) != 1 || rows[0]["Seats"] != float64(3) {
+		t.Errorf("Unexpected JSON rows: %v", rows)
+	}
+
+	if _, err := ParseMergeDataset([]byte("a,b"), "xml"); err == nil {
+		t.Error("Expected error for unsupported format")
+	}
+	if _, err := ParseMergeDataset([]byte("email,name\nann@example.com\n"), MergeFormatCSV); err == nil {
+		t.Error("Expected error for short CSV record")
+	}
+}
+
+func TestValidateMergeRows(t *testing.T) {
+	tmpl := Template{
+		Name:    "invite",
+		Subject: "Hi {{.FirstName}}",
+		Body:    "{{.FirstName}}, see you at {{.Venue}}. {{.Note}}",
+	}
+	rows := []map[string]interface{}{
+		{"email": "ann@example.com", "FirstName": "Ann", "Venue": "Hall A", "Note": ""},
+		{"email": "not-an-address", "FirstName": "Bob", "Venue": "Hall B", "Note": ""},
+		{"email": "cy@example.com", "FirstName": " ", "Note": ""},
+	}
+
+	problems, err := tmpl.ValidateMergeRows(rows, "email", []string{"Note"})
+	if err != nil {
+		t.Fatalf("Validation failed: %v", err)
+	}
+	if len(problems) != 2 {
+		t.Fatalf("Expected 2 invalid rows, got %v", problems)
+	}
+	if problems[0].Row != 2 || !strings.Contains(problems[0].Errors[0], "invalid email") {
+		t.Errorf("Unexpected problem for row 2: %v", problems[0])
+	}
+	if problems[1].Row != 3 || len(problems[1].Errors) != 2 {
+		t.Errorf("Expected empty FirstName and missing Venue for row 3, got %v", problems[1])
+	}
+}
+
+func TestSaveBatchDraft(t *testing.T) {
+	s := NewStorage(t.TempDir(), 10485760)
+
+	batchID := NewBatchID()
+	batchDraft, err := s.SaveBatchDraft(email.SendOptions{To: []string{"ann@example.com"}, Subject: "Hi Ann"}, batchID)
+	if err != nil {
+		t.Fatalf("Failed to save batch draft: %v", err)
+	}
+	if _, err := s.SaveDraft(email.SendOptions{To: []string{"bob@example.com"}, Subject: "Unrelated"}); err != nil {
+		t.Fatalf("Failed to save draft: %v", err)
+	}
+
+	// Updating keeps the batch tag
+	if err := s.UpdateDraft(batchDraft, email.SendOptions{To: []string{"ann@example.com"}, Subject: "Hello Ann"}); err != nil {
+		t.Fatalf("Failed to update draft: %v", err)
+	}
+
+	drafts, err := s.ListDrafts()
+	if err != nil {
+		t.Fatalf("Failed to list drafts: %v", err)
+	}
+	tagged := 0
+	for _, d := range drafts {
+		if d.BatchID == batchID {
+			tagged++
+			if d.ID != batchDraft {
+				t.Errorf("Unexpected draft in batch: %s", d.ID)
+			}
+		}
+	}
+	if tagged != 1 {
+		t.Errorf("Expected 1 draft in batch %s, got %d", batchID, tagged)
+	}
+}
@@ -0,0 +1,362 @@
+package storage
+
+import (
+	"crypto/rand"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prasanthmj/email/pkg/email"
+	"github.com/prasanthmj/email/pkg/securefs"
+	"gopkg.in/yaml.v3"
+)
+
+// Outbox entry states
+const (
+	OutboxStatusPending = "pending"
+	OutboxStatusSending = "sending"
+	OutboxStatusDead    = "dead"
+)
+
+// Retry backoff bounds for temporary send failures
+const (
+	outboxRetryBase = time.Minute
+	outboxRetryMax  = time.Hour
+)
+
+// outboxIDPattern matches IDs generated by newOutboxID
+var outboxIDPattern = regexp.MustCompile(`^out_[A-Za-z0-9_]+$`)
+
+// OutboxEntry is a message queued for delivery by the background worker.
+// Pending entries live in outbox/, entries being sent in outbox/sending/ and
+// permanently failed ones in outbox/dead/. Moving between them is a rename, so
+// an entry is claimed by exactly one of the worker or cancel_scheduled.
+type OutboxEntry struct {
+	ID            string    `yaml:"id" json:"id"`
+	Status        string    `yaml:"status" json:"status"`
+	QueuedAt      time.Time `yaml:"queued_at" json:"queued_at"`
+	SendAt        time.Time `yaml:"send_at" json:"send_at"`
+	NextAttemptAt time.Time `yaml:"next_attempt_at" json:"next_attempt_at"`
+	Attempts      int       `yaml:"attempts" json:"attempts"`
+	LastError     string    `yaml:"last_error,omitempty" json:"last_error,omitempty"`
+	Spacing       int       `yaml:"spacing_seconds,omitempty" json:"spacing_seconds,omitempty"` // Minimum gap before the account sends its next queued message
+	Message       Draft     `yaml:"message" json:"message"`
+}
+
+// OutboxSummary represents an outbox entry for listing
+type OutboxSummary struct {
+	ID            string    `json:"id"`
+	Status        string    `json:"status"`
+	SendAt        time.Time `json:"send_at"`
+	NextAttemptAt time.Time `json:"next_attempt_at"`
+	Attempts      int       `json:"attempts"`
+	LastError     string    `json:"last_error,omitempty"`
+	Subject       string    `json:"subject"`
+	To            []string  `json:"to"`
+	BatchID       string    `json:"batch_id,omitempty"`
+}
+
+// outboxDir returns the directory holding an account's outbox entries in the given state
+func (s *Storage) outboxDir(status string) string {
+	dir := filepath.Join(filepath.Dir(s.draftsDir), "outbox")
+	switch status {
+	case OutboxStatusSending:
+		return filepath.Join(dir, "sending")
+	case OutboxStatusDead:
+		return filepath.Join(dir, "dead")
+	}
+	return dir
+}
+
+// outboxPath returns the file path of an outbox entry in the given state
+func (s *Storage) outboxPath(status, id string) (string, error) {
+	if !outboxIDPattern.MatchString(id) {
+		return "", fmt.Errorf("invalid outbox ID: %q", id)
+	}
+	return filepath.Join(s.outboxDir(status), id+".yaml"), nil
+}
+
+// newOutboxID generates a unique, time-ordered outbox entry ID
+func newOutboxID() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return fmt.Sprintf("out_%s_%x", time.Now().Format("20060102T150405"), b)
+}
+
+// EnqueueMessage queues a message for delivery at sendAt (immediately when zero). After it
+// is sent, the account waits spacingSeconds before sending its next queued message.
+func (s *Storage) EnqueueMessage(opts email.SendOptions, sendAt time.Time, batchID string, spacingSeconds int) (*OutboxEntry, error) {
+	now := time.Now()
+	if sendAt.IsZero() {
+		sendAt = now
+	}
+
+	entry := &OutboxEntry{
+		ID:            newOutboxID(),
+		Status:        OutboxStatusPending,
+		QueuedAt:      now,
+		SendAt:        sendAt,
+		NextAttemptAt: sendAt,
+		Spacing:       spacingSeconds,
+		Message:       newDraft("", now, opts),
+	}
+	entry.Message.BatchID = batchID
+
+	if err := s.writeOutboxEntry(entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// writeOutboxEntry writes an entry into the directory for its status
+func (s *Storage) writeOutboxEntry(entry *OutboxEntry) error {
+	filePath, err := s.outboxPath(entry.Status, entry.ID)
+	if err != nil {
+		return err
+	}
+	if err := securefs.MkdirAll(filepath.Dir(filePath)); err != nil {
+		return fmt.Errorf("failed to create outbox directory: %w", err)
+	}
+
+	data, err := yaml.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal outbox entry: %w", err)
+	}
+
+	// Write to a temporary file first so the worker never sees a partial entry
+	tmpPath := filePath + ".tmp"
+	if err := securefs.WriteFile(tmpPath, data); err != nil {
+		return fmt.Errorf("failed to write outbox entry: %w", err)
+	}
+	if err := os.Rename(tmpPath, filePath); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write outbox entry: %w", err)
+	}
+	return nil
+}
+
+// readOutboxEntry loads an entry file
+func readOutboxEntry(filePath string) (*OutboxEntry, error) {
+	data, err := securefs.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var entry OutboxEntry
+	if err := yaml.Unmarshal(data, &entry); err != nil {
+		return nil, fmt.Errorf("failed to parse outbox entry: %w", err)
+	}
+	return &entry, nil
+}
+
+// readOutboxDir loads all entries in the directory for a status
+func (s *Storage) readOutboxDir(status string) ([]*OutboxEntry, error) {
+	files, err := os.ReadDir(s.outboxDir(status))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read outbox directory: %w", err)
+	}
+
+	var entries []*OutboxEntry
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".yaml") {
+			continue
+		}
+		entry, err := readOutboxEntry(filepath.Join(s.outboxDir(status), file.Name()))
+		if err != nil {
+			continue
+		}
+		entry.Status = status
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// ListOutbox returns summaries of pending, in-flight and dead-lettered messages, earliest first
+func (s *Storage) ListOutbox() ([]OutboxSummary, error) {
+	summaries := []OutboxSummary{}
+	for _, status := range []string{OutboxStatusPending, OutboxStatusSending, OutboxStatusDead} {
+		entries, err := s.readOutboxDir(status)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			summaries = append(summaries, OutboxSummary{
+				ID:            entry.ID,
+				Status:        entry.Status,
+				SendAt:        entry.SendAt,
+				NextAttemptAt: entry.NextAttemptAt,
+				Attempts:      entry.Attempts,
+				LastError:     entry.LastError,
+				Subject:       entry.Message.Subject,
+				To:            entry.Message.To,
+				BatchID:       entry.Message.BatchID,
+			})
+		}
+	}
+
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].NextAttemptAt.Before(summaries[j].NextAttemptAt)
+	})
+	return summaries, nil
+}
+
+// ClaimNextDue moves the earliest pending entry due at or before now into the sending
+// state and returns it. It returns nil when nothing is due.
+func (s *Storage) ClaimNextDue(now time.Time) (*OutboxEntry, error) {
+	entries, err := s.readOutboxDir(OutboxStatusPending)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].NextAttemptAt.Before(entries[j].NextAttemptAt)
+	})
+
+	if err := securefs.MkdirAll(s.outboxDir(OutboxStatusSending)); err != nil {
+		return nil, fmt.Errorf("failed to create outbox directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		if entry.NextAttemptAt.After(now) {
+			break
+		}
+		from, _ := s.outboxPath(OutboxStatusPending, entry.ID)
+		to, _ := s.outboxPath(OutboxStatusSending, entry.ID)
+		if err := os.Rename(from, to); err != nil {
+			// Cancelled after it was read
+			continue
+		}
+		entry.Status = OutboxStatusSending
+		return entry, nil
+	}
+	return nil, nil
+}
+
+// NextOutboxDue returns when the earliest pending entry is due, or the zero time if the
+// outbox is empty
+func (s *Storage) NextOutboxDue() (time.Time, error) {
+	entries, err := s.readOutboxDir(OutboxStatusPending)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var next time.Time
+	for _, entry := range entries {
+		if next.IsZero() || entry.NextAttemptAt.Before(next) {
+			next = entry.NextAttemptAt
+		}
+	}
+	return next, nil
+}
+
+// CompleteOutboxEntry removes a claimed entry after it was sent
+func (s *Storage) CompleteOutboxEntry(id string) error {
+	filePath, err := s.outboxPath(OutboxStatusSending, id)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove outbox entry: %w", err)
+	}
+	return nil
+}
+
+// RetryOutboxEntry returns a claimed entry to the queue after a temporary failure
+func (s *Storage) RetryOutboxEntry(entry *OutboxEntry, sendErr error, now time.Time) error {
+	entry.Attempts++
+	entry.LastError = sendErr.Error()
+	entry.NextAttemptAt = now.Add(OutboxRetryDelay(entry.Attempts))
+	return s.moveOutboxEntry(entry, OutboxStatusPending)
+}
+
+// DeferOutboxEntry returns a claimed entry to the queue until the given time without counting an attempt
+func (s *Storage) DeferOutboxEntry(entry *OutboxEntry, reason error, until time.Time) error {
+	entry.LastError = reason.Error()
+	entry.NextAttemptAt = until
+	return s.moveOutboxEntry(entry, OutboxStatusPending)
+}
+
+// DeadLetterOutboxEntry moves a claimed entry to the dead-letter queue after a permanent failure
+func (s *Storage) DeadLetterOutboxEntry(entry *OutboxEntry, sendErr error) error {
+	entry.Attempts++
+	entry.LastError = sendErr.Error()
+	return s.moveOutboxEntry(entry, OutboxStatusDead)
+}
+
+// moveOutboxEntry writes a claimed entry under a new status and removes the claim
+func (s *Storage) moveOutboxEntry(entry *OutboxEntry, status string) error {
+	claimed := entry.ID
+	entry.Status = status
+	if err := s.writeOutboxEntry(entry); err != nil {
+		return err
+	}
+	return s.CompleteOutboxEntry(claimed)
+}
+
+// RecoverOutbox returns entries left in the sending state by an interrupted worker to the queue.
+// A message may be delivered twice if the process stopped after the server accepted it.
+func (s *Storage) RecoverOutbox() error {
+	entries, err := s.readOutboxDir(OutboxStatusSending)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		from, _ := s.outboxPath(OutboxStatusSending, entry.ID)
+		to, _ := s.outboxPath(OutboxStatusPending, entry.ID)
+		if err := os.Rename(from, to); err != nil {
+			return fmt.Errorf("failed to recover outbox entry %s: %w", entry.ID, err)
+		}
+	}
+	return nil
+}
+
+// CancelOutboxEntry removes a pending or dead-lettered entry and returns it.
+// Entries already claimed by the worker cannot be cancelled.
+func (s *Storage) CancelOutboxEntry(id string) (*OutboxEntry, error) {
+	for _, status := range []string{OutboxStatusPending, OutboxStatusDead} {
+		filePath, err := s.outboxPath(status, id)
+		if err != nil {
+			return nil, err
+		}
+		entry, err := readOutboxEntry(filePath)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to read outbox entry: %w", err)
+		}
+		// Removal fails if the worker claimed the entry after it was read
+		if err := os.Remove(filePath); err != nil {
+			if os.IsNotExist(err) {
+				break
+			}
+			return nil, fmt.Errorf("failed to remove outbox entry: %w", err)
+		}
+		entry.Status = status
+		return entry, nil
+	}
+
+	if sending, err := s.outboxPath(OutboxStatusSending, id); err == nil {
+		if _, err := os.Stat(sending); err == nil {
+			return nil, fmt.Errorf("outbox entry %s is being sent and can no longer be cancelled", id)
+		}
+	}
+	return nil, fmt.Errorf("outbox entry not found: %s", id)
+}
+
+// OutboxRetryDelay returns the exponential backoff before retry number attempt (1-based)
+func OutboxRetryDelay(attempt int) time.Duration {
+	delay := outboxRetryBase
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if delay >= outboxRetryMax {
+			return outboxRetryMax
+		}
+	}
+	return delay
+}
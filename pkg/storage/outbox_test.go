@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prasanthmj/email/pkg/email"
+)
+
+func TestOutboxLifecycle(t *testing.T) {
+	s := NewStorage(t.TempDir(), 10485760)
+	now := time.Now()
+
+	later, err := s.EnqueueMessage(email.SendOptions{To: []string{"ann@example.com"}, Subject: "Later"}, now.Add(time.Hour), "", 0)
+	if err != nil {
+		t.Fatalf("Failed to enqueue: %v", err)
+	}
+	due, err := s.EnqueueMessage(email.SendOptions{To: []string{"bob@example.com"}, Subject: "Now"}, time.Time{}, "batch_1", 0)
+	if err != nil {
+		t.Fatalf("Failed to enqueue: %v", err)
+	}
+
+	if next, err := s.NextOutboxDue(); err != nil || !next.Equal(due.NextAttemptAt) {
+		t.Errorf("Expected the earliest entry to be next due, got %v (%v)", next, err)
+	}
+
+	// Only the due message is claimed
+	claimed, err := s.ClaimNextDue(now.Add(time.Second))
+	if err != nil || claimed == nil {
+		t.Fatalf("Expected a due entry, got %v, %v", claimed, err)
+	}
+	if claimed.ID != due.ID || claimed.Message.Subject != "Now" || claimed.Message.BatchID != "batch_1" {
+		t.Errorf("Claimed unexpected entry: %+v", claimed)
+	}
+	if next, _ := s.ClaimNextDue(now.Add(time.Second)); next != nil {
+		t.Errorf("Expected nothing else due, got %s", next.ID)
+	}
+
+	// A claimed entry cannot be cancelled
+	if _, err := s.CancelOutboxEntry(due.ID); err == nil || !strings.Contains(err.Error(), "being sent") {
+		t.Errorf("Expected cancel of claimed entry to fail, got %v", err)
+	}
+
+	// Temporary failure schedules a retry with backoff
+	if err := s.RetryOutboxEntry(claimed, errors.New("421 try later"), now); err != nil {
+		t.Fatalf("Failed to retry: %v", err)
+	}
+	list, err := s.ListOutbox()
+	if err != nil {
+		t.Fatalf("Failed to list outbox: %v", err)
+	}
+	if len(list) != 2 || list[0].ID != due.ID || list[0].Attempts != 1 || list[0].Status != OutboxStatusPending {
+		t.Fatalf("Unexpected outbox after retry: %+v", list)
+	}
+	if !list[0].NextAttemptAt.Equal(now.Add(OutboxRetryDelay(1))) {
+		t.Errorf("Expected next attempt after backoff, got %v", list[0].NextAttemptAt)
+	}
+
+	// Permanent failure moves it to the dead-letter queue
+	claimed, _ = s.ClaimNextDue(now.Add(2 * time.Minute))
+	if claimed == nil || claimed.ID != due.ID {
+		t.Fatalf("Expected retried entry to be due again, got %v", claimed)
+	}
+	if err := s.DeadLetterOutboxEntry(claimed, errors.New("550 no such user")); err != nil {
+		t.Fatalf("Failed to dead-letter: %v", err)
+	}
+	list, _ = s.ListOutbox()
+	var dead *OutboxSummary
+	for i := range list {
+		if list[i].ID == due.ID {
+			dead = &list[i]
+		}
+	}
+	if dead == nil || dead.Status != OutboxStatusDead || dead.Attempts != 2 || dead.LastError != "550 no such user" {
+		t.Errorf("Unexpected dead-letter entry: %+v", dead)
+	}
+
+	// Pending and dead entries can be cancelled
+	for _, id := range []string{later.ID, due.ID} {
+		entry, err := s.CancelOutboxEntry(id)
+		if err != nil {
+			t.Fatalf("Failed to cancel %s: %v", id, err)
+		}
+		if entry.ID != id {
+			t.Errorf("Cancelled wrong entry: %s", entry.ID)
+		}
+	}
+	if list, _ := s.ListOutbox(); len(list) != 0 {
+		t.Errorf("Expected empty outbox, got %+v", list)
+	}
+	if next, err := s.NextOutboxDue(); err != nil || !next.IsZero() {
+		t.Errorf("Expected nothing due in an empty outbox, got %v (%v)", next, err)
+	}
+	if _, err := s.CancelOutboxEntry("../drafts/x"); err == nil {
+		t.Error("Expected error for invalid outbox ID")
+	}
+}
+
+func TestRecoverOutbox(t *testing.T) {
+	s := NewStorage(t.TempDir(), 10485760)
+
+	entry, err := s.EnqueueMessage(email.SendOptions{To: []string{"ann@example.com"}, Subject: "Hi"}, time.Time{}, "", 0)
+	if err != nil {
+		t.Fatalf("Failed to enqueue: %v", err)
+	}
+	if claimed, _ := s.ClaimNextDue(time.Now().Add(time.Second)); claimed == nil {
+		t.Fatal("Expected entry to be claimed")
+	}
+
+	if err := s.RecoverOutbox(); err != nil {
+		t.Fatalf("Failed to recover: %v", err)
+	}
+	claimed, _ := s.ClaimNextDue(time.Now().Add(time.Second))
+	if claimed == nil || claimed.ID != entry.ID {
+		t.Errorf("Expected recovered entry to be claimable, got %v", claimed)
+	}
+}
+
+func TestOutboxRetryDelay(t *testing.T) {
+	tests := map[int]time.Duration{
+		1:  time.Minute,
+		2:  2 * time.Minute,
+		4:  8 * time.Minute,
+		7:  time.Hour,
+		20: time.Hour,
+	}
+	for attempt, want := range tests {
+		if got := OutboxRetryDelay(attempt); got != want {
+			t.Errorf("OutboxRetryDelay(%d) = %v, want %v", attempt, got, want)
+		}
+	}
+}
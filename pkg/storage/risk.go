@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/prasanthmj/email/pkg/email"
+	"github.com/prasanthmj/email/pkg/securefs"
+)
+
+// AnalyzeRisk runs the phishing heuristics on a cached email's headers, HTML body and
+// attachment metadata. ownDomains are the domains the account sends from.
+func (ec *EmailCache) AnalyzeRisk(messageID string, ownDomains []string) (*email.RiskReport, error) {
+	metadata, err := ec.LoadMetadata(messageID)
+	if err != nil {
+		return nil, err
+	}
+	emailDir := ec.getEmailDir(messageID)
+
+	input := email.RiskInput{
+		From:        metadata.From,
+		ReplyTo:     metadata.ReplyTo,
+		Subject:     metadata.Subject,
+		Attachments: metadata.Attachments,
+		OwnDomains:  ownDomains,
+	}
+	if metadata.HTMLBodySize > 0 {
+		html, err := securefs.ReadFile(filepath.Join(emailDir, "body_html.txt"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read HTML body: %w", err)
+		}
+		input.HTMLBody = string(html)
+	} else if metadata.TextBodySize > 0 {
+		text, err := securefs.ReadFile(filepath.Join(emailDir, "body_text.txt"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read text body: %w", err)
+		}
+		input.TextBody = string(text)
+	}
+
+	return email.AnalyzeRisk(input), nil
+}
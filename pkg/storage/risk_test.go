@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/prasanthmj/email/pkg/email"
+)
+
+func TestAnalyzeRisk(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "risk_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	ec := NewEmailCache(tempDir, 1024*1024)
+	msg := &email.Email{
+		MessageID:   "<risk@example.com>",
+		From:        "Billing <billing@examp1e.com>",
+		ReplyTo:     []string{"billing@examp1e.com"},
+		To:          []string{"me@example.com"},
+		Subject:     "Invoice",
+		Date:        time.Now(),
+		HTMLBody:    `<p>Download <a href="https://files.example.net/x">https://example.com/invoice</a></p>`,
+		Attachments: []email.Attachment{{Filename: "invoice.docm", Size: 2048}},
+	}
+	if _, err := ec.SaveEmail(context.Background(), msg, "work"); err != nil {
+		t.Fatalf("Failed to save email: %v", err)
+	}
+
+	report, err := ec.AnalyzeRisk(msg.MessageID, []string{"example.com"})
+	if err != nil {
+		t.Fatalf("Failed to analyze email: %v", err)
+	}
+	rules := make(map[string]bool)
+	for _, f := range report.Findings {
+		rules[f.Rule] = true
+	}
+	for _, rule := range []string{"lookalike_domain", "link_mismatch", "dangerous_attachment"} {
+		if !rules[rule] {
+			t.Errorf("Expected a %s finding, got %+v", rule, report.Findings)
+		}
+	}
+	if rules["reply_to_mismatch"] {
+		t.Errorf("Reply-To matching From should not be flagged")
+	}
+
+	info, err := ec.GetCacheInfo(msg.MessageID, 100)
+	if err != nil {
+		t.Fatalf("Failed to get cache info: %v", err)
+	}
+	if len(info.ReplyTo) != 1 || info.ReplyTo[0] != "billing@examp1e.com" {
+		t.Errorf("Expected Reply-To in cache info, got %v", info.ReplyTo)
+	}
+
+	if _, err := ec.AnalyzeRisk("<missing@example.com>", nil); err == nil {
+		t.Error("Expected an error for an uncached email")
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/prasanthmj/email/pkg/email"
+	"github.com/prasanthmj/email/pkg/securefs"
 	"gopkg.in/yaml.v3"
 )
 
@@ -28,8 +29,8 @@ func NewStorage(filesRoot string, cacheMaxSize int64) *Storage {
 	}
 	
 	// Create directories if they don't exist
-	os.MkdirAll(s.draftsDir, 0755)
-	os.MkdirAll(s.emailCacheDir, 0755)
+	securefs.MkdirAll(s.draftsDir)
+	securefs.MkdirAll(s.emailCacheDir)
 	
 	return s
 }
@@ -51,7 +52,7 @@ func (s *Storage) SaveEmail(e *email.Email) error {
 	}
 
 	// Write to file
-	if err := os.WriteFile(filePath, data, 0644); err != nil {
+	if err := securefs.WriteFile(filePath, data); err != nil {
 		return fmt.Errorf("failed to write email cache: %w", err)
 	}
 
@@ -81,7 +82,7 @@ func (s *Storage) LoadEmail(messageID string) (*email.Email, error) {
 	}
 
 	// Read from file
-	data, err := os.ReadFile(entry.FilePath)
+	data, err := securefs.ReadFile(entry.FilePath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read cached email: %w", err)
 	}
@@ -97,25 +98,25 @@ func (s *Storage) LoadEmail(messageID string) (*email.Email, error) {
 
 // SaveDraft saves a draft email
 func (s *Storage) SaveDraft(opts email.SendOptions) (string, error) {
-	// Generate draft ID
+	return s.SaveBatchDraft(opts, "")
+}
+
+// SaveBatchDraft saves a draft email tagged with a batch ID (e.g. from a mail merge)
+func (s *Storage) SaveBatchDraft(opts email.SendOptions, batchID string) (string, error) {
+	// Generate draft ID, retrying when drafts are created in quick succession
 	draftID := s.generateDraftID()
-	filename := fmt.Sprintf("draft_%s.yaml", draftID)
-	filePath := filepath.Join(s.draftsDir, filename)
+	filePath := filepath.Join(s.draftsDir, fmt.Sprintf("draft_%s.yaml", draftID))
+	for {
+		if _, err := os.Stat(filePath); err != nil {
+			break
+		}
+		draftID = s.generateDraftID()
+		filePath = filepath.Join(s.draftsDir, fmt.Sprintf("draft_%s.yaml", draftID))
+	}
 
 	// Create draft structure
-	draft := Draft{
-		ID:               draftID,
-		CreatedAt:        time.Now(),
-		To:               opts.To,
-		CC:               opts.CC,
-		BCC:              opts.BCC,
-		Subject:          opts.Subject,
-		Body:             opts.Body,
-		HTMLBody:         opts.HTMLBody,
-		Attachments:      opts.Attachments,
-		ReplyToMessageID: opts.ReplyToMessageID,
-		References:       opts.References,
-	}
+	draft := newDraft(draftID, time.Now(), opts)
+	draft.BatchID = batchID
 
 	// Marshal to YAML
 	data, err := yaml.Marshal(draft)
@@ -124,7 +125,7 @@ func (s *Storage) SaveDraft(opts email.SendOptions) (string, error) {
 	}
 
 	// Write to file
-	if err := os.WriteFile(filePath, data, 0644); err != nil {
+	if err := securefs.WriteFile(filePath, data); err != nil {
 		return "", fmt.Errorf("failed to write draft: %w", err)
 	}
 
@@ -137,7 +138,7 @@ func (s *Storage) LoadDraft(draftID string) (*Draft, error) {
 	filePath := filepath.Join(s.draftsDir, filename)
 
 	// Read from file
-	data, err := os.ReadFile(filePath)
+	data, err := securefs.ReadFile(filePath)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return nil, fmt.Errorf("draft not found: %s", draftID)
@@ -156,26 +157,21 @@ func (s *Storage) LoadDraft(draftID string) (*Draft, error) {
 
 // UpdateDraft updates an existing draft while preserving its ID and created_at timestamp
 func (s *Storage) UpdateDraft(draftID string, opts email.SendOptions) error {
+	unlock, err := s.lockDrafts()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	// Load existing draft to preserve metadata
 	existingDraft, err := s.LoadDraft(draftID)
 	if err != nil {
 		return fmt.Errorf("failed to load existing draft: %w", err)
 	}
 
-	// Create updated draft preserving ID and created_at
-	draft := Draft{
-		ID:               existingDraft.ID,        // Preserve original ID
-		CreatedAt:        existingDraft.CreatedAt, // Preserve creation time
-		To:               opts.To,
-		CC:               opts.CC,
-		BCC:              opts.BCC,
-		Subject:          opts.Subject,
-		Body:             opts.Body,
-		HTMLBody:         opts.HTMLBody,
-		Attachments:      opts.Attachments,
-		ReplyToMessageID: opts.ReplyToMessageID,
-		References:       opts.References,
-	}
+	// Create updated draft preserving ID, created_at and batch
+	draft := newDraft(existingDraft.ID, existingDraft.CreatedAt, opts)
+	draft.BatchID = existingDraft.BatchID
 
 	// Marshal to YAML
 	data, err := yaml.Marshal(draft)
@@ -186,7 +182,7 @@ func (s *Storage) UpdateDraft(draftID string, opts email.SendOptions) error {
 	// Write to file (overwrites existing file)
 	filename := fmt.Sprintf("draft_%s.yaml", draftID)
 	filePath := filepath.Join(s.draftsDir, filename)
-	if err := os.WriteFile(filePath, data, 0644); err != nil {
+	if err := securefs.WriteFile(filePath, data); err != nil {
 		return fmt.Errorf("failed to write draft: %w", err)
 	}
 
@@ -220,12 +216,18 @@ func (s *Storage) ListDrafts() ([]DraftSummary, error) {
 			CreatedAt: draft.CreatedAt,
 			Subject:   draft.Subject,
 			To:        draft.To,
+			BatchID:   draft.BatchID,
 		})
 	}
 
 	return drafts, nil
 }
 
+// lockDrafts serializes draft updates that read a draft before rewriting it
+func (s *Storage) lockDrafts() (func(), error) {
+	return lockFile(s.draftsDir)
+}
+
 // DeleteDraft deletes a draft by ID
 func (s *Storage) DeleteDraft(draftID string) error {
 	filename := fmt.Sprintf("draft_%s.yaml", draftID)
@@ -241,6 +243,64 @@ func (s *Storage) DeleteDraft(draftID string) error {
 	return nil
 }
 
+// newDraft builds a draft from send options
+func newDraft(draftID string, createdAt time.Time, opts email.SendOptions) Draft {
+	return Draft{
+		ID:                      draftID,
+		CreatedAt:               createdAt,
+		To:                      opts.To,
+		CC:                      opts.CC,
+		BCC:                     opts.BCC,
+		Subject:                 opts.Subject,
+		Body:                    opts.Body,
+		HTMLBody:                opts.HTMLBody,
+		Attachments:             opts.Attachments,
+		InlineAttachments:       opts.InlineAttachments,
+		EmbedDataURIs:           opts.EmbedDataURIs,
+		ReplyToMessageID:        opts.ReplyToMessageID,
+		References:              opts.References,
+		FromIdentity:            opts.FromIdentity,
+		FromName:                opts.FromName,
+		ReplyTo:                 opts.ReplyTo,
+		Priority:                opts.Priority,
+		ReadReceipt:             opts.ReadReceipt,
+		ListUnsubscribe:         opts.ListUnsubscribe,
+		ListUnsubscribeOneClick: opts.ListUnsubscribeOneClick,
+		Headers:                 opts.Headers,
+		Sign:                    opts.Sign,
+		Encrypt:                 opts.Encrypt,
+		Crypto:                  opts.Crypto,
+	}
+}
+
+// SendOptions converts the draft back into send options
+func (d *Draft) SendOptions() email.SendOptions {
+	return email.SendOptions{
+		To:                      d.To,
+		CC:                      d.CC,
+		BCC:                     d.BCC,
+		Subject:                 d.Subject,
+		Body:                    d.Body,
+		HTMLBody:                d.HTMLBody,
+		Attachments:             d.Attachments,
+		InlineAttachments:       d.InlineAttachments,
+		EmbedDataURIs:           d.EmbedDataURIs,
+		ReplyToMessageID:        d.ReplyToMessageID,
+		References:              d.References,
+		FromIdentity:            d.FromIdentity,
+		FromName:                d.FromName,
+		ReplyTo:                 d.ReplyTo,
+		Priority:                d.Priority,
+		ReadReceipt:             d.ReadReceipt,
+		ListUnsubscribe:         d.ListUnsubscribe,
+		ListUnsubscribeOneClick: d.ListUnsubscribeOneClick,
+		Headers:                 d.Headers,
+		Sign:                    d.Sign,
+		Encrypt:                 d.Encrypt,
+		Crypto:                  d.Crypto,
+	}
+}
+
 // generateEmailCacheID generates a cache ID from a Message-ID
 func (s *Storage) generateEmailCacheID(messageID string) string {
 	// Clean up Message-ID (remove < > and special characters)
@@ -265,17 +325,35 @@ func (s *Storage) generateDraftID() string {
 
 // Draft represents a saved email draft
 type Draft struct {
-	ID               string    `yaml:"id" json:"id"`
-	CreatedAt        time.Time `yaml:"created_at" json:"created_at"`
-	To               []string  `yaml:"to" json:"to"`
-	CC               []string  `yaml:"cc,omitempty" json:"cc,omitempty"`
-	BCC              []string  `yaml:"bcc,omitempty" json:"bcc,omitempty"`
-	Subject          string    `yaml:"subject" json:"subject"`
-	Body             string    `yaml:"body" json:"body"`
-	HTMLBody         string    `yaml:"html_body,omitempty" json:"html_body,omitempty"`
-	Attachments      []string  `yaml:"attachments,omitempty" json:"attachments,omitempty"`
-	ReplyToMessageID string    `yaml:"reply_to_message_id,omitempty" json:"reply_to_message_id,omitempty"`
-	References       []string  `yaml:"references,omitempty" json:"references,omitempty"`
+	ID                      string                   `yaml:"id" json:"id"`
+	CreatedAt               time.Time                `yaml:"created_at" json:"created_at"`
+	To                      []string                 `yaml:"to" json:"to"`
+	CC                      []string                 `yaml:"cc,omitempty" json:"cc,omitempty"`
+	BCC                     []string                 `yaml:"bcc,omitempty" json:"bcc,omitempty"`
+	Subject                 string                   `yaml:"subject" json:"subject"`
+	Body                    string                   `yaml:"body" json:"body"`
+	HTMLBody                string                   `yaml:"html_body,omitempty" json:"html_body,omitempty"`
+	Attachments             []string                 `yaml:"attachments,omitempty" json:"attachments,omitempty"`
+	InlineAttachments       []email.InlineAttachment `yaml:"inline_attachments,omitempty" json:"inline_attachments,omitempty"`
+	EmbedDataURIs           bool                     `yaml:"embed_data_uris,omitempty" json:"embed_data_uris,omitempty"`
+	ReplyToMessageID        string                   `yaml:"reply_to_message_id,omitempty" json:"reply_to_message_id,omitempty"`
+	References              []string                 `yaml:"references,omitempty" json:"references,omitempty"`
+	FromIdentity            string                   `yaml:"from_identity,omitempty" json:"from_identity,omitempty"`
+	FromName                string                   `yaml:"from_name,omitempty" json:"from_name,omitempty"`
+	ReplyTo                 []string                 `yaml:"reply_to,omitempty" json:"reply_to,omitempty"`
+	Priority                string                   `yaml:"priority,omitempty" json:"priority,omitempty"`
+	ReadReceipt             bool                     `yaml:"read_receipt,omitempty" json:"read_receipt,omitempty"`
+	ListUnsubscribe         []string                 `yaml:"list_unsubscribe,omitempty" json:"list_unsubscribe,omitempty"`
+	ListUnsubscribeOneClick bool                     `yaml:"list_unsubscribe_one_click,omitempty" json:"list_unsubscribe_one_click,omitempty"`
+	Headers                 map[string]string        `yaml:"headers,omitempty" json:"headers,omitempty"`
+	Sign                    bool                     `yaml:"sign,omitempty" json:"sign,omitempty"`
+	Encrypt                 bool                     `yaml:"encrypt,omitempty" json:"encrypt,omitempty"`
+	Crypto                  string                   `yaml:"crypto,omitempty" json:"crypto,omitempty"`
+	BatchID                 string                   `yaml:"batch_id,omitempty" json:"batch_id,omitempty"`
+
+	// Pending confirm_send token (SHA-256 hash) for messages held by the outbound policy
+	ConfirmTokenHash string    `yaml:"confirm_token_hash,omitempty" json:"-"`
+	ConfirmExpiresAt time.Time `yaml:"confirm_expires_at,omitempty" json:"confirm_expires_at,omitempty"`
 }
 
 // DraftSummary represents a draft summary for listing
@@ -284,4 +362,5 @@ type DraftSummary struct {
 	CreatedAt time.Time `json:"created_at"`
 	Subject   string    `json:"subject"`
 	To        []string  `json:"to"`
+	BatchID   string    `json:"batch_id,omitempty"`
 }
\ No newline at end of file
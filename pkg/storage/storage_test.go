@@ -128,6 +128,42 @@ func TestDraftOperations(t *testing.T) {
 	}
 }
 
+func TestDraftHeaderOptions(t *testing.T) {
+	s := NewStorage(t.TempDir(), 10485760)
+
+	opts := email.SendOptions{
+		To:              []string{"recipient@example.com"},
+		Subject:         "Newsletter",
+		Body:            "Hello",
+		FromName:        "Support Team",
+		ReplyTo:         []string{"help@example.com"},
+		Priority:        email.PriorityHigh,
+		ReadReceipt:     true,
+		ListUnsubscribe: []string{"https://example.com/unsub"},
+		Headers:         map[string]string{"X-Campaign-ID": "spring"},
+	}
+
+	draftID, err := s.SaveDraft(opts)
+	if err != nil {
+		t.Fatalf("Failed to save draft: %v", err)
+	}
+	draft, err := s.LoadDraft(draftID)
+	if err != nil {
+		t.Fatalf("Failed to load draft: %v", err)
+	}
+
+	loaded := draft.SendOptions()
+	if loaded.FromName != opts.FromName || loaded.Priority != opts.Priority || !loaded.ReadReceipt {
+		t.Errorf("Header options not preserved: %+v", loaded)
+	}
+	if len(loaded.ReplyTo) != 1 || loaded.ReplyTo[0] != "help@example.com" {
+		t.Errorf("Expected Reply-To to be preserved, got %v", loaded.ReplyTo)
+	}
+	if len(loaded.ListUnsubscribe) != 1 || loaded.Headers["X-Campaign-ID"] != "spring" {
+		t.Errorf("Expected List-Unsubscribe and custom headers to be preserved, got %v %v", loaded.ListUnsubscribe, loaded.Headers)
+	}
+}
+
 func TestGenerateEmailCacheID(t *testing.T) {
 	s := &Storage{}
 
@@ -0,0 +1,283 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+
+	"github.com/prasanthmj/email/pkg/email"
+	"github.com/prasanthmj/email/pkg/securefs"
+	"gopkg.in/yaml.v3"
+)
+
+// templateNamePattern restricts template names to safe file names
+var templateNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,63}$`)
+
+// Template is a reusable message with Go template placeholders such as {{.FirstName}}.
+// Values inserted into HTMLBody are HTML-escaped.
+type Template struct {
+	Name        string    `yaml:"name" json:"name"`
+	Description string    `yaml:"description,omitempty" json:"description,omitempty"`
+	Subject     string    `yaml:"subject" json:"subject"`
+	Body        string    `yaml:"body,omitempty" json:"body,omitempty"`
+	HTMLBody    string    `yaml:"html_body,omitempty" json:"html_body,omitempty"`
+	CreatedAt   time.Time `yaml:"created_at" json:"created_at"`
+	UpdatedAt   time.Time `yaml:"updated_at" json:"updated_at"`
+}
+
+// TemplateSummary represents a template summary for listing
+type TemplateSummary struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Subject     string    `json:"subject"`
+	Variables   []string  `json:"variables"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// templatesDir returns the directory holding the account's templates
+func (s *Storage) templatesDir() string {
+	return filepath.Join(filepath.Dir(s.draftsDir), "templates")
+}
+
+// templatePath returns the file path for a template name
+func (s *Storage) templatePath(name string) (string, error) {
+	if !templateNamePattern.MatchString(name) {
+		return "", fmt.Errorf("invalid template name: %q (use letters, digits, '.', '_' or '-')", name)
+	}
+	return filepath.Join(s.templatesDir(), name+".yaml"), nil
+}
+
+// SaveTemplate validates and stores a template. Existing templates are only replaced when overwrite is set.
+func (s *Storage) SaveTemplate(tmpl Template, overwrite bool) error {
+	filePath, err := s.templatePath(tmpl.Name)
+	if err != nil {
+		return err
+	}
+	if tmpl.Subject == "" {
+		return fmt.Errorf("template subject is required")
+	}
+	if tmpl.Body == "" && tmpl.HTMLBody == "" {
+		return fmt.Errorf("template body or html_body is required")
+	}
+	if _, err := tmpl.parse(); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	tmpl.CreatedAt = now
+	tmpl.UpdatedAt = now
+	if existing, err := s.LoadTemplate(tmpl.Name); err == nil {
+		if !overwrite {
+			return fmt.Errorf("template %s already exists (set overwrite to replace it)", tmpl.Name)
+		}
+		tmpl.CreatedAt = existing.CreatedAt
+	}
+
+	if err := securefs.MkdirAll(s.templatesDir()); err != nil {
+		return fmt.Errorf("failed to create templates directory: %w", err)
+	}
+
+	data, err := yaml.Marshal(tmpl)
+	if err != nil {
+		return fmt.Errorf("failed to marshal template: %w", err)
+	}
+	if err := securefs.WriteFile(filePath, data); err != nil {
+		return fmt.Errorf("failed to write template: %w", err)
+	}
+
+	return nil
+}
+
+// LoadTemplate loads a template by name
+func (s *Storage) LoadTemplate(name string) (*Template, error) {
+	filePath, err := s.templatePath(name)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := securefs.ReadFile(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("template not found: %s", name)
+		}
+		return nil, fmt.Errorf("failed to read template: %w", err)
+	}
+
+	var tmpl Template
+	if err := yaml.Unmarshal(data, &tmpl); err != nil {
+		return nil, fmt.Errorf("failed to parse template: %w", err)
+	}
+
+	return &tmpl, nil
+}
+
+// ListTemplates returns summaries of all stored templates sorted by name
+func (s *Storage) ListTemplates() ([]TemplateSummary, error) {
+	files, err := os.ReadDir(s.templatesDir())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []TemplateSummary{}, nil
+		}
+		return nil, fmt.Errorf("failed to read templates directory: %w", err)
+	}
+
+	templates := []TemplateSummary{}
+	for _, file := range files {
+		if !strings.HasSuffix(file.Name(), ".yaml") {
+			continue
+		}
+		tmpl, err := s.LoadTemplate(strings.TrimSuffix(file.Name(), ".yaml"))
+		if err != nil {
+			continue
+		}
+		variables, _ := tmpl.Variables()
+		templates = append(templates, TemplateSummary{
+			Name:        tmpl.Name,
+			Description: tmpl.Description,
+			Subject:     tmpl.Subject,
+			Variables:   variables,
+			UpdatedAt:   tmpl.UpdatedAt,
+		})
+	}
+
+	sort.Slice(templates, func(i, j int) bool {
+		return templates[i].Name < templates[j].Name
+	})
+	return templates, nil
+}
+
+// parsedTemplate is a compiled part of a template
+type parsedTemplate struct {
+	tree    *parse.Tree
+	execute func(w io.Writer, data interface{}) error
+}
+
+// parse compiles the subject, body and HTML body templates. The HTML body uses
+// html/template so variables are escaped for where they appear in the markup.
+func (t *Template) parse() ([]parsedTemplate, error) {
+	var parsed []parsedTemplate
+	for _, part := range []struct {
+		name string
+		text string
+	}{{"subject", t.Subject}, {"body", t.Body}} {
+		tmpl, err := template.New(part.name).Option("missingkey=error").Parse(part.text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template: %w", err)
+		}
+		parsed = append(parsed, parsedTemplate{tmpl.Tree, tmpl.Execute})
+	}
+
+	html, err := htmltemplate.New("html_body").Option("missingkey=error").Parse(t.HTMLBody)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+	parsed = append(parsed, parsedTemplate{html.Tree, html.Execute})
+	return parsed, nil
+}
+
+// Variables returns the top-level variable names referenced by the template
+func (t *Template) Variables() ([]string, error) {
+	parsed, err := t.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	for _, tmpl := range parsed {
+		if tmpl.tree != nil {
+			collectFields(tmpl.tree.Root, seen)
+		}
+	}
+
+	variables := make([]string, 0, len(seen))
+	for name := range seen {
+		variables = append(variables, name)
+	}
+	sort.Strings(variables)
+	return variables, nil
+}
+
+// collectFields walks a template parse tree and records the first identifier of each {{.Field}}
+func collectFields(node parse.Node, seen map[string]bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			collectFields(child, seen)
+		}
+	case *parse.ActionNode:
+		collectFields(n.Pipe, seen)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			collectFields(cmd, seen)
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			collectFields(arg, seen)
+		}
+	case *parse.FieldNode:
+		if len(n.Ident) > 0 {
+			seen[n.Ident[0]] = true
+		}
+	case *parse.IfNode:
+		collectFields(n.Pipe, seen)
+		collectFields(n.List, seen)
+		collectFields(n.ElseList, seen)
+	case *parse.RangeNode:
+		// Fields inside range refer to the element, so only the ranged pipeline counts
+		collectFields(n.Pipe, seen)
+		collectFields(n.ElseList, seen)
+	case *parse.WithNode:
+		collectFields(n.Pipe, seen)
+		collectFields(n.ElseList, seen)
+	case *parse.TemplateNode:
+		collectFields(n.Pipe, seen)
+	}
+}
+
+// Render executes the template with the given variables and returns the resulting send options.
+// Missing variables are reported as errors rather than rendered as "<no value>".
+func (t *Template) Render(vars map[string]interface{}) (email.SendOptions, error) {
+	parsed, err := t.parse()
+	if err != nil {
+		return email.SendOptions{}, err
+	}
+	if vars == nil {
+		vars = map[string]interface{}{}
+	}
+
+	var out [3]string
+	for i, tmpl := range parsed {
+		var buf bytes.Buffer
+		if err := tmpl.execute(&buf, vars); err != nil {
+			return email.SendOptions{}, fmt.Errorf("failed to render template %s: %w", t.Name, err)
+		}
+		out[i] = buf.String()
+	}
+
+	// Line breaks in the subject would become header injection
+	subject := strings.TrimSpace(out[0])
+	if strings.ContainsAny(subject, "\r\n") {
+		return email.SendOptions{}, fmt.Errorf("rendered subject must be a single line")
+	}
+
+	return email.SendOptions{
+		Subject:  subject,
+		Body:     out[1],
+		HTMLBody: out[2],
+	}, nil
+}
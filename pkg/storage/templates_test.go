@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTemplateOperations(t *testing.T) {
+	s := NewStorage(t.TempDir(), 10485760)
+
+	tmpl := Template{
+		Name:     "welcome",
+		Subject:  "Welcome, {{.FirstName}}!",
+		Body:     "Hi {{.FirstName}},\n{{if .Plan}}You are on the {{.Plan}} plan.{{end}}",
+		HTMLBody: "<p>Hi {{.FirstName | html}}</p>",
+	}
+	if err := s.SaveTemplate(tmpl, false); err != nil {
+		t.Fatalf("Failed to save template: %v", err)
+	}
+
+	// Saving again without overwrite fails
+	if err := s.SaveTemplate(tmpl, false); err == nil {
+		t.Error("Expected error when template exists")
+	}
+	if err := s.SaveTemplate(tmpl, true); err != nil {
+		t.Errorf("Overwrite failed: %v", err)
+	}
+
+	templates, err := s.ListTemplates()
+	if err != nil {
+		t.Fatalf("Failed to list templates: %v", err)
+	}
+	if len(templates) != 1 {
+		t.Fatalf("Expected 1 template, got %d", len(templates))
+	}
+	if want := []string{"FirstName", "Plan"}; !reflect.DeepEqual(templates[0].Variables, want) {
+		t.Errorf("Expected variables %v, got %v", want, templates[0].Variables)
+	}
+
+	loaded, err := s.LoadTemplate("welcome")
+	if err != nil {
+		t.Fatalf("Failed to load template: %v", err)
+	}
+	opts, err := loaded.Render(map[string]interface{}{"FirstName": "<Ann>", "Plan": "Pro"})
+	if err != nil {
+		t.Fatalf("Failed to render template: %v", err)
+	}
+	if opts.Subject != "Welcome, <Ann>!" {
+		t.Errorf("Unexpected subject: %q", opts.Subject)
+	}
+	if !strings.Contains(opts.Body, "You are on the Pro plan.") {
+		t.Errorf("Unexpected body: %q", opts.Body)
+	}
+	if opts.HTMLBody != "<p>Hi &lt;Ann&gt;</p>" {
+		t.Errorf("Unexpected HTML body: %q", opts.HTMLBody)
+	}
+
+	// Missing variables are errors, not "<no value>"
+	if _, err := loaded.Render(map[string]interface{}{"Plan": "Pro"}); err == nil {
+		t.Error("Expected error for missing variable")
+	}
+}
+
+func TestTemplateValidation(t *testing.T) {
+	s := NewStorage(t.TempDir(), 10485760)
+
+	tests := []Template{
+		{Name: "../escape", Subject: "x", Body: "x"},
+		{Name: "no-body", Subject: "x"},
+		{Name: "bad-syntax", Subject: "{{.Name", Body: "x"},
+	}
+	for _, tmpl := range tests {
+		if err := s.SaveTemplate(tmpl, false); err == nil {
+			t.Errorf("Expected error saving template %q", tmpl.Name)
+		}
+	}
+
+	// Rendered subjects must stay on one line
+	tmpl := Template{Name: "subject", Subject: "{{.Subject}}", Body: "x"}
+	if _, err := tmpl.Render(map[string]interface{}{"Subject": "Hi\r\nBcc: x@example.com"}); err == nil {
+		t.Error("Expected error for multi-line subject")
+	}
+}
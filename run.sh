@@ -226,6 +226,31 @@ case "$1" in
         go run ./cmd -tool send_all_drafts -args '{"dry_run":true}'
         ;;
     
+    "audit")
+        # Query the audit log, optionally for one recipient
+        if [ -z "$2" ]; then
+            echo "Showing recent audit log entries..."
+            go run ./cmd -audit -args '{}'
+        else
+            echo "Showing messages sent to $2..."
+            go run ./cmd -audit -args "{\"recipient\":\"$2\"}"
+        fi
+        ;;
+    
+    "encrypt-store")
+        echo "Encrypting files under FILES_ROOT..."
+        go run ./cmd -encrypt-store
+        ;;
+    
+    "discover")
+        if [ -z "$2" ]; then
+            echo "Usage: ./run.sh discover <address>"
+            exit 1
+        fi
+        echo "Looking up mail servers for $2..."
+        go run ./cmd -discover "$2"
+        ;;
+    
     "run")
         echo "Running Email MCP server..."
         go run ./cmd
@@ -266,6 +291,10 @@ case "$1" in
         echo "  send-all-drafts   - Send all drafts with delay"
         echo "  send-all-drafts-dry - Simulate sending all drafts"
         echo ""
+        echo "  audit [addr]   - Show the audit log (or messages sent to an address)"
+        echo "  encrypt-store  - Encrypt existing files under FILES_ROOT"
+        echo "  discover <addr> - Look up the IMAP and SMTP servers of an address"
+        echo ""
         echo "  run            - Run the MCP server"
         echo "  install        - Install Go dependencies"
         echo ""